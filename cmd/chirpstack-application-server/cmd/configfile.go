@@ -170,12 +170,122 @@ id="{{ .ApplicationServer.ID }}"
     # The login label is used in the web-interface login form.
     login_label="{{ .ApplicationServer.UserAuthentication.OpenIDConnect.LoginLabel }}"
 
+    # Groups claim.
+    #
+    # The name of the ID token claim containing the groups or roles of the
+    # user. Nested claims can be selected using a dot-separated path, e.g.
+    # "realm_access.roles". When left blank, group mappings are not applied.
+    groups_claim="{{ .ApplicationServer.UserAuthentication.OpenIDConnect.GroupsClaim }}"
+
+    # Group mappings.
+    #
+    # The group mappings define the organization memberships of the user
+    # based on the groups returned by the OpenID Connect provider. The
+    # mappings are applied on every login. For the organizations referenced
+    # by the mappings, memberships are added, updated and revoked based on
+    # the groups of the user. When multiple groups map to the same
+    # organization, the permissions are combined. Memberships of other
+    # organizations are not changed.
+    #
+    # Example (the [[application_server.user_authentication.openid_connect.group_mapping]]
+    # section can be repeated):
+    # [[application_server.user_authentication.openid_connect.group_mapping]]
+    # # Group or role name.
+    # group="chirpstack-org-admins"
+    #
+    # # Organization ID.
+    # organization_id=1
+    #
+    # # Organization permissions.
+    # is_admin=true
+    # is_device_admin=false
+    # is_gateway_admin=false
+{{ range $index, $element := .ApplicationServer.UserAuthentication.OpenIDConnect.GroupMappings }}
+    [[application_server.user_authentication.openid_connect.group_mapping]]
+    group="{{ $element.Group }}"
+    organization_id={{ $element.OrganizationID }}
+    is_admin={{ $element.IsAdmin }}
+    is_device_admin={{ $element.IsDeviceAdmin }}
+    is_gateway_admin={{ $element.IsGatewayAdmin }}
+{{ end }}
+
+    # Multi-factor authentication.
+    #
+    # Local (password) users can enroll a TOTP authenticator app as second
+    # factor. When enabled for a user, the login returns a short-lived
+    # challenge token which must be exchanged together with a TOTP or
+    # recovery code for the session token.
+    [application_server.user_authentication.mfa]
+
+    # Issuer.
+    #
+    # The issuer name as displayed by the authenticator app.
+    issuer="{{ .ApplicationServer.UserAuthentication.MFA.Issuer }}"
+
+    # Require MFA for admins.
+    #
+    # When set, global admin users and organization admin users must enroll
+    # a second factor before they are able to login. Organizations can also
+    # enable this requirement for their own admin users.
+    require_for_admins={{ .ApplicationServer.UserAuthentication.MFA.RequireForAdmins }}
+
+    # Challenge TTL.
+    #
+    # The time the user has to present the second factor after a successful
+    # password login.
+    challenge_ttl="{{ .ApplicationServer.UserAuthentication.MFA.ChallengeTTL }}"
+
 
   # JavaScript codec settings.
   [application_server.codec.js]
   # Maximum execution time.
   max_execution_time="{{ .ApplicationServer.Codec.JS.MaxExecutionTime }}"
 
+  # Pool size.
+  #
+  # The number of JavaScript VMs that can execute codec functions
+  # concurrently. VMs are re-used between executions of the same
+  # codec script.
+  pool_size={{ .ApplicationServer.Codec.JS.PoolSize }}
+
+  # Script cache size.
+  #
+  # The maximum number of compiled codec scripts that are cached.
+  # Scripts are cached by the hash of their source.
+  script_cache_size={{ .ApplicationServer.Codec.JS.ScriptCacheSize }}
+
+
+  # Uplink deduplication settings.
+  #
+  # Uplinks received from the network-server are deduplicated by DevEUI,
+  # DevAddr and frame-counter, so that a retry of the network-server does not
+  # result in the payload being decoded and forwarded to the integrations
+  # twice.
+  [application_server.uplink_deduplication]
+  # TTL.
+  #
+  # The duration for which a handled uplink is remembered. Set this to 0
+  # to disable the deduplication.
+  ttl="{{ .ApplicationServer.UplinkDeduplication.TTL }}"
+
+
+  # Device event-log settings.
+  #
+  # The device events (uplink, join, ack, error, status, location, ...) are
+  # stored per device in a Redis stream, so that they can be retrieved after
+  # they have occurred.
+  [application_server.device_event_log]
+  # Max length.
+  #
+  # The (approximate) maximum number of events that are stored per device.
+  max_length={{ .ApplicationServer.DeviceEventLog.MaxLength }}
+
+  # TTL.
+  #
+  # The time after which the event history of a device expires when no new
+  # events are logged for the device.
+  ttl="{{ .ApplicationServer.DeviceEventLog.TTL }}"
+
 
   # Integration configures the data integration.
   #
@@ -208,6 +318,39 @@ id="{{ .ApplicationServer.ID }}"
   enabled=[{{ if .ApplicationServer.Integration.Enabled|len }}"{{ end }}{{ range $index, $elm := .ApplicationServer.Integration.Enabled }}{{ if $index }}", "{{ end }}{{ $elm }}{{ end }}{{ if .ApplicationServer.Integration.Enabled|len }}"{{ end }}]
 
 
+  # Integration retry settings.
+  #
+  # When an integration fails to handle an event (e.g. a failed HTTP POST
+  # or Kafka publish), the event is retried in the background using an
+  # exponential backoff. When all attempts have failed, the event is stored
+  # in the dead-letter table, from which it can be replayed using the API.
+  # On shutdown, the events pending a retry are retried a last time before
+  # they are stored in the dead-letter table.
+  [application_server.integration.retry]
+  # Max. number of attempts (including the first attempt).
+  max_attempts={{ .ApplicationServer.Integration.Retry.MaxAttempts }}
+
+  # Interval before the first retry.
+  #
+  # This interval is doubled after each retry.
+  initial_interval="{{ .ApplicationServer.Integration.Retry.InitialInterval }}"
+
+  # Max. interval between two retries.
+  max_interval="{{ .ApplicationServer.Integration.Retry.MaxInterval }}"
+
+  # Max. pending retries.
+  #
+  # The max. number of events per integration that can be pending a retry.
+  # When reached, failed events are directly stored in the dead-letter table.
+  max_pending={{ .ApplicationServer.Integration.Retry.MaxPending }}
+
+  # Dead-letter retention.
+  #
+  # The duration for which dead-lettered events are kept. Set this to 0
+  # to keep the dead-lettered events until these are deleted using the API.
+  dead_letter_retention="{{ .ApplicationServer.Integration.Retry.DeadLetterRetention }}"
+
+
   # MQTT integration backend.
   [application_server.integration.mqtt]
   # Event topic template.
@@ -216,6 +359,11 @@ id="{{ .ApplicationServer.ID }}"
   # Command topic template.
   command_topic_template="{{ .ApplicationServer.Integration.MQTT.CommandTopicTemplate }}"
 
+  # Gateway event topic template.
+  #
+  # This topic is used for the gateway status (online / offline) events.
+  gateway_event_topic_template="{{ .ApplicationServer.Integration.MQTT.GatewayEventTopicTemplate }}"
+
   # Retain events.
   #
   # The MQTT broker will store the last publised message, when retain events is set
@@ -288,6 +436,35 @@ id="{{ .ApplicationServer.ID }}"
   # events.
   event_routing_key_template="{{ .ApplicationServer.Integration.AMQP.EventRoutingKeyTemplate }}"
 
+  # Command routing key template.
+  #
+  # This is the command routing-key template used for binding the command
+  # queue to the amq.topic exchange. The ApplicationID and DevEUI are
+  # retrieved from the routing-key of the received command. The payload must
+  # contain the JSON encoded downlink command, e.g.:
+  # {"confirmed": false, "fPort": 10, "data": "AQID"}
+  command_routing_key_template="{{ .ApplicationServer.Integration.AMQP.CommandRoutingKeyTemplate }}"
+
+  # Command queue name.
+  #
+  # When set, ChirpStack Application Server will declare this (durable) queue
+  # and consume the downlink commands from it. A command is acknowledged after
+  # it has been enqueued for the device. Leave this blank to disable consuming
+  # downlink commands.
+  command_queue_name="{{ .ApplicationServer.Integration.AMQP.CommandQueueName }}"
+
+  # Dead-letter exchange name.
+  #
+  # Commands that can not be decoded or enqueued are rejected to this
+  # (fanout) exchange.
+  dead_letter_exchange_name="{{ .ApplicationServer.Integration.AMQP.DeadLetterExchangeName }}"
+
+  # Dead-letter queue name.
+  #
+  # When set, this (durable) queue is declared and bound to the dead-letter
+  # exchange, so that rejected commands can be inspected.
+  dead_letter_queue_name="{{ .ApplicationServer.Integration.AMQP.DeadLetterQueueName }}"
+
 
   # AWS Simple Notification Service (SNS)
   [application_server.integration.aws_sns]
@@ -357,6 +534,25 @@ id="{{ .ApplicationServer.ID }}"
   # message. There is no need to parse it from the key.
   event_key_template="{{ .ApplicationServer.Integration.Kafka.EventKeyTemplate }}"
 
+  # Topic for downlink commands.
+  #
+  # When set, ChirpStack Application Server will consume downlink commands
+  # from this topic. The payload must contain the JSON encoded downlink
+  # command, including the applicationID and devEUI fields, e.g.:
+  # {"applicationID": "1", "devEUI": "0102030405060708", "confirmed": false, "fPort": 10, "data": "AQID"}
+  # The offset of a command is committed after the downlink has been enqueued.
+  # When the downlink can not be enqueued, the command is retried.
+  # Leave this blank to disable consuming downlink commands.
+  command_topic="{{ .ApplicationServer.Integration.Kafka.CommandTopic }}"
+
+  # Consumer group ID.
+  #
+  # The consumer group is used to commit the offsets of the consumed downlink
+  # commands. When running multiple ChirpStack Application Server instances,
+  # these must share the same consumer group ID, so that each command is
+  # handled only once.
+  consumer_group_id="{{ .ApplicationServer.Integration.Kafka.ConsumerGroupID }}"
+
 
   # PostgreSQL database integration.
   [application_server.integration.postgresql]
@@ -449,6 +645,42 @@ id="{{ .ApplicationServer.ID }}"
   # Synchronization batch-size.
   sync_batch_size={{ .ApplicationServer.FragmentationSession.SyncBatchSize }}
 
+
+  # Gateway status settings.
+  #
+  # A gateway is considered offline when it did not send its statistics within
+  # the offline threshold. On every offline and online transition, a gateway
+  # status event is sent to the integrations and the transition is stored.
+  [application_server.gateway_status]
+  # Check interval.
+  check_interval="{{ .ApplicationServer.GatewayStatus.CheckInterval }}"
+
+  # Check batch-size.
+  check_batch_size={{ .ApplicationServer.GatewayStatus.CheckBatchSize }}
+
+  # Default offline threshold.
+  #
+  # This threshold is used when no threshold is configured for the gateway or
+  # its gateway-profile. When set to 0s, only gateways with a gateway or
+  # gateway-profile threshold are monitored.
+  offline_threshold="{{ .ApplicationServer.GatewayStatus.OfflineThreshold }}"
+
+
+  # Device alert settings.
+  #
+  # The device alert-rules of each application are evaluated on every check.
+  # An alert event is sent to the integrations when a rule starts firing for
+  # a device and when it is resolved.
+  [application_server.device_alert]
+  # Check interval.
+  check_interval="{{ .ApplicationServer.DeviceAlert.CheckInterval }}"
+
+  # Check batch-size.
+  #
+  # The number of rules, and of devices per rule, that are read from the
+  # database at once. Batches are read until all alerts have been checked.
+  check_batch_size={{ .ApplicationServer.DeviceAlert.CheckBatchSize }}
+
 {{ if ne .ApplicationServer.Branding.Footer  "" }}
   # Branding configuration.
   [application_server.branding]
@@ -11,6 +11,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
+	"github.com/brocaar/chirpstack-application-server/internal/alert"
 	"github.com/brocaar/chirpstack-application-server/internal/api"
 	"github.com/brocaar/chirpstack-application-server/internal/applayer/fragmentation"
 	"github.com/brocaar/chirpstack-application-server/internal/applayer/multicastsetup"
@@ -18,8 +19,10 @@ import (
 	jscodec "github.com/brocaar/chirpstack-application-server/internal/codec/js"
 	"github.com/brocaar/chirpstack-application-server/internal/config"
 	"github.com/brocaar/chirpstack-application-server/internal/downlink"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
 	"github.com/brocaar/chirpstack-application-server/internal/fuota"
 	"github.com/brocaar/chirpstack-application-server/internal/gwping"
+	"github.com/brocaar/chirpstack-application-server/internal/gwstatus"
 	"github.com/brocaar/chirpstack-application-server/internal/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/migrations/code"
 	"github.com/brocaar/chirpstack-application-server/internal/monitoring"
@@ -41,8 +44,11 @@ func run(cmd *cobra.Command, args []string) error {
 		migrateToClusterKeys,
 		setupIntegration,
 		setupCodec,
+		setupEventLog,
 		handleDataDownPayloads,
 		startGatewayPing,
+		setupGatewayStatus,
+		setupDeviceAlert,
 		setupMulticastSetup,
 		setupFragmentation,
 		setupFUOTA,
@@ -111,6 +117,14 @@ func setupCodec() error {
 	return nil
 }
 
+func setupEventLog() error {
+	if err := eventlog.Setup(config.C); err != nil {
+		return errors.Wrap(err, "setup eventlog error")
+	}
+
+	return nil
+}
+
 func setupNetworkServer() error {
 	if err := networkserver.Setup(config.C); err != nil {
 		return errors.Wrap(err, "setup networkserver error")
@@ -151,6 +165,20 @@ func startGatewayPing() error {
 	return nil
 }
 
+func setupGatewayStatus() error {
+	if err := gwstatus.Setup(config.C); err != nil {
+		return errors.Wrap(err, "gwstatus setup error")
+	}
+	return nil
+}
+
+func setupDeviceAlert() error {
+	if err := alert.Setup(config.C); err != nil {
+		return errors.Wrap(err, "alert setup error")
+	}
+	return nil
+}
+
 func setupMulticastSetup() error {
 	if err := multicastsetup.Setup(config.C); err != nil {
 		return errors.Wrap(err, "multicastsetup setup error")
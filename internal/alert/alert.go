@@ -0,0 +1,207 @@
+// Package alert implements the evaluation of the device alert-rules.
+package alert
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/config"
+	"github.com/brocaar/chirpstack-application-server/internal/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+var (
+	checkInterval  = time.Minute
+	checkBatchSize = 100
+)
+
+var alertTypes = map[storage.AlertType]pb.AlertType{
+	storage.AlertTypeInactivity:   pb.AlertType_INACTIVITY,
+	storage.AlertTypeBatteryLevel: pb.AlertType_BATTERY_LEVEL,
+	storage.AlertTypeMargin:       pb.AlertType_MARGIN,
+}
+
+// Setup configures the package and starts the device alert check loop.
+func Setup(conf config.Config) error {
+	checkInterval = conf.ApplicationServer.DeviceAlert.CheckInterval
+	checkBatchSize = conf.ApplicationServer.DeviceAlert.CheckBatchSize
+
+	go checkLoop()
+
+	return nil
+}
+
+func checkLoop() {
+	for {
+		ctxID, err := uuid.NewV4()
+		if err != nil {
+			log.WithError(err).Error("new uuid error")
+		}
+
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, logging.ContextIDKey, ctxID)
+
+		if err := CheckDeviceAlerts(ctx, time.Now()); err != nil {
+			log.WithError(err).Error("alert: check device alerts error")
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// CheckDeviceAlerts evaluates all the device alert-rules at the given time.
+// For every device for which a rule starts firing, an alert is opened and a
+// firing alert event is sent. For every device with an open alert for which
+// the rule no longer fires, the alert is closed and a resolved alert event is
+// sent. As an alert is opened only once, no duplicate events are sent.
+func CheckDeviceAlerts(ctx context.Context, now time.Time) error {
+	for offset := 0; ; offset += checkBatchSize {
+		rules, err := storage.GetDeviceAlertRules(ctx, storage.DB(), 0, checkBatchSize, offset)
+		if err != nil {
+			return errors.Wrap(err, "get device alert-rules error")
+		}
+
+		for _, rule := range rules {
+			if err := checkDeviceAlertRule(ctx, rule, now); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"device_alert_rule_id": rule.ID,
+					"ctx_id":               ctx.Value(logging.ContextIDKey),
+				}).Error("alert: check device alert-rule error")
+			}
+		}
+
+		if len(rules) < checkBatchSize {
+			return nil
+		}
+	}
+}
+
+func checkDeviceAlertRule(ctx context.Context, rule storage.DeviceAlertRule, now time.Time) error {
+	var app *storage.Application
+
+	// Opened and resolved alerts no longer match the queries below, so the
+	// next batch is read without offset until a batch is not full.
+	for {
+		firing, err := storage.GetDevicesForDeviceAlert(ctx, storage.DB(), rule, now, checkBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "get devices for device alert error")
+		}
+
+		resolved, err := storage.GetDevicesForDeviceAlertResolve(ctx, storage.DB(), rule, now, checkBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "get devices for device alert resolve error")
+		}
+
+		if len(firing) == 0 && len(resolved) == 0 {
+			return nil
+		}
+
+		if app == nil {
+			a, err := storage.GetApplication(ctx, storage.DB(), rule.ApplicationID)
+			if err != nil {
+				return errors.Wrap(err, "get application error")
+			}
+			app = &a
+		}
+
+		for _, d := range firing {
+			// The alert could have been opened by an other instance in the
+			// meantime, in which case this instance must not send the event.
+			err := storage.CreateDeviceAlert(ctx, storage.DB(), rule.ID, d.DevEUI)
+			if errors.Cause(err) == storage.ErrAlreadyExists {
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "create device alert error")
+			}
+
+			sendAlertEvent(ctx, *app, rule, d, pb.AlertState_FIRING)
+		}
+
+		for _, d := range resolved {
+			err := storage.DeleteDeviceAlert(ctx, storage.DB(), rule.ID, d.DevEUI)
+			if errors.Cause(err) == storage.ErrDoesNotExist {
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "delete device alert error")
+			}
+
+			sendAlertEvent(ctx, *app, rule, d, pb.AlertState_RESOLVED)
+		}
+
+		if len(firing) < checkBatchSize && len(resolved) < checkBatchSize {
+			return nil
+		}
+	}
+}
+
+// sendAlertEvent sends the alert event to the integrations. As the alert
+// has already been opened or closed at this point, errors are logged but not
+// returned.
+func sendAlertEvent(ctx context.Context, app storage.Application, rule storage.DeviceAlertRule, d storage.Device, state pb.AlertState) {
+	err := func() error {
+		pl := pb.AlertEvent{
+			ApplicationId:   uint64(app.ID),
+			ApplicationName: app.Name,
+			DeviceName:      d.Name,
+			DevEui:          d.DevEUI[:],
+			AlertRuleId:     rule.ID.String(),
+			AlertRuleName:   rule.Name,
+			Type:            alertTypes[rule.Type],
+			State:           state,
+			Tags:            make(map[string]string),
+		}
+
+		if d.LastSeenAt != nil {
+			var err error
+			pl.LastSeenAt, err = ptypes.TimestampProto(*d.LastSeenAt)
+			if err != nil {
+				return errors.Wrap(err, "timestamp proto error")
+			}
+		}
+
+		if d.DeviceStatusBattery != nil {
+			pl.BatteryLevel = *d.DeviceStatusBattery
+		}
+
+		if d.DeviceStatusMargin != nil {
+			pl.Margin = int32(*d.DeviceStatusMargin)
+		}
+
+		for k, v := range d.Tags.Map {
+			if v.Valid {
+				pl.Tags[k] = v.String
+			}
+		}
+
+		vars := make(map[string]string)
+		for k, v := range d.Variables.Map {
+			if v.Valid {
+				vars[k] = v.String
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"device_alert_rule_id": rule.ID,
+			"dev_eui":              d.DevEUI,
+			"state":                state,
+			"ctx_id":               ctx.Value(logging.ContextIDKey),
+		}).Info("alert: device alert state changed")
+
+		return integration.ForApplicationID(app.ID).HandleAlertEvent(ctx, vars, pl)
+	}()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"device_alert_rule_id": rule.ID,
+			"dev_eui":              d.DevEUI,
+			"ctx_id":               ctx.Value(logging.ContextIDKey),
+		}).Error("alert: send alert event error")
+	}
+}
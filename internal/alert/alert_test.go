@@ -0,0 +1,161 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	nsmock "github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/test"
+	"github.com/brocaar/lorawan"
+)
+
+func TestCheckDeviceAlerts(t *testing.T) {
+	assert := require.New(t)
+
+	conf := test.GetConfig()
+	assert.NoError(storage.Setup(conf))
+	test.MustResetDB(storage.DB().DB)
+
+	networkserver.SetPool(nsmock.NewPool(nsmock.NewClient()))
+
+	h := mock.New()
+	integration.SetMockIntegration(h)
+	defer integration.SetMockIntegration(nil)
+
+	n := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	sp := storage.ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	dp := storage.DeviceProfile{
+		Name:            "test-dp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
+	dpID, err := uuid.FromBytes(dp.DeviceProfile.Id)
+	assert.NoError(err)
+
+	app := storage.Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	battery := float32(10)
+	d := storage.Device{
+		DevEUI:              lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		ApplicationID:       app.ID,
+		DeviceProfileID:     dpID,
+		Name:                "test-device",
+		DeviceStatusBattery: &battery,
+	}
+	assert.NoError(storage.CreateDevice(context.Background(), storage.DB(), &d))
+
+	rule := storage.DeviceAlertRule{
+		ApplicationID:         app.ID,
+		Name:                  "low-battery",
+		Type:                  storage.AlertTypeBatteryLevel,
+		BatteryLevelThreshold: 20,
+	}
+	assert.NoError(storage.CreateDeviceAlertRule(context.Background(), storage.DB(), &rule))
+
+	t.Run("Firing", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(CheckDeviceAlerts(context.Background(), time.Now()))
+
+		pl := <-h.SendAlertNotificationChan
+		assert.Equal(pb.AlertEvent{
+			ApplicationId:   uint64(app.ID),
+			ApplicationName: "test-app",
+			DeviceName:      "test-device",
+			DevEui:          d.DevEUI[:],
+			AlertRuleId:     rule.ID.String(),
+			AlertRuleName:   "low-battery",
+			Type:            pb.AlertType_BATTERY_LEVEL,
+			State:           pb.AlertState_FIRING,
+			BatteryLevel:    10,
+			Tags:            make(map[string]string),
+		}, pl)
+
+		t.Run("Deduplicated", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(CheckDeviceAlerts(context.Background(), time.Now()))
+			assert.Len(h.SendAlertNotificationChan, 0)
+		})
+
+		t.Run("Resolved", func(t *testing.T) {
+			assert := require.New(t)
+
+			battery := float32(80)
+			d.DeviceStatusBattery = &battery
+			assert.NoError(storage.UpdateDevice(context.Background(), storage.DB(), &d, true))
+
+			assert.NoError(CheckDeviceAlerts(context.Background(), time.Now()))
+
+			pl := <-h.SendAlertNotificationChan
+			assert.Equal(pb.AlertState_RESOLVED, pl.State)
+			assert.EqualValues(80, pl.BatteryLevel)
+
+			assert.NoError(CheckDeviceAlerts(context.Background(), time.Now()))
+			assert.Len(h.SendAlertNotificationChan, 0)
+		})
+	})
+
+	t.Run("More devices than batch size", func(t *testing.T) {
+		assert := require.New(t)
+
+		defer func(size int) {
+			checkBatchSize = size
+		}(checkBatchSize)
+		checkBatchSize = 2
+
+		for i := 0; i < 5; i++ {
+			battery := float32(10)
+			d := storage.Device{
+				DevEUI:              lorawan.EUI64{2, 2, 3, 4, 5, 6, 7, byte(i)},
+				ApplicationID:       app.ID,
+				DeviceProfileID:     dpID,
+				Name:                fmt.Sprintf("test-device-%d", i),
+				DeviceStatusBattery: &battery,
+			}
+			assert.NoError(storage.CreateDevice(context.Background(), storage.DB(), &d))
+		}
+
+		assert.NoError(CheckDeviceAlerts(context.Background(), time.Now()))
+		assert.Len(h.SendAlertNotificationChan, 5)
+
+		for i := 0; i < 5; i++ {
+			pl := <-h.SendAlertNotificationChan
+			assert.Equal(pb.AlertState_FIRING, pl.State)
+		}
+	})
+}
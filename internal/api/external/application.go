@@ -2,9 +2,11 @@ package external
 
 import (
 	"encoding/json"
+	"strconv"
 	"strings"
 
 	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
 	log "github.com/sirupsen/logrus"
 
@@ -18,11 +20,14 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
 	"github.com/brocaar/chirpstack-application-server/internal/codec"
 	"github.com/brocaar/chirpstack-application-server/internal/config"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
 	"github.com/brocaar/chirpstack-application-server/internal/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/http"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/influxdb"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/loracloud"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/mydevices"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/retry"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/thingsboard"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
@@ -75,7 +80,14 @@ func (a *ApplicationAPI) Create(ctx context.Context, req *pb.CreateApplicationRe
 		PayloadDecoderScript: req.Application.PayloadDecoderScript,
 	}
 
-	if err := storage.CreateApplication(ctx, storage.DB(), &app); err != nil {
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.CreateApplication(ctx, tx, &app); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogCreate, auditResourceApplication, strconv.FormatInt(app.ID, 10), nil, app)
+	})
+	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
@@ -144,6 +156,7 @@ func (a *ApplicationAPI) Update(ctx context.Context, req *pb.UpdateApplicationRe
 	}
 
 	// update the fields
+	before := app
 	app.Name = req.Application.Name
 	app.Description = req.Application.Description
 	app.ServiceProfileID = spID
@@ -151,7 +164,13 @@ func (a *ApplicationAPI) Update(ctx context.Context, req *pb.UpdateApplicationRe
 	app.PayloadEncoderScript = req.Application.PayloadEncoderScript
 	app.PayloadDecoderScript = req.Application.PayloadDecoderScript
 
-	err = storage.UpdateApplication(ctx, storage.DB(), app)
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.UpdateApplication(ctx, tx, app); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogUpdate, auditResourceApplication, strconv.FormatInt(app.ID, 10), before, app)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -167,11 +186,21 @@ func (a *ApplicationAPI) Delete(ctx context.Context, req *pb.DeleteApplicationRe
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err := storage.Transaction(func(tx sqlx.Ext) error {
+	app, err := storage.GetApplication(ctx, storage.DB(), req.Id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
 		err := storage.DeleteApplication(ctx, tx, req.Id)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
 		}
+
+		if err := auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogDelete, auditResourceApplication, strconv.FormatInt(app.ID, 10), app, nil); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -1522,3 +1551,217 @@ func (a *ApplicationAPI) ListIntegrations(ctx context.Context, in *pb.ListIntegr
 
 	return &out, nil
 }
+
+// ListIntegrationDeadLetters lists the events which could not be delivered
+// to an integration of the given application, most recent first.
+func (a *ApplicationAPI) ListIntegrationDeadLetters(ctx context.Context, req *pb.ListIntegrationDeadLettersRequest) (*pb.ListIntegrationDeadLettersResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateApplicationAccess(req.ApplicationId, auth.Update),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	count, err := storage.GetIntegrationDeadLetterCount(ctx, storage.DB(), req.ApplicationId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	items, err := storage.GetIntegrationDeadLetters(ctx, storage.DB(), req.ApplicationId, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListIntegrationDeadLettersResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, item := range items {
+		dl := pb.IntegrationDeadLetter{
+			Id:          item.ID.String(),
+			DevEui:      item.DevEUI.String(),
+			Integration: item.Integration,
+			EventType:   item.EventType,
+			Attempts:    uint32(item.Attempts),
+			LastError:   item.LastError,
+		}
+
+		dl.CreatedAt, err = ptypes.TimestampProto(item.CreatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+		dl.UpdatedAt, err = ptypes.TimestampProto(item.UpdatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		msg, err := retry.UnmarshalEvent(item.EventType, item.Event)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+		b, err := marshaler.Marshal(marshaler.ProtobufJSON, msg)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "marshal json error: %s", err)
+		}
+		dl.EventJson = string(b)
+
+		resp.Result = append(resp.Result, &dl)
+	}
+
+	return &resp, nil
+}
+
+// ReplayIntegrationDeadLetter sends the given dead-lettered event again to
+// the integration for which the delivery failed. On success, the event is
+// removed from the dead-letters.
+func (a *ApplicationAPI) ReplayIntegrationDeadLetter(ctx context.Context, req *pb.ReplayIntegrationDeadLetterRequest) (*empty.Empty, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateApplicationAccess(req.ApplicationId, auth.Update),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	id, err := uuid.FromString(req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	dl, err := storage.GetIntegrationDeadLetter(ctx, storage.DB(), id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if dl.ApplicationID != req.ApplicationId {
+		return nil, grpc.Errorf(codes.NotFound, "object does not exist")
+	}
+
+	if err := integration.ReplayDeadLetter(ctx, dl); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// PurgeIntegrationDeadLetters deletes all the dead-lettered events of the
+// given application.
+func (a *ApplicationAPI) PurgeIntegrationDeadLetters(ctx context.Context, req *pb.PurgeIntegrationDeadLettersRequest) (*pb.PurgeIntegrationDeadLettersResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateApplicationAccess(req.ApplicationId, auth.Update),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	count, err := storage.DeleteIntegrationDeadLettersForApplicationID(ctx, storage.DB(), req.ApplicationId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.PurgeIntegrationDeadLettersResponse{
+		Count: uint32(count),
+	}, nil
+}
+
+// GetIntegrationFilter returns the event filter of the given application
+// integration.
+func (a *ApplicationAPI) GetIntegrationFilter(ctx context.Context, req *pb.GetIntegrationFilterRequest) (*pb.GetIntegrationFilterResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateApplicationAccess(req.ApplicationId, auth.Read),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	intgr, err := storage.GetIntegrationByApplicationID(ctx, storage.DB(), req.ApplicationId, req.Kind.String())
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.GetIntegrationFilterResponse{
+		Filter: integrationFilterToPB(intgr.Filter),
+	}, nil
+}
+
+// UpdateIntegrationFilter updates the event filter of the given application
+// integration. An empty filter removes the filter.
+func (a *ApplicationAPI) UpdateIntegrationFilter(ctx context.Context, req *pb.UpdateIntegrationFilterRequest) (*empty.Empty, error) {
+	if req.Filter == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "filter must not be nil")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateApplicationAccess(req.ApplicationId, auth.Update),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	filter, err := integrationFilterFromPB(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	intgr, err := storage.GetIntegrationByApplicationID(ctx, storage.DB(), req.ApplicationId, req.Kind.String())
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	intgr.Filter = filter
+
+	if err := storage.UpdateIntegration(ctx, storage.DB(), &intgr); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// integrationFilterToPB returns the given integration filter as protobuf
+// message.
+func integrationFilterToPB(f storage.IntegrationFilter) *pb.IntegrationFilter {
+	out := pb.IntegrationFilter{
+		EventTypes: f.EventTypes,
+		DeviceTags: f.DeviceTags,
+		FPortMin:   uint32(f.FPortMin),
+		FPortMax:   uint32(f.FPortMax),
+	}
+
+	if f.DeviceProfileID != nil {
+		out.DeviceProfileId = f.DeviceProfileID.String()
+	}
+
+	return &out
+}
+
+// integrationFilterFromPB validates and returns the given protobuf message
+// as integration filter.
+func integrationFilterFromPB(f *pb.IntegrationFilter) (storage.IntegrationFilter, error) {
+	for _, t := range f.EventTypes {
+		switch t {
+		case eventlog.Uplink, eventlog.Join, eventlog.ACK, eventlog.Error, eventlog.Status, eventlog.Location, eventlog.TxAck, eventlog.Integration, eventlog.Management, eventlog.Alert:
+		default:
+			return storage.IntegrationFilter{}, grpc.Errorf(codes.InvalidArgument, "invalid event type: %s", t)
+		}
+	}
+
+	// a zero fPort means that the bound is not set
+	if f.FPortMin > 255 || f.FPortMax > 255 {
+		return storage.IntegrationFilter{}, grpc.Errorf(codes.InvalidArgument, "fPort must be between 1 and 255")
+	}
+
+	if f.FPortMin != 0 && f.FPortMax != 0 && f.FPortMin > f.FPortMax {
+		return storage.IntegrationFilter{}, grpc.Errorf(codes.InvalidArgument, "fPort min must not be greater than fPort max")
+	}
+
+	out := storage.IntegrationFilter{
+		EventTypes: f.EventTypes,
+		DeviceTags: f.DeviceTags,
+		FPortMin:   uint8(f.FPortMin),
+		FPortMax:   uint8(f.FPortMax),
+	}
+
+	if f.DeviceProfileId != "" {
+		dpID, err := uuid.FromString(f.DeviceProfileId)
+		if err != nil {
+			return storage.IntegrationFilter{}, grpc.Errorf(codes.InvalidArgument, "device_profile_id: %s", err)
+		}
+		out.DeviceProfileID = &dpID
+	}
+
+	return out, nil
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 
@@ -11,9 +12,11 @@ import (
 	"google.golang.org/grpc/codes"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-api/go/v3/as/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
 )
 
 func (ts *APITestSuite) TestApplication() {
@@ -268,6 +271,79 @@ func (ts *APITestSuite) TestApplication() {
 					}, resp.Result[0])
 				})
 
+				t.Run("Filter", func(t *testing.T) {
+					assert := require.New(t)
+
+					resp, err := api.GetIntegrationFilter(context.Background(), &pb.GetIntegrationFilterRequest{
+						ApplicationId: createResp.Id,
+						Kind:          pb.IntegrationKind_HTTP,
+					})
+					assert.NoError(err)
+					assert.Equal(&pb.IntegrationFilter{}, resp.Filter)
+
+					t.Run("Invalid event type", func(t *testing.T) {
+						assert := require.New(t)
+
+						_, err := api.UpdateIntegrationFilter(context.Background(), &pb.UpdateIntegrationFilterRequest{
+							ApplicationId: createResp.Id,
+							Kind:          pb.IntegrationKind_HTTP,
+							Filter: &pb.IntegrationFilter{
+								EventTypes: []string{"foo"},
+							},
+						})
+						assert.Equal(codes.InvalidArgument, grpc.Code(err))
+					})
+
+					t.Run("Invalid fPort range", func(t *testing.T) {
+						assert := require.New(t)
+
+						_, err := api.UpdateIntegrationFilter(context.Background(), &pb.UpdateIntegrationFilterRequest{
+							ApplicationId: createResp.Id,
+							Kind:          pb.IntegrationKind_HTTP,
+							Filter: &pb.IntegrationFilter{
+								FPortMin: 20,
+								FPortMax: 10,
+							},
+						})
+						assert.Equal(codes.InvalidArgument, grpc.Code(err))
+
+						_, err = api.UpdateIntegrationFilter(context.Background(), &pb.UpdateIntegrationFilterRequest{
+							ApplicationId: createResp.Id,
+							Kind:          pb.IntegrationKind_HTTP,
+							Filter: &pb.IntegrationFilter{
+								FPortMax: 256,
+							},
+						})
+						assert.Equal(codes.InvalidArgument, grpc.Code(err))
+					})
+
+					t.Run("Update", func(t *testing.T) {
+						assert := require.New(t)
+
+						filter := pb.IntegrationFilter{
+							EventTypes:      []string{"up"},
+							DeviceTags:      map[string]string{"type": "meter"},
+							DeviceProfileId: "f8e4e0a5-3e2b-4b6a-9c0a-6b6b6b6b6b6b",
+							FPortMin:        1,
+							FPortMax:        10,
+						}
+
+						_, err := api.UpdateIntegrationFilter(context.Background(), &pb.UpdateIntegrationFilterRequest{
+							ApplicationId: createResp.Id,
+							Kind:          pb.IntegrationKind_HTTP,
+							Filter:        &filter,
+						})
+						assert.NoError(err)
+
+						resp, err := api.GetIntegrationFilter(context.Background(), &pb.GetIntegrationFilterRequest{
+							ApplicationId: createResp.Id,
+							Kind:          pb.IntegrationKind_HTTP,
+						})
+						assert.NoError(err)
+						assert.Equal(&filter, resp.Filter)
+					})
+				})
+
 				t.Run("Update", func(t *testing.T) {
 					assert := require.New(t)
 
@@ -841,6 +917,84 @@ func (ts *APITestSuite) TestApplication() {
 			})
 		})
 
+		t.Run("IntegrationDeadLetters", func(t *testing.T) {
+			assert := require.New(t)
+
+			b, err := proto.Marshal(&integration.UplinkEvent{
+				ApplicationId: uint64(createResp.Id),
+				DevEui:        []byte{1, 2, 3, 4, 5, 6, 7, 8},
+				FPort:         10,
+			})
+			assert.NoError(err)
+
+			dl := storage.IntegrationDeadLetter{
+				ApplicationID: createResp.Id,
+				DevEUI:        lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+				Integration:   "HTTP",
+				EventType:     "up",
+				Event:         b,
+				Attempts:      3,
+				LastError:     "connection refused",
+			}
+			assert.NoError(storage.CreateIntegrationDeadLetter(context.Background(), storage.DB(), &dl))
+
+			t.Run("List", func(t *testing.T) {
+				assert := require.New(t)
+
+				resp, err := api.ListIntegrationDeadLetters(context.Background(), &pb.ListIntegrationDeadLettersRequest{
+					ApplicationId: createResp.Id,
+					Limit:         10,
+				})
+				assert.NoError(err)
+				assert.EqualValues(1, resp.TotalCount)
+				assert.Len(resp.Result, 1)
+				assert.Equal(dl.ID.String(), resp.Result[0].Id)
+				assert.Equal("0102030405060708", resp.Result[0].DevEui)
+				assert.Equal("HTTP", resp.Result[0].Integration)
+				assert.Equal("up", resp.Result[0].EventType)
+				assert.EqualValues(3, resp.Result[0].Attempts)
+				assert.Equal("connection refused", resp.Result[0].LastError)
+				assert.Contains(resp.Result[0].EventJson, `"fPort":10`)
+			})
+
+			t.Run("Replay for other application", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.ReplayIntegrationDeadLetter(context.Background(), &pb.ReplayIntegrationDeadLetterRequest{
+					ApplicationId: createResp.Id + 1,
+					Id:            dl.ID.String(),
+				})
+				assert.Equal(codes.NotFound, grpc.Code(err))
+			})
+
+			t.Run("Replay removed integration", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.ReplayIntegrationDeadLetter(context.Background(), &pb.ReplayIntegrationDeadLetterRequest{
+					ApplicationId: createResp.Id,
+					Id:            dl.ID.String(),
+				})
+				assert.Equal(codes.NotFound, grpc.Code(err))
+			})
+
+			t.Run("Purge", func(t *testing.T) {
+				assert := require.New(t)
+
+				resp, err := api.PurgeIntegrationDeadLetters(context.Background(), &pb.PurgeIntegrationDeadLettersRequest{
+					ApplicationId: createResp.Id,
+				})
+				assert.NoError(err)
+				assert.EqualValues(1, resp.Count)
+
+				listResp, err := api.ListIntegrationDeadLetters(context.Background(), &pb.ListIntegrationDeadLettersRequest{
+					ApplicationId: createResp.Id,
+					Limit:         10,
+				})
+				assert.NoError(err)
+				assert.EqualValues(0, listResp.TotalCount)
+			})
+		})
+
 		t.Run("Delete", func(t *testing.T) {
 			assert := require.New(t)
 
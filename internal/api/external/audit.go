@@ -0,0 +1,314 @@
+package external
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// Audit-log resources.
+const (
+	auditResourceOrganization     = "organization"
+	auditResourceOrganizationUser = "organization_user"
+	auditResourceApplication      = "application"
+	auditResourceDevice           = "device"
+	auditResourceDeviceKeys       = "device_keys"
+	auditResourceDeviceActivation = "device_activation"
+	auditResourceGateway          = "gateway"
+	auditResourceAPIKey           = "api_key"
+)
+
+const auditRedacted = "<redacted>"
+
+// auditRedactRegexp matches the fields of which the values must not be
+// stored in the audit log (e.g. session-keys).
+var auditRedactRegexp = regexp.MustCompile(`(?i)(password|secret|token|key$)`)
+
+// auditIgnoreFields contains the fields which are not included in the diff.
+var auditIgnoreFields = map[string]struct{}{
+	"CreatedAt": {},
+	"UpdatedAt": {},
+}
+
+// auditDeviceActivation contains the (ABP) activation state of a device
+// as recorded in the audit log.
+type auditDeviceActivation struct {
+	DevAddr     lorawan.DevAddr
+	AppSKey     lorawan.AES128Key
+	NwkSEncKey  lorawan.AES128Key
+	SNwkSIntKey lorawan.AES128Key
+	FNwkSIntKey lorawan.AES128Key
+	FCntUp      uint32
+	NFCntDown   uint32
+	AFCntDown   uint32
+}
+
+// auditLog records the given mutation in the audit log. before and after
+// hold the state of the resource before and after the mutation, one of
+// them is nil in case of a create or delete. It must be called with the
+// transaction of the mutation, so that the mutation is rolled back when
+// the audit-log record can not be stored.
+func auditLog(ctx context.Context, db sqlx.Queryer, validator auth.Validator, organizationID int64, action, resource, resourceID string, before, after interface{}) error {
+	al := storage.AuditLog{
+		Action:     action,
+		Resource:   resource,
+		ResourceID: resourceID,
+	}
+
+	if organizationID != 0 {
+		al.OrganizationID = &organizationID
+	}
+
+	if err := auditLogSetActor(ctx, validator, &al); err != nil {
+		return errors.Wrap(err, "get audit-log actor error")
+	}
+
+	changes, err := auditLogChanges(before, after)
+	if err != nil {
+		return errors.Wrap(err, "audit-log diff error")
+	}
+	al.Changes = changes
+
+	if err := storage.CreateAuditLog(ctx, db, &al); err != nil {
+		return errors.Wrap(err, "create audit-log error")
+	}
+
+	return nil
+}
+
+// auditOrganizationIDForDevEUI returns the organization ID of the given
+// device.
+func auditOrganizationIDForDevEUI(ctx context.Context, db sqlx.Queryer, devEUI lorawan.EUI64) (int64, error) {
+	d, err := storage.GetDevice(ctx, db, devEUI, false, true)
+	if err != nil {
+		return 0, errors.Wrap(err, "get device error")
+	}
+
+	app, err := storage.GetApplication(ctx, db, d.ApplicationID)
+	if err != nil {
+		return 0, errors.Wrap(err, "get application error")
+	}
+
+	return app.OrganizationID, nil
+}
+
+// auditOrganizationIDForAPIKey returns the organization ID of the given API
+// key. It returns 0 for admin API keys.
+func auditOrganizationIDForAPIKey(ctx context.Context, db sqlx.Queryer, ak storage.APIKey) (int64, error) {
+	if ak.OrganizationID != nil {
+		return *ak.OrganizationID, nil
+	}
+
+	if ak.ApplicationID != nil {
+		app, err := storage.GetApplication(ctx, db, *ak.ApplicationID)
+		if err != nil {
+			return 0, errors.Wrap(err, "get application error")
+		}
+		return app.OrganizationID, nil
+	}
+
+	return 0, nil
+}
+
+// auditLogSetActor sets the user or API key ID of the client performing the
+// request.
+func auditLogSetActor(ctx context.Context, validator auth.Validator, al *storage.AuditLog) error {
+	sub, err := validator.GetSubject(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case auth.SubjectUser:
+		user, err := validator.GetUser(ctx)
+		if err != nil {
+			return err
+		}
+		al.UserID = &user.ID
+	case auth.SubjectAPIKey:
+		id, err := validator.GetAPIKeyID(ctx)
+		if err != nil {
+			return err
+		}
+		al.APIKeyID = &id
+	}
+
+	return nil
+}
+
+// auditLogChanges returns the top-level fields that differ between before
+// and after. Values of sensitive fields are redacted.
+func auditLogChanges(before, after interface{}) (storage.AuditLogChanges, error) {
+	b, err := auditLogFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := auditLogFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(storage.AuditLogChanges)
+	for _, fields := range []map[string]interface{}{b, a} {
+		for k := range fields {
+			if _, ok := auditIgnoreFields[k]; ok {
+				continue
+			}
+			if _, ok := out[k]; ok {
+				continue
+			}
+			if reflect.DeepEqual(b[k], a[k]) {
+				continue
+			}
+
+			c := storage.AuditLogChange{
+				Before: b[k],
+				After:  a[k],
+			}
+			if auditRedactRegexp.MatchString(k) {
+				if c.Before != nil {
+					c.Before = auditRedacted
+				}
+				if c.After != nil {
+					c.After = auditRedacted
+				}
+			}
+			out[k] = c
+		}
+	}
+
+	return out, nil
+}
+
+func auditLogFields(v interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	if v == nil {
+		return out, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal json error")
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, errors.Wrap(err, "unmarshal json error")
+	}
+
+	return out, nil
+}
+
+// AuditLogAPI exports the audit-log related functions.
+type AuditLogAPI struct {
+	validator auth.Validator
+}
+
+// NewAuditLogAPI creates a new AuditLogAPI.
+func NewAuditLogAPI(validator auth.Validator) *AuditLogAPI {
+	return &AuditLogAPI{
+		validator: validator,
+	}
+}
+
+// List lists the audit-log records of the given organization.
+func (a *AuditLogAPI) List(ctx context.Context, req *pb.ListAuditLogRequest) (*pb.ListAuditLogResponse, error) {
+	if req.OrganizationId == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "organization_id must be set")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateIsOrganizationAdmin(req.OrganizationId)); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	filters := storage.AuditLogFilters{
+		OrganizationID: req.OrganizationId,
+		UserID:         req.UserId,
+		Resource:       req.Resource,
+		ResourceID:     req.ResourceId,
+		Limit:          int(req.Limit),
+		Offset:         int(req.Offset),
+	}
+
+	if req.ApiKeyId != "" {
+		id, err := uuid.FromString(req.ApiKeyId)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "api_key_id: %s", err)
+		}
+		filters.APIKeyID = id
+	}
+
+	if req.Since != nil {
+		t, err := ptypes.Timestamp(req.Since)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "since: %s", err)
+		}
+		filters.Since = t
+	}
+
+	if req.Until != nil {
+		t, err := ptypes.Timestamp(req.Until)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "until: %s", err)
+		}
+		filters.Until = t
+	}
+
+	count, err := storage.GetAuditLogCount(ctx, storage.DB(), filters)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	items, err := storage.GetAuditLogs(ctx, storage.DB(), filters)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListAuditLogResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, item := range items {
+		row := pb.AuditLogListItem{
+			Id:         item.ID,
+			Action:     item.Action,
+			Resource:   item.Resource,
+			ResourceId: item.ResourceID,
+		}
+
+		if item.UserID != nil {
+			row.UserId = *item.UserID
+		}
+		if item.APIKeyID != nil {
+			row.ApiKeyId = item.APIKeyID.String()
+		}
+
+		row.CreatedAt, err = ptypes.TimestampProto(item.CreatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		b, err := json.Marshal(item.Changes)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+		row.Changes = string(b)
+
+		resp.Result = append(resp.Result, &row)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,180 @@
+package external
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *APITestSuite) TestAuditLog() {
+	assert := require.New(ts.T())
+
+	validator := &TestValidator{}
+	orgAPI := NewOrganizationAPI(validator)
+	api := NewAuditLogAPI(validator)
+
+	user := storage.User{
+		Email:    "admin@user.com",
+		IsActive: true,
+		IsAdmin:  true,
+	}
+	assert.NoError(storage.CreateUser(context.Background(), storage.DB(), &user))
+
+	apiKeyID, err := uuid.NewV4()
+	assert.NoError(err)
+
+	validator.returnSubject = "user"
+	validator.returnUser = user
+
+	createResp, err := orgAPI.Create(context.Background(), &pb.CreateOrganizationRequest{
+		Organization: &pb.Organization{
+			Name:        "test-org",
+			DisplayName: "Test Org",
+		},
+	})
+	assert.NoError(err)
+
+	validator.returnSubject = "api_key"
+	validator.returnAPIKeyID = apiKeyID
+
+	_, err = orgAPI.Update(context.Background(), &pb.UpdateOrganizationRequest{
+		Organization: &pb.Organization{
+			Id:          createResp.Id,
+			Name:        "test-org",
+			DisplayName: "Test Organization",
+		},
+	})
+	assert.NoError(err)
+
+	ts.T().Run("List", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.List(context.Background(), &pb.ListAuditLogRequest{
+			OrganizationId: createResp.Id,
+			Limit:          10,
+		})
+		assert.NoError(err)
+		assert.EqualValues(2, resp.TotalCount)
+		assert.Len(resp.Result, 2)
+
+		update := resp.Result[0]
+		assert.Equal(storage.AuditLogUpdate, update.Action)
+		assert.Equal(auditResourceOrganization, update.Resource)
+		assert.Equal(strconv.FormatInt(createResp.Id, 10), update.ResourceId)
+		assert.Equal(apiKeyID.String(), update.ApiKeyId)
+		assert.EqualValues(0, update.UserId)
+
+		var changes storage.AuditLogChanges
+		assert.NoError(json.Unmarshal([]byte(update.Changes), &changes))
+		assert.Equal(storage.AuditLogChanges{
+			"DisplayName": {Before: "Test Org", After: "Test Organization"},
+		}, changes)
+
+		create := resp.Result[1]
+		assert.Equal(storage.AuditLogCreate, create.Action)
+		assert.Equal(user.ID, create.UserId)
+		assert.Equal("", create.ApiKeyId)
+	})
+
+	ts.T().Run("List filtered by actor", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.List(context.Background(), &pb.ListAuditLogRequest{
+			OrganizationId: createResp.Id,
+			UserId:         user.ID,
+			Limit:          10,
+		})
+		assert.NoError(err)
+		assert.EqualValues(1, resp.TotalCount)
+		assert.Equal(storage.AuditLogCreate, resp.Result[0].Action)
+	})
+
+	ts.T().Run("Mutation is rolled back when audit-log fails", func(t *testing.T) {
+		assert := require.New(t)
+
+		validator.returnSubject = "user"
+		validator.returnUserError = errors.New("get user error")
+		defer func() {
+			validator.returnUserError = nil
+		}()
+
+		_, err := orgAPI.Create(context.Background(), &pb.CreateOrganizationRequest{
+			Organization: &pb.Organization{
+				Name:        "test-org-2",
+				DisplayName: "Test Org 2",
+			},
+		})
+		assert.Error(err)
+
+		count, err := storage.GetOrganizationCount(context.Background(), storage.DB(), storage.OrganizationFilters{Search: "test-org-2"})
+		assert.NoError(err)
+		assert.Equal(0, count)
+	})
+
+	ts.T().Run("List without organization", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.List(context.Background(), &pb.ListAuditLogRequest{})
+		assert.Error(err)
+	})
+}
+
+func TestAuditLogChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   interface{}
+		after    interface{}
+		expected storage.AuditLogChanges
+	}{
+		{
+			name:  "create",
+			after: storage.Application{ID: 1, Name: "test-app"},
+			expected: storage.AuditLogChanges{
+				"ID":   {After: float64(1)},
+				"Name": {After: "test-app"},
+			},
+		},
+		{
+			name:   "update",
+			before: storage.Application{ID: 1, Name: "test-app", Description: "foo"},
+			after:  storage.Application{ID: 1, Name: "test-app", Description: "bar"},
+			expected: storage.AuditLogChanges{
+				"Description": {Before: "foo", After: "bar"},
+			},
+		},
+		{
+			name:   "redacted",
+			before: storage.DeviceKeys{NwkKey: lorawan.AES128Key{1}},
+			after:  storage.DeviceKeys{NwkKey: lorawan.AES128Key{2}},
+			expected: storage.AuditLogChanges{
+				"NwkKey": {Before: auditRedacted, After: auditRedacted},
+			},
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert := require.New(t)
+
+			changes, err := auditLogChanges(tst.before, tst.after)
+			assert.NoError(err)
+
+			for k, v := range tst.expected {
+				assert.Equal(v, changes[k], k)
+			}
+
+			if tst.before != nil && tst.after != nil {
+				assert.Equal(tst.expected, changes)
+			}
+		})
+	}
+}
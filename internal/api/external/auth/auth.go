@@ -2,7 +2,11 @@ package auth
 
 import (
 	"fmt"
+	"net"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/gofrs/uuid"
@@ -11,12 +15,39 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
 
 var validAuthorizationRegexp = regexp.MustCompile(`(?i)^bearer (.*)$`)
 
+// lastUsedUpdateInterval defines the interval in which the last-used
+// timestamp of an API key is updated.
+var lastUsedUpdateInterval = time.Minute
+
+// apiKeyCacheTTL defines how long an API key is cached after it has been
+// read from the database. Changes to an API key (e.g. its scopes or its
+// removal) take effect after at most this duration.
+var apiKeyCacheTTL = 10 * time.Second
+
+// apiKeyCache caches the API keys read by the validator, so that the
+// database is not queried on every request. lastUsed holds per API key the
+// time the last-used timestamp was last written.
+var apiKeyCache = struct {
+	sync.Mutex
+	items    map[uuid.UUID]apiKeyCacheItem
+	lastUsed map[uuid.UUID]time.Time
+}{
+	items:    make(map[uuid.UUID]apiKeyCacheItem),
+	lastUsed: make(map[uuid.UUID]time.Time),
+}
+
+type apiKeyCacheItem struct {
+	apiKey    storage.APIKey
+	expiresAt time.Time
+}
+
 // Claims defines the struct containing the token claims.
 type Claims struct {
 	jwt.StandardClaims
@@ -29,6 +60,11 @@ type Claims struct {
 
 	// APIKeyID defines the API key ID.
 	APIKeyID uuid.UUID `json:"api_key_id"`
+
+	// Scopes contains the scopes of the API key. These are not part of the
+	// token but are read from the database on validation, so that changes
+	// take effect without issuing a new token.
+	Scopes []string `json:"-"`
 }
 
 // Validator defines the interface a validator needs to implement.
@@ -81,6 +117,12 @@ func (v JWTValidator) Validate(ctx context.Context, funcs ...ValidatorFunc) erro
 		return err
 	}
 
+	if claims.Subject == SubjectAPIKey {
+		if err := v.validateAPIKey(ctx, claims); err != nil {
+			return err
+		}
+	}
+
 	for _, f := range funcs {
 		ok, err := f(v.db, claims)
 		if err != nil {
@@ -136,6 +178,86 @@ func (v JWTValidator) GetUser(ctx context.Context) (storage.User, error) {
 	return storage.User{}, errors.New("no username or user_id in claims")
 }
 
+// validateAPIKey validates the expiry and source-IP allowlist of the API key
+// and sets its scopes in the claims.
+func (v JWTValidator) validateAPIKey(ctx context.Context, claims *Claims) error {
+	ak, err := getAPIKey(ctx, v.db, claims.APIKeyID)
+	if err != nil {
+		return errors.Wrap(err, "get api key error")
+	}
+
+	if ak.ExpiresAt != nil && !ak.ExpiresAt.After(time.Now()) {
+		return ErrAPIKeyExpired
+	}
+
+	if len(ak.AllowedIPs) != 0 {
+		ip, err := getSourceIPFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "get source ip error")
+		}
+
+		if !isAllowedIP(ip, ak.AllowedIPs) {
+			return ErrSourceIPNotAllowed
+		}
+	}
+
+	claims.Scopes = ak.Scopes
+
+	if updateAPIKeyLastUsed(ak) {
+		if err := storage.UpdateAPIKeyLastUsedAt(ctx, v.db, ak.ID, time.Now()); err != nil {
+			log.WithError(err).WithField("id", ak.ID).Error("api/auth: update api key last-used timestamp error")
+		}
+	}
+
+	return nil
+}
+
+// getAPIKey returns the API key for the given ID, from the cache when
+// available.
+func getAPIKey(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (storage.APIKey, error) {
+	apiKeyCache.Lock()
+	item, ok := apiKeyCache.items[id]
+	apiKeyCache.Unlock()
+
+	if ok && time.Now().Before(item.expiresAt) {
+		return item.apiKey, nil
+	}
+
+	ak, err := storage.GetAPIKey(ctx, db, id)
+	if err != nil {
+		return ak, err
+	}
+
+	apiKeyCache.Lock()
+	apiKeyCache.items[id] = apiKeyCacheItem{
+		apiKey:    ak,
+		expiresAt: time.Now().Add(apiKeyCacheTTL),
+	}
+	apiKeyCache.Unlock()
+
+	return ak, nil
+}
+
+// updateAPIKeyLastUsed returns true when the last-used timestamp of the
+// given API key must be updated. To limit the number of writes, this is at
+// most once per update interval per API key.
+func updateAPIKeyLastUsed(ak storage.APIKey) bool {
+	apiKeyCache.Lock()
+	defer apiKeyCache.Unlock()
+
+	lastUsed, ok := apiKeyCache.lastUsed[ak.ID]
+	if !ok && ak.LastUsedAt != nil {
+		lastUsed = *ak.LastUsedAt
+	}
+
+	if !lastUsed.IsZero() && time.Since(lastUsed) < lastUsedUpdateInterval {
+		return false
+	}
+
+	apiKeyCache.lastUsed[ak.ID] = time.Now()
+	return true
+}
+
 func (v JWTValidator) getClaims(ctx context.Context) (*Claims, error) {
 	tokenStr, err := getTokenFromContext(ctx)
 	if err != nil {
@@ -165,6 +287,59 @@ func (v JWTValidator) getClaims(ctx context.Context) (*Claims, error) {
 	return claims, nil
 }
 
+// getSourceIPFromContext returns the IP address of the client. Requests
+// proxied by the REST API gateway are received on the loopback interface,
+// in which case the client IP is the last x-forwarded-for entry, as added by
+// the gateway.
+func getSourceIPFromContext(ctx context.Context) (net.IP, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, ErrNoPeerInContext
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "split host and port error")
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid peer address: %s", host)
+	}
+
+	if ip.IsLoopback() {
+		md, ok := metadata.FromIncomingContext(ctx)
+		if ok && len(md["x-forwarded-for"]) != 0 {
+			values := md["x-forwarded-for"]
+			entries := strings.Split(values[len(values)-1], ",")
+			if fwd := net.ParseIP(strings.TrimSpace(entries[len(entries)-1])); fwd != nil {
+				return fwd, nil
+			}
+		}
+	}
+
+	return ip, nil
+}
+
+// isAllowedIP returns true when the given IP matches one of the given IP
+// addresses or CIDR ranges.
+func isAllowedIP(ip net.IP, allowed []string) bool {
+	for _, a := range allowed {
+		if _, ipNet, err := net.ParseCIDR(a); err == nil {
+			if ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if allowedIP := net.ParseIP(a); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getTokenFromContext(ctx context.Context) (string, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
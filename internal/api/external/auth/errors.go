@@ -9,4 +9,7 @@ var (
 	ErrInvalidAlgorithm          = errors.New("invalid algorithm")
 	ErrInvalidToken              = errors.New("invalid token")
 	ErrNotAuthorized             = errors.New("not authorized")
+	ErrNoPeerInContext           = errors.New("no peer in context")
+	ErrAPIKeyExpired             = errors.New("api key is expired")
+	ErrSourceIPNotAllowed        = errors.New("source ip is not allowed")
 )
@@ -0,0 +1,82 @@
+package auth
+
+import "strings"
+
+// Scope resources.
+const (
+	ScopeApplication     = "application"
+	ScopeDevice          = "device"
+	ScopeDeviceQueue     = "device_queue"
+	ScopeDeviceProfile   = "device_profile"
+	ScopeGateway         = "gateway"
+	ScopeOrganization    = "organization"
+	ScopeNetworkServer   = "network_server"
+	ScopeServiceProfile  = "service_profile"
+	ScopeMulticastGroup  = "multicast_group"
+	ScopeFUOTADeployment = "fuota_deployment"
+	ScopeUser            = "user"
+)
+
+// Scope permissions.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var scopeResources = []string{
+	ScopeApplication,
+	ScopeDevice,
+	ScopeDeviceQueue,
+	ScopeDeviceProfile,
+	ScopeGateway,
+	ScopeOrganization,
+	ScopeNetworkServer,
+	ScopeServiceProfile,
+	ScopeMulticastGroup,
+	ScopeFUOTADeployment,
+	ScopeUser,
+}
+
+// IsValidScope returns true when the given scope is valid. A scope is
+// formatted as resource:permission, e.g. device:read or
+// device_queue:write.
+func IsValidScope(scope string) bool {
+	parts := strings.SplitN(scope, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	if parts[1] != ScopeRead && parts[1] != ScopeWrite {
+		return false
+	}
+
+	for _, r := range scopeResources {
+		if r == parts[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateScope returns true when the scopes of the API key permit the given
+// flag on the given resource. API keys without scopes are not restricted.
+// The write permission implies the read permission.
+func validateScope(claims *Claims, resource string, flag Flag) bool {
+	if len(claims.Scopes) == 0 {
+		return true
+	}
+
+	for _, s := range claims.Scopes {
+		switch s {
+		case resource + ":" + ScopeWrite:
+			return true
+		case resource + ":" + ScopeRead:
+			if flag == Read || flag == List {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -104,6 +104,9 @@ func ValidateUsersAccess(flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeUser, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID)
 		default:
 			return false, nil
@@ -175,6 +178,9 @@ func ValidateUserAccess(userID int64, flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, userID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeUser, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID)
 		default:
 			return false, nil
@@ -255,6 +261,9 @@ func ValidateApplicationsAccess(flag Flag, organizationID int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeApplication, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -349,6 +358,9 @@ func ValidateApplicationAccess(applicationID int64, flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, applicationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeApplication, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, applicationID)
 		default:
 			return false, nil
@@ -426,6 +438,9 @@ func ValidateNodesAccess(applicationID int64, flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, applicationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeDevice, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, applicationID)
 		default:
 			return false, nil
@@ -524,6 +539,9 @@ func ValidateNodeAccess(devEUI lorawan.EUI64, flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, devEUI[:], claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeDevice, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, devEUI[:])
 		default:
 			return false, nil
@@ -587,6 +605,9 @@ func ValidateDeviceQueueAccess(devEUI lorawan.EUI64, flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, devEUI[:], claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeDeviceQueue, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, devEUI[:])
 		default:
 			return false, nil
@@ -662,6 +683,9 @@ func ValidateGatewaysAccess(flag Flag, organizationID int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeGateway, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -736,6 +760,9 @@ func ValidateGatewayAccess(flag Flag, mac lorawan.EUI64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, mac[:], claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeGateway, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, mac[:])
 		default:
 			return false, nil
@@ -785,6 +812,9 @@ func ValidateIsOrganizationAdmin(organizationID int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeOrganization, Update) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -844,6 +874,9 @@ func ValidateOrganizationsAccess(flag Flag) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeOrganization, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID)
 		default:
 			return false, nil
@@ -923,6 +956,9 @@ func ValidateOrganizationAccess(flag Flag, id int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeOrganization, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -991,6 +1027,9 @@ func ValidateOrganizationUsersAccess(flag Flag, id int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeOrganization, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -1075,6 +1114,9 @@ func ValidateOrganizationUserAccess(flag Flag, organizationID, userID int64) Val
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, userID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeOrganization, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -1168,6 +1210,9 @@ func ValidateNetworkServersAccess(flag Flag, organizationID int64) ValidatorFunc
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeNetworkServer, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -1241,6 +1286,9 @@ func ValidateNetworkServerAccess(flag Flag, id int64) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeNetworkServer, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -1306,6 +1354,9 @@ func ValidateOrganizationNetworkServerAccess(flag Flag, organizationID, networkS
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, networkServerID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeNetworkServer, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID, networkServerID)
 		default:
 			return false, nil
@@ -1371,6 +1422,9 @@ func ValidateServiceProfilesAccess(flag Flag, organizationID int64) ValidatorFun
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeServiceProfile, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -1436,6 +1490,9 @@ func ValidateServiceProfileAccess(flag Flag, id uuid.UUID) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeServiceProfile, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -1515,6 +1572,9 @@ func ValidateDeviceProfilesAccess(flag Flag, organizationID, applicationID int64
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, applicationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeDeviceProfile, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID, applicationID)
 		default:
 			return false, nil
@@ -1595,6 +1655,9 @@ func ValidateDeviceProfileAccess(flag Flag, id uuid.UUID) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeDeviceProfile, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -1665,6 +1728,9 @@ func ValidateMulticastGroupsAccess(flag Flag, organizationID int64) ValidatorFun
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, organizationID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeMulticastGroup, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, organizationID)
 		default:
 			return false, nil
@@ -1740,6 +1806,9 @@ func ValidateMulticastGroupAccess(flag Flag, multicastGroupID uuid.UUID) Validat
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, multicastGroupID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeMulticastGroup, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, multicastGroupID)
 		default:
 			return false, nil
@@ -1801,6 +1870,9 @@ func ValidateMulticastGroupQueueAccess(flag Flag, multicastGroupID uuid.UUID) Va
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, multicastGroupID, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeMulticastGroup, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, multicastGroupID)
 		default:
 			return false, nil
@@ -1855,6 +1927,21 @@ func ValidateFUOTADeploymentAccess(flag Flag, id uuid.UUID) ValidatorFunc {
 			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "fd.id = $2"},
 		}
 
+		// admin api key
+		// org api key
+		// app api key
+		apiKeyWhere = [][]string{
+			{"ak.id = $1", "ak.is_admin = true"},
+			{"ak.id = $1", "fd.id = $2"},
+		}
+	case Update:
+		// global admin
+		// organization admin
+		userWhere = [][]string{
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "u.is_admin = true"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "ou.is_admin = true", "fd.id = $2"},
+		}
+
 		// admin api key
 		// org api key
 		// app api key
@@ -1869,6 +1956,9 @@ func ValidateFUOTADeploymentAccess(flag Flag, id uuid.UUID) ValidatorFunc {
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeFUOTADeployment, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
 		default:
 			return false, nil
@@ -1931,6 +2021,9 @@ func ValidateFUOTADeploymentsAccess(flag Flag, applicationID int64, devEUI loraw
 		case SubjectUser:
 			return executeQuery(db, userQuery, userWhere, claims.Username, applicationID, devEUI, claims.UserID)
 		case SubjectAPIKey:
+			if !validateScope(claims, ScopeFUOTADeployment, flag) {
+				return false, nil
+			}
 			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, applicationID, devEUI)
 		default:
 			return false, nil
@@ -1938,6 +2031,166 @@ func ValidateFUOTADeploymentsAccess(flag Flag, applicationID int64, devEUI loraw
 	}
 }
 
+// ValidateDeviceAlertRulesAccess validates if the client has access to the
+// device alert-rules of the given application.
+func ValidateDeviceAlertRulesAccess(flag Flag, applicationID int64) ValidatorFunc {
+	userQuery := `
+		select
+			1
+		from
+			"user" u
+		left join organization_user ou
+			on u.id = ou.user_id
+		left join application a
+			on a.organization_id = ou.organization_id
+	`
+
+	apiKeyQuery := `
+		select
+			1
+		from
+			api_key ak
+		left join application a
+			on ak.application_id = a.id or ak.organization_id = a.organization_id
+	`
+
+	var userWhere = [][]string{}
+	var apiKeyWhere = [][]string{}
+
+	switch flag {
+	case Create:
+		// global admin
+		// organization admin
+		// organization device admin
+		userWhere = [][]string{
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "u.is_admin = true"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "ou.is_admin = true", "a.id = $2"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "ou.is_device_admin = true", "a.id = $2"},
+		}
+
+		// admin api key
+		// organization api key
+		// application api key
+		apiKeyWhere = [][]string{
+			{"ak.id = $1", "ak.is_admin = true"},
+			{"ak.id = $1", "a.id = $2"},
+		}
+	case List:
+		// global admin
+		// organization user
+		userWhere = [][]string{
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "u.is_admin = true"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "a.id = $2"},
+		}
+
+		// admin api key
+		// organization api key
+		// application api key
+		apiKeyWhere = [][]string{
+			{"ak.id = $1", "ak.is_admin = true"},
+			{"ak.id = $1", "a.id = $2"},
+		}
+	default:
+		panic("unsupported flag")
+	}
+
+	return func(db sqlx.Queryer, claims *Claims) (bool, error) {
+		switch claims.Subject {
+		case SubjectUser:
+			return executeQuery(db, userQuery, userWhere, claims.Username, applicationID, claims.UserID)
+		case SubjectAPIKey:
+			if !validateScope(claims, ScopeApplication, flag) {
+				return false, nil
+			}
+			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, applicationID)
+		default:
+			return false, nil
+		}
+	}
+}
+
+// ValidateDeviceAlertRuleAccess validates if the client has access to the
+// given device alert-rule.
+func ValidateDeviceAlertRuleAccess(flag Flag, id uuid.UUID) ValidatorFunc {
+	userQuery := `
+		select
+			1
+		from
+			"user" u
+		left join organization_user ou
+			on u.id = ou.user_id
+		left join application a
+			on a.organization_id = ou.organization_id
+		left join device_alert_rule dar
+			on a.id = dar.application_id
+	`
+
+	apiKeyQuery := `
+		select
+			1
+		from
+			api_key ak
+		left join application a
+			on ak.application_id = a.id or ak.organization_id = a.organization_id
+		left join device_alert_rule dar
+			on a.id = dar.application_id
+	`
+
+	var userWhere = [][]string{}
+	var apiKeyWhere = [][]string{}
+
+	switch flag {
+	case Read:
+		// global admin
+		// organization user
+		userWhere = [][]string{
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "u.is_admin = true"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "dar.id = $2"},
+		}
+
+		// admin api key
+		// organization api key
+		// application api key
+		apiKeyWhere = [][]string{
+			{"ak.id = $1", "ak.is_admin = true"},
+			{"ak.id = $1", "dar.id = $2"},
+		}
+	case Update, Delete:
+		// global admin
+		// organization admin
+		// organization device admin
+		userWhere = [][]string{
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "u.is_admin = true"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "ou.is_admin = true", "dar.id = $2"},
+			{"(u.email = $1 or u.id = $3)", "u.is_active = true", "ou.is_device_admin = true", "dar.id = $2"},
+		}
+
+		// admin api key
+		// organization api key
+		// application api key
+		apiKeyWhere = [][]string{
+			{"ak.id = $1", "ak.is_admin = true"},
+			{"ak.id = $1", "dar.id = $2"},
+		}
+	default:
+		panic("unsupported flag")
+	}
+
+	return func(db sqlx.Queryer, claims *Claims) (bool, error) {
+		switch claims.Subject {
+		case SubjectUser:
+			return executeQuery(db, userQuery, userWhere, claims.Username, id, claims.UserID)
+		case SubjectAPIKey:
+			if !validateScope(claims, ScopeApplication, flag) {
+				return false, nil
+			}
+			return executeQuery(db, apiKeyQuery, apiKeyWhere, claims.APIKeyID, id)
+		default:
+			return false, nil
+		}
+	}
+}
+
 // ValidateAPIKeysAccess validates if the client has access to the global
 // API key resource.
 func ValidateAPIKeysAccess(flag Flag, organizationID int64, applicationID int64) ValidatorFunc {
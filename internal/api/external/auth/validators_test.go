@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"net"
 	"testing"
 	"time"
 
@@ -8,6 +9,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
@@ -2355,7 +2358,7 @@ func (ts *ValidatorTestSuite) TestFUOTA() {
 	}
 
 	deviceProfiles := []storage.DeviceProfile{
-		{Name: "test-dp-1", OrganizationID: ts.organizations[0].ID, NetworkServerID: ts.networkServers[0].ID},
+		{Name: "test-dp-1", OrganizationID: ts.organizations[0].ID, NetworkServerID: ts.networkServers[0].ID, MulticastSetupEnabled: true, MulticastSetupFPort: 200, FragmentationEnabled: true, FragmentationFPort: 201},
 	}
 	var deviceProfilesIDs []uuid.UUID
 	for i := range deviceProfiles {
@@ -2428,6 +2431,54 @@ func (ts *ValidatorTestSuite) TestFUOTA() {
 				Claims:     Claims{APIKeyID: apiKeys[3].ID},
 				ExpectedOK: false,
 			},
+			{
+				Name:       "global admin user can update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{UserID: users[0].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization admin can update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{UserID: orgUsers[1].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization user can not update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{UserID: orgUsers[0].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "non-organization user can not update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{UserID: users[2].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "admin api key can update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{APIKeyID: apiKeys[0].ID},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "org api key can update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{APIKeyID: apiKeys[1].ID},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "app api key can update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{APIKeyID: apiKeys[2].ID},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "other api key can not update",
+				Validators: []ValidatorFunc{ValidateFUOTADeploymentAccess(Update, fuotaDeployments[0].ID)},
+				Claims:     Claims{APIKeyID: apiKeys[3].ID},
+				ExpectedOK: false,
+			},
 		}
 
 		ts.RunTests(t, tests)
@@ -2489,6 +2540,174 @@ func (ts *ValidatorTestSuite) TestFUOTA() {
 	})
 }
 
+func (ts *ValidatorTestSuite) TestDeviceAlertRule() {
+	assert := require.New(ts.T())
+
+	users := []struct {
+		id       int64
+		username string
+		isActive bool
+		isAdmin  bool
+	}{
+		{username: "activeAdmin", isActive: true, isAdmin: true},
+		{username: "activeUser", isActive: true, isAdmin: false},
+	}
+
+	for i, user := range users {
+		id, err := ts.CreateUser(user.username, user.isActive, user.isAdmin)
+		assert.NoError(err)
+		users[i].id = id
+	}
+
+	orgUsers := []struct {
+		id             int64
+		organizationID int64
+		username       string
+		isAdmin        bool
+		isDeviceAdmin  bool
+		isGatewayAdmin bool
+	}{
+		{organizationID: ts.organizations[0].ID, username: "org0ActiveUser", isAdmin: false, isDeviceAdmin: false, isGatewayAdmin: false},
+		{organizationID: ts.organizations[0].ID, username: "org0ActiveUserAdmin", isAdmin: true, isDeviceAdmin: false, isGatewayAdmin: false},
+		{organizationID: ts.organizations[0].ID, username: "org0ActiveUserDeviceAdmin", isAdmin: false, isDeviceAdmin: true, isGatewayAdmin: false},
+		{organizationID: ts.organizations[1].ID, username: "org1ActiveUserAdmin", isAdmin: true, isDeviceAdmin: false, isGatewayAdmin: false},
+	}
+
+	for i, orgUser := range orgUsers {
+		id, err := ts.CreateUser(orgUser.username, true, false)
+		assert.NoError(err)
+		orgUsers[i].id = id
+
+		err = storage.CreateOrganizationUser(context.Background(), storage.DB(), orgUser.organizationID, id, orgUser.isAdmin, orgUser.isDeviceAdmin, orgUser.isGatewayAdmin)
+		assert.NoError(err)
+	}
+
+	sp := storage.ServiceProfile{Name: "test-sp-1", NetworkServerID: ts.networkServers[0].ID, OrganizationID: ts.organizations[0].ID}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, _ := uuid.FromBytes(sp.ServiceProfile.Id)
+
+	app := storage.Application{OrganizationID: ts.organizations[0].ID, Name: "application-1", ServiceProfileID: spID}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	apiKeys := []storage.APIKey{
+		{Name: "admin", IsAdmin: true},
+		{Name: "org", OrganizationID: &ts.organizations[0].ID},
+		{Name: "app", ApplicationID: &app.ID},
+		{Name: "other-org", OrganizationID: &ts.organizations[1].ID},
+	}
+	for i := range apiKeys {
+		_, err := storage.CreateAPIKey(context.Background(), storage.DB(), &apiKeys[i])
+		assert.NoError(err)
+	}
+
+	rule := storage.DeviceAlertRule{ApplicationID: app.ID, Name: "test-rule", Type: storage.AlertTypeMargin}
+	assert.NoError(storage.CreateDeviceAlertRule(context.Background(), storage.DB(), &rule))
+
+	ts.T().Run("DeviceAlertRulesAccess", func(t *testing.T) {
+		tests := []validatorTest{
+			{
+				Name:       "global admin user can create and list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID), ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{UserID: users[0].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization admin and device admin can create and list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID), ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{UserID: orgUsers[2].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization user can list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{UserID: orgUsers[0].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization user can not create",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID)},
+				Claims:     Claims{UserID: orgUsers[0].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "other organization admin can not create or list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID), ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{UserID: orgUsers[3].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "non-organization user can not list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{UserID: users[1].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "app api key can create and list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID), ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{APIKeyID: apiKeys[2].ID},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "other org api key can not create or list",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRulesAccess(Create, app.ID), ValidateDeviceAlertRulesAccess(List, app.ID)},
+				Claims:     Claims{APIKeyID: apiKeys[3].ID},
+				ExpectedOK: false,
+			},
+		}
+
+		ts.RunTests(t, tests)
+	})
+
+	ts.T().Run("DeviceAlertRuleAccess", func(t *testing.T) {
+		tests := []validatorTest{
+			{
+				Name:       "global admin user can read, update and delete",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID), ValidateDeviceAlertRuleAccess(Update, rule.ID), ValidateDeviceAlertRuleAccess(Delete, rule.ID)},
+				Claims:     Claims{UserID: users[0].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization admin can read, update and delete",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID), ValidateDeviceAlertRuleAccess(Update, rule.ID), ValidateDeviceAlertRuleAccess(Delete, rule.ID)},
+				Claims:     Claims{UserID: orgUsers[1].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization user can read",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID)},
+				Claims:     Claims{UserID: orgUsers[0].id},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "organization user can not update or delete",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Update, rule.ID), ValidateDeviceAlertRuleAccess(Delete, rule.ID)},
+				Claims:     Claims{UserID: orgUsers[0].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "other organization admin can not read",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID)},
+				Claims:     Claims{UserID: orgUsers[3].id},
+				ExpectedOK: false,
+			},
+			{
+				Name:       "org api key can read, update and delete",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID), ValidateDeviceAlertRuleAccess(Update, rule.ID), ValidateDeviceAlertRuleAccess(Delete, rule.ID)},
+				Claims:     Claims{APIKeyID: apiKeys[1].ID},
+				ExpectedOK: true,
+			},
+			{
+				Name:       "other org api key can not read",
+				Validators: []ValidatorFunc{ValidateDeviceAlertRuleAccess(Read, rule.ID)},
+				Claims:     Claims{APIKeyID: apiKeys[3].ID},
+				ExpectedOK: false,
+			},
+		}
+
+		ts.RunTests(t, tests)
+	})
+}
+
 func (ts *ValidatorTestSuite) TestAPIKeys() {
 	assert := require.New(ts.T())
 
@@ -2717,6 +2936,173 @@ func (ts *ValidatorTestSuite) TestAPIKeys() {
 	})
 }
 
+func (ts *ValidatorTestSuite) TestAPIKeyScopes() {
+	assert := require.New(ts.T())
+
+	sp := storage.ServiceProfile{Name: "test-sp-1", NetworkServerID: ts.networkServers[0].ID, OrganizationID: ts.organizations[0].ID}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	app := storage.Application{OrganizationID: ts.organizations[0].ID, Name: "application-1", ServiceProfileID: spID}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	dp := storage.DeviceProfile{Name: "test-dp-1", OrganizationID: ts.organizations[0].ID, NetworkServerID: ts.networkServers[0].ID}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
+	dpID, err := uuid.FromBytes(dp.DeviceProfile.Id)
+	assert.NoError(err)
+
+	device := storage.Device{DevEUI: lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1}, Name: "test-1", ApplicationID: app.ID, DeviceProfileID: dpID}
+	assert.NoError(storage.CreateDevice(context.Background(), storage.DB(), &device))
+
+	apiKey := storage.APIKey{Name: "app", ApplicationID: &app.ID}
+	_, err = storage.CreateAPIKey(context.Background(), storage.DB(), &apiKey)
+	assert.NoError(err)
+
+	tests := []validatorTest{
+		{
+			Name:       "api key without scopes has access to device and queue",
+			Validators: []ValidatorFunc{ValidateNodeAccess(device.DevEUI, Read), ValidateNodeAccess(device.DevEUI, Update), ValidateDeviceQueueAccess(device.DevEUI, Create)},
+			Claims:     Claims{APIKeyID: apiKey.ID},
+			ExpectedOK: true,
+		},
+		{
+			Name:       "api key with device:read scope can read device",
+			Validators: []ValidatorFunc{ValidateNodeAccess(device.DevEUI, Read), ValidateNodesAccess(app.ID, List)},
+			Claims:     Claims{APIKeyID: apiKey.ID, Scopes: []string{"device:read"}},
+			ExpectedOK: true,
+		},
+		{
+			Name:       "api key with device:read scope can not update device, enqueue or read application",
+			Validators: []ValidatorFunc{ValidateNodeAccess(device.DevEUI, Update), ValidateDeviceQueueAccess(device.DevEUI, Create), ValidateApplicationAccess(app.ID, Read)},
+			Claims:     Claims{APIKeyID: apiKey.ID, Scopes: []string{"device:read"}},
+			ExpectedOK: false,
+		},
+		{
+			Name:       "api key with device_queue:write scope can enqueue and read queue",
+			Validators: []ValidatorFunc{ValidateDeviceQueueAccess(device.DevEUI, Create), ValidateDeviceQueueAccess(device.DevEUI, List)},
+			Claims:     Claims{APIKeyID: apiKey.ID, Scopes: []string{"device_queue:write"}},
+			ExpectedOK: true,
+		},
+	}
+
+	ts.RunTests(ts.T(), tests)
+}
+
+func (ts *ValidatorTestSuite) TestJWTValidatorAPIKey() {
+	assert := require.New(ts.T())
+
+	conf := test.GetConfig()
+	v := NewJWTValidator(storage.DB(), "HS256", conf.ApplicationServer.ExternalAPI.JWTSecret)
+
+	expired := time.Now().Add(-time.Minute)
+
+	keys := []storage.APIKey{
+		{Name: "admin", IsAdmin: true},
+		{Name: "expired", IsAdmin: true},
+		{Name: "allowlist", IsAdmin: true, AllowedIPs: []string{"10.0.0.0/8"}},
+	}
+	var tokens []string
+	for i := range keys {
+		token, err := storage.CreateAPIKey(context.Background(), storage.DB(), &keys[i])
+		assert.NoError(err)
+		tokens = append(tokens, token)
+	}
+
+	// Expire the key after the token has been created, so that the token
+	// itself does not contain an expiry.
+	_, err := storage.DB().Exec("update api_key set expires_at = $2 where id = $1", keys[1].ID, expired)
+	assert.NoError(err)
+
+	newContext := func(token, peerIP string, forwardedFor ...string) context.Context {
+		md := metadata.MD{
+			"authorization": []string{token},
+		}
+		if len(forwardedFor) != 0 {
+			md["x-forwarded-for"] = forwardedFor
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		return peer.NewContext(ctx, &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(peerIP), Port: 12345},
+		})
+	}
+
+	ts.T().Run("Valid", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(v.Validate(newContext(tokens[0], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+
+		ak, err := storage.GetAPIKey(context.Background(), storage.DB(), keys[0].ID)
+		assert.NoError(err)
+		assert.NotNil(ak.LastUsedAt)
+	})
+
+	ts.T().Run("Expired", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Equal(ErrAPIKeyExpired, v.Validate(newContext(tokens[1], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+	})
+
+	ts.T().Run("Allowed IP", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(v.Validate(newContext(tokens[2], "10.1.2.3"), ValidateOrganizationsAccess(List)))
+		assert.NoError(v.Validate(newContext(tokens[2], "127.0.0.1", "192.168.1.1, 10.1.2.3"), ValidateOrganizationsAccess(List)))
+	})
+
+	ts.T().Run("Not allowed IP", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.Equal(ErrSourceIPNotAllowed, v.Validate(newContext(tokens[2], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+		assert.Equal(ErrSourceIPNotAllowed, v.Validate(newContext(tokens[2], "192.168.1.1", "10.1.2.3"), ValidateOrganizationsAccess(List)))
+		assert.Equal(ErrSourceIPNotAllowed, v.Validate(newContext(tokens[2], "127.0.0.1", "10.1.2.3, 192.168.1.1"), ValidateOrganizationsAccess(List)))
+	})
+
+	ts.T().Run("Last-used update is throttled", func(t *testing.T) {
+		assert := require.New(t)
+
+		// The key was used by the "Valid" test less than the update
+		// interval ago, the timestamp set below must not be overwritten.
+		lastUsed := time.Now().Add(-time.Hour).Truncate(time.Second)
+		_, err := storage.DB().Exec("update api_key set last_used_at = $2 where id = $1", keys[0].ID, lastUsed)
+		assert.NoError(err)
+
+		assert.NoError(v.Validate(newContext(tokens[0], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+
+		ak, err := storage.GetAPIKey(context.Background(), storage.DB(), keys[0].ID)
+		assert.NoError(err)
+		assert.NotNil(ak.LastUsedAt)
+		assert.True(ak.LastUsedAt.Equal(lastUsed))
+	})
+
+	ts.T().Run("Cached", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := storage.DB().Exec("update api_key set expires_at = $2 where id = $1", keys[0].ID, expired)
+		assert.NoError(err)
+
+		// the cached key is used until it expires from the cache
+		assert.NoError(v.Validate(newContext(tokens[0], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+
+		apiKeyCache.Lock()
+		delete(apiKeyCache.items, keys[0].ID)
+		apiKeyCache.Unlock()
+
+		assert.Equal(ErrAPIKeyExpired, v.Validate(newContext(tokens[0], "192.168.1.1"), ValidateOrganizationsAccess(List)))
+	})
+}
+
+func TestIsValidScope(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(IsValidScope("device:read"))
+	assert.True(IsValidScope("device_queue:write"))
+	assert.True(IsValidScope("gateway:read"))
+	assert.False(IsValidScope("device"))
+	assert.False(IsValidScope("device:execute"))
+	assert.False(IsValidScope("unknown:read"))
+}
+
 func TestValidators(t *testing.T) {
 	suite.Run(t, new(ValidatorTestSuite))
 }
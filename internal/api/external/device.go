@@ -16,6 +16,7 @@ import (
 	"google.golang.org/grpc/codes"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-api/go/v3/as/integration"
 	"github.com/brocaar/chirpstack-api/go/v3/common"
 	"github.com/brocaar/chirpstack-api/go/v3/ns"
 	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
@@ -129,12 +130,20 @@ func (a *DeviceAPI) Create(ctx context.Context, req *pb.CreateDeviceRequest) (*e
 			}
 		}
 
+		// The audit-log record is written before the device is created at
+		// the network-server, so that a failing write rolls back both.
+		if err := auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogCreate, auditResourceDevice, d.DevEUI.String(), nil, d); err != nil {
+			return err
+		}
+
 		return storage.CreateDevice(ctx, tx, &d)
 	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
+	managementEvent(ctx, integration.ManagementEventType_CREATE, d, nil, newManagementDeviceState(d))
+
 	return &empty.Empty{}, nil
 }
 
@@ -171,6 +180,7 @@ func (a *DeviceAPI) Get(ctx context.Context, req *pb.GetDeviceRequest) (*pb.GetD
 
 		DeviceStatusBattery: 256,
 		DeviceStatusMargin:  256,
+		FirmwareVersion:     d.FirmwareVersion,
 	}
 
 	if d.DeviceStatusBattery != nil {
@@ -335,11 +345,14 @@ func (a *DeviceAPI) Update(ctx context.Context, req *pb.UpdateDeviceRequest) (*e
 		return nil, grpc.Errorf(codes.InvalidArgument, "device-profile and application must be under the same organization")
 	}
 
+	var before, d storage.Device
 	err = storage.Transaction(func(tx sqlx.Ext) error {
-		d, err := storage.GetDevice(ctx, tx, devEUI, true, false)
+		var err error
+		d, err = storage.GetDevice(ctx, tx, devEUI, true, false)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
 		}
+		before = d
 
 		// If the device is moved to a different application, validate that
 		// the new application is assigned to the same service-profile.
@@ -383,6 +396,10 @@ func (a *DeviceAPI) Update(ctx context.Context, req *pb.UpdateDeviceRequest) (*e
 			d.Tags.Map[k] = sql.NullString{String: v, Valid: true}
 		}
 
+		if err := auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogUpdate, auditResourceDevice, d.DevEUI.String(), before, d); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		if err := storage.UpdateDevice(ctx, tx, &d, false); err != nil {
 			return helpers.ErrToRPCError(err)
 		}
@@ -393,6 +410,8 @@ func (a *DeviceAPI) Update(ctx context.Context, req *pb.UpdateDeviceRequest) (*e
 		return nil, err
 	}
 
+	managementEvent(ctx, integration.ManagementEventType_UPDATE, d, newManagementDeviceState(before), newManagementDeviceState(d))
+
 	return &empty.Empty{}, nil
 }
 
@@ -408,15 +427,31 @@ func (a *DeviceAPI) Delete(ctx context.Context, req *pb.DeleteDeviceRequest) (*e
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
+	d, err := storage.GetDevice(ctx, storage.DB(), eui, false, true)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
 	// as this also performs a remote call to delete the node from the
 	// network-server, wrap it in a transaction
-	err := storage.Transaction(func(tx sqlx.Ext) error {
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		orgID, err := auditOrganizationIDForDevEUI(ctx, tx, eui)
+		if err != nil {
+			return err
+		}
+
+		if err := auditLog(ctx, tx, a.validator, orgID, storage.AuditLogDelete, auditResourceDevice, eui.String(), d, nil); err != nil {
+			return err
+		}
+
 		return storage.DeleteDevice(ctx, tx, eui)
 	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
+	managementEvent(ctx, integration.ManagementEventType_DELETE, d, newManagementDeviceState(d), nil)
+
 	return &empty.Empty{}, nil
 }
 
@@ -461,11 +496,23 @@ func (a *DeviceAPI) CreateKeys(ctx context.Context, req *pb.CreateDeviceKeysRequ
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err := storage.CreateDeviceKeys(ctx, storage.DB(), &storage.DeviceKeys{
+	dk := storage.DeviceKeys{
 		DevEUI:    eui,
 		NwkKey:    nwkKey,
 		AppKey:    appKey,
 		GenAppKey: genAppKey,
+	}
+	err := storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.CreateDeviceKeys(ctx, tx, &dk); err != nil {
+			return err
+		}
+
+		orgID, err := auditOrganizationIDForDevEUI(ctx, tx, eui)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogCreate, auditResourceDeviceKeys, eui.String(), nil, dk)
 	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
@@ -545,11 +592,23 @@ func (a *DeviceAPI) UpdateKeys(ctx context.Context, req *pb.UpdateDeviceKeysRequ
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
+	before := dk
 	dk.NwkKey = nwkKey
 	dk.AppKey = appKey
 	dk.GenAppKey = genAppKey
 
-	err = storage.UpdateDeviceKeys(ctx, storage.DB(), &dk)
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.UpdateDeviceKeys(ctx, tx, &dk); err != nil {
+			return err
+		}
+
+		orgID, err := auditOrganizationIDForDevEUI(ctx, tx, eui)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogUpdate, auditResourceDeviceKeys, eui.String(), before, dk)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -570,7 +629,24 @@ func (a *DeviceAPI) DeleteKeys(ctx context.Context, req *pb.DeleteDeviceKeysRequ
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	if err := storage.DeleteDeviceKeys(ctx, storage.DB(), eui); err != nil {
+	dk, err := storage.GetDeviceKeys(ctx, storage.DB(), eui)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.DeleteDeviceKeys(ctx, tx, eui); err != nil {
+			return err
+		}
+
+		orgID, err := auditOrganizationIDForDevEUI(ctx, tx, eui)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogDelete, auditResourceDeviceKeys, eui.String(), dk, nil)
+	})
+	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
@@ -605,10 +681,31 @@ func (a *DeviceAPI) Deactivate(ctx context.Context, req *pb.DeactivateDeviceRequ
 		return nil, helpers.ErrToRPCError(err)
 	}
 
+	// The audit-log record is stored before the de-activation is sent to
+	// the network-server, as the latter can't be rolled back.
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		orgID, err := auditOrganizationIDForDevEUI(ctx, tx, d.DevEUI)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogDelete, auditResourceDeviceActivation, d.DevEUI.String(), auditDeviceActivation{
+			DevAddr: d.DevAddr,
+			AppSKey: d.AppSKey,
+		}, nil)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
 	_, _ = nsClient.DeactivateDevice(ctx, &ns.DeactivateDeviceRequest{
 		DevEui: d.DevEUI[:],
 	})
 
+	after := d
+	after.DevAddr = lorawan.DevAddr{}
+	managementEvent(ctx, integration.ManagementEventType_DEACTIVATE, d, newManagementDeviceState(d), newManagementDeviceState(after))
+
 	return &empty.Empty{}, nil
 }
 
@@ -686,7 +783,29 @@ func (a *DeviceAPI) Activate(ctx context.Context, req *pb.ActivateDeviceRequest)
 			return helpers.ErrToRPCError(err)
 		}
 
-		_, err := nsClient.ActivateDevice(ctx, &actReq)
+		orgID, err := auditOrganizationIDForDevEUI(ctx, db, d.DevEUI)
+		if err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
+		err = auditLog(ctx, db, a.validator, orgID, storage.AuditLogUpdate, auditResourceDeviceActivation, d.DevEUI.String(), auditDeviceActivation{
+			DevAddr: d.DevAddr,
+			AppSKey: d.AppSKey,
+		}, auditDeviceActivation{
+			DevAddr:     devAddr,
+			AppSKey:     appSKey,
+			NwkSEncKey:  nwkSEncKey,
+			SNwkSIntKey: sNwkSIntKey,
+			FNwkSIntKey: fNwkSIntKey,
+			FCntUp:      req.DeviceActivation.FCntUp,
+			NFCntDown:   req.DeviceActivation.NFCntDown,
+			AFCntDown:   req.DeviceActivation.AFCntDown,
+		})
+		if err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
+		_, err = nsClient.ActivateDevice(ctx, &actReq)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
 		}
@@ -703,6 +822,10 @@ func (a *DeviceAPI) Activate(ctx context.Context, req *pb.ActivateDeviceRequest)
 		"ctx_id":   ctx.Value(logging.ContextIDKey),
 	}).Info("device activated")
 
+	after := d
+	after.DevAddr = devAddr
+	managementEvent(ctx, integration.ManagementEventType_ACTIVATE, d, newManagementDeviceState(d), newManagementDeviceState(after))
+
 	return &empty.Empty{}, nil
 }
 
@@ -848,7 +971,7 @@ func (a *DeviceAPI) StreamEventLogs(req *pb.StreamDeviceEventLogsRequest, srv pb
 
 	eventLogChan := make(chan eventlog.EventLog)
 	go func() {
-		err := eventlog.GetEventLogForDevice(srv.Context(), devEUI, eventLogChan)
+		err := eventlog.GetEventLogForDevice(srv.Context(), devEUI, req.FromId, eventLogChan)
 		if err != nil {
 			log.WithError(err).Error("get event-log for device error")
 		}
@@ -862,6 +985,7 @@ func (a *DeviceAPI) StreamEventLogs(req *pb.StreamDeviceEventLogsRequest, srv pb
 		}
 
 		resp := pb.StreamDeviceEventLogsResponse{
+			Id:          el.ID,
 			Type:        el.Type,
 			PayloadJson: string(b),
 		}
@@ -875,6 +999,54 @@ func (a *DeviceAPI) StreamEventLogs(req *pb.StreamDeviceEventLogsRequest, srv pb
 	return nil
 }
 
+// ListEventLogs lists the logged device events (uplink payloads, ACKs, joins,
+// errors, ...), most recent events first.
+func (a *DeviceAPI) ListEventLogs(ctx context.Context, req *pb.ListDeviceEventLogsRequest) (*pb.ListDeviceEventLogsResponse, error) {
+	var devEUI lorawan.EUI64
+
+	if err := devEUI.UnmarshalText([]byte(req.DevEui)); err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "devEUI: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateNodeAccess(devEUI, auth.Read)); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if req.Limit <= 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "limit must be greater than 0")
+	}
+
+	count, err := eventlog.GetEventLogCountForDevice(devEUI)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	els, err := eventlog.GetEventLogsForDevice(devEUI, req.Before, int(req.Limit))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListDeviceEventLogsResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, el := range els {
+		b, err := json.Marshal(el.Payload)
+		if err != nil {
+			return nil, grpc.Errorf(codes.Internal, "marshal json error: %s", err)
+		}
+
+		resp.Result = append(resp.Result, &pb.DeviceEventLog{
+			Id:          el.ID,
+			Type:        el.Type,
+			PayloadJson: string(b),
+		})
+	}
+
+	return &resp, nil
+}
+
 // GetRandomDevAddr returns a random DevAddr taking the NwkID prefix into account.
 func (a *DeviceAPI) GetRandomDevAddr(ctx context.Context, req *pb.GetRandomDevAddrRequest) (*pb.GetRandomDevAddrResponse, error) {
 	var devEUI lorawan.EUI64
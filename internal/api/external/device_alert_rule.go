@@ -0,0 +1,222 @@
+package external
+
+import (
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+// DeviceAlertRuleAPI exports the device alert-rule related functions.
+type DeviceAlertRuleAPI struct {
+	validator auth.Validator
+}
+
+// NewDeviceAlertRuleAPI creates a new DeviceAlertRuleAPI.
+func NewDeviceAlertRuleAPI(validator auth.Validator) *DeviceAlertRuleAPI {
+	return &DeviceAlertRuleAPI{
+		validator: validator,
+	}
+}
+
+// Create creates the given device alert-rule.
+func (a *DeviceAlertRuleAPI) Create(ctx context.Context, req *pb.CreateDeviceAlertRuleRequest) (*pb.CreateDeviceAlertRuleResponse, error) {
+	if req.DeviceAlertRule == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "device_alert_rule must not be nil")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceAlertRulesAccess(auth.Create, req.DeviceAlertRule.ApplicationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	r := storage.DeviceAlertRule{
+		ApplicationID: req.DeviceAlertRule.ApplicationId,
+	}
+	if err := deviceAlertRuleFromPB(req.DeviceAlertRule, &r); err != nil {
+		return nil, err
+	}
+
+	if err := storage.CreateDeviceAlertRule(ctx, storage.DB(), &r); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.CreateDeviceAlertRuleResponse{
+		Id: r.ID.String(),
+	}, nil
+}
+
+// Get returns the device alert-rule matching the given ID.
+func (a *DeviceAlertRuleAPI) Get(ctx context.Context, req *pb.GetDeviceAlertRuleRequest) (*pb.GetDeviceAlertRuleResponse, error) {
+	id, err := uuid.FromString(req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceAlertRuleAccess(auth.Read, id),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	r, err := storage.GetDeviceAlertRule(ctx, storage.DB(), id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.GetDeviceAlertRuleResponse{
+		DeviceAlertRule: &pb.DeviceAlertRule{
+			Id:                    r.ID.String(),
+			ApplicationId:         r.ApplicationID,
+			Name:                  r.Name,
+			Type:                  pb.AlertType(pb.AlertType_value[string(r.Type)]),
+			BatteryLevelThreshold: r.BatteryLevelThreshold,
+			MarginThreshold:       int32(r.MarginThreshold),
+		},
+	}
+
+	if r.InactivityThreshold != 0 {
+		resp.DeviceAlertRule.InactivityThreshold = ptypes.DurationProto(r.InactivityThreshold)
+	}
+
+	resp.CreatedAt, err = ptypes.TimestampProto(r.CreatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	resp.UpdatedAt, err = ptypes.TimestampProto(r.UpdatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &resp, nil
+}
+
+// Update updates the given device alert-rule. Open alerts of which the
+// device no longer matches the updated rule are resolved on the next check.
+func (a *DeviceAlertRuleAPI) Update(ctx context.Context, req *pb.UpdateDeviceAlertRuleRequest) (*empty.Empty, error) {
+	if req.DeviceAlertRule == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "device_alert_rule must not be nil")
+	}
+
+	id, err := uuid.FromString(req.DeviceAlertRule.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceAlertRuleAccess(auth.Update, id),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	r, err := storage.GetDeviceAlertRule(ctx, storage.DB(), id)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if err := deviceAlertRuleFromPB(req.DeviceAlertRule, &r); err != nil {
+		return nil, err
+	}
+
+	if err := storage.UpdateDeviceAlertRule(ctx, storage.DB(), &r); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// Delete deletes the device alert-rule matching the given ID.
+func (a *DeviceAlertRuleAPI) Delete(ctx context.Context, req *pb.DeleteDeviceAlertRuleRequest) (*empty.Empty, error) {
+	id, err := uuid.FromString(req.Id)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceAlertRuleAccess(auth.Delete, id),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := storage.DeleteDeviceAlertRule(ctx, storage.DB(), id); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// List lists the device alert-rules of the given application.
+func (a *DeviceAlertRuleAPI) List(ctx context.Context, req *pb.ListDeviceAlertRuleRequest) (*pb.ListDeviceAlertRuleResponse, error) {
+	if req.ApplicationId == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "application_id must be set")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceAlertRulesAccess(auth.List, req.ApplicationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	count, err := storage.GetDeviceAlertRuleCount(ctx, storage.DB(), req.ApplicationId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	rules, err := storage.GetDeviceAlertRules(ctx, storage.DB(), req.ApplicationId, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListDeviceAlertRuleResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, r := range rules {
+		row := pb.DeviceAlertRuleListItem{
+			Id:   r.ID.String(),
+			Name: r.Name,
+			Type: pb.AlertType(pb.AlertType_value[string(r.Type)]),
+		}
+
+		row.CreatedAt, err = ptypes.TimestampProto(r.CreatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+		row.UpdatedAt, err = ptypes.TimestampProto(r.UpdatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		resp.Result = append(resp.Result, &row)
+	}
+
+	return &resp, nil
+}
+
+// deviceAlertRuleFromPB sets the user-settable fields of the given
+// device alert-rule. The application of an existing rule can not be changed.
+func deviceAlertRuleFromPB(in *pb.DeviceAlertRule, r *storage.DeviceAlertRule) error {
+	r.Name = in.Name
+	r.Type = storage.AlertType(in.Type.String())
+	r.InactivityThreshold = 0
+	r.BatteryLevelThreshold = in.BatteryLevelThreshold
+	r.MarginThreshold = int(in.MarginThreshold)
+
+	if in.InactivityThreshold != nil {
+		var err error
+		r.InactivityThreshold, err = ptypes.Duration(in.InactivityThreshold)
+		if err != nil {
+			return grpc.Errorf(codes.InvalidArgument, "inactivity_threshold: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package external
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+func (ts *APITestSuite) TestDeviceAlertRule() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	validator := &TestValidator{}
+	api := NewDeviceAlertRuleAPI(validator)
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	n := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	sp := storage.ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	app := storage.Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	ts.T().Run("Create invalid threshold", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(context.Background(), &pb.CreateDeviceAlertRuleRequest{
+			DeviceAlertRule: &pb.DeviceAlertRule{
+				ApplicationId: app.ID,
+				Name:          "no-uplink",
+				Type:          pb.AlertType_INACTIVITY,
+			},
+		})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	})
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		rule := pb.DeviceAlertRule{
+			ApplicationId:       app.ID,
+			Name:                "no-uplink",
+			Type:                pb.AlertType_INACTIVITY,
+			InactivityThreshold: ptypes.DurationProto(6 * time.Hour),
+		}
+
+		createResp, err := api.Create(context.Background(), &pb.CreateDeviceAlertRuleRequest{
+			DeviceAlertRule: &rule,
+		})
+		assert.NoError(err)
+		rule.Id = createResp.Id
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.Get(context.Background(), &pb.GetDeviceAlertRuleRequest{
+				Id: createResp.Id,
+			})
+			assert.NoError(err)
+			assert.Equal(&rule, resp.DeviceAlertRule)
+			assert.NotNil(resp.CreatedAt)
+			assert.NotNil(resp.UpdatedAt)
+		})
+
+		t.Run("List", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.List(context.Background(), &pb.ListDeviceAlertRuleRequest{
+				ApplicationId: app.ID,
+				Limit:         10,
+			})
+			assert.NoError(err)
+			assert.EqualValues(1, resp.TotalCount)
+			assert.Len(resp.Result, 1)
+			assert.Equal(createResp.Id, resp.Result[0].Id)
+			assert.Equal("no-uplink", resp.Result[0].Name)
+			assert.Equal(pb.AlertType_INACTIVITY, resp.Result[0].Type)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			updated := pb.DeviceAlertRule{
+				Id:                    createResp.Id,
+				ApplicationId:         app.ID,
+				Name:                  "low-battery",
+				Type:                  pb.AlertType_BATTERY_LEVEL,
+				BatteryLevelThreshold: 15,
+			}
+
+			_, err := api.Update(context.Background(), &pb.UpdateDeviceAlertRuleRequest{
+				DeviceAlertRule: &updated,
+			})
+			assert.NoError(err)
+
+			resp, err := api.Get(context.Background(), &pb.GetDeviceAlertRuleRequest{
+				Id: createResp.Id,
+			})
+			assert.NoError(err)
+			assert.Equal(&updated, resp.DeviceAlertRule)
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Delete(context.Background(), &pb.DeleteDeviceAlertRuleRequest{
+				Id: createResp.Id,
+			})
+			assert.NoError(err)
+
+			_, err = api.Get(context.Background(), &pb.GetDeviceAlertRuleRequest{
+				Id: createResp.Id,
+			})
+			assert.Equal(codes.NotFound, grpc.Code(err))
+		})
+	})
+}
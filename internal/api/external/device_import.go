@@ -0,0 +1,627 @@
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq/hstore"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// importBatchSize defines the number of devices that are created within a
+// single database transaction.
+var importBatchSize = 100
+
+// exportPageSize defines the number of devices that are read per query
+// when exporting devices.
+var exportPageSize = 100
+
+// deviceImportCSVHeader defines the columns of the CSV import and export
+// format. Tags and variables are encoded as key=value pairs, separated by ;.
+var deviceImportCSVHeader = []string{"dev_eui", "name", "device_profile_id", "tags", "variables", "app_key", "nwk_key"}
+
+// deviceImportRecord defines a device record of the import and export
+// format. In case of JSON lines, each line contains a JSON encoded record.
+type deviceImportRecord struct {
+	DevEUI          string            `json:"devEUI"`
+	Name            string            `json:"name"`
+	DeviceProfileID string            `json:"deviceProfileID"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	AppKey          string            `json:"appKey,omitempty"`
+	NwkKey          string            `json:"nwkKey,omitempty"`
+}
+
+// deviceImportRow contains a parsed and validated import record.
+type deviceImportRow struct {
+	line   int
+	device storage.Device
+	keys   *storage.DeviceKeys
+}
+
+// ImportDevices creates the devices read from the stream of CSV or JSON
+// lines encoded data. The first request must contain the application ID and
+// the format. For every row, a result is returned.
+func (a *DeviceAPI) ImportDevices(srv pb.DeviceService_ImportDevicesServer) error {
+	ctx := srv.Context()
+
+	req, err := srv.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return grpc.Errorf(codes.InvalidArgument, "no data received")
+		}
+		return err
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateNodesAccess(req.ApplicationId, auth.Create)); err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	app, err := storage.GetApplication(ctx, storage.DB(), req.ApplicationId)
+	if err != nil {
+		return helpers.ErrToRPCError(err)
+	}
+
+	// Read the data of the stream in a separate goroutine, so that the
+	// records can be parsed while the data is received.
+	pr, pw := io.Pipe()
+	go func(first *pb.ImportDevicesRequest) {
+		if _, err := pw.Write(first.Data); err != nil {
+			return
+		}
+
+		for {
+			req, err := srv.Recv()
+			if err != nil {
+				if err == io.EOF {
+					pw.Close()
+				} else {
+					pw.CloseWithError(err)
+				}
+				return
+			}
+
+			if _, err := pw.Write(req.Data); err != nil {
+				return
+			}
+		}
+	}(req)
+	defer pr.Close()
+
+	var next func() (int, deviceImportRecord, error)
+	switch req.Format {
+	case pb.DeviceImportFormat_CSV:
+		next, err = newDeviceImportCSVReader(pr)
+		if err != nil {
+			return grpc.Errorf(codes.InvalidArgument, "read csv header error: %s", err)
+		}
+	case pb.DeviceImportFormat_JSON_LINES:
+		next = newDeviceImportJSONLinesReader(pr)
+	default:
+		return grpc.Errorf(codes.InvalidArgument, "invalid format: %s", req.Format)
+	}
+
+	// device-profile ID to organization ID cache
+	dpOrgIDs := make(map[uuid.UUID]int64)
+
+	var batch []deviceImportRow
+	for {
+		line, rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(recordError); !ok {
+				return helpers.ErrToRPCError(err)
+			}
+
+			if err := srv.Send(&pb.ImportDevicesResponse{
+				Line:   uint32(line),
+				DevEui: rec.DevEUI,
+				Error:  err.Error(),
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		row, err := newDeviceImportRow(ctx, line, app, rec, dpOrgIDs)
+		if err != nil {
+			if err := srv.Send(&pb.ImportDevicesResponse{
+				Line:   uint32(line),
+				DevEui: rec.DevEUI,
+				Error:  err.Error(),
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := a.importDeviceBatch(ctx, srv, app, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+
+	if len(batch) != 0 {
+		if err := a.importDeviceBatch(ctx, srv, app, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportDevices exports the devices of the given application as CSV or
+// JSON lines encoded data, in the same format as used by ImportDevices.
+// The device keys are only exported when the client has the same access as
+// required for retrieving the keys of a single device.
+func (a *DeviceAPI) ExportDevices(req *pb.ExportDevicesRequest, srv pb.DeviceService_ExportDevicesServer) error {
+	ctx := srv.Context()
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateNodesAccess(req.ApplicationId, auth.List)); err != nil {
+		return grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	var buf bytes.Buffer
+	var write func(rec deviceImportRecord) error
+
+	switch req.Format {
+	case pb.DeviceImportFormat_CSV:
+		w := csv.NewWriter(&buf)
+		if err := w.Write(deviceImportCSVHeader); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+		write = func(rec deviceImportRecord) error {
+			if err := w.Write([]string{
+				rec.DevEUI,
+				rec.Name,
+				rec.DeviceProfileID,
+				encodeKeyValuePairs(rec.Tags),
+				encodeKeyValuePairs(rec.Variables),
+				rec.AppKey,
+				rec.NwkKey,
+			}); err != nil {
+				return err
+			}
+			w.Flush()
+			return w.Error()
+		}
+	case pb.DeviceImportFormat_JSON_LINES:
+		enc := json.NewEncoder(&buf)
+		write = func(rec deviceImportRecord) error {
+			return enc.Encode(rec)
+		}
+	default:
+		return grpc.Errorf(codes.InvalidArgument, "invalid format: %s", req.Format)
+	}
+
+	// as the access to the device keys is granted per application, it is
+	// only validated for the first device
+	var keysChecked, keysAccess bool
+
+	for offset := 0; ; offset += exportPageSize {
+		devices, err := storage.GetDevices(ctx, storage.DB(), storage.DeviceFilters{
+			ApplicationID: req.ApplicationId,
+			Limit:         exportPageSize,
+			Offset:        offset,
+		})
+		if err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
+		for _, d := range devices {
+			rec := deviceImportRecord{
+				DevEUI:          d.DevEUI.String(),
+				Name:            d.Name,
+				DeviceProfileID: d.DeviceProfileID.String(),
+				Tags:            hstoreToMap(d.Tags),
+				Variables:       hstoreToMap(d.Variables),
+			}
+
+			if !keysChecked {
+				keysAccess = a.validator.Validate(ctx, auth.ValidateNodeAccess(d.DevEUI, auth.Update)) == nil
+				keysChecked = true
+			}
+
+			if keysAccess {
+				dk, err := storage.GetDeviceKeys(ctx, storage.DB(), d.DevEUI)
+				if err != nil && errors.Cause(err) != storage.ErrDoesNotExist {
+					return helpers.ErrToRPCError(err)
+				}
+				if err == nil {
+					rec.AppKey = dk.AppKey.String()
+					rec.NwkKey = dk.NwkKey.String()
+				}
+			}
+
+			if err := write(rec); err != nil {
+				return helpers.ErrToRPCError(err)
+			}
+		}
+
+		if buf.Len() != 0 {
+			if err := srv.Send(&pb.ExportDevicesResponse{
+				Data: buf.Bytes(),
+			}); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+
+		if len(devices) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// importDeviceBatch creates the devices of the given batch and sends the
+// result for each row. The local device records are created within a single
+// transaction, using a savepoint for each device so that a failing row does
+// not rollback the whole batch. As the organization is locked during this
+// transaction to validate the max. device count, the devices are only
+// created at the network-server after the transaction has been committed.
+// When this fails, the local device record is deleted.
+func (a *DeviceAPI) importDeviceBatch(ctx context.Context, srv pb.DeviceService_ImportDevicesServer, app storage.Application, batch []deviceImportRow) error {
+	rowErrors := make([]error, len(batch))
+
+	err := storage.Transaction(func(tx sqlx.Ext) error {
+		// lock the organization so that the max. device count can be
+		// validated
+		org, err := storage.GetOrganization(ctx, tx, app.OrganizationID, true)
+		if err != nil {
+			return err
+		}
+
+		var count int
+		if org.MaxDeviceCount != 0 {
+			count, err = storage.GetDeviceCount(ctx, tx, storage.DeviceFilters{OrganizationID: app.OrganizationID})
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := range batch {
+			if org.MaxDeviceCount != 0 && count >= org.MaxDeviceCount {
+				rowErrors[i] = storage.ErrOrganizationMaxDeviceCount
+				continue
+			}
+
+			if _, err := tx.Exec("savepoint device_import"); err != nil {
+				return errors.Wrap(err, "savepoint error")
+			}
+
+			if err := createImportedDevice(ctx, tx, &batch[i]); err != nil {
+				if _, err := tx.Exec("rollback to savepoint device_import"); err != nil {
+					return errors.Wrap(err, "rollback to savepoint error")
+				}
+				rowErrors[i] = err
+				continue
+			}
+
+			if _, err := tx.Exec("release savepoint device_import"); err != nil {
+				return errors.Wrap(err, "release savepoint error")
+			}
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"application_id": app.ID,
+			"ctx_id":         ctx.Value(logging.ContextIDKey),
+		}).Error("api/external: import device batch error")
+
+		for i := range rowErrors {
+			rowErrors[i] = err
+		}
+	}
+
+	for i, row := range batch {
+		if rowErrors[i] != nil {
+			continue
+		}
+
+		// The audit-log records are written in the same transaction as the
+		// network-server create, so that they are rolled back when the
+		// latter fails and the local device is removed again.
+		err := storage.Transaction(func(tx sqlx.Ext) error {
+			if err := auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogCreate, auditResourceDevice, row.device.DevEUI.String(), nil, row.device); err != nil {
+				return err
+			}
+			if row.keys != nil {
+				if err := auditLog(ctx, tx, a.validator, app.OrganizationID, storage.AuditLogCreate, auditResourceDeviceKeys, row.device.DevEUI.String(), nil, *row.keys); err != nil {
+					return err
+				}
+			}
+
+			return storage.CreateNetworkServerDevice(ctx, tx, row.device)
+		})
+		if err != nil {
+			rowErrors[i] = err
+
+			if err := storage.DeleteLocalDevice(ctx, storage.DB(), row.device.DevEUI); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"dev_eui": row.device.DevEUI,
+					"ctx_id":  ctx.Value(logging.ContextIDKey),
+				}).Error("api/external: delete imported device error")
+			}
+			continue
+		}
+
+		managementEvent(ctx, integration.ManagementEventType_CREATE, row.device, nil, newManagementDeviceState(row.device))
+	}
+
+	for i, row := range batch {
+		resp := pb.ImportDevicesResponse{
+			Line:   uint32(row.line),
+			DevEui: row.device.DevEUI.String(),
+		}
+		if rowErrors[i] != nil {
+			resp.Error = errors.Cause(rowErrors[i]).Error()
+		}
+
+		if err := srv.Send(&resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createImportedDevice creates the local device record and the device keys
+// (if any) of the given row.
+func createImportedDevice(ctx context.Context, tx sqlx.Ext, row *deviceImportRow) error {
+	if err := storage.CreateLocalDevice(ctx, tx, &row.device); err != nil {
+		return err
+	}
+
+	if row.keys != nil {
+		if err := storage.CreateDeviceKeys(ctx, tx, row.keys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newDeviceImportRow parses and validates the given record.
+func newDeviceImportRow(ctx context.Context, line int, app storage.Application, rec deviceImportRecord, dpOrgIDs map[uuid.UUID]int64) (deviceImportRow, error) {
+	row := deviceImportRow{
+		line: line,
+	}
+
+	if err := row.device.DevEUI.UnmarshalText([]byte(rec.DevEUI)); err != nil {
+		return row, errors.Wrap(err, "dev_eui")
+	}
+
+	dpID, err := uuid.FromString(rec.DeviceProfileID)
+	if err != nil {
+		return row, errors.Wrap(err, "device_profile_id")
+	}
+
+	// validate that the device-profile is under the same organization as
+	// the application
+	orgID, ok := dpOrgIDs[dpID]
+	if !ok {
+		dp, err := storage.GetDeviceProfile(ctx, storage.DB(), dpID, false, true)
+		if err != nil {
+			return row, errors.Cause(err)
+		}
+		orgID = dp.OrganizationID
+		dpOrgIDs[dpID] = orgID
+	}
+	if orgID != app.OrganizationID {
+		return row, errors.New("device-profile and application must be under the same organization")
+	}
+
+	row.device.ApplicationID = app.ID
+	row.device.DeviceProfileID = dpID
+	row.device.Name = rec.Name
+	if row.device.Name == "" {
+		row.device.Name = rec.DevEUI
+	}
+	row.device.Tags = mapToHstore(rec.Tags)
+	row.device.Variables = mapToHstore(rec.Variables)
+
+	if err := row.device.Validate(); err != nil {
+		return row, err
+	}
+
+	if rec.AppKey != "" || rec.NwkKey != "" {
+		row.keys = &storage.DeviceKeys{
+			DevEUI: row.device.DevEUI,
+		}
+
+		if rec.AppKey != "" {
+			if err := row.keys.AppKey.UnmarshalText([]byte(rec.AppKey)); err != nil {
+				return row, errors.Wrap(err, "app_key")
+			}
+		}
+
+		if rec.NwkKey != "" {
+			if err := row.keys.NwkKey.UnmarshalText([]byte(rec.NwkKey)); err != nil {
+				return row, errors.Wrap(err, "nwk_key")
+			}
+		}
+	}
+
+	return row, nil
+}
+
+// recordError is returned by the import readers when a single record could
+// not be decoded. Other errors abort the import.
+type recordError struct {
+	error
+}
+
+// newDeviceImportCSVReader returns a function which returns the next line
+// number and record for every call. The first row must contain the header.
+func newDeviceImportCSVReader(r io.Reader) (func() (int, deviceImportRecord, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, h := range header {
+		columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, required := range []string{"dev_eui", "device_profile_id"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column: %s", required)
+		}
+	}
+
+	line := 1
+	return func() (int, deviceImportRecord, error) {
+		var rec deviceImportRecord
+
+		fields, err := cr.Read()
+		line++
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				return line, rec, recordError{err}
+			}
+			return line, rec, err
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		rec = deviceImportRecord{
+			DevEUI:          get("dev_eui"),
+			Name:            get("name"),
+			DeviceProfileID: get("device_profile_id"),
+			AppKey:          get("app_key"),
+			NwkKey:          get("nwk_key"),
+		}
+
+		if rec.Tags, err = decodeKeyValuePairs(get("tags")); err != nil {
+			return line, rec, recordError{errors.Wrap(err, "tags")}
+		}
+		if rec.Variables, err = decodeKeyValuePairs(get("variables")); err != nil {
+			return line, rec, recordError{errors.Wrap(err, "variables")}
+		}
+
+		return line, rec, nil
+	}, nil
+}
+
+// newDeviceImportJSONLinesReader returns a function which returns the next
+// line number and record for every call. Empty lines are skipped.
+func newDeviceImportJSONLinesReader(r io.Reader) func() (int, deviceImportRecord, error) {
+	scanner := bufio.NewScanner(r)
+	var line int
+
+	return func() (int, deviceImportRecord, error) {
+		var rec deviceImportRecord
+
+		for scanner.Scan() {
+			line++
+
+			b := bytes.TrimSpace(scanner.Bytes())
+			if len(b) == 0 {
+				continue
+			}
+
+			if err := json.Unmarshal(b, &rec); err != nil {
+				return line, rec, recordError{err}
+			}
+			return line, rec, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return line, rec, err
+		}
+		return line, rec, io.EOF
+	}
+}
+
+// decodeKeyValuePairs decodes key=value pairs separated by ;.
+func decodeKeyValuePairs(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	if s == "" {
+		return out, nil
+	}
+
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid key=value pair: %s", pair)
+		}
+		out[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return out, nil
+}
+
+// encodeKeyValuePairs encodes the given map as key=value pairs separated
+// by ;, sorted by key.
+func encodeKeyValuePairs(m map[string]string) string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+func mapToHstore(m map[string]string) hstore.Hstore {
+	out := hstore.Hstore{
+		Map: make(map[string]sql.NullString),
+	}
+	for k, v := range m {
+		out.Map[k] = sql.NullString{String: v, Valid: true}
+	}
+	return out
+}
+
+func hstoreToMap(h hstore.Hstore) map[string]string {
+	out := make(map[string]string)
+	for k, v := range h.Map {
+		if v.Valid {
+			out[k] = v.String
+		}
+	}
+	return out
+}
@@ -0,0 +1,347 @@
+package external
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	asintegration "github.com/brocaar/chirpstack-application-server/internal/integration"
+	intmock "github.com/brocaar/chirpstack-application-server/internal/integration/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *APITestSuite) TestDeviceImport() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	h := intmock.New()
+	asintegration.SetMockIntegration(h)
+	defer asintegration.SetMockIntegration(nil)
+
+	validator := &TestValidator{}
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterDeviceServiceServer(grpcServer, NewDeviceAPI(validator))
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(err)
+	go grpcServer.Serve(ln)
+	defer func() {
+		grpcServer.Stop()
+		ln.Close()
+	}()
+
+	apiClient, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+	assert.NoError(err)
+	defer apiClient.Close()
+
+	api := pb.NewDeviceServiceClient(apiClient)
+
+	org := storage.Organization{
+		Name:           "test-org",
+		MaxDeviceCount: 2,
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+	org2 := storage.Organization{
+		Name: "test-org-2",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org2))
+
+	n := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	sp := storage.ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	app := storage.Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	dp := storage.DeviceProfile{
+		Name:            "test-dp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
+	dpID, err := uuid.FromBytes(dp.DeviceProfile.Id)
+	assert.NoError(err)
+
+	dp2 := storage.DeviceProfile{
+		Name:            "test-dp",
+		OrganizationID:  org2.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp2))
+	dp2ID, err := uuid.FromBytes(dp2.DeviceProfile.Id)
+	assert.NoError(err)
+
+	ts.T().Run("Import", func(t *testing.T) {
+		assert := require.New(t)
+
+		data := strings.Join([]string{
+			`dev_eui,name,device_profile_id,tags,variables,app_key,nwk_key`,
+			`0102030405060701,meter-1,` + dpID.String() + `,type=meter;vendor=acme,token=abc,,01020304050607080102030405060708`,
+			`invalid,meter-2,` + dpID.String() + `,,,,`,
+			`0102030405060703,meter-3,` + dp2ID.String() + `,,,,`,
+			`0102030405060704,,` + dpID.String() + `,type=meter,,,`,
+			`0102030405060705,meter-5,` + dpID.String() + `,,,,`,
+		}, "\n")
+
+		stream, err := api.ImportDevices(context.Background())
+		assert.NoError(err)
+
+		// send the data in two chunks
+		assert.NoError(stream.Send(&pb.ImportDevicesRequest{
+			ApplicationId: app.ID,
+			Format:        pb.DeviceImportFormat_CSV,
+			Data:          []byte(data[:50]),
+		}))
+		assert.NoError(stream.Send(&pb.ImportDevicesRequest{
+			Data: []byte(data[50:]),
+		}))
+		assert.NoError(stream.CloseSend())
+
+		results := make(map[uint32]*pb.ImportDevicesResponse)
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(err)
+			results[resp.Line] = resp
+		}
+
+		assert.Len(results, 5)
+		assert.Equal("", results[2].Error)
+		assert.NotEqual("", results[3].Error)
+		assert.Equal("device-profile and application must be under the same organization", results[4].Error)
+		assert.Equal("", results[5].Error)
+		assert.Equal(storage.ErrOrganizationMaxDeviceCount.Error(), results[6].Error)
+
+		d, err := storage.GetDevice(context.Background(), storage.DB(), lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 1}, false, true)
+		assert.NoError(err)
+		assert.Equal("meter-1", d.Name)
+		assert.Equal(map[string]string{"type": "meter", "vendor": "acme"}, hstoreToMap(d.Tags))
+		assert.Equal(map[string]string{"token": "abc"}, hstoreToMap(d.Variables))
+
+		dk, err := storage.GetDeviceKeys(context.Background(), storage.DB(), d.DevEUI)
+		assert.NoError(err)
+		assert.Equal(lorawan.AES128Key{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, dk.NwkKey)
+
+		d, err = storage.GetDevice(context.Background(), storage.DB(), lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 4}, false, true)
+		assert.NoError(err)
+		assert.Equal("0102030405060704", d.Name)
+
+		for _, devEUI := range [][]byte{{1, 2, 3, 4, 5, 6, 7, 1}, {1, 2, 3, 4, 5, 6, 7, 4}} {
+			pl := <-h.SendManagementNotificationChan
+			assert.Equal(integration.ManagementEventType_CREATE, pl.Type)
+			assert.Equal(devEUI, pl.DevEui)
+		}
+
+		count, err := storage.GetAuditLogCount(context.Background(), storage.DB(), storage.AuditLogFilters{
+			OrganizationID: org.ID,
+			Resource:       auditResourceDevice,
+		})
+		assert.NoError(err)
+		assert.Equal(2, count)
+
+		count, err = storage.GetAuditLogCount(context.Background(), storage.DB(), storage.AuditLogFilters{
+			OrganizationID: org.ID,
+			Resource:       auditResourceDeviceKeys,
+			ResourceID:     "0102030405060701",
+		})
+		assert.NoError(err)
+		assert.Equal(1, count)
+	})
+
+	ts.T().Run("AppKey only", func(t *testing.T) {
+		assert := require.New(t)
+
+		row, err := newDeviceImportRow(context.Background(), 2, app, deviceImportRecord{
+			DevEUI:          "0102030405060706",
+			DeviceProfileID: dpID.String(),
+			AppKey:          "01020304050607080102030405060708",
+		}, map[uuid.UUID]int64{dpID: org.ID})
+		assert.NoError(err)
+		assert.NotNil(row.keys)
+		assert.Equal(lorawan.AES128Key{1, 2, 3, 4, 5, 6, 7, 8, 1, 2, 3, 4, 5, 6, 7, 8}, row.keys.AppKey)
+		assert.Equal(lorawan.AES128Key{}, row.keys.NwkKey)
+	})
+
+	ts.T().Run("Export", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			format   pb.DeviceImportFormat
+			expected string
+		}{
+			{
+				name:   "csv",
+				format: pb.DeviceImportFormat_CSV,
+				expected: strings.Join([]string{
+					`dev_eui,name,device_profile_id,tags,variables,app_key,nwk_key`,
+					`0102030405060704,0102030405060704,` + dpID.String() + `,type=meter,,,`,
+					`0102030405060701,meter-1,` + dpID.String() + `,type=meter;vendor=acme,token=abc,00000000000000000000000000000000,01020304050607080102030405060708`,
+				}, "\n") + "\n",
+			},
+			{
+				name:   "json lines",
+				format: pb.DeviceImportFormat_JSON_LINES,
+				expected: strings.Join([]string{
+					`{"devEUI":"0102030405060704","name":"0102030405060704","deviceProfileID":"` + dpID.String() + `","tags":{"type":"meter"}}`,
+					`{"devEUI":"0102030405060701","name":"meter-1","deviceProfileID":"` + dpID.String() + `","tags":{"type":"meter","vendor":"acme"},"variables":{"token":"abc"},"appKey":"00000000000000000000000000000000","nwkKey":"01020304050607080102030405060708"}`,
+				}, "\n") + "\n",
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+
+				stream, err := api.ExportDevices(context.Background(), &pb.ExportDevicesRequest{
+					ApplicationId: app.ID,
+					Format:        tst.format,
+				})
+				assert.NoError(err)
+
+				var out []byte
+				for {
+					resp, err := stream.Recv()
+					if err == io.EOF {
+						break
+					}
+					assert.NoError(err)
+					out = append(out, resp.Data...)
+				}
+
+				assert.Equal(tst.expected, string(out))
+			})
+		}
+	})
+
+	ts.T().Run("Export without keys access", func(t *testing.T) {
+		assert := require.New(t)
+
+		// only the first validation (the devices access) succeeds
+		validator := &exportTestValidator{}
+		grpcServer := grpc.NewServer()
+		pb.RegisterDeviceServiceServer(grpcServer, NewDeviceAPI(validator))
+
+		ln, err := net.Listen("tcp", "localhost:0")
+		assert.NoError(err)
+		go grpcServer.Serve(ln)
+		defer func() {
+			grpcServer.Stop()
+			ln.Close()
+		}()
+
+		apiClient, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure(), grpc.WithBlock())
+		assert.NoError(err)
+		defer apiClient.Close()
+
+		stream, err := pb.NewDeviceServiceClient(apiClient).ExportDevices(context.Background(), &pb.ExportDevicesRequest{
+			ApplicationId: app.ID,
+			Format:        pb.DeviceImportFormat_CSV,
+		})
+		assert.NoError(err)
+
+		var out []byte
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(err)
+			out = append(out, resp.Data...)
+		}
+
+		assert.Equal(strings.Join([]string{
+			`dev_eui,name,device_profile_id,tags,variables,app_key,nwk_key`,
+			`0102030405060704,0102030405060704,` + dpID.String() + `,type=meter,,,`,
+			`0102030405060701,meter-1,` + dpID.String() + `,type=meter;vendor=acme,token=abc,,`,
+		}, "\n")+"\n", string(out))
+	})
+}
+
+// exportTestValidator only validates the first call.
+type exportTestValidator struct {
+	TestValidator
+	calls int
+}
+
+func (v *exportTestValidator) Validate(ctx context.Context, funcs ...auth.ValidatorFunc) error {
+	v.calls++
+	if v.calls > 1 {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+func TestDecodeKeyValuePairs(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			in:       "",
+			expected: map[string]string{},
+		},
+		{
+			in:       "a=1; b = 2;",
+			expected: map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			in:       "a=1=2",
+			expected: map[string]string{"a": "1=2"},
+		},
+		{
+			in:  "a",
+			err: true,
+		},
+		{
+			in:  "=1",
+			err: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.in, func(t *testing.T) {
+			assert := require.New(t)
+
+			out, err := decodeKeyValuePairs(tst.in)
+			if tst.err {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tst.expected, out)
+		})
+	}
+}
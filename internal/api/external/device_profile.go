@@ -2,6 +2,7 @@ package external
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
@@ -20,6 +21,9 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
 	"github.com/brocaar/chirpstack-application-server/internal/codec"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan/applayer/clocksync"
+	"github.com/brocaar/lorawan/applayer/fragmentation"
+	"github.com/brocaar/lorawan/applayer/multicastsetup"
 )
 
 // DeviceProfileServiceAPI exports the ServiceProfile related functions.
@@ -79,6 +83,11 @@ func (a *DeviceProfileServiceAPI) Create(ctx context.Context, req *pb.CreateDevi
 		},
 	}
 
+	// the packages are enabled by default, using the default fPorts
+	dp.MulticastSetupEnabled, dp.MulticastSetupFPort = appLayerPackageFromPB(req.DeviceProfile.MulticastSetupEnabled, req.DeviceProfile.MulticastSetupFPort, true, multicastsetup.DefaultFPort)
+	dp.FragmentationEnabled, dp.FragmentationFPort = appLayerPackageFromPB(req.DeviceProfile.FragmentationEnabled, req.DeviceProfile.FragmentationFPort, true, fragmentation.DefaultFPort)
+	dp.ClockSyncEnabled, dp.ClockSyncFPort = appLayerPackageFromPB(req.DeviceProfile.ClockSyncEnabled, req.DeviceProfile.ClockSyncFPort, true, clocksync.DefaultFPort)
+
 	for k, v := range req.DeviceProfile.Tags {
 		dp.Tags.Map[k] = sql.NullString{Valid: true, String: v}
 	}
@@ -122,33 +131,39 @@ func (a *DeviceProfileServiceAPI) Get(ctx context.Context, req *pb.GetDeviceProf
 
 	resp := pb.GetDeviceProfileResponse{
 		DeviceProfile: &pb.DeviceProfile{
-			Id:                   dpID.String(),
-			Name:                 dp.Name,
-			OrganizationId:       dp.OrganizationID,
-			NetworkServerId:      dp.NetworkServerID,
-			PayloadCodec:         string(dp.PayloadCodec),
-			PayloadEncoderScript: dp.PayloadEncoderScript,
-			PayloadDecoderScript: dp.PayloadDecoderScript,
-			SupportsClassB:       dp.DeviceProfile.SupportsClassB,
-			ClassBTimeout:        dp.DeviceProfile.ClassBTimeout,
-			PingSlotPeriod:       dp.DeviceProfile.PingSlotPeriod,
-			PingSlotDr:           dp.DeviceProfile.PingSlotDr,
-			PingSlotFreq:         dp.DeviceProfile.PingSlotFreq,
-			SupportsClassC:       dp.DeviceProfile.SupportsClassC,
-			ClassCTimeout:        dp.DeviceProfile.ClassCTimeout,
-			MacVersion:           dp.DeviceProfile.MacVersion,
-			RegParamsRevision:    dp.DeviceProfile.RegParamsRevision,
-			RxDelay_1:            dp.DeviceProfile.RxDelay_1,
-			RxDrOffset_1:         dp.DeviceProfile.RxDrOffset_1,
-			RxDatarate_2:         dp.DeviceProfile.RxDatarate_2,
-			RxFreq_2:             dp.DeviceProfile.RxFreq_2,
-			MaxEirp:              dp.DeviceProfile.MaxEirp,
-			MaxDutyCycle:         dp.DeviceProfile.MaxDutyCycle,
-			SupportsJoin:         dp.DeviceProfile.SupportsJoin,
-			RfRegion:             dp.DeviceProfile.RfRegion,
-			Supports_32BitFCnt:   dp.DeviceProfile.Supports_32BitFCnt,
-			FactoryPresetFreqs:   dp.DeviceProfile.FactoryPresetFreqs,
-			Tags:                 make(map[string]string),
+			Id:                    dpID.String(),
+			Name:                  dp.Name,
+			OrganizationId:        dp.OrganizationID,
+			NetworkServerId:       dp.NetworkServerID,
+			PayloadCodec:          string(dp.PayloadCodec),
+			PayloadEncoderScript:  dp.PayloadEncoderScript,
+			PayloadDecoderScript:  dp.PayloadDecoderScript,
+			MulticastSetupEnabled: dp.MulticastSetupEnabled,
+			MulticastSetupFPort:   uint32(dp.MulticastSetupFPort),
+			FragmentationEnabled:  dp.FragmentationEnabled,
+			FragmentationFPort:    uint32(dp.FragmentationFPort),
+			ClockSyncEnabled:      dp.ClockSyncEnabled,
+			ClockSyncFPort:        uint32(dp.ClockSyncFPort),
+			SupportsClassB:        dp.DeviceProfile.SupportsClassB,
+			ClassBTimeout:         dp.DeviceProfile.ClassBTimeout,
+			PingSlotPeriod:        dp.DeviceProfile.PingSlotPeriod,
+			PingSlotDr:            dp.DeviceProfile.PingSlotDr,
+			PingSlotFreq:          dp.DeviceProfile.PingSlotFreq,
+			SupportsClassC:        dp.DeviceProfile.SupportsClassC,
+			ClassCTimeout:         dp.DeviceProfile.ClassCTimeout,
+			MacVersion:            dp.DeviceProfile.MacVersion,
+			RegParamsRevision:     dp.DeviceProfile.RegParamsRevision,
+			RxDelay_1:             dp.DeviceProfile.RxDelay_1,
+			RxDrOffset_1:          dp.DeviceProfile.RxDrOffset_1,
+			RxDatarate_2:          dp.DeviceProfile.RxDatarate_2,
+			RxFreq_2:              dp.DeviceProfile.RxFreq_2,
+			MaxEirp:               dp.DeviceProfile.MaxEirp,
+			MaxDutyCycle:          dp.DeviceProfile.MaxDutyCycle,
+			SupportsJoin:          dp.DeviceProfile.SupportsJoin,
+			RfRegion:              dp.DeviceProfile.RfRegion,
+			Supports_32BitFCnt:    dp.DeviceProfile.Supports_32BitFCnt,
+			FactoryPresetFreqs:    dp.DeviceProfile.FactoryPresetFreqs,
+			Tags:                  make(map[string]string),
 		},
 	}
 
@@ -198,6 +213,9 @@ func (a *DeviceProfileServiceAPI) Update(ctx context.Context, req *pb.UpdateDevi
 		dp.PayloadCodec = codec.Type(req.DeviceProfile.PayloadCodec)
 		dp.PayloadEncoderScript = req.DeviceProfile.PayloadEncoderScript
 		dp.PayloadDecoderScript = req.DeviceProfile.PayloadDecoderScript
+		dp.MulticastSetupEnabled, dp.MulticastSetupFPort = appLayerPackageFromPB(req.DeviceProfile.MulticastSetupEnabled, req.DeviceProfile.MulticastSetupFPort, dp.MulticastSetupEnabled, dp.MulticastSetupFPort)
+		dp.FragmentationEnabled, dp.FragmentationFPort = appLayerPackageFromPB(req.DeviceProfile.FragmentationEnabled, req.DeviceProfile.FragmentationFPort, dp.FragmentationEnabled, dp.FragmentationFPort)
+		dp.ClockSyncEnabled, dp.ClockSyncFPort = appLayerPackageFromPB(req.DeviceProfile.ClockSyncEnabled, req.DeviceProfile.ClockSyncFPort, dp.ClockSyncEnabled, dp.ClockSyncFPort)
 		dp.Tags = hstore.Hstore{
 			Map: make(map[string]sql.NullString),
 		}
@@ -347,3 +365,86 @@ func (a *DeviceProfileServiceAPI) List(ctx context.Context, req *pb.ListDevicePr
 
 	return &resp, nil
 }
+
+// ListPayloadCodecs lists the available payload codecs.
+func (a *DeviceProfileServiceAPI) ListPayloadCodecs(ctx context.Context, req *empty.Empty) (*pb.ListPayloadCodecsResponse, error) {
+	if _, err := a.validator.GetSubject(ctx); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	var resp pb.ListPayloadCodecsResponse
+	for _, c := range codec.List() {
+		resp.Result = append(resp.Result, &pb.PayloadCodecListItem{
+			Type:           string(c.Type()),
+			Name:           c.Name(),
+			SupportsDecode: c.Capabilities()&codec.Decode != 0,
+			SupportsEncode: c.Capabilities()&codec.Encode != 0,
+		})
+	}
+
+	return &resp, nil
+}
+
+// TestPayloadCodec executes the given payload codec against the given
+// payload, without storing the codec configuration.
+func (a *DeviceProfileServiceAPI) TestPayloadCodec(ctx context.Context, req *pb.TestPayloadCodecRequest) (*pb.TestPayloadCodecResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceProfilesAccess(auth.Create, req.OrganizationId, 0),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if req.FPort > 255 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "fPort must be between 0 - 255")
+	}
+
+	codecType := codec.Type(req.PayloadCodec)
+	if _, err := codec.Get(codecType); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	variables := hstore.Hstore{
+		Map: make(map[string]sql.NullString),
+	}
+	for k, v := range req.Variables {
+		variables.Map[k] = sql.NullString{String: v, Valid: true}
+	}
+
+	var resp pb.TestPayloadCodecResponse
+	var err error
+	start := time.Now()
+
+	switch pl := req.Payload.(type) {
+	case *pb.TestPayloadCodecRequest_Data:
+		var b []byte
+		b, err = codec.BinaryToJSON(codecType, uint8(req.FPort), variables, req.Script, pl.Data)
+		resp.JsonObject = string(b)
+	case *pb.TestPayloadCodecRequest_JsonObject:
+		resp.Data, err = codec.JSONToBinary(codecType, uint8(req.FPort), variables, req.Script, []byte(pl.JsonObject))
+	default:
+		return nil, grpc.Errorf(codes.InvalidArgument, "data or jsonObject expected")
+	}
+
+	resp.ExecutionTime = ptypes.DurationProto(time.Since(start))
+
+	if err != nil {
+		resp.Error = err.Error()
+		if line, column, ok := codec.ErrorPosition(err); ok {
+			resp.ErrorLine = uint32(line)
+			resp.ErrorColumn = uint32(column)
+		}
+	}
+
+	return &resp, nil
+}
+
+// appLayerPackageFromPB returns the enabled flag and fPort of an application
+// layer package. API clients that predate these fields do not set the fPort
+// (which is never valid for an enabled package), in which case the given
+// current (or default) values are returned.
+func appLayerPackageFromPB(enabled bool, fPort uint32, curEnabled bool, curFPort uint8) (bool, uint8) {
+	if fPort == 0 {
+		return curEnabled, curFPort
+	}
+	return enabled, uint8(fPort)
+}
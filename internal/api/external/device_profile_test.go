@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	uuid "github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
@@ -99,7 +100,14 @@ func (ts *APITestSuite) TestDeviceProfile() {
 			})
 			assert.NoError(err)
 
+			// the application layer packages are enabled by default
 			createReq.DeviceProfile.Id = createResp.Id
+			createReq.DeviceProfile.MulticastSetupEnabled = true
+			createReq.DeviceProfile.MulticastSetupFPort = 200
+			createReq.DeviceProfile.FragmentationEnabled = true
+			createReq.DeviceProfile.FragmentationFPort = 201
+			createReq.DeviceProfile.ClockSyncEnabled = true
+			createReq.DeviceProfile.ClockSyncFPort = 202
 			assert.Equal(createReq.DeviceProfile, getResp.DeviceProfile)
 		})
 
@@ -130,6 +138,8 @@ func (ts *APITestSuite) TestDeviceProfile() {
 					SupportsJoin:       true,
 					RfRegion:           "EU868",
 					Supports_32BitFCnt: true,
+					ClockSyncEnabled:   false,
+					ClockSyncFPort:     202,
 					Tags: map[string]string{
 						"alice": "bob",
 					},
@@ -148,6 +158,12 @@ func (ts *APITestSuite) TestDeviceProfile() {
 				Id: createResp.Id,
 			})
 			assert.NoError(err)
+
+			// the packages without fPort keep their stored values
+			updateReq.DeviceProfile.MulticastSetupEnabled = true
+			updateReq.DeviceProfile.MulticastSetupFPort = 200
+			updateReq.DeviceProfile.FragmentationEnabled = true
+			updateReq.DeviceProfile.FragmentationFPort = 201
 			assert.Equal(updateReq.DeviceProfile, getResp.DeviceProfile)
 		})
 
@@ -307,4 +323,99 @@ func (ts *APITestSuite) TestDeviceProfile() {
 			assert.Equal(codes.NotFound, grpc.Code(err))
 		})
 	})
+	ts.T().Run("ListPayloadCodecs", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.ListPayloadCodecs(context.Background(), &empty.Empty{})
+		assert.NoError(err)
+		assert.Equal([]*pb.PayloadCodecListItem{
+			{
+				Type:           "CAYENNE_LPP",
+				Name:           "Cayenne LPP",
+				SupportsDecode: true,
+				SupportsEncode: true,
+			},
+			{
+				Type:           "CUSTOM_JS",
+				Name:           "Custom JavaScript codec functions",
+				SupportsDecode: true,
+				SupportsEncode: true,
+			},
+		}, resp.Result)
+	})
+	ts.T().Run("TestPayloadCodec", func(t *testing.T) {
+		t.Run("Decode", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.TestPayloadCodec(context.Background(), &pb.TestPayloadCodecRequest{
+				OrganizationId: org.ID,
+				PayloadCodec:   "CUSTOM_JS",
+				Script: `
+					function Decode(fPort, bytes, variables) {
+						return {"port": fPort, "value": bytes[0], "unit": variables["unit"]};
+					}
+				`,
+				FPort:     10,
+				Variables: map[string]string{"unit": "C"},
+				Payload: &pb.TestPayloadCodecRequest_Data{
+					Data: []byte{21},
+				},
+			})
+			assert.NoError(err)
+			assert.Equal(`{"port":10,"unit":"C","value":21}`, resp.JsonObject)
+			assert.Equal("", resp.Error)
+			assert.NotNil(resp.ExecutionTime)
+		})
+
+		t.Run("Encode", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.TestPayloadCodec(context.Background(), &pb.TestPayloadCodecRequest{
+				OrganizationId: org.ID,
+				PayloadCodec:   "CUSTOM_JS",
+				Script: `
+					function Encode(fPort, obj) {
+						return [obj.value];
+					}
+				`,
+				FPort: 10,
+				Payload: &pb.TestPayloadCodecRequest_JsonObject{
+					JsonObject: `{"value": 21}`,
+				},
+			})
+			assert.NoError(err)
+			assert.Equal([]byte{21}, resp.Data)
+			assert.Equal("", resp.Error)
+		})
+
+		t.Run("Script error", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.TestPayloadCodec(context.Background(), &pb.TestPayloadCodecRequest{
+				OrganizationId: org.ID,
+				PayloadCodec:   "CUSTOM_JS",
+				Script:         "function Decode(fPort, bytes) {\n  return {;\n}",
+				FPort:          10,
+				Payload: &pb.TestPayloadCodecRequest_Data{
+					Data: []byte{21},
+				},
+			})
+			assert.NoError(err)
+			assert.NotEqual("", resp.Error)
+			assert.EqualValues(2, resp.ErrorLine)
+		})
+
+		t.Run("Unknown codec", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.TestPayloadCodec(context.Background(), &pb.TestPayloadCodecRequest{
+				OrganizationId: org.ID,
+				PayloadCodec:   "UNKNOWN",
+				Payload: &pb.TestPayloadCodecRequest_Data{
+					Data: []byte{21},
+				},
+			})
+			assert.Equal(codes.InvalidArgument, grpc.Code(err))
+		})
+	})
 }
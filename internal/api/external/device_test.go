@@ -667,6 +667,31 @@ func (ts *APITestSuite) TestDevice() {
 
 				resp := <-respChan
 				assert.Equal(eventlog.Join, resp.Type)
+				assert.NotEqual("", resp.Id)
+			})
+
+			t.Run("ListEventLogs", func(t *testing.T) {
+				assert := require.New(t)
+
+				assert.NoError(eventlog.LogEventForDevice(lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1}, eventlog.Uplink, &integration.UplinkEvent{}))
+
+				resp, err := api.ListEventLogs(context.Background(), &pb.ListDeviceEventLogsRequest{
+					DevEui: "0807060504030201",
+					Limit:  1,
+				})
+				assert.NoError(err)
+				assert.EqualValues(2, resp.TotalCount)
+				assert.Len(resp.Result, 1)
+				assert.Equal(eventlog.Uplink, resp.Result[0].Type)
+
+				resp, err = api.ListEventLogs(context.Background(), &pb.ListDeviceEventLogsRequest{
+					DevEui: "0807060504030201",
+					Limit:  10,
+					Before: resp.Result[0].Id,
+				})
+				assert.NoError(err)
+				assert.Len(resp.Result, 1)
+				assert.Equal(eventlog.Join, resp.Result[0].Type)
 			})
 
 			t.Run("Delete", func(t *testing.T) {
@@ -38,6 +38,9 @@ var (
 	openIDConnectEnabled    bool
 	registrationEnabled     bool
 	registrationCallbackURL string
+	oidcGroupMappings       []config.OIDCGroupMapping
+	mfaIssuer               = "ChirpStack"
+	mfaRequireForAdmins     bool
 
 	bind            string
 	tlsCert         string
@@ -60,6 +63,11 @@ func Setup(conf config.Config) error {
 	registrationCallbackURL = conf.ApplicationServer.UserAuthentication.OpenIDConnect.RegistrationCallbackURL
 	openIDConnectEnabled = conf.ApplicationServer.UserAuthentication.OpenIDConnect.Enabled
 	openIDLoginLabel = conf.ApplicationServer.UserAuthentication.OpenIDConnect.LoginLabel
+	oidcGroupMappings = conf.ApplicationServer.UserAuthentication.OpenIDConnect.GroupMappings
+	if conf.ApplicationServer.UserAuthentication.MFA.Issuer != "" {
+		mfaIssuer = conf.ApplicationServer.UserAuthentication.MFA.Issuer
+	}
+	mfaRequireForAdmins = conf.ApplicationServer.UserAuthentication.MFA.RequireForAdmins
 
 	bind = conf.ApplicationServer.ExternalAPI.Bind
 	tlsCert = conf.ApplicationServer.ExternalAPI.TLSCert
@@ -96,6 +104,10 @@ func setupAPI(conf config.Config) error {
 	pb.RegisterDeviceProfileServiceServer(grpcServer, NewDeviceProfileServiceAPI(validator))
 	pb.RegisterMulticastGroupServiceServer(grpcServer, NewMulticastGroupAPI(validator, rpID))
 	pb.RegisterFUOTADeploymentServiceServer(grpcServer, NewFUOTADeploymentAPI(validator))
+	pb.RegisterAuditLogServiceServer(grpcServer, NewAuditLogAPI(validator))
+	pb.RegisterDeviceAlertRuleServiceServer(grpcServer, NewDeviceAlertRuleAPI(validator))
+	pb.RegisterOrganizationIntegrationServiceServer(grpcServer, NewOrganizationIntegrationAPI(validator))
+	pb.RegisterFirmwareImageServiceServer(grpcServer, NewFirmwareImageAPI(validator))
 
 	// setup the client http interface variable
 	// we need to start the gRPC service first, as it is used by the
@@ -270,6 +282,18 @@ func getJSONGateway(ctx context.Context) (http.Handler, error) {
 	if err := pb.RegisterFUOTADeploymentServiceHandlerFromEndpoint(ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
 		return nil, errors.Wrap(err, "register fuota deployment handler error")
 	}
+	if err := pb.RegisterAuditLogServiceHandlerFromEndpoint(ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
+		return nil, errors.Wrap(err, "register audit-log handler error")
+	}
+	if err := pb.RegisterDeviceAlertRuleServiceHandlerFromEndpoint(ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
+		return nil, errors.Wrap(err, "register device alert-rule handler error")
+	}
+	if err := pb.RegisterOrganizationIntegrationServiceHandlerFromEndpoint(ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
+		return nil, errors.Wrap(err, "register organization integration handler error")
+	}
+	if err := pb.RegisterFirmwareImageServiceHandlerFromEndpoint(ctx, mux, apiEndpoint, grpcDialOpts); err != nil {
+		return nil, errors.Wrap(err, "register firmware image handler error")
+	}
 
 	return mux, nil
 }
@@ -0,0 +1,202 @@
+package external
+
+import (
+	"encoding/hex"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+// FirmwareImageAPI exports the firmware image related functions.
+type FirmwareImageAPI struct {
+	validator auth.Validator
+}
+
+// NewFirmwareImageAPI creates a new FirmwareImageAPI.
+func NewFirmwareImageAPI(validator auth.Validator) *FirmwareImageAPI {
+	return &FirmwareImageAPI{
+		validator: validator,
+	}
+}
+
+// Create uploads the given firmware image.
+func (a *FirmwareImageAPI) Create(ctx context.Context, req *pb.CreateFirmwareImageRequest) (*pb.CreateFirmwareImageResponse, error) {
+	if req.FirmwareImage == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "firmware_image must not be nil")
+	}
+
+	dpID, err := uuid.FromString(req.FirmwareImage.DeviceProfileId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "device_profile_id: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceProfileAccess(auth.Update, dpID)); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	fi := storage.FirmwareImage{
+		DeviceProfileID: dpID,
+		Version:         req.FirmwareImage.Version,
+		ReleaseNotes:    req.FirmwareImage.ReleaseNotes,
+		Payload:         req.FirmwareImage.Payload,
+	}
+
+	if req.FirmwareImage.Checksum != "" {
+		fi.Checksum, err = hex.DecodeString(req.FirmwareImage.Checksum)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "checksum: %s", err)
+		}
+	}
+
+	if err := storage.CreateFirmwareImage(ctx, storage.DB(), &fi); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.CreateFirmwareImageResponse{
+		Id: fi.ID.String(),
+	}, nil
+}
+
+// Get returns the firmware image matching the given ID.
+func (a *FirmwareImageAPI) Get(ctx context.Context, req *pb.GetFirmwareImageRequest) (*pb.GetFirmwareImageResponse, error) {
+	fi, err := a.getFirmwareImage(ctx, req.Id, auth.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := pb.GetFirmwareImageResponse{
+		FirmwareImage: &pb.FirmwareImage{
+			Id:              fi.ID.String(),
+			DeviceProfileId: fi.DeviceProfileID.String(),
+			Version:         fi.Version,
+			Checksum:        hex.EncodeToString(fi.Checksum),
+			ReleaseNotes:    fi.ReleaseNotes,
+			Payload:         fi.Payload,
+		},
+	}
+
+	resp.CreatedAt, err = ptypes.TimestampProto(fi.CreatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	resp.UpdatedAt, err = ptypes.TimestampProto(fi.UpdatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &resp, nil
+}
+
+// Update updates the release notes of the given firmware image.
+func (a *FirmwareImageAPI) Update(ctx context.Context, req *pb.UpdateFirmwareImageRequest) (*empty.Empty, error) {
+	if req.FirmwareImage == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "firmware_image must not be nil")
+	}
+
+	fi, err := a.getFirmwareImage(ctx, req.FirmwareImage.Id, auth.Update)
+	if err != nil {
+		return nil, err
+	}
+
+	fi.ReleaseNotes = req.FirmwareImage.ReleaseNotes
+
+	if err := storage.UpdateFirmwareImage(ctx, storage.DB(), &fi); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// Delete deletes the firmware image matching the given ID.
+func (a *FirmwareImageAPI) Delete(ctx context.Context, req *pb.DeleteFirmwareImageRequest) (*empty.Empty, error) {
+	fi, err := a.getFirmwareImage(ctx, req.Id, auth.Delete)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.DeleteFirmwareImage(ctx, storage.DB(), fi.ID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// List lists the firmware images for the given device-profile ID.
+func (a *FirmwareImageAPI) List(ctx context.Context, req *pb.ListFirmwareImageRequest) (*pb.ListFirmwareImageResponse, error) {
+	dpID, err := uuid.FromString(req.DeviceProfileId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "device_profile_id: %s", err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceProfileAccess(auth.Read, dpID)); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	count, err := storage.GetFirmwareImageCount(ctx, storage.DB(), dpID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	images, err := storage.GetFirmwareImages(ctx, storage.DB(), dpID, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListFirmwareImageResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, fi := range images {
+		item := pb.FirmwareImageListItem{
+			Id:              fi.ID.String(),
+			DeviceProfileId: fi.DeviceProfileID.String(),
+			Version:         fi.Version,
+			Checksum:        hex.EncodeToString(fi.Checksum),
+		}
+
+		item.CreatedAt, err = ptypes.TimestampProto(fi.CreatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+		item.UpdatedAt, err = ptypes.TimestampProto(fi.UpdatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		resp.Result = append(resp.Result, &item)
+	}
+
+	return &resp, nil
+}
+
+// getFirmwareImage returns the firmware image for the given ID, after
+// validating that the client has access to its device-profile.
+func (a *FirmwareImageAPI) getFirmwareImage(ctx context.Context, id string, flag auth.Flag) (storage.FirmwareImage, error) {
+	fiID, err := uuid.FromString(id)
+	if err != nil {
+		return storage.FirmwareImage{}, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	fi, err := storage.GetFirmwareImage(ctx, storage.DB(), fiID)
+	if err != nil {
+		return fi, helpers.ErrToRPCError(err)
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateDeviceProfileAccess(flag, fi.DeviceProfileID)); err != nil {
+		return fi, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	return fi, nil
+}
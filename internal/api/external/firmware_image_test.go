@@ -0,0 +1,141 @@
+package external
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+func (ts *APITestSuite) TestFirmwareImage() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	validator := &TestValidator{}
+	api := NewFirmwareImageAPI(validator)
+
+	n := storage.NetworkServer{
+		Name:   "test",
+		Server: "test:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	dp := storage.DeviceProfile{
+		Name:            "test-dp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
+	var dpID uuid.UUID
+	copy(dpID[:], dp.DeviceProfile.Id)
+
+	payload := []byte{1, 2, 3, 4, 5}
+	checksum := sha256.Sum256(payload)
+
+	ts.T().Run("Create invalid checksum", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(context.Background(), &pb.CreateFirmwareImageRequest{
+			FirmwareImage: &pb.FirmwareImage{
+				DeviceProfileId: dpID.String(),
+				Version:         "1.0.0",
+				Checksum:        "010203",
+				Payload:         payload,
+			},
+		})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	})
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		fi := pb.FirmwareImage{
+			DeviceProfileId: dpID.String(),
+			Version:         "1.0.0",
+			Checksum:        hex.EncodeToString(checksum[:]),
+			ReleaseNotes:    "Initial release.",
+			Payload:         payload,
+		}
+
+		createResp, err := api.Create(context.Background(), &pb.CreateFirmwareImageRequest{
+			FirmwareImage: &fi,
+		})
+		assert.NoError(err)
+		assert.NotEqual("", createResp.Id)
+		fi.Id = createResp.Id
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.Get(context.Background(), &pb.GetFirmwareImageRequest{
+				Id: fi.Id,
+			})
+			assert.NoError(err)
+			assert.Equal(&fi, resp.FirmwareImage)
+			assert.NotNil(resp.CreatedAt)
+			assert.NotNil(resp.UpdatedAt)
+		})
+
+		t.Run("List", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.List(context.Background(), &pb.ListFirmwareImageRequest{
+				DeviceProfileId: dpID.String(),
+				Limit:           10,
+			})
+			assert.NoError(err)
+			assert.EqualValues(1, resp.TotalCount)
+			assert.Len(resp.Result, 1)
+			assert.Equal(fi.Id, resp.Result[0].Id)
+			assert.Equal(fi.Version, resp.Result[0].Version)
+			assert.Equal(fi.Checksum, resp.Result[0].Checksum)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			fi.ReleaseNotes = "Updated release notes."
+			_, err := api.Update(context.Background(), &pb.UpdateFirmwareImageRequest{
+				FirmwareImage: &fi,
+			})
+			assert.NoError(err)
+
+			resp, err := api.Get(context.Background(), &pb.GetFirmwareImageRequest{
+				Id: fi.Id,
+			})
+			assert.NoError(err)
+			assert.Equal(fi.ReleaseNotes, resp.FirmwareImage.ReleaseNotes)
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Delete(context.Background(), &pb.DeleteFirmwareImageRequest{
+				Id: fi.Id,
+			})
+			assert.NoError(err)
+
+			_, err = api.Get(context.Background(), &pb.GetFirmwareImageRequest{
+				Id: fi.Id,
+			})
+			assert.Equal(codes.NotFound, grpc.Code(err))
+		})
+	})
+}
@@ -1,10 +1,13 @@
 package external
 
 import (
+	"database/sql"
+
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq/hstore"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -14,6 +17,7 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
 	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/fuota"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 	"github.com/brocaar/lorawan"
 	"github.com/brocaar/lorawan/band"
@@ -52,108 +56,88 @@ func (f *FUOTADeploymentAPI) CreateForDevice(ctx context.Context, req *pb.Create
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	nsClient, err := networkserver.GetPool().Get(n.Server, []byte(n.CACert), []byte(n.TLSCert), []byte(n.TLSKey))
+	fd, err := fuotaDeploymentFromPB(ctx, n, req.FuotaDeployment)
 	if err != nil {
-		return nil, helpers.ErrToRPCError(err)
+		return nil, err
 	}
 
-	versionResp, err := nsClient.GetVersion(ctx, &empty.Empty{})
+	err = storage.Transaction(func(db sqlx.Ext) error {
+		return storage.CreateFUOTADeploymentForDevice(ctx, db, &fd, devEUI)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	var b band.Band
+	return &pb.CreateFUOTADeploymentForDeviceResponse{
+		Id: fd.ID.String(),
+	}, nil
+}
 
-	switch versionResp.Region {
-	case common.Region_EU868:
-		b, err = band.GetConfig(band.EU868, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_US915:
-		b, err = band.GetConfig(band.US915, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_CN779:
-		b, err = band.GetConfig(band.CN779, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_EU433:
-		b, err = band.GetConfig(band.EU433, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_AU915:
-		b, err = band.GetConfig(band.AU915, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_CN470:
-		b, err = band.GetConfig(band.CN470, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_AS923:
-		b, err = band.GetConfig(band.AS923, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_KR920:
-		b, err = band.GetConfig(band.KR920, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
-		}
-	case common.Region_IN865:
-		b, err = band.GetConfig(band.IN865, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
+// CreateForApplication creates a deployment for the devices of the given
+// application, optionally filtered by device-profile, tags or DevEUIs.
+func (f *FUOTADeploymentAPI) CreateForApplication(ctx context.Context, req *pb.CreateFUOTADeploymentForApplicationRequest) (*pb.CreateFUOTADeploymentForApplicationResponse, error) {
+	if req.FuotaDeployment == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "fuota_deployment must not be nil")
+	}
+
+	if err := f.validator.Validate(ctx,
+		auth.ValidateFUOTADeploymentsAccess(auth.Create, req.ApplicationId, lorawan.EUI64{})); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	target := storage.FUOTADeploymentTarget{
+		ApplicationID: req.ApplicationId,
+		Tags: hstore.Hstore{
+			Map: make(map[string]sql.NullString),
+		},
+	}
+
+	if req.DeviceProfileId != "" {
+		if err := target.DeviceProfileID.UnmarshalText([]byte(req.DeviceProfileId)); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "device_profile_id: %s", err)
 		}
-	case common.Region_RU864:
-		b, err = band.GetConfig(band.RU864, false, lorawan.DwellTimeNoLimit)
-		if err != nil {
-			return nil, helpers.ErrToRPCError(err)
+	}
+
+	for k, v := range req.Tags {
+		target.Tags.Map[k] = sql.NullString{String: v, Valid: true}
+	}
+
+	for _, s := range req.DevEuis {
+		var devEUI lorawan.EUI64
+		if err := devEUI.UnmarshalText([]byte(s)); err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "dev_euis: %s", err)
 		}
-	default:
-		return nil, grpc.Errorf(codes.Internal, "region %s is not implemented", versionResp.Region)
+		target.DevEUIs = append(target.DevEUIs, devEUI)
 	}
 
-	maxPLSize, err := b.GetMaxPayloadSizeForDataRateIndex("", "", int(req.FuotaDeployment.Dr))
+	app, err := storage.GetApplication(ctx, storage.DB(), req.ApplicationId)
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	fd := storage.FUOTADeployment{
-		Name:             req.FuotaDeployment.Name,
-		DR:               int(req.FuotaDeployment.Dr),
-		Frequency:        int(req.FuotaDeployment.Frequency),
-		Payload:          req.FuotaDeployment.Payload,
-		FragSize:         maxPLSize.N - 3,
-		Redundancy:       int(req.FuotaDeployment.Redundancy),
-		MulticastTimeout: int(req.FuotaDeployment.MulticastTimeout),
-	}
-
-	switch req.FuotaDeployment.GroupType {
-	case pb.MulticastGroupType_CLASS_C:
-		fd.GroupType = storage.FUOTADeploymentGroupTypeC
-	default:
-		return nil, grpc.Errorf(codes.InvalidArgument, "group_type %s is not supported", req.FuotaDeployment.GroupType)
+	n, err := storage.GetNetworkServerForServiceProfileID(ctx, storage.DB(), app.ServiceProfileID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
 	}
 
-	fd.UnicastTimeout, err = ptypes.Duration(req.FuotaDeployment.UnicastTimeout)
+	fd, err := fuotaDeploymentFromPB(ctx, n, req.FuotaDeployment)
 	if err != nil {
-		return nil, grpc.Errorf(codes.InvalidArgument, "unicast_timeout: %s", err)
+		return nil, err
 	}
 
 	err = storage.Transaction(func(db sqlx.Ext) error {
-		return storage.CreateFUOTADeploymentForDevice(ctx, db, &fd, devEUI)
+		devEUIs, err := storage.GetDevEUIsForFUOTADeploymentTarget(ctx, db, target)
+		if err != nil {
+			return err
+		}
+
+		return storage.CreateFUOTADeployment(ctx, db, &fd, devEUIs)
 	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	return &pb.CreateFUOTADeploymentForDeviceResponse{
+	return &pb.CreateFUOTADeploymentForApplicationResponse{
 		Id: fd.ID.String(),
 	}, nil
 }
@@ -179,18 +163,27 @@ func (f *FUOTADeploymentAPI) Get(ctx context.Context, req *pb.GetFUOTADeployment
 
 	resp := pb.GetFUOTADeploymentResponse{
 		FuotaDeployment: &pb.FUOTADeployment{
-			Id:               fd.ID.String(),
-			Name:             fd.Name,
-			Dr:               uint32(fd.DR),
-			Frequency:        uint32(fd.Frequency),
-			Payload:          fd.Payload,
-			Redundancy:       uint32(fd.Redundancy),
-			MulticastTimeout: uint32(fd.MulticastTimeout),
-			UnicastTimeout:   ptypes.DurationProto(fd.UnicastTimeout),
-			State:            string(fd.State),
+			Id:                     fd.ID.String(),
+			Name:                   fd.Name,
+			Dr:                     uint32(fd.DR),
+			Frequency:              uint32(fd.Frequency),
+			PingSlotPeriod:         uint32(fd.PingSlotPeriod),
+			Payload:                fd.Payload,
+			Redundancy:             uint32(fd.Redundancy),
+			MulticastTimeout:       uint32(fd.MulticastTimeout),
+			UnicastTimeout:         ptypes.DurationProto(fd.UnicastTimeout),
+			UnicastRetransmissions: uint32(fd.UnicastRetransmissions),
+			State:                  string(fd.State),
 		},
 	}
 
+	if fd.FirmwareImageID != nil {
+		resp.FuotaDeployment.FirmwareImageId = fd.FirmwareImageID.String()
+	}
+	if fd.PausedAt != nil {
+		resp.FuotaDeployment.Paused = true
+	}
+
 	resp.CreatedAt, err = ptypes.TimestampProto(fd.CreatedAt)
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
@@ -402,6 +395,44 @@ func (f *FUOTADeploymentAPI) ListDeploymentDevices(ctx context.Context, req *pb.
 	return &out, nil
 }
 
+// Cancel cancels the fuota deployment for the given id.
+func (f *FUOTADeploymentAPI) Cancel(ctx context.Context, req *pb.CancelFUOTADeploymentRequest) (*empty.Empty, error) {
+	return f.updateDeployment(ctx, req.Id, fuota.CancelDeployment)
+}
+
+// Pause pauses the fuota deployment for the given id.
+func (f *FUOTADeploymentAPI) Pause(ctx context.Context, req *pb.PauseFUOTADeploymentRequest) (*empty.Empty, error) {
+	return f.updateDeployment(ctx, req.Id, fuota.PauseDeployment)
+}
+
+// Resume resumes the paused fuota deployment for the given id.
+func (f *FUOTADeploymentAPI) Resume(ctx context.Context, req *pb.ResumeFUOTADeploymentRequest) (*empty.Empty, error) {
+	return f.updateDeployment(ctx, req.Id, fuota.ResumeDeployment)
+}
+
+func (f *FUOTADeploymentAPI) updateDeployment(ctx context.Context, fuotaDeploymentID string, update func(context.Context, sqlx.Ext, uuid.UUID) error) (*empty.Empty, error) {
+	id, err := uuid.FromString(fuotaDeploymentID)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "id: %s", err)
+	}
+
+	err = f.validator.Validate(ctx,
+		auth.ValidateFUOTADeploymentAccess(auth.Update, id),
+	)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	err = storage.Transaction(func(db sqlx.Ext) error {
+		return update(ctx, db, id)
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
 func (f *FUOTADeploymentAPI) returnList(count int, deployments []storage.FUOTADeploymentListItem) (*pb.ListFUOTADeploymentResponse, error) {
 	var err error
 
@@ -411,9 +442,10 @@ func (f *FUOTADeploymentAPI) returnList(count int, deployments []storage.FUOTADe
 
 	for _, fd := range deployments {
 		item := pb.FUOTADeploymentListItem{
-			Id:    fd.ID.String(),
-			Name:  fd.Name,
-			State: string(fd.State),
+			Id:     fd.ID.String(),
+			Name:   fd.Name,
+			State:  string(fd.State),
+			Paused: fd.PausedAt != nil,
 		}
 
 		item.CreatedAt, err = ptypes.TimestampProto(fd.CreatedAt)
@@ -434,3 +466,129 @@ func (f *FUOTADeploymentAPI) returnList(count int, deployments []storage.FUOTADe
 
 	return &resp, nil
 }
+
+// fuotaDeploymentFromPB returns the storage.FUOTADeployment for the given
+// pb.FUOTADeployment. The fragment size is set to the max. payload size
+// of the data-rate, for the region of the given network-server.
+func fuotaDeploymentFromPB(ctx context.Context, n storage.NetworkServer, pbfd *pb.FUOTADeployment) (storage.FUOTADeployment, error) {
+	var fd storage.FUOTADeployment
+
+	nsClient, err := networkserver.GetPool().Get(n.Server, []byte(n.CACert), []byte(n.TLSCert), []byte(n.TLSKey))
+	if err != nil {
+		return fd, helpers.ErrToRPCError(err)
+	}
+
+	versionResp, err := nsClient.GetVersion(ctx, &empty.Empty{})
+	if err != nil {
+		return fd, helpers.ErrToRPCError(err)
+	}
+
+	var b band.Band
+
+	switch versionResp.Region {
+	case common.Region_EU868:
+		b, err = band.GetConfig(band.EU868, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_US915:
+		b, err = band.GetConfig(band.US915, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_CN779:
+		b, err = band.GetConfig(band.CN779, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_EU433:
+		b, err = band.GetConfig(band.EU433, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_AU915:
+		b, err = band.GetConfig(band.AU915, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_CN470:
+		b, err = band.GetConfig(band.CN470, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_AS923:
+		b, err = band.GetConfig(band.AS923, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_KR920:
+		b, err = band.GetConfig(band.KR920, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_IN865:
+		b, err = band.GetConfig(band.IN865, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	case common.Region_RU864:
+		b, err = band.GetConfig(band.RU864, false, lorawan.DwellTimeNoLimit)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+	default:
+		return fd, grpc.Errorf(codes.Internal, "region %s is not implemented", versionResp.Region)
+	}
+
+	maxPLSize, err := b.GetMaxPayloadSizeForDataRateIndex("", "", int(pbfd.Dr))
+	if err != nil {
+		return fd, helpers.ErrToRPCError(err)
+	}
+
+	fd = storage.FUOTADeployment{
+		Name:                   pbfd.Name,
+		DR:                     int(pbfd.Dr),
+		Frequency:              int(pbfd.Frequency),
+		Payload:                pbfd.Payload,
+		FragSize:               maxPLSize.N - 3,
+		Redundancy:             int(pbfd.Redundancy),
+		MulticastTimeout:       int(pbfd.MulticastTimeout),
+		UnicastRetransmissions: int(pbfd.UnicastRetransmissions),
+	}
+
+	if pbfd.FirmwareImageId != "" {
+		id, err := uuid.FromString(pbfd.FirmwareImageId)
+		if err != nil {
+			return fd, grpc.Errorf(codes.InvalidArgument, "firmware_image_id: %s", err)
+		}
+
+		fi, err := storage.GetFirmwareImage(ctx, storage.DB(), id)
+		if err != nil {
+			return fd, helpers.ErrToRPCError(err)
+		}
+
+		fd.FirmwareImageID = &fi.ID
+		fd.Payload = fi.Payload
+	}
+
+	switch pbfd.GroupType {
+	case pb.MulticastGroupType_CLASS_B:
+		fd.GroupType = storage.FUOTADeploymentGroupTypeB
+		fd.PingSlotPeriod = int(pbfd.PingSlotPeriod)
+
+		if _, err := fuota.PingSlotPeriodicity(fd.PingSlotPeriod); err != nil {
+			return fd, grpc.Errorf(codes.InvalidArgument, "ping_slot_period: %s", err)
+		}
+	case pb.MulticastGroupType_CLASS_C:
+		fd.GroupType = storage.FUOTADeploymentGroupTypeC
+	default:
+		return fd, grpc.Errorf(codes.InvalidArgument, "group_type %s is not supported", pbfd.GroupType)
+	}
+
+	fd.UnicastTimeout, err = ptypes.Duration(pbfd.UnicastTimeout)
+	if err != nil {
+		return fd, grpc.Errorf(codes.InvalidArgument, "unicast_timeout: %s", err)
+	}
+
+	return fd, nil
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/golang/protobuf/ptypes"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
 	"github.com/brocaar/chirpstack-api/go/v3/common"
@@ -55,9 +57,13 @@ func (ts *APITestSuite) TestFUOTADeployment() {
 	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
 
 	dp := storage.DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  org.ID,
-		NetworkServerID: n.ID,
+		Name:                  "test-dp",
+		OrganizationID:        org.ID,
+		NetworkServerID:       n.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
 	}
 	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
 	var dpID uuid.UUID
@@ -85,6 +91,19 @@ func (ts *APITestSuite) TestFUOTADeployment() {
 	}
 	assert.NoError(storage.CreateUser(context.Background(), storage.DB(), &user))
 
+	// setDone completes the given deployment, so that its devices can be
+	// used by a next deployment
+	setDone := func(t *testing.T, id string) {
+		assert := require.New(t)
+
+		fdID, err := uuid.FromString(id)
+		assert.NoError(err)
+		fd, err := storage.GetFUOTADeployment(context.Background(), storage.DB(), fdID, false)
+		assert.NoError(err)
+		fd.State = storage.FUOTADeploymentDone
+		assert.NoError(storage.UpdateFUOTADeployment(context.Background(), storage.DB(), &fd))
+	}
+
 	ts.T().Run("CreateForDevice", func(t *testing.T) {
 		assert := require.New(t)
 
@@ -95,14 +114,15 @@ func (ts *APITestSuite) TestFUOTADeployment() {
 		req := pb.CreateFUOTADeploymentForDeviceRequest{
 			DevEui: d.DevEUI.String(),
 			FuotaDeployment: &pb.FUOTADeployment{
-				Name:             "test-deployment",
-				GroupType:        pb.MulticastGroupType_CLASS_C,
-				Dr:               5,
-				Frequency:        868100000,
-				Payload:          []byte{1, 2, 3, 4},
-				Redundancy:       2,
-				MulticastTimeout: 3,
-				UnicastTimeout:   ptypes.DurationProto(5 * time.Second),
+				Name:                   "test-deployment",
+				GroupType:              pb.MulticastGroupType_CLASS_C,
+				Dr:                     5,
+				Frequency:              868100000,
+				Payload:                []byte{1, 2, 3, 4},
+				Redundancy:             2,
+				MulticastTimeout:       3,
+				UnicastTimeout:         ptypes.DurationProto(5 * time.Second),
+				UnicastRetransmissions: 2,
 			},
 		}
 
@@ -211,5 +231,169 @@ func (ts *APITestSuite) TestFUOTADeployment() {
 			assert.EqualValues(1, resp.TotalCount)
 			assert.Len(resp.Result, 1)
 		})
+
+		t.Run("Device in other deployment", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.CreateForDevice(context.Background(), &req)
+			assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+		})
+
+		setDone(t, resp.Id)
+	})
+
+	ts.T().Run("CreateForApplication", func(t *testing.T) {
+		assert := require.New(t)
+
+		nsClient.GetVersionResponse = ns.GetVersionResponse{
+			Region: common.Region_EU868,
+		}
+
+		req := pb.CreateFUOTADeploymentForApplicationRequest{
+			ApplicationId:   app.ID,
+			DeviceProfileId: dpID.String(),
+			FuotaDeployment: &pb.FUOTADeployment{
+				Name:             "test-deployment",
+				GroupType:        pb.MulticastGroupType_CLASS_C,
+				Dr:               5,
+				Frequency:        868100000,
+				Payload:          []byte{1, 2, 3, 4},
+				Redundancy:       2,
+				MulticastTimeout: 3,
+				UnicastTimeout:   ptypes.DurationProto(5 * time.Second),
+			},
+		}
+
+		resp, err := api.CreateForApplication(context.Background(), &req)
+		assert.NoError(err)
+		assert.NotEqual("", resp.Id)
+
+		t.Run("ListDeploymentDevices", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.ListDeploymentDevices(context.Background(), &pb.ListFUOTADeploymentDevicesRequest{
+				FuotaDeploymentId: resp.Id,
+				Limit:             10,
+			})
+			assert.NoError(err)
+
+			assert.EqualValues(1, resp.TotalCount)
+			assert.Len(resp.Result, 1)
+			assert.Equal(d.DevEUI.String(), resp.Result[0].DevEui)
+		})
+
+		t.Run("Pause and resume", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Pause(context.Background(), &pb.PauseFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+
+			getResp, err := api.Get(context.Background(), &pb.GetFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+			assert.True(getResp.FuotaDeployment.Paused)
+
+			_, err = api.Pause(context.Background(), &pb.PauseFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+
+			_, err = api.Resume(context.Background(), &pb.ResumeFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+
+			getResp, err = api.Get(context.Background(), &pb.GetFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+			assert.False(getResp.FuotaDeployment.Paused)
+		})
+
+		t.Run("Cancel", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Cancel(context.Background(), &pb.CancelFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+
+			getResp, err := api.Get(context.Background(), &pb.GetFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.NoError(err)
+			assert.Equal(string(storage.FUOTADeploymentCleanup), getResp.FuotaDeployment.State)
+
+			_, err = api.Cancel(context.Background(), &pb.CancelFUOTADeploymentRequest{
+				Id: resp.Id,
+			})
+			assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+		})
+
+		setDone(t, resp.Id)
+
+		t.Run("Unknown DevEUI", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.CreateForApplication(context.Background(), &pb.CreateFUOTADeploymentForApplicationRequest{
+				ApplicationId:   app.ID,
+				DevEuis:         []string{d.DevEUI.String(), "0101010101010101"},
+				FuotaDeployment: req.FuotaDeployment,
+			})
+			assert.Equal(codes.InvalidArgument, grpc.Code(err))
+		})
+
+		t.Run("No matching devices", func(t *testing.T) {
+			assert := require.New(t)
+
+			req.DeviceProfileId = ""
+			req.Tags = map[string]string{
+				"foo": "bar",
+			}
+
+			_, err := api.CreateForApplication(context.Background(), &req)
+			assert.Equal(codes.InvalidArgument, grpc.Code(err))
+		})
+	})
+
+	ts.T().Run("CreateForDevice Class-B", func(t *testing.T) {
+		assert := require.New(t)
+
+		req := pb.CreateFUOTADeploymentForDeviceRequest{
+			DevEui: d.DevEUI.String(),
+			FuotaDeployment: &pb.FUOTADeployment{
+				Name:             "test-deployment-class-b",
+				GroupType:        pb.MulticastGroupType_CLASS_B,
+				Dr:               3,
+				Frequency:        869525000,
+				PingSlotPeriod:   100,
+				Payload:          []byte{1, 2, 3, 4},
+				Redundancy:       2,
+				MulticastTimeout: 3,
+				UnicastTimeout:   ptypes.DurationProto(5 * time.Second),
+			},
+		}
+
+		t.Run("Invalid ping-slot period", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.CreateForDevice(context.Background(), &req)
+			assert.Equal(codes.InvalidArgument, grpc.Code(err))
+		})
+
+		req.FuotaDeployment.PingSlotPeriod = 32 * 4
+
+		resp, err := api.CreateForDevice(context.Background(), &req)
+		assert.NoError(err)
+
+		getResp, err := api.Get(context.Background(), &pb.GetFUOTADeploymentRequest{
+			Id: resp.Id,
+		})
+		assert.NoError(err)
+		assert.Equal(pb.MulticastGroupType_CLASS_B, getResp.FuotaDeployment.GroupType)
+		assert.EqualValues(32*4, getResp.FuotaDeployment.PingSlotPeriod)
 	})
 }
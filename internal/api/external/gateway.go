@@ -3,6 +3,7 @@ package external
 import (
 	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
@@ -69,12 +70,24 @@ func (a *GatewayAPI) Create(ctx context.Context, req *pb.CreateGatewayRequest) (
 			RoutingProfileId: applicationServerID.Bytes(),
 		},
 	}
+	var gatewayProfileID *string
 	if req.Gateway.GatewayProfileId != "" {
 		gpID, err := uuid.FromString(req.Gateway.GatewayProfileId)
 		if err != nil {
 			return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
 		}
 		createReq.Gateway.GatewayProfileId = gpID.Bytes()
+
+		gpIDStr := gpID.String()
+		gatewayProfileID = &gpIDStr
+	}
+
+	var offlineThreshold time.Duration
+	if req.Gateway.OfflineThreshold != nil {
+		offlineThreshold, err = ptypes.Duration(req.Gateway.OfflineThreshold)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "offline_threshold: %s", err)
+		}
 	}
 	for _, board := range req.Gateway.Boards {
 		var gwBoard ns.GatewayBoard
@@ -109,6 +122,7 @@ func (a *GatewayAPI) Create(ctx context.Context, req *pb.CreateGatewayRequest) (
 	//    rollback the transaction.
 	//  * We want to lock the organization so that we can validate the
 	//    max gateway count.
+	var gw storage.Gateway
 	err = storage.Transaction(func(tx sqlx.Ext) error {
 		org, err := storage.GetOrganization(ctx, tx, req.Gateway.OrganizationId, true)
 		if err != nil {
@@ -127,22 +141,29 @@ func (a *GatewayAPI) Create(ctx context.Context, req *pb.CreateGatewayRequest) (
 			}
 		}
 
-		err = storage.CreateGateway(ctx, tx, &storage.Gateway{
-			MAC:             mac,
-			Name:            req.Gateway.Name,
-			Description:     req.Gateway.Description,
-			OrganizationID:  req.Gateway.OrganizationId,
-			Ping:            req.Gateway.DiscoveryEnabled,
-			NetworkServerID: req.Gateway.NetworkServerId,
-			Latitude:        req.Gateway.Location.Latitude,
-			Longitude:       req.Gateway.Location.Longitude,
-			Altitude:        req.Gateway.Location.Altitude,
-			Tags:            tags,
-		})
+		gw = storage.Gateway{
+			MAC:              mac,
+			Name:             req.Gateway.Name,
+			Description:      req.Gateway.Description,
+			OrganizationID:   req.Gateway.OrganizationId,
+			Ping:             req.Gateway.DiscoveryEnabled,
+			NetworkServerID:  req.Gateway.NetworkServerId,
+			GatewayProfileID: gatewayProfileID,
+			Latitude:         req.Gateway.Location.Latitude,
+			Longitude:        req.Gateway.Location.Longitude,
+			Altitude:         req.Gateway.Location.Altitude,
+			Tags:             tags,
+			OfflineThreshold: offlineThreshold,
+		}
+		err = storage.CreateGateway(ctx, tx, &gw)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
 		}
 
+		if err := auditLog(ctx, tx, a.validator, gw.OrganizationID, storage.AuditLogCreate, auditResourceGateway, gw.MAC.String(), nil, gw); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		n, err := storage.GetNetworkServer(ctx, tx, req.Gateway.NetworkServerId)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
@@ -217,6 +238,11 @@ func (a *GatewayAPI) Get(ctx context.Context, req *pb.GetGatewayRequest) (*pb.Ge
 			Tags:            make(map[string]string),
 			Metadata:        make(map[string]string),
 		},
+		Offline: gw.IsOffline,
+	}
+
+	if gw.OfflineThreshold != 0 {
+		resp.Gateway.OfflineThreshold = ptypes.DurationProto(gw.OfflineThreshold)
 	}
 
 	resp.CreatedAt, err = ptypes.TimestampProto(gw.CreatedAt)
@@ -401,11 +427,21 @@ func (a *GatewayAPI) Update(ctx context.Context, req *pb.UpdateGatewayRequest) (
 		tags.Map[k] = sql.NullString{Valid: true, String: v}
 	}
 
+	var offlineThreshold time.Duration
+	if req.Gateway.OfflineThreshold != nil {
+		offlineThreshold, err = ptypes.Duration(req.Gateway.OfflineThreshold)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "offline_threshold: %s", err)
+		}
+	}
+
+	var before, gw storage.Gateway
 	err = storage.Transaction(func(tx sqlx.Ext) error {
-		gw, err := storage.GetGateway(ctx, tx, mac, true)
+		gw, err = storage.GetGateway(ctx, tx, mac, true)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
 		}
+		before = gw
 
 		gw.Name = req.Gateway.Name
 		gw.Description = req.Gateway.Description
@@ -414,11 +450,8 @@ func (a *GatewayAPI) Update(ctx context.Context, req *pb.UpdateGatewayRequest) (
 		gw.Longitude = req.Gateway.Location.Longitude
 		gw.Altitude = req.Gateway.Location.Altitude
 		gw.Tags = tags
-
-		err = storage.UpdateGateway(ctx, tx, &gw)
-		if err != nil {
-			return helpers.ErrToRPCError(err)
-		}
+		gw.OfflineThreshold = offlineThreshold
+		gw.GatewayProfileID = nil
 
 		updateReq := ns.UpdateGatewayRequest{
 			Gateway: &ns.Gateway{
@@ -433,6 +466,14 @@ func (a *GatewayAPI) Update(ctx context.Context, req *pb.UpdateGatewayRequest) (
 				return grpc.Errorf(codes.InvalidArgument, err.Error())
 			}
 			updateReq.Gateway.GatewayProfileId = gpID.Bytes()
+
+			gpIDStr := gpID.String()
+			gw.GatewayProfileID = &gpIDStr
+		}
+
+		err = storage.UpdateGateway(ctx, tx, &gw)
+		if err != nil {
+			return helpers.ErrToRPCError(err)
 		}
 
 		for _, board := range req.Gateway.Boards {
@@ -457,6 +498,10 @@ func (a *GatewayAPI) Update(ctx context.Context, req *pb.UpdateGatewayRequest) (
 			updateReq.Gateway.Boards = append(updateReq.Gateway.Boards, &gwBoard)
 		}
 
+		if err := auditLog(ctx, tx, a.validator, gw.OrganizationID, storage.AuditLogUpdate, auditResourceGateway, gw.MAC.String(), before, gw); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		n, err := storage.GetNetworkServer(ctx, tx, gw.NetworkServerID)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
@@ -480,6 +525,56 @@ func (a *GatewayAPI) Update(ctx context.Context, req *pb.UpdateGatewayRequest) (
 	return &empty.Empty{}, nil
 }
 
+// ListStatusTransitions lists the online / offline transitions of the given
+// gateway, most recent first.
+func (a *GatewayAPI) ListStatusTransitions(ctx context.Context, req *pb.ListGatewayStatusTransitionsRequest) (*pb.ListGatewayStatusTransitionsResponse, error) {
+	var mac lorawan.EUI64
+	if err := mac.UnmarshalText([]byte(req.GatewayId)); err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "bad gateway mac: %s", err)
+	}
+
+	err := a.validator.Validate(ctx, auth.ValidateGatewayAccess(auth.Read, mac))
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	count, err := storage.GetGatewayStatusTransitionCount(ctx, storage.DB(), mac)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	items, err := storage.GetGatewayStatusTransitions(ctx, storage.DB(), mac, int(req.Limit), int(req.Offset))
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.ListGatewayStatusTransitionsResponse{
+		TotalCount: int64(count),
+	}
+
+	for _, item := range items {
+		row := pb.GatewayStatusTransitionListItem{
+			Online: item.Online,
+		}
+
+		row.CreatedAt, err = ptypes.TimestampProto(item.CreatedAt)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		if item.LastSeenAt != nil {
+			row.LastSeenAt, err = ptypes.TimestampProto(*item.LastSeenAt)
+			if err != nil {
+				return nil, helpers.ErrToRPCError(err)
+			}
+		}
+
+		resp.Result = append(resp.Result, &row)
+	}
+
+	return &resp, nil
+}
+
 // Delete deletes the gateway matching the given ID.
 func (a *GatewayAPI) Delete(ctx context.Context, req *pb.DeleteGatewayRequest) (*empty.Empty, error) {
 	var mac lorawan.EUI64
@@ -492,7 +587,16 @@ func (a *GatewayAPI) Delete(ctx context.Context, req *pb.DeleteGatewayRequest) (
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
+	gw, err := storage.GetGateway(ctx, storage.DB(), mac, false)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
 	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := auditLog(ctx, tx, a.validator, gw.OrganizationID, storage.AuditLogDelete, auditResourceGateway, gw.MAC.String(), gw, nil); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		err = storage.DeleteGateway(ctx, tx, mac)
 		if err != nil {
 			return helpers.ErrToRPCError(err)
@@ -59,6 +59,14 @@ func (a *GatewayProfileAPI) Create(ctx context.Context, req *pb.CreateGatewayPro
 		})
 	}
 
+	if req.GatewayProfile.OfflineThreshold != nil {
+		var err error
+		gp.OfflineThreshold, err = ptypes.Duration(req.GatewayProfile.OfflineThreshold)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "offline_threshold: %s", err)
+		}
+	}
+
 	err := storage.Transaction(func(tx sqlx.Ext) error {
 		return storage.CreateGatewayProfile(ctx, tx, &gp)
 	})
@@ -103,6 +111,10 @@ func (a *GatewayProfileAPI) Get(ctx context.Context, req *pb.GetGatewayProfileRe
 		},
 	}
 
+	if gp.OfflineThreshold != 0 {
+		out.GatewayProfile.OfflineThreshold = ptypes.DurationProto(gp.OfflineThreshold)
+	}
+
 	out.CreatedAt, err = ptypes.TimestampProto(gp.CreatedAt)
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
@@ -161,6 +173,14 @@ func (a *GatewayProfileAPI) Update(ctx context.Context, req *pb.UpdateGatewayPro
 		})
 	}
 
+	gp.OfflineThreshold = 0
+	if req.GatewayProfile.OfflineThreshold != nil {
+		gp.OfflineThreshold, err = ptypes.Duration(req.GatewayProfile.OfflineThreshold)
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "offline_threshold: %s", err)
+		}
+	}
+
 	err = storage.Transaction(func(tx sqlx.Ext) error {
 		return storage.UpdateGatewayProfile(ctx, tx, &gp)
 	})
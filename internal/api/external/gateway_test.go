@@ -217,7 +217,8 @@ func (ts *APITestSuite) TestGateway() {
 					Tags: map[string]string{
 						"bar": "foo",
 					},
-					Metadata: make(map[string]string),
+					Metadata:         make(map[string]string),
+					OfflineThreshold: ptypes.DurationProto(5 * time.Minute),
 				},
 			}
 			_, err := api.Update(ctx, &updateReq)
@@ -237,6 +238,32 @@ func (ts *APITestSuite) TestGateway() {
 			assert.NotEqual("", getResp.UpdatedAt)
 		})
 
+		t.Run("ListStatusTransitions", func(t *testing.T) {
+			assert := require.New(t)
+
+			lastSeen := time.Now().Add(-10 * time.Minute)
+			assert.NoError(storage.CreateGatewayStatusTransition(context.Background(), storage.DB(), &storage.GatewayStatusTransition{
+				GatewayID:  lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1},
+				LastSeenAt: &lastSeen,
+			}))
+			assert.NoError(storage.CreateGatewayStatusTransition(context.Background(), storage.DB(), &storage.GatewayStatusTransition{
+				GatewayID: lorawan.EUI64{8, 7, 6, 5, 4, 3, 2, 1},
+				Online:    true,
+			}))
+
+			resp, err := api.ListStatusTransitions(ctx, &pb.ListGatewayStatusTransitionsRequest{
+				GatewayId: createReq.Gateway.Id,
+				Limit:     10,
+			})
+			assert.NoError(err)
+			assert.EqualValues(2, resp.TotalCount)
+			assert.Len(resp.Result, 2)
+			assert.True(resp.Result[0].Online)
+			assert.Nil(resp.Result[0].LastSeenAt)
+			assert.False(resp.Result[1].Online)
+			assert.NotNil(resp.Result[1].LastSeenAt)
+		})
+
 		t.Run("GetStats", func(t *testing.T) {
 			assert := require.New(t)
 			assert.NoError(storage.SetAggregationIntervals([]storage.AggregationInterval{storage.AggregationMinute}))
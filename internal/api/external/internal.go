@@ -7,6 +7,7 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
@@ -17,6 +18,7 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
 	"github.com/brocaar/chirpstack-application-server/internal/api/external/oidc"
 	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
 
@@ -32,14 +34,41 @@ func NewInternalAPI(validator auth.Validator) *InternalAPI {
 	}
 }
 
-// Login validates the login request and returns a JWT token.
+// Login validates the login request and returns a JWT token. When the user
+// has enabled a second factor, or is required to enroll one, a short-lived
+// MFA challenge token is returned instead. This token must be exchanged
+// for the JWT token using LoginMFA (or ConfirmTOTP on enrollment).
 func (a *InternalAPI) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	jwt, err := storage.LoginUserByPassword(ctx, storage.DB(), req.Email, req.Password)
+	user, err := storage.GetUserByEmailAndPassword(ctx, storage.DB(), req.Email, req.Password)
 	if nil != err {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	return &pb.LoginResponse{Jwt: jwt}, nil
+	if !user.TOTPEnabled {
+		required, err := storage.IsUserMFARequired(ctx, storage.DB(), user, mfaRequireForAdmins)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+
+		if !required {
+			jwt, err := storage.GetUserToken(user)
+			if err != nil {
+				return nil, helpers.ErrToRPCError(err)
+			}
+
+			return &pb.LoginResponse{Jwt: jwt}, nil
+		}
+	}
+
+	challenge, err := storage.GetUserMFAChallengeToken(user)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.LoginResponse{
+		MfaChallengeToken:     challenge,
+		MfaEnrollmentRequired: !user.TOTPEnabled,
+	}, nil
 }
 
 // Profile returns the user profile.
@@ -68,6 +97,7 @@ func (a *InternalAPI) Profile(ctx context.Context, req *empty.Empty) (*pb.Profil
 			IsAdmin:    prof.User.IsAdmin,
 			IsActive:   prof.User.IsActive,
 		},
+		MfaEnabled: user.TOTPEnabled,
 	}
 
 	for _, org := range prof.Organizations {
@@ -177,18 +207,48 @@ func (a *InternalAPI) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequ
 		applicationID = &id
 	}
 
+	for _, s := range apiKey.GetScopes() {
+		if !auth.IsValidScope(s) {
+			return nil, grpc.Errorf(codes.InvalidArgument, "invalid scope: %s", s)
+		}
+	}
+
 	ak := storage.APIKey{
 		Name:           apiKey.GetName(),
 		IsAdmin:        apiKey.GetIsAdmin(),
 		OrganizationID: organizationID,
 		ApplicationID:  applicationID,
+		Scopes:         apiKey.GetScopes(),
+		AllowedIPs:     apiKey.GetAllowedIps(),
+	}
+
+	if apiKey.GetExpiresAt() != nil {
+		expiresAt, err := ptypes.Timestamp(apiKey.GetExpiresAt())
+		if err != nil {
+			return nil, grpc.Errorf(codes.InvalidArgument, "expires_at: %s", err)
+		}
+		ak.ExpiresAt = &expiresAt
 	}
 
 	if !ak.IsAdmin && ak.OrganizationID == nil && ak.ApplicationID == nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, "the api key must be either of type admin, organization or application")
 	}
 
-	jwtToken, err := storage.CreateAPIKey(ctx, storage.DB(), &ak)
+	var jwtToken string
+	err := storage.Transaction(func(tx sqlx.Ext) error {
+		var err error
+		jwtToken, err = storage.CreateAPIKey(ctx, tx, &ak)
+		if err != nil {
+			return err
+		}
+
+		orgID, err := auditOrganizationIDForAPIKey(ctx, tx, ak)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogCreate, auditResourceAPIKey, ak.ID.String(), nil, ak)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -240,9 +300,11 @@ func (a *InternalAPI) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysReques
 
 	for _, apiKey := range apiKeys {
 		ak := pb.APIKey{
-			Id:      apiKey.ID.String(),
-			Name:    apiKey.Name,
-			IsAdmin: apiKey.IsAdmin,
+			Id:         apiKey.ID.String(),
+			Name:       apiKey.Name,
+			IsAdmin:    apiKey.IsAdmin,
+			Scopes:     apiKey.Scopes,
+			AllowedIps: apiKey.AllowedIPs,
 		}
 
 		if apiKey.OrganizationID != nil {
@@ -253,6 +315,20 @@ func (a *InternalAPI) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysReques
 			ak.ApplicationId = *apiKey.ApplicationID
 		}
 
+		if apiKey.ExpiresAt != nil {
+			ak.ExpiresAt, err = ptypes.TimestampProto(*apiKey.ExpiresAt)
+			if err != nil {
+				return nil, helpers.ErrToRPCError(err)
+			}
+		}
+
+		if apiKey.LastUsedAt != nil {
+			ak.LastUsedAt, err = ptypes.TimestampProto(*apiKey.LastUsedAt)
+			if err != nil {
+				return nil, helpers.ErrToRPCError(err)
+			}
+		}
+
 		resp.Result = append(resp.Result, &ak)
 	}
 
@@ -271,7 +347,24 @@ func (a *InternalAPI) DeleteAPIKey(ctx context.Context, req *pb.DeleteAPIKeyRequ
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	if err := storage.DeleteAPIKey(ctx, storage.DB(), apiKeyID); err != nil {
+	ak, err := storage.GetAPIKey(ctx, storage.DB(), apiKeyID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		orgID, err := auditOrganizationIDForAPIKey(ctx, tx, ak)
+		if err != nil {
+			return err
+		}
+
+		if err := storage.DeleteAPIKey(ctx, tx, apiKeyID); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, orgID, storage.AuditLogDelete, auditResourceAPIKey, ak.ID.String(), ak, nil)
+	})
+	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
 
@@ -337,6 +430,16 @@ func (a *InternalAPI) OpenIDConnectLogin(ctx context.Context, req *pb.OpenIDConn
 		return nil, helpers.ErrToRPCError(err)
 	}
 
+	// apply the group mappings
+	if len(oidcGroupMappings) != 0 {
+		err := storage.Transaction(func(tx sqlx.Ext) error {
+			return syncOrganizationUsers(ctx, tx, user.ID, oidcUser.Groups)
+		})
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+	}
+
 	// get the jwt token
 	token, err := storage.GetUserToken(user)
 	if err != nil {
@@ -377,6 +480,88 @@ func (a *InternalAPI) createAndProvisionUser(ctx context.Context, user oidc.User
 	return u, nil
 }
 
+// syncOrganizationUsers applies the OpenID Connect group mappings to the
+// organization memberships of the given user. The organizations referenced
+// by the mappings are managed by the OpenID Connect provider: memberships
+// are added, updated and removed based on the given groups. Memberships of
+// other organizations are not changed.
+func syncOrganizationUsers(ctx context.Context, db sqlx.Ext, userID int64, groups []string) error {
+	groupSet := make(map[string]struct{})
+	for _, g := range groups {
+		groupSet[g] = struct{}{}
+	}
+
+	type membership struct {
+		member         bool
+		isAdmin        bool
+		isDeviceAdmin  bool
+		isGatewayAdmin bool
+	}
+
+	memberships := make(map[int64]*membership)
+	for _, m := range oidcGroupMappings {
+		ms, ok := memberships[m.OrganizationID]
+		if !ok {
+			ms = &membership{}
+			memberships[m.OrganizationID] = ms
+		}
+
+		if _, ok := groupSet[m.Group]; !ok {
+			continue
+		}
+
+		// permissions of multiple matching groups are combined
+		ms.member = true
+		ms.isAdmin = ms.isAdmin || m.IsAdmin
+		ms.isDeviceAdmin = ms.isDeviceAdmin || m.IsDeviceAdmin
+		ms.isGatewayAdmin = ms.isGatewayAdmin || m.IsGatewayAdmin
+	}
+
+	for orgID, ms := range memberships {
+		ou, err := storage.GetOrganizationUser(ctx, db, orgID, userID)
+		if err != nil {
+			if errors.Cause(err) != storage.ErrDoesNotExist {
+				return errors.Wrap(err, "get organization user error")
+			}
+
+			if !ms.member {
+				continue
+			}
+
+			if _, err := storage.GetOrganization(ctx, db, orgID, false); err != nil {
+				if errors.Cause(err) == storage.ErrDoesNotExist {
+					log.WithFields(log.Fields{
+						"organization_id": orgID,
+						"ctx_id":          ctx.Value(logging.ContextIDKey),
+					}).Warning("api/external: organization in oidc group mapping does not exist")
+					continue
+				}
+				return errors.Wrap(err, "get organization error")
+			}
+
+			if err := storage.CreateOrganizationUser(ctx, db, orgID, userID, ms.isAdmin, ms.isDeviceAdmin, ms.isGatewayAdmin); err != nil {
+				return errors.Wrap(err, "create organization user error")
+			}
+			continue
+		}
+
+		if !ms.member {
+			if err := storage.DeleteOrganizationUser(ctx, db, orgID, userID); err != nil {
+				return errors.Wrap(err, "delete organization user error")
+			}
+			continue
+		}
+
+		if ou.IsAdmin != ms.isAdmin || ou.IsDeviceAdmin != ms.isDeviceAdmin || ou.IsGatewayAdmin != ms.isGatewayAdmin {
+			if err := storage.UpdateOrganizationUser(ctx, db, orgID, userID, ms.isAdmin, ms.isDeviceAdmin, ms.isGatewayAdmin); err != nil {
+				return errors.Wrap(err, "update organization user error")
+			}
+		}
+	}
+
+	return nil
+}
+
 func (a *InternalAPI) provisionUser(ctx context.Context, u storage.User) error {
 	req, err := http.NewRequestWithContext(ctx, "POST", registrationCallbackURL, nil)
 	if err != nil {
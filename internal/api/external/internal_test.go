@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/context"
@@ -17,6 +18,7 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/api/external/oidc"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/config"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
 
@@ -174,6 +176,63 @@ func (ts *APITestSuite) TestInternal() {
 			})
 			assert.Equal(codes.NotFound, grpc.Code(err))
 		})
+
+		ts.T().Run("Scoped key", func(t *testing.T) {
+			expiresAt := ptypes.TimestampNow()
+			expiresAt.Seconds += 3600
+
+			t.Run("Invalid scope", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.CreateAPIKey(context.Background(), &pb.CreateAPIKeyRequest{
+					ApiKey: &pb.APIKey{
+						Name:          "scoped",
+						ApplicationId: app.ID,
+						Scopes:        []string{"device:execute"},
+					},
+				})
+				assert.Equal(codes.InvalidArgument, grpc.Code(err))
+			})
+
+			t.Run("Invalid allowed ip", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.CreateAPIKey(context.Background(), &pb.CreateAPIKeyRequest{
+					ApiKey: &pb.APIKey{
+						Name:          "scoped",
+						ApplicationId: app.ID,
+						AllowedIps:    []string{"10.0.0.300"},
+					},
+				})
+				assert.Equal(codes.InvalidArgument, grpc.Code(err))
+			})
+
+			t.Run("Valid", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.CreateAPIKey(context.Background(), &pb.CreateAPIKeyRequest{
+					ApiKey: &pb.APIKey{
+						Name:          "scoped",
+						ApplicationId: app.ID,
+						Scopes:        []string{"device:read", "device_queue:write"},
+						AllowedIps:    []string{"10.0.0.0/8", "192.168.1.1"},
+						ExpiresAt:     expiresAt,
+					},
+				})
+				assert.NoError(err)
+
+				resp, err := api.ListAPIKeys(context.Background(), &pb.ListAPIKeysRequest{
+					Limit:         10,
+					ApplicationId: app.ID,
+				})
+				assert.NoError(err)
+				assert.Len(resp.Result, 1)
+				assert.Equal([]string{"device:read", "device_queue:write"}, resp.Result[0].Scopes)
+				assert.Equal([]string{"10.0.0.0/8", "192.168.1.1"}, resp.Result[0].AllowedIps)
+				assert.Equal(expiresAt.Seconds, resp.Result[0].ExpiresAt.Seconds)
+				assert.Nil(resp.Result[0].LastUsedAt)
+			})
+		})
 	})
 
 	ts.T().Run("Settings", func(t *testing.T) {
@@ -392,5 +451,102 @@ func (ts *APITestSuite) TestInternal() {
 			assert.NoError(err)
 			assert.Equal("foo@bar.com", user.Email)
 		})
+
+		t.Run("Group mappings", func(t *testing.T) {
+			assert := require.New(t)
+
+			registrationEnabled = true
+			registrationCallbackURL = ""
+
+			org2 := storage.Organization{
+				Name: "test-org-2",
+			}
+			assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org2))
+
+			org3 := storage.Organization{
+				Name: "test-org-3",
+			}
+			assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org3))
+
+			oidcGroupMappings = []config.OIDCGroupMapping{
+				{Group: "admins", OrganizationID: org.ID, IsAdmin: true},
+				{Group: "gateways", OrganizationID: org.ID, IsGatewayAdmin: true},
+				{Group: "users", OrganizationID: org2.ID},
+				{Group: "users", OrganizationID: org.ID + org2.ID + org3.ID},
+			}
+			defer func() {
+				oidcGroupMappings = nil
+			}()
+
+			login := func(groups []string) storage.User {
+				oidc.MockGetUserUser = &oidc.User{
+					ExternalID:    "ext-test-id-groups",
+					Email:         "groups@bar.com",
+					EmailVerified: true,
+					Groups:        groups,
+				}
+				oidc.MockGetUserError = nil
+
+				_, err := api.OpenIDConnectLogin(context.Background(), &pb.OpenIDConnectLoginRequest{
+					Code:  "A",
+					State: "B",
+				})
+				assert.NoError(err)
+
+				user, err := storage.GetUserByExternalID(context.Background(), storage.DB(), "ext-test-id-groups")
+				assert.NoError(err)
+				return user
+			}
+
+			user := login(nil)
+
+			// membership of an organization that is not mapped
+			assert.NoError(storage.CreateOrganizationUser(context.Background(), storage.DB(), org3.ID, user.ID, true, false, false))
+
+			t.Run("Add", func(t *testing.T) {
+				assert := require.New(t)
+
+				login([]string{"admins", "gateways", "users"})
+
+				ou, err := storage.GetOrganizationUser(context.Background(), storage.DB(), org.ID, user.ID)
+				assert.NoError(err)
+				assert.True(ou.IsAdmin)
+				assert.False(ou.IsDeviceAdmin)
+				assert.True(ou.IsGatewayAdmin)
+
+				ou, err = storage.GetOrganizationUser(context.Background(), storage.DB(), org2.ID, user.ID)
+				assert.NoError(err)
+				assert.False(ou.IsAdmin)
+			})
+
+			t.Run("Update and revoke", func(t *testing.T) {
+				assert := require.New(t)
+
+				login([]string{"gateways"})
+
+				ou, err := storage.GetOrganizationUser(context.Background(), storage.DB(), org.ID, user.ID)
+				assert.NoError(err)
+				assert.False(ou.IsAdmin)
+				assert.True(ou.IsGatewayAdmin)
+
+				_, err = storage.GetOrganizationUser(context.Background(), storage.DB(), org2.ID, user.ID)
+				assert.Equal(storage.ErrDoesNotExist, errors.Cause(err))
+
+				_, err = storage.GetOrganizationUser(context.Background(), storage.DB(), org3.ID, user.ID)
+				assert.NoError(err)
+			})
+
+			t.Run("Revoke all", func(t *testing.T) {
+				assert := require.New(t)
+
+				login(nil)
+
+				_, err := storage.GetOrganizationUser(context.Background(), storage.DB(), org.ID, user.ID)
+				assert.Equal(storage.ErrDoesNotExist, errors.Cause(err))
+
+				_, err = storage.GetOrganizationUser(context.Background(), storage.DB(), org3.ID, user.ID)
+				assert.NoError(err)
+			})
+		})
 	})
 }
@@ -0,0 +1,118 @@
+package external
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// managementDeviceState contains the device state as sent to the
+// integrations in the management event. Session-keys are never included.
+type managementDeviceState struct {
+	ApplicationID     int64             `json:"applicationID,string"`
+	DeviceProfileID   string            `json:"deviceProfileID"`
+	Name              string            `json:"name"`
+	Description       string            `json:"description"`
+	SkipFCntCheck     bool              `json:"skipFCntCheck"`
+	ReferenceAltitude float64           `json:"referenceAltitude"`
+	IsDisabled        bool              `json:"isDisabled"`
+	Tags              map[string]string `json:"tags"`
+	DevAddr           *lorawan.DevAddr  `json:"devAddr,omitempty"`
+}
+
+// newManagementDeviceState returns the management state of the given device.
+// The DevAddr is only set when the device is activated.
+func newManagementDeviceState(d storage.Device) *managementDeviceState {
+	s := managementDeviceState{
+		ApplicationID:     d.ApplicationID,
+		DeviceProfileID:   d.DeviceProfileID.String(),
+		Name:              d.Name,
+		Description:       d.Description,
+		SkipFCntCheck:     d.SkipFCntCheck,
+		ReferenceAltitude: d.ReferenceAltitude,
+		IsDisabled:        d.IsDisabled,
+		Tags:              make(map[string]string),
+	}
+
+	for k, v := range d.Tags.Map {
+		if v.Valid {
+			s.Tags[k] = v.String
+		}
+	}
+
+	if d.DevAddr != (lorawan.DevAddr{}) {
+		devAddr := d.DevAddr
+		s.DevAddr = &devAddr
+	}
+
+	return &s
+}
+
+// managementEvent sends a management event for the given device to the
+// integrations of its application. before and after hold the state of the
+// device before and after the mutation, one of them is nil in case of a
+// create or delete. As the mutation has already been performed at this
+// point, errors are logged but not returned.
+func managementEvent(ctx context.Context, typ pb.ManagementEventType, d storage.Device, before, after *managementDeviceState) {
+	err := func() error {
+		app, err := storage.GetApplication(ctx, storage.DB(), d.ApplicationID)
+		if err != nil {
+			return errors.Wrap(err, "get application error")
+		}
+
+		pl := pb.ManagementEvent{
+			ApplicationId:   uint64(app.ID),
+			ApplicationName: app.Name,
+			DeviceName:      d.Name,
+			DevEui:          d.DevEUI[:],
+			Type:            typ,
+			Tags:            make(map[string]string),
+		}
+
+		for k, v := range d.Tags.Map {
+			if v.Valid {
+				pl.Tags[k] = v.String
+			}
+		}
+
+		vars := make(map[string]string)
+		for k, v := range d.Variables.Map {
+			if v.Valid {
+				vars[k] = v.String
+			}
+		}
+
+		if before != nil {
+			b, err := json.Marshal(before)
+			if err != nil {
+				return errors.Wrap(err, "marshal json error")
+			}
+			pl.OldStateJson = string(b)
+		}
+
+		if after != nil {
+			b, err := json.Marshal(after)
+			if err != nil {
+				return errors.Wrap(err, "marshal json error")
+			}
+			pl.NewStateJson = string(b)
+		}
+
+		return integration.ForApplicationID(app.ID).HandleManagementEvent(ctx, vars, pl)
+	}()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"dev_eui": d.DevEUI,
+			"type":    typ,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Error("api/external: send management event error")
+	}
+}
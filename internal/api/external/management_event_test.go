@@ -0,0 +1,183 @@
+package external
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-api/go/v3/ns"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	asintegration "github.com/brocaar/chirpstack-application-server/internal/integration"
+	intmock "github.com/brocaar/chirpstack-application-server/internal/integration/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+func (ts *APITestSuite) TestManagementEvent() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	h := intmock.New()
+	asintegration.SetMockIntegration(h)
+	defer asintegration.SetMockIntegration(nil)
+
+	validator := &TestValidator{}
+	api := NewDeviceAPI(validator)
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	n := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	sp := storage.ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	app := storage.Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	dp := storage.DeviceProfile{
+		Name:            "test-dp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(storage.CreateDeviceProfile(context.Background(), storage.DB(), &dp))
+	dpID, err := uuid.FromBytes(dp.DeviceProfile.Id)
+	assert.NoError(err)
+
+	state := func(s string) map[string]interface{} {
+		if s == "" {
+			return nil
+		}
+		var out map[string]interface{}
+		assert.NoError(json.Unmarshal([]byte(s), &out))
+		return out
+	}
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(context.Background(), &pb.CreateDeviceRequest{
+			Device: &pb.Device{
+				ApplicationId:   app.ID,
+				Name:            "test-device",
+				DevEui:          "0102030405060708",
+				DeviceProfileId: dpID.String(),
+				Variables: map[string]string{
+					"var": "value",
+				},
+				Tags: map[string]string{
+					"foo": "bar",
+				},
+			},
+		})
+		assert.NoError(err)
+
+		nsReq := <-nsClient.CreateDeviceChan
+		nsClient.GetDeviceResponse = ns.GetDeviceResponse{
+			Device: nsReq.Device,
+		}
+
+		pl := <-h.SendManagementNotificationChan
+		assert.Equal(integration.ManagementEventType_CREATE, pl.Type)
+		assert.EqualValues(app.ID, pl.ApplicationId)
+		assert.Equal("test-app", pl.ApplicationName)
+		assert.Equal("test-device", pl.DeviceName)
+		assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, pl.DevEui)
+		assert.Equal(map[string]string{"foo": "bar"}, pl.Tags)
+		assert.Equal("", pl.OldStateJson)
+		assert.Equal("test-device", state(pl.NewStateJson)["name"])
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Update(context.Background(), &pb.UpdateDeviceRequest{
+				Device: &pb.Device{
+					ApplicationId:   app.ID,
+					Name:            "test-device-updated",
+					DevEui:          "0102030405060708",
+					DeviceProfileId: dpID.String(),
+				},
+			})
+			assert.NoError(err)
+
+			pl := <-h.SendManagementNotificationChan
+			assert.Equal(integration.ManagementEventType_UPDATE, pl.Type)
+			assert.Equal("test-device-updated", pl.DeviceName)
+			assert.Equal("test-device", state(pl.OldStateJson)["name"])
+			assert.Equal("test-device-updated", state(pl.NewStateJson)["name"])
+		})
+
+		t.Run("Activate", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Activate(context.Background(), &pb.ActivateDeviceRequest{
+				DeviceActivation: &pb.DeviceActivation{
+					DevEui:      "0102030405060708",
+					DevAddr:     "01020304",
+					AppSKey:     "01020304050607080102030405060708",
+					NwkSEncKey:  "08070605040302010807060504030201",
+					SNwkSIntKey: "08070605040302010807060504030202",
+					FNwkSIntKey: "08070605040302010807060504030203",
+				},
+			})
+			assert.NoError(err)
+
+			pl := <-h.SendManagementNotificationChan
+			assert.Equal(integration.ManagementEventType_ACTIVATE, pl.Type)
+			assert.Nil(state(pl.OldStateJson)["devAddr"])
+			assert.Equal("01020304", state(pl.NewStateJson)["devAddr"])
+			assert.NotContains(pl.NewStateJson, "01020304050607080102030405060708")
+		})
+
+		t.Run("Deactivate", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Deactivate(context.Background(), &pb.DeactivateDeviceRequest{
+				DevEui: "0102030405060708",
+			})
+			assert.NoError(err)
+
+			pl := <-h.SendManagementNotificationChan
+			assert.Equal(integration.ManagementEventType_DEACTIVATE, pl.Type)
+			assert.Equal("01020304", state(pl.OldStateJson)["devAddr"])
+			assert.Nil(state(pl.NewStateJson)["devAddr"])
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Delete(context.Background(), &pb.DeleteDeviceRequest{
+				DevEui: "0102030405060708",
+			})
+			assert.NoError(err)
+
+			pl := <-h.SendManagementNotificationChan
+			assert.Equal(integration.ManagementEventType_DELETE, pl.Type)
+			assert.Equal("test-device-updated", state(pl.OldStateJson)["name"])
+			assert.Equal("", pl.NewStateJson)
+		})
+	})
+}
@@ -0,0 +1,253 @@
+package external
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/totp"
+)
+
+// LoginMFA validates the second factor for the given MFA challenge token
+// and returns a JWT token.
+func (a *InternalAPI) LoginMFA(ctx context.Context, req *pb.LoginMFARequest) (*pb.LoginResponse, error) {
+	userID, err := storage.GetUserIDFromMFAChallengeToken(ctx, req.MfaChallengeToken)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	user, err := storage.GetUser(ctx, storage.DB(), userID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if !user.TOTPEnabled {
+		return nil, helpers.ErrToRPCError(storage.ErrMFANotEnabled)
+	}
+
+	if err := verifySecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	jwt, err := storage.GetUserToken(user)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.LoginResponse{Jwt: jwt}, nil
+}
+
+// EnrollTOTP generates a new TOTP secret for the user. The second factor
+// is enabled after the enrollment has been confirmed using ConfirmTOTP.
+func (a *InternalAPI) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	user, err := a.getMFAUser(ctx, req.MfaChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, helpers.ErrToRPCError(storage.ErrMFAAlreadyEnabled)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if err := storage.SetUserTOTPSecret(ctx, storage.DB(), user.ID, secret); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.EnrollTOTPResponse{
+		Secret: secret,
+		Url:    totp.URL(mfaIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP confirms the TOTP enrollment using a code generated by the
+// authenticator app and returns the recovery codes. When the enrollment
+// was enforced on login, this also returns the JWT token.
+func (a *InternalAPI) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	user, err := a.getMFAUser(ctx, req.MfaChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, helpers.ErrToRPCError(storage.ErrMFAAlreadyEnabled)
+	}
+
+	if user.TOTPSecret == nil {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "totp enrollment must be started first")
+	}
+
+	step, ok := totp.Validate(*user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		return nil, helpers.ErrToRPCError(storage.ErrInvalidMFACode)
+	}
+
+	var resp pb.ConfirmTOTPResponse
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.EnableUserTOTP(ctx, tx, user.ID, step); err != nil {
+			return err
+		}
+
+		recoveryCodes, err := storage.CreateUserRecoveryCodes(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		resp.RecoveryCodes = recoveryCodes
+
+		return nil
+	})
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if req.MfaChallengeToken != "" {
+		resp.Jwt, err = storage.GetUserToken(user)
+		if err != nil {
+			return nil, helpers.ErrToRPCError(err)
+		}
+	}
+
+	return &resp, nil
+}
+
+// DisableTOTP disables the TOTP second factor of the user. This requires
+// a valid TOTP or recovery code.
+func (a *InternalAPI) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*empty.Empty, error) {
+	user, err := a.getMFAUser(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, helpers.ErrToRPCError(storage.ErrMFANotEnabled)
+	}
+
+	required, err := storage.IsUserMFARequired(ctx, storage.DB(), user, mfaRequireForAdmins)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	if required {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "mfa is required for this user")
+	}
+
+	if err := verifySecondFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if err := storage.DisableUserTOTP(ctx, storage.DB(), user.ID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user. This
+// requires a valid TOTP code.
+func (a *InternalAPI) RegenerateRecoveryCodes(ctx context.Context, req *pb.RegenerateRecoveryCodesRequest) (*pb.RegenerateRecoveryCodesResponse, error) {
+	user, err := a.getMFAUser(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, helpers.ErrToRPCError(storage.ErrMFANotEnabled)
+	}
+
+	if err := verifySecondFactor(ctx, user, req.Code, ""); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	recoveryCodes, err := storage.CreateUserRecoveryCodes(ctx, storage.DB(), user.ID)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &pb.RegenerateRecoveryCodesResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// getMFAUser returns the user for the MFA requests. When a challenge token
+// is given (enrollment enforced on login), the user is authenticated by
+// this token, else by the session token.
+func (a *InternalAPI) getMFAUser(ctx context.Context, challengeToken string) (storage.User, error) {
+	if challengeToken != "" {
+		userID, err := storage.GetUserIDFromMFAChallengeToken(ctx, challengeToken)
+		if err != nil {
+			return storage.User{}, helpers.ErrToRPCError(err)
+		}
+
+		user, err := storage.GetUser(ctx, storage.DB(), userID)
+		if err != nil {
+			return storage.User{}, helpers.ErrToRPCError(err)
+		}
+
+		return user, nil
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateActiveUser()); err != nil {
+		return storage.User{}, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	user, err := a.validator.GetUser(ctx)
+	if err != nil {
+		return storage.User{}, helpers.ErrToRPCError(err)
+	}
+
+	return user, nil
+}
+
+// verifySecondFactor verifies the given TOTP code, or the recovery code
+// when set. The invalid codes are counted per user, so that the second
+// factor can not be brute-forced by requesting new challenge tokens.
+func verifySecondFactor(ctx context.Context, user storage.User, code, recoveryCode string) error {
+	if err := storage.ValidateUserMFAFailures(ctx, user.ID); err != nil {
+		return err
+	}
+
+	err := checkSecondFactor(ctx, user, code, recoveryCode)
+	switch errors.Cause(err) {
+	case nil:
+		if err := storage.ResetUserMFAFailures(ctx, user.ID); err != nil {
+			return err
+		}
+	case storage.ErrInvalidMFACode:
+		if err := storage.RegisterUserMFAFailure(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func checkSecondFactor(ctx context.Context, user storage.User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return storage.UseUserRecoveryCode(ctx, storage.DB(), user.ID, recoveryCode)
+	}
+
+	if user.TOTPSecret == nil {
+		return storage.ErrMFANotEnabled
+	}
+
+	step, ok := totp.Validate(*user.TOTPSecret, code, time.Now())
+	if !ok {
+		return storage.ErrInvalidMFACode
+	}
+
+	return storage.UpdateUserTOTPLastStep(ctx, storage.DB(), user.ID, step)
+}
@@ -0,0 +1,239 @@
+package external
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/totp"
+)
+
+func (ts *APITestSuite) TestMFA() {
+	assert := require.New(ts.T())
+
+	validator := &TestValidator{returnSubject: "user"}
+	api := NewInternalAPI(validator)
+	userAPI := NewUserAPI(validator)
+
+	user := storage.User{
+		IsActive: true,
+		Email:    "foo@bar.com",
+	}
+	assert.NoError(user.SetPasswordHash("password"))
+	assert.NoError(storage.CreateUser(context.Background(), storage.DB(), &user))
+
+	refreshUser := func() {
+		var err error
+		validator.returnUser, err = storage.GetUser(context.Background(), storage.DB(), user.ID)
+		assert.NoError(err)
+	}
+	refreshUser()
+
+	ts.T().Run("Login without MFA", func(t *testing.T) {
+		assert := require.New(t)
+
+		resp, err := api.Login(context.Background(), &pb.LoginRequest{
+			Email:    "foo@bar.com",
+			Password: "password",
+		})
+		assert.NoError(err)
+		assert.NotEqual("", resp.Jwt)
+		assert.Equal("", resp.MfaChallengeToken)
+	})
+
+	var recoveryCodes []string
+
+	ts.T().Run("Enroll", func(t *testing.T) {
+		assert := require.New(t)
+
+		enrollResp, err := api.EnrollTOTP(context.Background(), &pb.EnrollTOTPRequest{})
+		assert.NoError(err)
+		assert.NotEqual("", enrollResp.Secret)
+		assert.Contains(enrollResp.Url, "otpauth://totp/")
+		refreshUser()
+
+		t.Run("Invalid code", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.ConfirmTOTP(context.Background(), &pb.ConfirmTOTPRequest{
+				Code: "000000",
+			})
+			assert.Equal(codes.Unauthenticated, grpc.Code(err))
+		})
+
+		t.Run("Confirm", func(t *testing.T) {
+			assert := require.New(t)
+
+			code, err := totp.GenerateCode(enrollResp.Secret, totp.Step(time.Now()))
+			assert.NoError(err)
+
+			resp, err := api.ConfirmTOTP(context.Background(), &pb.ConfirmTOTPRequest{
+				Code: code,
+			})
+			assert.NoError(err)
+			assert.Len(resp.RecoveryCodes, storage.RecoveryCodeCount)
+			assert.Equal("", resp.Jwt)
+			recoveryCodes = resp.RecoveryCodes
+			refreshUser()
+
+			profile, err := api.Profile(context.Background(), nil)
+			assert.NoError(err)
+			assert.True(profile.MfaEnabled)
+
+			t.Run("Login re-used code", func(t *testing.T) {
+				assert := require.New(t)
+
+				loginResp, err := api.Login(context.Background(), &pb.LoginRequest{
+					Email:    "foo@bar.com",
+					Password: "password",
+				})
+				assert.NoError(err)
+				assert.Equal("", loginResp.Jwt)
+				assert.NotEqual("", loginResp.MfaChallengeToken)
+				assert.False(loginResp.MfaEnrollmentRequired)
+
+				_, err = api.LoginMFA(context.Background(), &pb.LoginMFARequest{
+					MfaChallengeToken: loginResp.MfaChallengeToken,
+					Code:              code,
+				})
+				assert.Equal(codes.Unauthenticated, grpc.Code(err))
+			})
+
+			t.Run("Login recovery code", func(t *testing.T) {
+				assert := require.New(t)
+
+				loginResp, err := api.Login(context.Background(), &pb.LoginRequest{
+					Email:    "foo@bar.com",
+					Password: "password",
+				})
+				assert.NoError(err)
+
+				resp, err := api.LoginMFA(context.Background(), &pb.LoginMFARequest{
+					MfaChallengeToken: loginResp.MfaChallengeToken,
+					RecoveryCode:      recoveryCodes[0],
+				})
+				assert.NoError(err)
+				assert.NotEqual("", resp.Jwt)
+			})
+
+			t.Run("Login invalid challenge", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.LoginMFA(context.Background(), &pb.LoginMFARequest{
+					MfaChallengeToken: "invalid",
+					RecoveryCode:      recoveryCodes[1],
+				})
+				assert.Equal(codes.Unauthenticated, grpc.Code(err))
+			})
+
+			t.Run("Login too many invalid codes", func(t *testing.T) {
+				assert := require.New(t)
+
+				login := func(code, recoveryCode string) error {
+					loginResp, err := api.Login(context.Background(), &pb.LoginRequest{
+						Email:    "foo@bar.com",
+						Password: "password",
+					})
+					assert.NoError(err)
+
+					_, err = api.LoginMFA(context.Background(), &pb.LoginMFARequest{
+						MfaChallengeToken: loginResp.MfaChallengeToken,
+						Code:              code,
+						RecoveryCode:      recoveryCode,
+					})
+					return err
+				}
+
+				// the failures are counted across challenge tokens
+				for i := 0; i < 10; i++ {
+					assert.Equal(codes.Unauthenticated, grpc.Code(login("000000", "")))
+				}
+
+				assert.Equal(codes.ResourceExhausted, grpc.Code(login("", recoveryCodes[2])))
+
+				assert.NoError(storage.ResetUserMFAFailures(context.Background(), user.ID))
+				assert.NoError(login("", recoveryCodes[2]))
+			})
+
+			t.Run("Enroll again", func(t *testing.T) {
+				assert := require.New(t)
+
+				_, err := api.EnrollTOTP(context.Background(), &pb.EnrollTOTPRequest{})
+				assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+			})
+		})
+	})
+
+	ts.T().Run("Disable", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.DisableTOTP(context.Background(), &pb.DisableTOTPRequest{
+			RecoveryCode: recoveryCodes[1],
+		})
+		assert.NoError(err)
+		refreshUser()
+		assert.False(validator.returnUser.TOTPEnabled)
+	})
+
+	ts.T().Run("Enforced enrollment", func(t *testing.T) {
+		assert := require.New(t)
+
+		org := storage.Organization{
+			Name:                "test-org",
+			RequireMFAForAdmins: true,
+		}
+		assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+		assert.NoError(storage.CreateOrganizationUser(context.Background(), storage.DB(), org.ID, user.ID, true, false, false))
+
+		loginResp, err := api.Login(context.Background(), &pb.LoginRequest{
+			Email:    "foo@bar.com",
+			Password: "password",
+		})
+		assert.NoError(err)
+		assert.Equal("", loginResp.Jwt)
+		assert.True(loginResp.MfaEnrollmentRequired)
+
+		enrollResp, err := api.EnrollTOTP(context.Background(), &pb.EnrollTOTPRequest{
+			MfaChallengeToken: loginResp.MfaChallengeToken,
+		})
+		assert.NoError(err)
+
+		code, err := totp.GenerateCode(enrollResp.Secret, totp.Step(time.Now()))
+		assert.NoError(err)
+
+		resp, err := api.ConfirmTOTP(context.Background(), &pb.ConfirmTOTPRequest{
+			MfaChallengeToken: loginResp.MfaChallengeToken,
+			Code:              code,
+		})
+		assert.NoError(err)
+		assert.NotEqual("", resp.Jwt)
+		assert.Len(resp.RecoveryCodes, storage.RecoveryCodeCount)
+		refreshUser()
+
+		t.Run("Disable", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.DisableTOTP(context.Background(), &pb.DisableTOTPRequest{
+				RecoveryCode: resp.RecoveryCodes[0],
+			})
+			assert.Equal(codes.FailedPrecondition, grpc.Code(err))
+		})
+
+		t.Run("Reset by admin", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := userAPI.ResetMFA(context.Background(), &pb.ResetUserMFARequest{
+				UserId: user.ID,
+			})
+			assert.NoError(err)
+			refreshUser()
+			assert.False(validator.returnUser.TOTPEnabled)
+		})
+	})
+}
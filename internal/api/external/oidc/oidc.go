@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc"
@@ -24,6 +25,7 @@ var (
 	clientSecret string
 	redirectURL  string
 	jwtSecret    string
+	groupsClaim  string
 
 	// MockGetUserUser contains a possible mocked GetUser User
 	MockGetUserUser *User
@@ -37,6 +39,10 @@ type User struct {
 	Name          string `json:"name"`
 	Email         string `json:"email"`
 	EmailVerified bool   `json:"email_verified"`
+
+	// Groups contains the groups or roles of the user, read from the
+	// configured groups claim.
+	Groups []string `json:"-"`
 }
 
 // Setup configured the OpenID Connect endpoint handlers.
@@ -57,6 +63,7 @@ func Setup(conf config.Config, r *mux.Router) error {
 	clientSecret = oidcConfig.ClientSecret
 	redirectURL = oidcConfig.RedirectURL
 	jwtSecret = externalAPIConfig.JWTSecret
+	groupsClaim = oidcConfig.GroupsClaim
 
 	r.HandleFunc("/auth/oidc/login", loginHandler)
 	r.HandleFunc("/auth/oidc/callback", callbackHandler)
@@ -200,5 +207,42 @@ func GetUser(ctx context.Context, code string, state string) (User, error) {
 		return User{}, errors.Wrap(err, "get userInfo error")
 	}
 
+	if groupsClaim != "" {
+		var claims map[string]interface{}
+		if err := idToken.Claims(&claims); err != nil {
+			return User{}, errors.Wrap(err, "get claims error")
+		}
+		user.Groups = getGroups(claims, groupsClaim)
+	}
+
 	return user, nil
 }
+
+// getGroups returns the groups from the given claims. The claim can be a
+// dot-separated path to select a nested claim. The value of the claim can
+// either be a list of strings or a single string.
+func getGroups(claims map[string]interface{}, claim string) []string {
+	var v interface{} = claims
+	for _, key := range strings.Split(claim, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
@@ -16,3 +16,50 @@ func TestNewAuthenticator(t *testing.T) {
 		assert.Equal("openid connect is not properly configured", err.Error())
 	})
 }
+
+func TestGetGroups(t *testing.T) {
+	claims := map[string]interface{}{
+		"groups": []interface{}{"admins", "users"},
+		"role":   "operator",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"org-1-admin"},
+		},
+	}
+
+	tests := []struct {
+		Name     string
+		Claim    string
+		Expected []string
+	}{
+		{
+			Name:     "list",
+			Claim:    "groups",
+			Expected: []string{"admins", "users"},
+		},
+		{
+			Name:     "string",
+			Claim:    "role",
+			Expected: []string{"operator"},
+		},
+		{
+			Name:     "nested",
+			Claim:    "realm_access.roles",
+			Expected: []string{"org-1-admin"},
+		},
+		{
+			Name:  "missing",
+			Claim: "realm_access.groups",
+		},
+		{
+			Name:  "invalid path",
+			Claim: "role.name",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.Expected, getGroups(claims, tst.Claim))
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package external
 
 import (
+	"strconv"
+
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/jmoiron/sqlx"
@@ -43,9 +45,17 @@ func (a *OrganizationAPI) Create(ctx context.Context, req *pb.CreateOrganization
 		CanHaveGateways: req.Organization.CanHaveGateways,
 		MaxDeviceCount:  int(req.Organization.MaxDeviceCount),
 		MaxGatewayCount: int(req.Organization.MaxGatewayCount),
+
+		RequireMFAForAdmins: req.Organization.RequireMfaForAdmins,
 	}
 
-	err := storage.CreateOrganization(ctx, storage.DB(), &org)
+	err := storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.CreateOrganization(ctx, tx, &org); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, org.ID, storage.AuditLogCreate, auditResourceOrganization, strconv.FormatInt(org.ID, 10), nil, org)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -75,6 +85,8 @@ func (a *OrganizationAPI) Get(ctx context.Context, req *pb.GetOrganizationReques
 			CanHaveGateways: org.CanHaveGateways,
 			MaxDeviceCount:  uint32(org.MaxDeviceCount),
 			MaxGatewayCount: uint32(org.MaxGatewayCount),
+
+			RequireMfaForAdmins: org.RequireMFAForAdmins,
 		},
 	}
 
@@ -183,8 +195,10 @@ func (a *OrganizationAPI) Update(ctx context.Context, req *pb.UpdateOrganization
 		return nil, helpers.ErrToRPCError(err)
 	}
 
+	before := org
 	org.Name = req.Organization.Name
 	org.DisplayName = req.Organization.DisplayName
+	org.RequireMFAForAdmins = req.Organization.RequireMfaForAdmins
 
 	switch sub {
 	case auth.SubjectUser:
@@ -206,7 +220,13 @@ func (a *OrganizationAPI) Update(ctx context.Context, req *pb.UpdateOrganization
 		org.MaxDeviceCount = int(req.Organization.MaxDeviceCount)
 	}
 
-	err = storage.UpdateOrganization(ctx, storage.DB(), &org)
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.UpdateOrganization(ctx, tx, &org); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, org.ID, storage.AuditLogUpdate, auditResourceOrganization, strconv.FormatInt(org.ID, 10), before, org)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -221,7 +241,16 @@ func (a *OrganizationAPI) Delete(ctx context.Context, req *pb.DeleteOrganization
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err := storage.Transaction(func(tx sqlx.Ext) error {
+	org, err := storage.GetOrganization(ctx, storage.DB(), req.Id, false)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := auditLog(ctx, tx, a.validator, org.ID, storage.AuditLogDelete, auditResourceOrganization, strconv.FormatInt(org.ID, 10), org, nil); err != nil {
+			return helpers.ErrToRPCError(err)
+		}
+
 		if err := storage.DeleteAllGatewaysForOrganizationID(ctx, tx, req.Id); err != nil {
 			return helpers.ErrToRPCError(err)
 		}
@@ -300,14 +329,26 @@ func (a *OrganizationAPI) AddUser(ctx context.Context, req *pb.AddOrganizationUs
 		return nil, helpers.ErrToRPCError(err)
 	}
 
-	err = storage.CreateOrganizationUser(ctx,
-		storage.DB(),
-		req.OrganizationUser.OrganizationId,
-		user.ID,
-		req.OrganizationUser.IsAdmin,
-		req.OrganizationUser.IsDeviceAdmin,
-		req.OrganizationUser.IsGatewayAdmin,
-	)
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		err := storage.CreateOrganizationUser(ctx,
+			tx,
+			req.OrganizationUser.OrganizationId,
+			user.ID,
+			req.OrganizationUser.IsAdmin,
+			req.OrganizationUser.IsDeviceAdmin,
+			req.OrganizationUser.IsGatewayAdmin,
+		)
+		if err != nil {
+			return err
+		}
+
+		after, err := storage.GetOrganizationUser(ctx, tx, req.OrganizationUser.OrganizationId, user.ID)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, req.OrganizationUser.OrganizationId, storage.AuditLogCreate, auditResourceOrganizationUser, strconv.FormatInt(user.ID, 10), nil, after)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -326,14 +367,31 @@ func (a *OrganizationAPI) UpdateUser(ctx context.Context, req *pb.UpdateOrganiza
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err := storage.UpdateOrganizationUser(ctx,
-		storage.DB(),
-		req.OrganizationUser.OrganizationId,
-		req.OrganizationUser.UserId,
-		req.OrganizationUser.IsAdmin,
-		req.OrganizationUser.IsDeviceAdmin,
-		req.OrganizationUser.IsGatewayAdmin,
-	)
+	before, err := storage.GetOrganizationUser(ctx, storage.DB(), req.OrganizationUser.OrganizationId, req.OrganizationUser.UserId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		err := storage.UpdateOrganizationUser(ctx,
+			tx,
+			req.OrganizationUser.OrganizationId,
+			req.OrganizationUser.UserId,
+			req.OrganizationUser.IsAdmin,
+			req.OrganizationUser.IsDeviceAdmin,
+			req.OrganizationUser.IsGatewayAdmin,
+		)
+		if err != nil {
+			return err
+		}
+
+		after, err := storage.GetOrganizationUser(ctx, tx, req.OrganizationUser.OrganizationId, req.OrganizationUser.UserId)
+		if err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, req.OrganizationUser.OrganizationId, storage.AuditLogUpdate, auditResourceOrganizationUser, strconv.FormatInt(req.OrganizationUser.UserId, 10), before, after)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -348,7 +406,18 @@ func (a *OrganizationAPI) DeleteUser(ctx context.Context, req *pb.DeleteOrganiza
 		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
 	}
 
-	err := storage.DeleteOrganizationUser(ctx, storage.DB(), req.OrganizationId, req.UserId)
+	before, err := storage.GetOrganizationUser(ctx, storage.DB(), req.OrganizationId, req.UserId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	err = storage.Transaction(func(tx sqlx.Ext) error {
+		if err := storage.DeleteOrganizationUser(ctx, tx, req.OrganizationId, req.UserId); err != nil {
+			return err
+		}
+
+		return auditLog(ctx, tx, a.validator, req.OrganizationId, storage.AuditLogDelete, auditResourceOrganizationUser, strconv.FormatInt(req.UserId, 10), before, nil)
+	})
 	if err != nil {
 		return nil, helpers.ErrToRPCError(err)
 	}
@@ -0,0 +1,193 @@
+package external
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/api/external/auth"
+	"github.com/brocaar/chirpstack-application-server/internal/api/helpers"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+// OrganizationIntegrationAPI exports the organization integration related
+// functions. Organization integrations are used by all the applications of
+// the organization, unless an application has an integration of the same
+// kind.
+type OrganizationIntegrationAPI struct {
+	validator auth.Validator
+}
+
+// NewOrganizationIntegrationAPI creates a new OrganizationIntegrationAPI.
+func NewOrganizationIntegrationAPI(validator auth.Validator) *OrganizationIntegrationAPI {
+	return &OrganizationIntegrationAPI{
+		validator: validator,
+	}
+}
+
+// Create creates the given organization integration.
+func (a *OrganizationIntegrationAPI) Create(ctx context.Context, req *pb.CreateOrganizationIntegrationRequest) (*empty.Empty, error) {
+	if req.Integration == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "integration must not be nil")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateOrganizationAccess(auth.Update, req.Integration.OrganizationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	oi := storage.OrganizationIntegration{
+		OrganizationID: req.Integration.OrganizationId,
+		Kind:           req.Integration.Kind.String(),
+	}
+	if err := organizationIntegrationFromPB(req.Integration, &oi); err != nil {
+		return nil, err
+	}
+
+	if err := storage.CreateOrganizationIntegration(ctx, storage.DB(), &oi); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// Get returns the organization integration for the given organization and
+// kind.
+func (a *OrganizationIntegrationAPI) Get(ctx context.Context, req *pb.GetOrganizationIntegrationRequest) (*pb.GetOrganizationIntegrationResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateOrganizationAccess(auth.Update, req.OrganizationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	oi, err := storage.GetOrganizationIntegration(ctx, storage.DB(), req.OrganizationId, req.Kind.String())
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	resp := pb.GetOrganizationIntegrationResponse{
+		Integration: &pb.OrganizationIntegration{
+			OrganizationId: oi.OrganizationID,
+			Kind:           req.Kind,
+			Configuration:  string(oi.Settings),
+			Filter:         integrationFilterToPB(oi.Filter),
+		},
+	}
+
+	resp.CreatedAt, err = ptypes.TimestampProto(oi.CreatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+	resp.UpdatedAt, err = ptypes.TimestampProto(oi.UpdatedAt)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &resp, nil
+}
+
+// Update updates the given organization integration.
+func (a *OrganizationIntegrationAPI) Update(ctx context.Context, req *pb.UpdateOrganizationIntegrationRequest) (*empty.Empty, error) {
+	if req.Integration == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "integration must not be nil")
+	}
+
+	if err := a.validator.Validate(ctx,
+		auth.ValidateOrganizationAccess(auth.Update, req.Integration.OrganizationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	oi, err := storage.GetOrganizationIntegration(ctx, storage.DB(), req.Integration.OrganizationId, req.Integration.Kind.String())
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if err := organizationIntegrationFromPB(req.Integration, &oi); err != nil {
+		return nil, err
+	}
+
+	if err := storage.UpdateOrganizationIntegration(ctx, storage.DB(), &oi); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// Delete deletes the organization integration for the given organization
+// and kind.
+func (a *OrganizationIntegrationAPI) Delete(ctx context.Context, req *pb.DeleteOrganizationIntegrationRequest) (*empty.Empty, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateOrganizationAccess(auth.Update, req.OrganizationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	oi, err := storage.GetOrganizationIntegration(ctx, storage.DB(), req.OrganizationId, req.Kind.String())
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	if err := storage.DeleteOrganizationIntegration(ctx, storage.DB(), oi.ID); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
+
+// List lists the integrations of the given organization.
+func (a *OrganizationIntegrationAPI) List(ctx context.Context, req *pb.ListOrganizationIntegrationRequest) (*pb.ListIntegrationResponse, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateOrganizationAccess(auth.Update, req.OrganizationId),
+	); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	items, err := storage.GetOrganizationIntegrationsForOrganizationID(ctx, storage.DB(), req.OrganizationId)
+	if err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	out := pb.ListIntegrationResponse{
+		TotalCount: int64(len(items)),
+	}
+
+	for _, oi := range items {
+		out.Result = append(out.Result, &pb.IntegrationListItem{
+			Kind: pb.IntegrationKind(pb.IntegrationKind_value[oi.Kind]),
+		})
+	}
+
+	return &out, nil
+}
+
+// organizationIntegrationFromPB sets the user-settable fields of the given
+// organization integration. The configuration must be the JSON encoded
+// configuration of the application integration of the same kind.
+func organizationIntegrationFromPB(in *pb.OrganizationIntegration, oi *storage.OrganizationIntegration) error {
+	if _, ok := pb.IntegrationKind_name[int32(in.Kind)]; !ok {
+		return grpc.Errorf(codes.InvalidArgument, "invalid integration kind: %d", in.Kind)
+	}
+
+	if in.Configuration == "" || !json.Valid([]byte(in.Configuration)) {
+		return grpc.Errorf(codes.InvalidArgument, "configuration must be valid JSON")
+	}
+	oi.Settings = json.RawMessage(in.Configuration)
+
+	oi.Filter = storage.IntegrationFilter{}
+	if in.Filter != nil {
+		var err error
+		oi.Filter, err = integrationFilterFromPB(in.Filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package external
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/external/api"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+func (ts *APITestSuite) TestOrganizationIntegration() {
+	assert := require.New(ts.T())
+
+	validator := &TestValidator{}
+	api := NewOrganizationIntegrationAPI(validator)
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	ts.T().Run("Create invalid configuration", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := api.Create(context.Background(), &pb.CreateOrganizationIntegrationRequest{
+			Integration: &pb.OrganizationIntegration{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+				Configuration:  "{",
+			},
+		})
+		assert.Equal(codes.InvalidArgument, grpc.Code(err))
+	})
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		oi := pb.OrganizationIntegration{
+			OrganizationId: org.ID,
+			Kind:           pb.IntegrationKind_HTTP,
+			Configuration:  `{"dataUpURL":"http://localhost/rx"}`,
+			Filter: &pb.IntegrationFilter{
+				EventTypes: []string{"up"},
+			},
+		}
+
+		_, err := api.Create(context.Background(), &pb.CreateOrganizationIntegrationRequest{
+			Integration: &oi,
+		})
+		assert.NoError(err)
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.Get(context.Background(), &pb.GetOrganizationIntegrationRequest{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+			})
+			assert.NoError(err)
+			assert.Equal(oi.OrganizationId, resp.Integration.OrganizationId)
+			assert.Equal(oi.Kind, resp.Integration.Kind)
+			assert.Equal(oi.Filter, resp.Integration.Filter)
+			assert.JSONEq(oi.Configuration, resp.Integration.Configuration)
+			assert.NotNil(resp.CreatedAt)
+			assert.NotNil(resp.UpdatedAt)
+		})
+
+		t.Run("List", func(t *testing.T) {
+			assert := require.New(t)
+
+			resp, err := api.List(context.Background(), &pb.ListOrganizationIntegrationRequest{
+				OrganizationId: org.ID,
+			})
+			assert.NoError(err)
+			assert.Equal(&pb.ListIntegrationResponse{
+				TotalCount: 1,
+				Result: []*pb.IntegrationListItem{
+					{Kind: pb.IntegrationKind_HTTP},
+				},
+			}, resp)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			updated := pb.OrganizationIntegration{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+				Configuration:  `{"dataUpURL":"http://localhost/uplink"}`,
+				Filter:         &pb.IntegrationFilter{},
+			}
+
+			_, err := api.Update(context.Background(), &pb.UpdateOrganizationIntegrationRequest{
+				Integration: &updated,
+			})
+			assert.NoError(err)
+
+			resp, err := api.Get(context.Background(), &pb.GetOrganizationIntegrationRequest{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+			})
+			assert.NoError(err)
+			assert.Equal(updated.Filter, resp.Integration.Filter)
+			assert.JSONEq(updated.Configuration, resp.Integration.Configuration)
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := api.Delete(context.Background(), &pb.DeleteOrganizationIntegrationRequest{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+			})
+			assert.NoError(err)
+
+			_, err = api.Get(context.Background(), &pb.GetOrganizationIntegrationRequest{
+				OrganizationId: org.ID,
+				Kind:           pb.IntegrationKind_HTTP,
+			})
+			assert.Equal(codes.NotFound, grpc.Code(err))
+		})
+	})
+}
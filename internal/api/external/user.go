@@ -216,3 +216,19 @@ func (a *UserAPI) UpdatePassword(ctx context.Context, req *pb.UpdateUserPassword
 
 	return &empty.Empty{}, nil
 }
+
+// ResetMFA disables the second factor of the given user and removes the
+// recovery codes, e.g. when the user lost access to the authenticator app
+// and recovery codes.
+func (a *UserAPI) ResetMFA(ctx context.Context, req *pb.ResetUserMFARequest) (*empty.Empty, error) {
+	if err := a.validator.Validate(ctx,
+		auth.ValidateUserAccess(req.UserId, auth.Update)); err != nil {
+		return nil, grpc.Errorf(codes.Unauthenticated, "authentication failed: %s", err)
+	}
+
+	if err := storage.DisableUserTOTP(ctx, storage.DB(), req.UserId); err != nil {
+		return nil, helpers.ErrToRPCError(err)
+	}
+
+	return &empty.Empty{}, nil
+}
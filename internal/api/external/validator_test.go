@@ -14,6 +14,8 @@ type TestValidator struct {
 	returnSubject  string
 	returnAPIKeyID uuid.UUID
 	returnUser     storage.User
+
+	returnUserError error
 }
 
 func (v *TestValidator) Validate(ctx context.Context, funcs ...auth.ValidatorFunc) error {
@@ -31,5 +33,8 @@ func (v *TestValidator) GetAPIKeyID(ctx context.Context) (uuid.UUID, error) {
 }
 
 func (v *TestValidator) GetUser(ctx context.Context) (storage.User, error) {
+	if v.returnUserError != nil {
+		return v.returnUser, v.returnUserError
+	}
 	return v.returnUser, v.returnError
 }
@@ -6,31 +6,54 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/brocaar/chirpstack-application-server/internal/codec"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/http"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/influxdb"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
 
 var errToCode = map[error]codes.Code{
-	storage.ErrAlreadyExists:                   codes.AlreadyExists,
-	storage.ErrDoesNotExist:                    codes.NotFound,
-	storage.ErrUsedByOtherObjects:              codes.FailedPrecondition,
-	storage.ErrApplicationInvalidName:          codes.InvalidArgument,
-	storage.ErrNodeInvalidName:                 codes.InvalidArgument,
-	storage.ErrNodeMaxRXDelay:                  codes.InvalidArgument,
-	storage.ErrCFListTooManyChannels:           codes.InvalidArgument,
-	storage.ErrUserInvalidUsername:             codes.InvalidArgument,
-	storage.ErrUserPasswordLength:              codes.InvalidArgument,
-	storage.ErrInvalidUsernameOrPassword:       codes.Unauthenticated,
-	storage.ErrInvalidEmail:                    codes.InvalidArgument,
-	storage.ErrInvalidGatewayDiscoveryInterval: codes.InvalidArgument,
-	storage.ErrDeviceProfileInvalidName:        codes.InvalidArgument,
-	storage.ErrServiceProfileInvalidName:       codes.InvalidArgument,
-	storage.ErrMulticastGroupInvalidName:       codes.InvalidArgument,
-	storage.ErrOrganizationMaxDeviceCount:      codes.FailedPrecondition,
-	storage.ErrOrganizationMaxGatewayCount:     codes.FailedPrecondition,
-	http.ErrInvalidHeaderName:                  codes.InvalidArgument,
-	influxdb.ErrInvalidPrecision:               codes.InvalidArgument,
+	storage.ErrAlreadyExists:                       codes.AlreadyExists,
+	storage.ErrDoesNotExist:                        codes.NotFound,
+	storage.ErrUsedByOtherObjects:                  codes.FailedPrecondition,
+	storage.ErrApplicationInvalidName:              codes.InvalidArgument,
+	storage.ErrNodeInvalidName:                     codes.InvalidArgument,
+	storage.ErrNodeMaxRXDelay:                      codes.InvalidArgument,
+	storage.ErrCFListTooManyChannels:               codes.InvalidArgument,
+	storage.ErrUserInvalidUsername:                 codes.InvalidArgument,
+	storage.ErrUserPasswordLength:                  codes.InvalidArgument,
+	storage.ErrInvalidUsernameOrPassword:           codes.Unauthenticated,
+	storage.ErrInvalidEmail:                        codes.InvalidArgument,
+	storage.ErrInvalidGatewayDiscoveryInterval:     codes.InvalidArgument,
+	storage.ErrDeviceProfileInvalidName:            codes.InvalidArgument,
+	storage.ErrDeviceProfileInvalidAppLayerFPort:   codes.InvalidArgument,
+	storage.ErrServiceProfileInvalidName:           codes.InvalidArgument,
+	storage.ErrMulticastGroupInvalidName:           codes.InvalidArgument,
+	storage.ErrOrganizationMaxDeviceCount:          codes.FailedPrecondition,
+	storage.ErrOrganizationMaxGatewayCount:         codes.FailedPrecondition,
+	storage.ErrIntegrationFilterInvalidFPortRange:  codes.InvalidArgument,
+	storage.ErrAPIKeyInvalidAllowedIP:              codes.InvalidArgument,
+	storage.ErrInvalidMFACode:                      codes.Unauthenticated,
+	storage.ErrInvalidMFAChallenge:                 codes.Unauthenticated,
+	storage.ErrMFAAlreadyEnabled:                   codes.FailedPrecondition,
+	storage.ErrMFANotEnabled:                       codes.FailedPrecondition,
+	storage.ErrMFATooManyFailures:                  codes.ResourceExhausted,
+	storage.ErrDeviceAlertRuleInvalidName:          codes.InvalidArgument,
+	storage.ErrDeviceAlertRuleInvalidType:          codes.InvalidArgument,
+	storage.ErrDeviceAlertRuleInvalidThreshold:     codes.InvalidArgument,
+	storage.ErrFUOTADeploymentNoDevices:            codes.InvalidArgument,
+	storage.ErrFUOTADeploymentIncompatibleDevices:  codes.InvalidArgument,
+	storage.ErrFUOTADeploymentInvalidFirmwareImage: codes.InvalidArgument,
+	storage.ErrFUOTADeploymentInvalidState:         codes.FailedPrecondition,
+	storage.ErrFUOTADeploymentAppLayerDisabled:     codes.InvalidArgument,
+	storage.ErrFUOTADeploymentDeviceInProgress:     codes.FailedPrecondition,
+	storage.ErrFUOTADeploymentInvalidDevEUIs:       codes.InvalidArgument,
+	storage.ErrFirmwareImageInvalidVersion:         codes.InvalidArgument,
+	storage.ErrFirmwareImageInvalidChecksum:        codes.InvalidArgument,
+	http.ErrInvalidHeaderName:                      codes.InvalidArgument,
+	influxdb.ErrInvalidPrecision:                   codes.InvalidArgument,
+	codec.ErrUnknownType:                           codes.InvalidArgument,
+	codec.ErrInvalidConfig:                         codes.InvalidArgument,
 }
 
 // ErrToRPCError converts the given error into a gRPC error.
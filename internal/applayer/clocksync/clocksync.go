@@ -15,7 +15,8 @@ import (
 )
 
 // HandleClockSyncCommand handles an uplink clock synchronization command.
-func HandleClockSyncCommand(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, timeSinceGPSEpoch time.Duration, b []byte) error {
+// The answer is sent on the same fPort as the command was received on.
+func HandleClockSyncCommand(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, fPort uint8, timeSinceGPSEpoch time.Duration, b []byte) error {
 	var cmd clocksync.Command
 
 	if err := cmd.UnmarshalBinary(true, b); err != nil {
@@ -28,7 +29,7 @@ func HandleClockSyncCommand(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI
 		if !ok {
 			return fmt.Errorf("expected *clocksync.AppTimeReqPayload, got: %T", cmd.Payload)
 		}
-		if err := handleAppTimeReq(ctx, db, devEUI, timeSinceGPSEpoch, pl); err != nil {
+		if err := handleAppTimeReq(ctx, db, devEUI, fPort, timeSinceGPSEpoch, pl); err != nil {
 			return errors.Wrap(err, "handle AppTimeReq error")
 		}
 	default:
@@ -38,7 +39,7 @@ func HandleClockSyncCommand(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI
 	return nil
 }
 
-func handleAppTimeReq(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, timeSinceGPSEpoch time.Duration, pl *clocksync.AppTimeReqPayload) error {
+func handleAppTimeReq(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, fPort uint8, timeSinceGPSEpoch time.Duration, pl *clocksync.AppTimeReqPayload) error {
 	deviceGPSTime := int64(pl.DeviceTime)
 	networkGPSTime := int64((timeSinceGPSEpoch / time.Second) % (1 << 32))
 
@@ -63,7 +64,7 @@ func handleAppTimeReq(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, ti
 		return errors.Wrap(err, "marshal command error")
 	}
 
-	_, err = storage.EnqueueDownlinkPayload(ctx, db, devEUI, false, uint8(clocksync.DefaultFPort), b)
+	_, err = storage.EnqueueDownlinkPayload(ctx, db, devEUI, false, fPort, b)
 	if err != nil {
 		return errors.Wrap(err, "enqueue downlink payload error")
 	}
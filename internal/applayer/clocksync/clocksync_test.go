@@ -80,9 +80,15 @@ func (ts *ClockSyncTestSuite) SetupTest() {
 	assert.NoError(storage.CreateApplication(context.Background(), ts.tx, &ts.Application))
 
 	ts.DeviceProfile = storage.DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  ts.Organization.ID,
-		NetworkServerID: ts.NetworkServer.ID,
+		Name:                  "test-dp",
+		OrganizationID:        ts.Organization.ID,
+		NetworkServerID:       ts.NetworkServer.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
+		ClockSyncEnabled:      true,
+		ClockSyncFPort:        202,
 	}
 	assert.NoError(storage.CreateDeviceProfile(context.Background(), ts.tx, &ts.DeviceProfile))
 	var dpID uuid.UUID
@@ -120,7 +126,7 @@ func (ts *ClockSyncTestSuite) TestAppTimeReq() {
 		}
 		b, err := cmd.MarshalBinary()
 		assert.NoError(err)
-		assert.NoError(HandleClockSyncCommand(context.Background(), ts.tx, ts.Device.DevEUI, serverGPSTime, b))
+		assert.NoError(HandleClockSyncCommand(context.Background(), ts.tx, ts.Device.DevEUI, clocksync.DefaultFPort, serverGPSTime, b))
 
 		queueReq := <-ts.NSClient.CreateDeviceQueueItemChan
 
@@ -157,16 +157,28 @@ func syncRemoteFragmentationSession(ctx context.Context, db sqlx.Ext, item stora
 		return errors.Wrap(err, "marshal binary error")
 	}
 
-	_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, fragmentation.DefaultFPort, b)
+	dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, item.DevEUI)
 	if err != nil {
-		return errors.Wrap(err, "enqueue downlink payload error")
+		return errors.Wrap(err, "get device-profile error")
 	}
 
-	log.WithFields(log.Fields{
-		"dev_eui":    item.DevEUI,
-		"frag_index": item.FragIndex,
-		"ctx_id":     ctx.Value(logging.ContextIDKey),
-	}).Infof("%s enqueued", cmd.CID)
+	if dp.FragmentationEnabled {
+		_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, dp.FragmentationFPort, b)
+		if err != nil {
+			return errors.Wrap(err, "enqueue downlink payload error")
+		}
+
+		log.WithFields(log.Fields{
+			"dev_eui":    item.DevEUI,
+			"frag_index": item.FragIndex,
+			"ctx_id":     ctx.Value(logging.ContextIDKey),
+		}).Infof("%s enqueued", cmd.CID)
+	} else {
+		log.WithFields(log.Fields{
+			"dev_eui": item.DevEUI,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warningf("applayer/fragmentation: fragmentation package is disabled for device-profile, %s not enqueued", cmd.CID)
+	}
 
 	item.RetryCount++
 	item.RetryAfter = time.Now().Add(item.RetryInterval)
@@ -248,15 +260,20 @@ func handleFragSessionStatusAns(ctx context.Context, db sqlx.Ext, devEUI lorawan
 	}
 
 	fdd.State = storage.FUOTADeploymentDeviceSuccess
+	fdd.MissingFrag = 0
 
+	// the missing fragments are stored, so that they can be retransmitted
+	// as unicast when enabled for the FUOTA deployment
 	if pl.MissingFrag > 0 {
 		fdd.State = storage.FUOTADeploymentDeviceError
 		fdd.ErrorMessage = fmt.Sprintf("%d fragments missed (%d received).", pl.MissingFrag, pl.ReceivedAndIndex.NbFragReceived)
+		fdd.MissingFrag = int(pl.MissingFrag)
 	}
 
 	if pl.Status.NotEnoughMatrixMemory {
 		fdd.State = storage.FUOTADeploymentDeviceError
 		fdd.ErrorMessage = "Not enough matrix memory."
+		fdd.MissingFrag = 0
 	}
 
 	err = storage.UpdateFUOTADeploymentDevice(ctx, db, &fdd)
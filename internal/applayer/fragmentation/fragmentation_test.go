@@ -85,9 +85,15 @@ func (ts *FragmentationSessionTestSuite) SetupTest() {
 	assert.NoError(storage.CreateApplication(context.Background(), ts.tx, &ts.Application))
 
 	ts.DeviceProfile = storage.DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  ts.Organization.ID,
-		NetworkServerID: ts.NetworkServer.ID,
+		Name:                  "test-dp",
+		OrganizationID:        ts.Organization.ID,
+		NetworkServerID:       ts.NetworkServer.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
+		ClockSyncEnabled:      true,
+		ClockSyncFPort:        202,
 	}
 	assert.NoError(storage.CreateDeviceProfile(context.Background(), ts.tx, &ts.DeviceProfile))
 	var dpID uuid.UUID
@@ -304,6 +310,7 @@ func (ts *FragmentationSessionTestSuite) TestFragSessionStatusAns() {
 		FragSessionStatusAns fragmentation.FragSessionStatusAnsPayload
 		ExpectedState        storage.FUOTADeploymentDeviceState
 		ExpectedErrorMessage string
+		ExpectedMissingFrag  int
 	}{
 		{
 			Name: "success",
@@ -326,6 +333,7 @@ func (ts *FragmentationSessionTestSuite) TestFragSessionStatusAns() {
 			},
 			ExpectedState:        storage.FUOTADeploymentDeviceError,
 			ExpectedErrorMessage: "20 fragments missed (10 received).",
+			ExpectedMissingFrag:  20,
 		},
 		{
 			Name: "not enough matrix memory",
@@ -334,6 +342,7 @@ func (ts *FragmentationSessionTestSuite) TestFragSessionStatusAns() {
 					FragIndex:      0,
 					NbFragReceived: 10,
 				},
+				MissingFrag: 20,
 				Status: fragmentation.FragSessionStatusAnsPayloadStatus{
 					NotEnoughMatrixMemory: true,
 				},
@@ -366,6 +375,10 @@ func (ts *FragmentationSessionTestSuite) TestFragSessionStatusAns() {
 			assert.Len(devices, 1)
 			assert.Equal(tst.ExpectedState, devices[0].State)
 			assert.Equal(tst.ExpectedErrorMessage, devices[0].ErrorMessage)
+
+			fddGet, err := storage.GetFUOTADeploymentDevice(context.Background(), ts.tx, fd.ID, ts.Device.DevEUI)
+			assert.NoError(err)
+			assert.Equal(tst.ExpectedMissingFrag, fddGet.MissingFrag)
 		})
 	}
 }
@@ -31,6 +31,7 @@ func Setup(conf config.Config) error {
 	syncRetries = conf.ApplicationServer.RemoteMulticastSetup.SyncRetries
 
 	go SyncRemoteMulticastSetupLoop()
+	go SyncRemoteMulticastClassBSessionLoop()
 	go SyncRemoteMulticastClassCSessionLoop()
 
 	return nil
@@ -58,6 +59,29 @@ func SyncRemoteMulticastSetupLoop() {
 	}
 }
 
+// SyncRemoteMulticastClassBSessionLoop syncs the multicast Class-B session
+// with the devices.
+func SyncRemoteMulticastClassBSessionLoop() {
+	for {
+		ctxID, err := uuid.NewV4()
+		if err != nil {
+			log.WithError(err).Error("new uuid error")
+		}
+
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, logging.ContextIDKey, ctxID)
+
+		err = storage.Transaction(func(tx sqlx.Ext) error {
+			return syncRemoteMulticastClassBSession(ctx, tx)
+		})
+
+		if err != nil {
+			log.WithError(err).Error("sync remote multicast class-b session error")
+		}
+		time.Sleep(syncInterval)
+	}
+}
+
 // SyncRemoteMulticastClassCSessionLoop syncs the multicast Class-C session
 // with the devices.
 func SyncRemoteMulticastClassCSessionLoop() {
@@ -106,6 +130,14 @@ func HandleRemoteMulticastSetupCommand(ctx context.Context, db sqlx.Ext, devEUI
 		if err := handleMcGroupDeleteAns(ctx, db, devEUI, pl); err != nil {
 			return errors.Wrap(err, "handle McGroupDeleteAns error")
 		}
+	case multicastsetup.McClassBSessionAns:
+		pl, ok := cmd.Payload.(*multicastsetup.McClassBSessionAnsPayload)
+		if !ok {
+			return fmt.Errorf("expected *multicastsetup.McClassBSessionAnsPayload, got: %T", cmd.Payload)
+		}
+		if err := handleMcClassBSessionAns(ctx, db, devEUI, pl); err != nil {
+			return errors.Wrap(err, "handle McClassBSessionAns error")
+		}
 	case multicastsetup.McClassCSessionAns:
 		pl, ok := cmd.Payload.(*multicastsetup.McClassCSessionAnsPayload)
 		if !ok {
@@ -183,6 +215,46 @@ func handleMcGroupDeleteAns(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI
 	return nil
 }
 
+func handleMcClassBSessionAns(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, pl *multicastsetup.McClassBSessionAnsPayload) error {
+	log.WithFields(log.Fields{
+		"dev_eui":            devEUI,
+		"time_to_start":      pl.TimeToStart,
+		"mc_group_undefined": pl.StatusAndMcGroupID.McGroupUndefined,
+		"freq_error":         pl.StatusAndMcGroupID.FreqError,
+		"dr_error":           pl.StatusAndMcGroupID.DRError,
+		"mc_group_id":        pl.StatusAndMcGroupID.McGroupID,
+		"ctx_id":             ctx.Value(logging.ContextIDKey),
+	}).Info("McClassBSessionAns received")
+
+	if pl.StatusAndMcGroupID.DRError || pl.StatusAndMcGroupID.FreqError || pl.StatusAndMcGroupID.McGroupUndefined {
+		return fmt.Errorf("DRError: %t, FreqError: %t, McGroupUndefined: %t for McGroupID: %d", pl.StatusAndMcGroupID.DRError, pl.StatusAndMcGroupID.FreqError, pl.StatusAndMcGroupID.McGroupUndefined, pl.StatusAndMcGroupID.McGroupID)
+	}
+
+	sess, err := storage.GetRemoteMulticastClassBSessionByGroupID(ctx, db, devEUI, int(pl.StatusAndMcGroupID.McGroupID), true)
+	if err != nil {
+		return errors.Wrap(err, "get remote multicast class-b session error")
+	}
+
+	sess.StateProvisioned = true
+	if err := storage.UpdateRemoteMulticastClassBSession(ctx, db, &sess); err != nil {
+		return errors.Wrap(err, "update remote multicast class-b session error")
+	}
+
+	if err := storage.AddDeviceToMulticastGroup(ctx, db, sess.MulticastGroupID, devEUI); err != nil {
+		if err == storage.ErrAlreadyExists {
+			log.WithFields(log.Fields{
+				"dev_eui":            devEUI,
+				"multicast_group_id": sess.MulticastGroupID,
+				"ctx_id":             ctx.Value(logging.ContextIDKey),
+			}).Warning("applayer/multicastsetup: adding device to multicast group, but device was already added")
+		} else {
+			return errors.Wrap(err, "add device to multicast group error")
+		}
+	}
+
+	return nil
+}
+
 func handleMcClassCSessionAns(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, pl *multicastsetup.McClassCSessionAnsPayload) error {
 	log.WithFields(log.Fields{
 		"dev_eui":            devEUI,
@@ -273,16 +345,28 @@ func syncRemoteMulticastSetupItem(ctx context.Context, db sqlx.Ext, item storage
 		return errors.Wrap(err, "marshal binary error")
 	}
 
-	_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, multicastsetup.DefaultFPort, b)
+	dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, item.DevEUI)
 	if err != nil {
-		return errors.Wrap(err, "enqueue downlink payload error")
+		return errors.Wrap(err, "get device-profile error")
 	}
 
-	log.WithFields(log.Fields{
-		"dev_eui":     item.DevEUI,
-		"mc_group_id": item.McGroupID,
-		"ctx_id":      ctx.Value(logging.ContextIDKey),
-	}).Infof("%s enqueued", cmd.CID)
+	if dp.MulticastSetupEnabled {
+		_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, dp.MulticastSetupFPort, b)
+		if err != nil {
+			return errors.Wrap(err, "enqueue downlink payload error")
+		}
+
+		log.WithFields(log.Fields{
+			"dev_eui":     item.DevEUI,
+			"mc_group_id": item.McGroupID,
+			"ctx_id":      ctx.Value(logging.ContextIDKey),
+		}).Infof("%s enqueued", cmd.CID)
+	} else {
+		log.WithFields(log.Fields{
+			"dev_eui": item.DevEUI,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warningf("applayer/multicastsetup: multicast-setup package is disabled for device-profile, %s not enqueued", cmd.CID)
+	}
 
 	item.RetryCount++
 	item.RetryAfter = time.Now().Add(item.RetryInterval)
@@ -295,6 +379,77 @@ func syncRemoteMulticastSetupItem(ctx context.Context, db sqlx.Ext, item storage
 	return nil
 }
 
+func syncRemoteMulticastClassBSession(ctx context.Context, db sqlx.Ext) error {
+	items, err := storage.GetPendingRemoteMulticastClassBSessions(ctx, db, syncBatchSize, syncRetries)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := syncRemoteMulticastClassBSessionItem(ctx, db, item); err != nil {
+			return errors.Wrap(err, "sync remote multicast class-b session error")
+		}
+	}
+
+	return nil
+}
+
+func syncRemoteMulticastClassBSessionItem(ctx context.Context, db sqlx.Ext, item storage.RemoteMulticastClassBSession) error {
+	cmd := multicastsetup.Command{
+		CID: multicastsetup.McClassBSessionReq,
+		Payload: &multicastsetup.McClassBSessionReqPayload{
+			McGroupIDHeader: multicastsetup.McClassBSessionReqPayloadMcGroupIDHeader{
+				McGroupID: uint8(item.McGroupID),
+			},
+			SessionTime: uint32((gps.Time(item.SessionTime).TimeSinceGPSEpoch() / time.Second) % (1 << 32)),
+			TimeOutPeriodicity: multicastsetup.McClassBSessionReqPayloadTimeOutPeriodicity{
+				Periodicity: uint8(item.Periodicity),
+				TimeOut:     uint8(item.SessionTimeOut),
+			},
+			DLFrequency: uint32(item.DLFrequency),
+			DR:          uint8(item.DR),
+		},
+	}
+
+	b, err := cmd.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "marshal binary error")
+	}
+
+	dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, item.DevEUI)
+	if err != nil {
+		return errors.Wrap(err, "get device-profile error")
+	}
+
+	if dp.MulticastSetupEnabled {
+		_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, dp.MulticastSetupFPort, b)
+		if err != nil {
+			return errors.Wrap(err, "enqueue downlink payload error")
+		}
+
+		log.WithFields(log.Fields{
+			"dev_eui":     item.DevEUI,
+			"mc_group_id": item.McGroupID,
+			"ctx_id":      ctx.Value(logging.ContextIDKey),
+		}).Infof("%s enqueued", cmd.CID)
+	} else {
+		log.WithFields(log.Fields{
+			"dev_eui": item.DevEUI,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warningf("applayer/multicastsetup: multicast-setup package is disabled for device-profile, %s not enqueued", cmd.CID)
+	}
+
+	item.RetryCount++
+	item.RetryAfter = time.Now().Add(item.RetryInterval)
+
+	err = storage.UpdateRemoteMulticastClassBSession(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update remote multicast class-b session error")
+	}
+
+	return nil
+}
+
 func syncRemoteMulticastClassCSession(ctx context.Context, db sqlx.Ext) error {
 	items, err := storage.GetPendingRemoteMulticastClassCSessions(ctx, db, syncBatchSize, syncRetries)
 	if err != nil {
@@ -331,15 +486,27 @@ func syncRemoteMulticastClassCSessionItem(ctx context.Context, db sqlx.Ext, item
 		return errors.Wrap(err, "marshal binary error")
 	}
 
-	_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, multicastsetup.DefaultFPort, b)
+	dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, item.DevEUI)
 	if err != nil {
-		return errors.Wrap(err, "enqueue downlink payload error")
+		return errors.Wrap(err, "get device-profile error")
 	}
 
-	log.WithFields(log.Fields{
-		"dev_eui":     item.DevEUI,
-		"mc_group_id": item.McGroupID,
-	}).Infof("%s enqueued", cmd.CID)
+	if dp.MulticastSetupEnabled {
+		_, err = storage.EnqueueDownlinkPayload(ctx, db, item.DevEUI, false, dp.MulticastSetupFPort, b)
+		if err != nil {
+			return errors.Wrap(err, "enqueue downlink payload error")
+		}
+
+		log.WithFields(log.Fields{
+			"dev_eui":     item.DevEUI,
+			"mc_group_id": item.McGroupID,
+		}).Infof("%s enqueued", cmd.CID)
+	} else {
+		log.WithFields(log.Fields{
+			"dev_eui": item.DevEUI,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warningf("applayer/multicastsetup: multicast-setup package is disabled for device-profile, %s not enqueued", cmd.CID)
+	}
 
 	item.RetryCount++
 	item.RetryAfter = time.Now().Add(item.RetryInterval)
@@ -85,9 +85,15 @@ func (ts *MulticastSetupTestSuite) SetupTest() {
 	assert.NoError(storage.CreateApplication(context.Background(), ts.tx, &ts.Application))
 
 	ts.DeviceProfile = storage.DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  ts.Organization.ID,
-		NetworkServerID: ts.NetworkServer.ID,
+		Name:                  "test-dp",
+		OrganizationID:        ts.Organization.ID,
+		NetworkServerID:       ts.NetworkServer.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
+		ClockSyncEnabled:      true,
+		ClockSyncFPort:        202,
 	}
 	assert.NoError(storage.CreateDeviceProfile(context.Background(), ts.tx, &ts.DeviceProfile))
 	var dpID uuid.UUID
@@ -431,6 +437,125 @@ func (ts *MulticastSetupTestSuite) TestSyncRemoteMulticastClassCSessionAns() {
 	})
 }
 
+func (ts *MulticastSetupTestSuite) TestSyncRemoteMulticastClassBSessionReq() {
+	assert := require.New(ts.T())
+	now := time.Now().Round(time.Second)
+
+	ms := storage.RemoteMulticastSetup{
+		DevEUI:           ts.Device.DevEUI,
+		McGroupID:        1,
+		State:            storage.RemoteMulticastSetupSetup,
+		StateProvisioned: true,
+	}
+	copy(ms.MulticastGroupID[:], ts.MulticastGroup.MulticastGroup.Id)
+	assert.NoError(storage.CreateRemoteMulticastSetup(context.Background(), ts.tx, &ms))
+
+	sess := storage.RemoteMulticastClassBSession{
+		DevEUI:         ts.Device.DevEUI,
+		McGroupID:      1,
+		SessionTime:    now,
+		SessionTimeOut: 10,
+		Periodicity:    2,
+		DLFrequency:    868100000,
+		DR:             3,
+		RetryInterval:  time.Minute,
+	}
+	copy(sess.MulticastGroupID[:], ts.MulticastGroup.MulticastGroup.Id)
+	assert.NoError(storage.CreateRemoteMulticastClassBSession(context.Background(), ts.tx, &sess))
+	assert.NoError(syncRemoteMulticastClassBSession(context.Background(), ts.tx))
+
+	sess, err := storage.GetRemoteMulticastClassBSession(context.Background(), ts.tx, sess.DevEUI, sess.MulticastGroupID, false)
+	assert.NoError(err)
+	assert.Equal(1, sess.RetryCount)
+	assert.True(sess.RetryAfter.After(time.Now()))
+
+	req := <-ts.NSClient.CreateDeviceQueueItemChan
+	assert.Equal(multicastsetup.DefaultFPort, uint8(req.Item.FPort))
+
+	b, err := lorawan.EncryptFRMPayload(ts.Device.AppSKey, false, ts.Device.DevAddr, 0, req.Item.FrmPayload)
+	assert.NoError(err)
+
+	var cmd multicastsetup.Command
+	assert.NoError(cmd.UnmarshalBinary(false, b))
+
+	assert.Equal(multicastsetup.Command{
+		CID: multicastsetup.McClassBSessionReq,
+		Payload: &multicastsetup.McClassBSessionReqPayload{
+			McGroupIDHeader: multicastsetup.McClassBSessionReqPayloadMcGroupIDHeader{
+				McGroupID: 1,
+			},
+			SessionTime: uint32((gps.Time(now).TimeSinceGPSEpoch() / time.Second) % (1 << 32)),
+			TimeOutPeriodicity: multicastsetup.McClassBSessionReqPayloadTimeOutPeriodicity{
+				Periodicity: 2,
+				TimeOut:     10,
+			},
+			DLFrequency: 868100000,
+			DR:          3,
+		},
+	}, cmd)
+}
+
+func (ts *MulticastSetupTestSuite) TestSyncRemoteMulticastClassBSessionAns() {
+	assert := require.New(ts.T())
+
+	sess := storage.RemoteMulticastClassBSession{
+		DevEUI:         ts.Device.DevEUI,
+		McGroupID:      1,
+		SessionTimeOut: 10,
+		DLFrequency:    868100000,
+		DR:             3,
+	}
+	copy(sess.MulticastGroupID[:], ts.MulticastGroup.MulticastGroup.Id)
+	assert.NoError(storage.CreateRemoteMulticastClassBSession(context.Background(), ts.tx, &sess))
+
+	ts.T().Run("Error", func(t *testing.T) {
+		assert := require.New(t)
+
+		cmd := multicastsetup.Command{
+			CID: multicastsetup.McClassBSessionAns,
+			Payload: &multicastsetup.McClassBSessionAnsPayload{
+				StatusAndMcGroupID: multicastsetup.McClassBSessionAnsPayloadStatusAndMcGroupID{
+					McGroupUndefined: true,
+					McGroupID:        1,
+				},
+			},
+		}
+		b, err := cmd.MarshalBinary()
+		assert.NoError(err)
+		assert.Equal("handle McClassBSessionAns error: DRError: false, FreqError: false, McGroupUndefined: true for McGroupID: 1", HandleRemoteMulticastSetupCommand(context.Background(), ts.tx, ts.Device.DevEUI, b).Error())
+
+		devices, err := storage.GetDevicesForMulticastGroup(context.Background(), ts.tx, sess.MulticastGroupID, 10, 0)
+		assert.NoError(err)
+		assert.Len(devices, 0)
+	})
+
+	ts.T().Run("OK", func(t *testing.T) {
+		assert := require.New(t)
+		tts := uint32(100)
+
+		cmd := multicastsetup.Command{
+			CID: multicastsetup.McClassBSessionAns,
+			Payload: &multicastsetup.McClassBSessionAnsPayload{
+				StatusAndMcGroupID: multicastsetup.McClassBSessionAnsPayloadStatusAndMcGroupID{
+					McGroupID: 1,
+				},
+				TimeToStart: &tts,
+			},
+		}
+		b, err := cmd.MarshalBinary()
+		assert.NoError(err)
+		assert.NoError(HandleRemoteMulticastSetupCommand(context.Background(), ts.tx, ts.Device.DevEUI, b))
+
+		sess, err := storage.GetRemoteMulticastClassBSessionByGroupID(context.Background(), ts.tx, ts.Device.DevEUI, 1, false)
+		assert.NoError(err)
+		assert.True(sess.StateProvisioned)
+
+		devices, err := storage.GetDevicesForMulticastGroup(context.Background(), ts.tx, sess.MulticastGroupID, 10, 0)
+		assert.NoError(err)
+		assert.Len(devices, 1)
+	})
+}
+
 func TestMulticastSetup(t *testing.T) {
 	suite.Run(t, new(MulticastSetupTestSuite))
 }
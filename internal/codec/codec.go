@@ -2,10 +2,14 @@ package codec
 
 import (
 	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/lib/pq/hstore"
+	"github.com/pkg/errors"
 
 	"github.com/brocaar/chirpstack-application-server/internal/codec/cayennelpp"
 	"github.com/brocaar/chirpstack-application-server/internal/codec/js"
-	"github.com/lib/pq/hstore"
 )
 
 // Type defines the codec type.
@@ -18,40 +22,223 @@ const (
 	CustomJSType   Type = "CUSTOM_JS"
 )
 
+// Capability defines the codec capability flags.
+type Capability int
+
+// Codec capabilities.
+const (
+	Decode Capability = 1 << iota
+	Encode
+
+	DecodeEncode = Decode | Encode
+)
+
+// errors
+var (
+	ErrUnknownType        = errors.New("unknown codec type")
+	ErrInvalidConfig      = errors.New("invalid codec configuration")
+	ErrDecodeNotSupported = errors.New("codec does not support decoding")
+	ErrEncodeNotSupported = errors.New("codec does not support encoding")
+)
+
+// Config holds the codec configuration as stored with the application or
+// device-profile.
+type Config struct {
+	EncoderScript string
+	DecoderScript string
+}
+
+// Codec defines the interface that a payload codec must implement.
+type Codec interface {
+	// Type returns the codec type, which is stored as payload codec with
+	// the application or device-profile.
+	Type() Type
+
+	// Name returns the human-readable name of the codec.
+	Name() string
+
+	// Capabilities returns the capability flags of the codec.
+	Capabilities() Capability
+
+	// ValidateConfig validates the given codec configuration.
+	ValidateConfig(conf Config) error
+
+	// BinaryToJSON decodes the given binary payload to JSON.
+	BinaryToJSON(conf Config, fPort uint8, variables map[string]string, b []byte) ([]byte, error)
+
+	// JSONToBinary encodes the given JSON to binary.
+	JSONToBinary(conf Config, fPort uint8, variables map[string]string, jsonB []byte) ([]byte, error)
+}
+
+var (
+	codecsMux sync.RWMutex
+	codecs    = make(map[Type]Codec)
+)
+
+func init() {
+	Register(cayenneLPPCodec{})
+	Register(customJSCodec{})
+}
+
+// Register registers the given codec. It panics when a codec with the same
+// type has already been registered, or when the type equals None.
+func Register(c Codec) {
+	codecsMux.Lock()
+	defer codecsMux.Unlock()
+
+	if c.Type() == None {
+		panic("codec: codec type must not be empty")
+	}
+
+	if _, ok := codecs[c.Type()]; ok {
+		panic(fmt.Sprintf("codec: codec %s already registered", c.Type()))
+	}
+
+	codecs[c.Type()] = c
+}
+
+// Get returns the codec for the given type.
+func Get(t Type) (Codec, error) {
+	codecsMux.RLock()
+	defer codecsMux.RUnlock()
+
+	c, ok := codecs[t]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownType, "codec %s", t)
+	}
+
+	return c, nil
+}
+
+// List returns all registered codecs, sorted by type.
+func List() []Codec {
+	codecsMux.RLock()
+	defer codecsMux.RUnlock()
+
+	var out []Codec
+	for _, c := range codecs {
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Type() < out[j].Type()
+	})
+
+	return out
+}
+
+// ValidateConfig validates the codec configuration for the given codec
+// type. When the type equals None, no validation is performed.
+func ValidateConfig(t Type, conf Config) error {
+	if t == None {
+		return nil
+	}
+
+	c, err := Get(t)
+	if err != nil {
+		return err
+	}
+
+	return c.ValidateConfig(conf)
+}
+
 // BinaryToJSON encodes the given binary payload to JSON.
 func BinaryToJSON(t Type, fPort uint8, variables hstore.Hstore, decodeScript string, b []byte) ([]byte, error) {
-	vars := make(map[string]string)
-	for k, v := range variables.Map {
-		if v.Valid {
-			vars[k] = v.String
-		}
+	c, err := Get(t)
+	if err != nil {
+		return nil, err
 	}
 
-	switch t {
-	case CayenneLPPType:
-		return cayennelpp.BinaryToJSON(b)
-	case CustomJSType:
-		return js.BinaryToJSON(fPort, vars, decodeScript, b)
-	default:
-		return nil, fmt.Errorf("unknown codec type: %s", t)
+	if c.Capabilities()&Decode == 0 {
+		return nil, ErrDecodeNotSupported
 	}
+
+	return c.BinaryToJSON(Config{DecoderScript: decodeScript}, fPort, hstoreToMap(variables), b)
 }
 
 // JSONToBinary encodes the given JSON to binary.
 func JSONToBinary(t Type, fPort uint8, variables hstore.Hstore, encodeScript string, jsonB []byte) ([]byte, error) {
+	c, err := Get(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Capabilities()&Encode == 0 {
+		return nil, ErrEncodeNotSupported
+	}
+
+	return c.JSONToBinary(Config{EncoderScript: encodeScript}, fPort, hstoreToMap(variables), jsonB)
+}
+
+// ErrorPosition returns the line and column within the codec script at which
+// the given codec error occurred, if available.
+func ErrorPosition(err error) (line, column int, ok bool) {
+	return js.ErrorPosition(err)
+}
+
+func hstoreToMap(variables hstore.Hstore) map[string]string {
 	vars := make(map[string]string)
 	for k, v := range variables.Map {
 		if v.Valid {
 			vars[k] = v.String
 		}
 	}
+	return vars
+}
+
+// cayenneLPPCodec implements the Cayenne LPP codec.
+type cayenneLPPCodec struct{}
+
+func (c cayenneLPPCodec) Type() Type {
+	return CayenneLPPType
+}
 
-	switch t {
-	case CayenneLPPType:
-		return cayennelpp.JSONToBinary(jsonB)
-	case CustomJSType:
-		return js.JSONToBinary(fPort, vars, encodeScript, jsonB)
-	default:
-		return nil, fmt.Errorf("unknown codec type: %s", t)
+func (c cayenneLPPCodec) Name() string {
+	return "Cayenne LPP"
+}
+
+func (c cayenneLPPCodec) Capabilities() Capability {
+	return DecodeEncode
+}
+
+func (c cayenneLPPCodec) ValidateConfig(conf Config) error {
+	return nil
+}
+
+func (c cayenneLPPCodec) BinaryToJSON(conf Config, fPort uint8, variables map[string]string, b []byte) ([]byte, error) {
+	return cayennelpp.BinaryToJSON(b)
+}
+
+func (c cayenneLPPCodec) JSONToBinary(conf Config, fPort uint8, variables map[string]string, jsonB []byte) ([]byte, error) {
+	return cayennelpp.JSONToBinary(jsonB)
+}
+
+// customJSCodec implements the custom JavaScript codec.
+type customJSCodec struct{}
+
+func (c customJSCodec) Type() Type {
+	return CustomJSType
+}
+
+func (c customJSCodec) Name() string {
+	return "Custom JavaScript codec functions"
+}
+
+func (c customJSCodec) Capabilities() Capability {
+	return DecodeEncode
+}
+
+func (c customJSCodec) ValidateConfig(conf Config) error {
+	if conf.DecoderScript == "" && conf.EncoderScript == "" {
+		return errors.Wrap(ErrInvalidConfig, "decoder and / or encoder script must be set")
 	}
+	return nil
+}
+
+func (c customJSCodec) BinaryToJSON(conf Config, fPort uint8, variables map[string]string, b []byte) ([]byte, error) {
+	return js.BinaryToJSON(fPort, variables, conf.DecoderScript, b)
+}
+
+func (c customJSCodec) JSONToBinary(conf Config, fPort uint8, variables map[string]string, jsonB []byte) ([]byte, error) {
+	return js.JSONToBinary(fPort, variables, conf.EncoderScript, jsonB)
 }
@@ -0,0 +1,125 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/lib/pq/hstore"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type decodeOnlyCodec struct{}
+
+func (c decodeOnlyCodec) Type() Type {
+	return "DECODE_ONLY"
+}
+
+func (c decodeOnlyCodec) Name() string {
+	return "Decode only"
+}
+
+func (c decodeOnlyCodec) Capabilities() Capability {
+	return Decode
+}
+
+func (c decodeOnlyCodec) ValidateConfig(conf Config) error {
+	return nil
+}
+
+func (c decodeOnlyCodec) BinaryToJSON(conf Config, fPort uint8, variables map[string]string, b []byte) ([]byte, error) {
+	return []byte(`{}`), nil
+}
+
+func (c decodeOnlyCodec) JSONToBinary(conf Config, fPort uint8, variables map[string]string, jsonB []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func TestRegistry(t *testing.T) {
+	Register(decodeOnlyCodec{})
+	defer func() {
+		codecsMux.Lock()
+		delete(codecs, decodeOnlyCodec{}.Type())
+		codecsMux.Unlock()
+	}()
+
+	t.Run("Register duplicate", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Panics(func() {
+			Register(decodeOnlyCodec{})
+		})
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		assert := require.New(t)
+
+		c, err := Get(CayenneLPPType)
+		assert.NoError(err)
+		assert.Equal(CayenneLPPType, c.Type())
+
+		_, err = Get("UNKNOWN")
+		assert.Equal(ErrUnknownType, errors.Cause(err))
+	})
+
+	t.Run("List", func(t *testing.T) {
+		assert := require.New(t)
+
+		var types []Type
+		for _, c := range List() {
+			types = append(types, c.Type())
+		}
+		assert.Equal([]Type{CayenneLPPType, CustomJSType, "DECODE_ONLY"}, types)
+	})
+
+	t.Run("Capabilities", func(t *testing.T) {
+		assert := require.New(t)
+
+		b, err := BinaryToJSON("DECODE_ONLY", 1, hstore.Hstore{}, "", []byte{1})
+		assert.NoError(err)
+		assert.Equal(`{}`, string(b))
+
+		_, err = JSONToBinary("DECODE_ONLY", 1, hstore.Hstore{}, "", []byte(`{}`))
+		assert.Equal(ErrEncodeNotSupported, err)
+	})
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Type          Type
+		Config        Config
+		ExpectedError error
+	}{
+		{
+			Name: "no codec",
+			Type: None,
+		},
+		{
+			Name: "cayenne lpp",
+			Type: CayenneLPPType,
+		},
+		{
+			Name: "custom js with decoder script",
+			Type: CustomJSType,
+			Config: Config{
+				DecoderScript: "function Decode(fPort, bytes) { return {}; }",
+			},
+		},
+		{
+			Name:          "custom js without scripts",
+			Type:          CustomJSType,
+			ExpectedError: ErrInvalidConfig,
+		},
+		{
+			Name:          "unknown codec",
+			Type:          "UNKNOWN",
+			ExpectedError: ErrUnknownType,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.ExpectedError, errors.Cause(ValidateConfig(tst.Type, tst.Config)))
+		})
+	}
+}
@@ -4,34 +4,50 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/brocaar/chirpstack-application-server/internal/config"
 	"github.com/pkg/errors"
 	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/parser"
 )
 
+var stackPositionRegexp = regexp.MustCompile(`:(\d+):(\d+)\)?\s*(?:\n|$)`)
+
 var (
 	maxExecutionTime = 10 * time.Millisecond
+	pool             = newRuntimePool(10, 1000)
 )
 
 // Setup configures the JS codec.
 func Setup(conf config.Config) error {
 	maxExecutionTime = conf.ApplicationServer.Codec.JS.MaxExecutionTime
+
+	poolSize := conf.ApplicationServer.Codec.JS.PoolSize
+	if poolSize <= 0 {
+		poolSize = 10
+	}
+
+	cacheSize := conf.ApplicationServer.Codec.JS.ScriptCacheSize
+	if cacheSize <= 0 {
+		cacheSize = 1000
+	}
+
+	pool = newRuntimePool(poolSize, cacheSize)
+
 	return nil
 }
 
 // BinaryToJSON encodes the given binary payload to JSON.
 func BinaryToJSON(fPort uint8, variables map[string]string, decodeScript string, b []byte) ([]byte, error) {
-	decodeScript = decodeScript + "\n\nDecode(fPort, bytes, variables);\n"
-
-	vars := make(map[string]interface{})
-
-	vars["fPort"] = fPort
-	vars["bytes"] = b
-	vars["variables"] = variables
+	// The script is wrapped inside a function so that the functions and
+	// variables it declares do not leak into the global scope of the
+	// (re-used) VM. The wrapper takes exactly one line, see ErrorPosition.
+	decodeScript = "(function(fPort, bytes, variables) {\n" + decodeScript + "\n\nreturn Decode(fPort, bytes, variables);\n})"
 
-	v, err := executeJS(decodeScript, vars)
+	v, err := executeJS(decodeScript, fPort, b, variables)
 	if err != nil {
 		return nil, errors.Wrap(err, "execute js error")
 	}
@@ -46,15 +62,9 @@ func JSONToBinary(fPort uint8, variables map[string]string, encodeScript string,
 		return nil, errors.Wrap(err, "unmarshal json error")
 	}
 
-	encodeScript = encodeScript + "\n\nEncode(fPort, obj, variables);"
+	encodeScript = "(function(fPort, obj, variables) {\n" + encodeScript + "\n\nreturn Encode(fPort, obj, variables);\n})"
 
-	vars := make(map[string]interface{})
-
-	vars["fPort"] = fPort
-	vars["obj"] = v
-	vars["variables"] = variables
-
-	v, err := executeJS(encodeScript, vars)
+	v, err := executeJS(encodeScript, fPort, v, variables)
 	if err != nil {
 		return nil, errors.Wrap(err, "execute js error")
 	}
@@ -62,34 +72,89 @@ func JSONToBinary(fPort uint8, variables map[string]string, encodeScript string,
 	return interfaceToByteSlice(v)
 }
 
-func executeJS(script string, vars map[string]interface{}) (out interface{}, err error) {
+// ErrorPosition returns the line and column within the codec script at which
+// the given error occurred. It returns false when the error does not contain
+// position information (e.g. on an execution timeout).
+func ErrorPosition(err error) (line, column int, ok bool) {
+	switch e := errors.Cause(err).(type) {
+	case *parser.Error:
+		line, column = e.Position.Line, e.Position.Column
+	case parser.ErrorList:
+		if len(e) == 0 {
+			return 0, 0, false
+		}
+		line, column = e[0].Position.Line, e[0].Position.Column
+	case *otto.Error:
+		line, column, _ = stackPosition(e.String())
+	case otto.Error:
+		line, column, _ = stackPosition(e.String())
+	default:
+		return 0, 0, false
+	}
+
+	// correct for the function wrapper line
+	line = line - 1
+	if line < 1 {
+		return 0, 0, false
+	}
+
+	return line, column, true
+}
+
+// stackPosition returns the position of the top stack frame of the given
+// otto error string, e.g. "    at Decode (<anonymous>:3:12)".
+func stackPosition(s string) (int, int, bool) {
+	match := stackPositionRegexp.FindStringSubmatch(s)
+	if match == nil {
+		return 0, 0, false
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	column, _ := strconv.Atoi(match[2])
+	return line, column, true
+}
+
+// executeJS executes the given script, which must evaluate to a function,
+// with the given arguments using a VM from the pool.
+func executeJS(script string, args ...interface{}) (out interface{}, err error) {
+	rt := pool.get(script)
+
+	// A VM is only returned to the pool when the execution was not
+	// interrupted, as its state is unknown after a panic.
+	reusable := false
+	defer func() {
+		pool.put(rt, reusable)
+	}()
+
 	defer func() {
 		if caught := recover(); caught != nil {
 			err = fmt.Errorf("%s", caught)
 		}
 	}()
 
-	vm := otto.New()
-	vm.Interrupt = make(chan func(), 1)
-	vm.SetStackDepthLimit(32)
-
-	for k, v := range vars {
-		if err := vm.Set(k, v); err != nil {
-			return nil, errors.Wrap(err, "set variable error")
-		}
+	fn, err := rt.function(pool, script)
+	if err != nil {
+		reusable = true
+		return nil, errors.Wrap(err, "js vm error")
 	}
 
-	go func() {
-		time.Sleep(maxExecutionTime)
-		vm.Interrupt <- func() {
+	timer := time.AfterFunc(maxExecutionTime, func() {
+		rt.vm.Interrupt <- func() {
 			panic(errors.New("execution timeout"))
 		}
-	}()
+	})
+
+	val, err := fn.Call(otto.NullValue(), args...)
+
+	// When the timer already fired, the interrupt has not been handled by
+	// the VM as the execution completed. Remove it so that it does not
+	// interrupt the next execution.
+	if !timer.Stop() {
+		<-rt.vm.Interrupt
+	}
+	reusable = true
 
-	var val otto.Value
-	val, err = vm.Run(script)
 	if err != nil {
-		fmt.Println(err)
 		return nil, errors.Wrap(err, "js vm error")
 	}
 
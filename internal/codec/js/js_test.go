@@ -202,3 +202,46 @@ func TestJSEncode(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		Name           string
+		Script         string
+		ExpectedOK     bool
+		ExpectedLine   int
+		ExpectedColumn int
+	}{
+		{
+			Name:           "syntax error",
+			Script:         "function Decode(fPort, bytes) {\n  return {;\n}",
+			ExpectedOK:     true,
+			ExpectedLine:   2,
+			ExpectedColumn: 11,
+		},
+		{
+			Name:           "runtime error",
+			Script:         "function Decode(fPort, bytes) {\n  return foo.bar;\n}",
+			ExpectedOK:     true,
+			ExpectedLine:   2,
+			ExpectedColumn: 10,
+		},
+		{
+			Name:   "timeout",
+			Script: "function Decode(fPort, bytes) {\n  while(true) {}\n}",
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := BinaryToJSON(1, nil, tst.Script, []byte{1})
+			assert.Error(err)
+
+			line, column, ok := ErrorPosition(err)
+			assert.Equal(tst.ExpectedOK, ok)
+			assert.Equal(tst.ExpectedLine, line)
+			assert.Equal(tst.ExpectedColumn, column)
+		})
+	}
+}
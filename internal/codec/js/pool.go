@@ -0,0 +1,189 @@
+package js
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/robertkrimen/otto"
+)
+
+// runtimePool implements a bounded pool of re-usable JavaScript VMs. The
+// compiled scripts are shared between the VMs of the pool.
+//
+// A VM is bound to the script it was first used for and is only re-used for
+// executions of that same script. Globals assigned or builtins patched by
+// one codec script therefore never leak into the execution of another.
+type runtimePool struct {
+	tokens chan struct{}
+	size   int
+
+	idleMux sync.Mutex
+	idle    *list.List
+
+	scriptsMux sync.Mutex
+	scripts    *lruCache
+}
+
+// runtime holds a VM together with the function that has been created by
+// evaluating the compiled script within this VM.
+type runtime struct {
+	vm   *otto.Otto
+	hash string
+	fn   otto.Value
+}
+
+func newRuntimePool(size, cacheSize int) *runtimePool {
+	return &runtimePool{
+		tokens:  make(chan struct{}, size),
+		size:    size,
+		idle:    list.New(),
+		scripts: newLRUCache(cacheSize),
+	}
+}
+
+// get returns a VM for the given script from the pool. It blocks until a VM
+// is available when the maximum number of VMs is in use. A new VM is created
+// when there is no idle VM bound to the given script.
+func (p *runtimePool) get(script string) *runtime {
+	p.tokens <- struct{}{}
+
+	hash := scriptHash(script)
+
+	p.idleMux.Lock()
+	defer p.idleMux.Unlock()
+
+	for el := p.idle.Front(); el != nil; el = el.Next() {
+		if rt := el.Value.(*runtime); rt.hash == hash {
+			p.idle.Remove(el)
+			return rt
+		}
+	}
+
+	return p.newRuntime(hash)
+}
+
+// put returns the VM to the pool. When reusable is false, the VM is
+// discarded and a new VM will be created on the next get. When the pool
+// holds more idle VMs than its size, the least recently used VM is
+// discarded.
+func (p *runtimePool) put(rt *runtime, reusable bool) {
+	if reusable {
+		p.idleMux.Lock()
+		p.idle.PushFront(rt)
+		if p.idle.Len() > p.size {
+			p.idle.Remove(p.idle.Back())
+		}
+		p.idleMux.Unlock()
+	}
+
+	<-p.tokens
+}
+
+func (p *runtimePool) newRuntime(hash string) *runtime {
+	vm := otto.New()
+	vm.Interrupt = make(chan func(), 1)
+	vm.SetStackDepthLimit(32)
+
+	return &runtime{
+		vm:   vm,
+		hash: hash,
+	}
+}
+
+// compile returns the compiled script for the given hash, compiling and
+// caching it using the given VM when it is not yet cached.
+func (p *runtimePool) compile(vm *otto.Otto, hash, script string) (*otto.Script, error) {
+	p.scriptsMux.Lock()
+	defer p.scriptsMux.Unlock()
+
+	if s, ok := p.scripts.get(hash); ok {
+		return s.(*otto.Script), nil
+	}
+
+	s, err := vm.Compile("", script)
+	if err != nil {
+		return nil, err
+	}
+	p.scripts.add(hash, s)
+
+	return s, nil
+}
+
+// function returns the function that the script of the runtime evaluates
+// to.
+func (rt *runtime) function(p *runtimePool, script string) (otto.Value, error) {
+	if rt.fn.IsDefined() {
+		return rt.fn, nil
+	}
+
+	s, err := p.compile(rt.vm, rt.hash, script)
+	if err != nil {
+		return otto.Value{}, err
+	}
+
+	fn, err := rt.vm.Run(s)
+	if err != nil {
+		return otto.Value{}, err
+	}
+	rt.fn = fn
+
+	return fn, nil
+}
+
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// lruCache implements a least-recently-used cache. It is not safe for
+// concurrent use.
+type lruCache struct {
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	value interface{}
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem).value, true
+}
+
+func (c *lruCache) add(key string, value interface{}) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		el.Value.(*lruItem).value = value
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, value: value})
+
+	if c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruItem).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	return c.ll.Len()
+}
@@ -0,0 +1,131 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimePool(t *testing.T) {
+	assert := require.New(t)
+
+	oldPool := pool
+	pool = newRuntimePool(1, 10)
+	defer func() {
+		pool = oldPool
+	}()
+
+	script := `
+		function Decode(fPort, bytes) {
+			return {"port": fPort};
+		}
+	`
+
+	t.Run("Script is compiled once", func(t *testing.T) {
+		assert := require.New(t)
+
+		for i := 0; i < 3; i++ {
+			b, err := BinaryToJSON(10, nil, script, []byte{1})
+			assert.NoError(err)
+			assert.Equal(`{"port":10}`, string(b))
+		}
+
+		assert.Equal(1, pool.scripts.len())
+	})
+
+	t.Run("Declarations do not leak between scripts", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := BinaryToJSON(10, nil, "", []byte{1})
+		assert.EqualError(err, "execute js error: js vm error: ReferenceError: 'Decode' is not defined")
+	})
+
+	t.Run("VM is replaced after timeout", func(t *testing.T) {
+		assert := require.New(t)
+
+		timeoutScript := "function Decode() { while(true) {} }"
+		wrapped := "(function(fPort, bytes, variables) {\n" + timeoutScript + "\n\nreturn Decode(fPort, bytes, variables);\n})"
+		rt := pool.get(wrapped)
+		pool.put(rt, true)
+
+		_, err := BinaryToJSON(10, nil, timeoutScript, []byte{1})
+		assert.EqualError(err, "execute js error: execution timeout")
+
+		b, err := BinaryToJSON(10, nil, script, []byte{1})
+		assert.NoError(err)
+		assert.Equal(`{"port":10}`, string(b))
+
+		rt2 := pool.get(wrapped)
+		pool.put(rt2, true)
+		assert.False(rt == rt2)
+	})
+
+	t.Run("Global assignments do not leak between scripts", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := BinaryToJSON(10, nil, `
+			function Decode(fPort, bytes) {
+				leaked = "secret";
+				return {};
+			}
+		`, []byte{1})
+		assert.NoError(err)
+
+		b, err := BinaryToJSON(10, nil, `
+			function Decode(fPort, bytes) {
+				return {"leaked": typeof leaked};
+			}
+		`, []byte{1})
+		assert.NoError(err)
+		assert.Equal(`{"leaked":"undefined"}`, string(b))
+	})
+
+	t.Run("Patched builtins do not leak between scripts", func(t *testing.T) {
+		assert := require.New(t)
+
+		_, err := BinaryToJSON(10, nil, `
+			function Decode(fPort, bytes) {
+				JSON.stringify = function() { return "patched"; };
+				Array.prototype.join = function() { return "patched"; };
+				return {};
+			}
+		`, []byte{1})
+		assert.NoError(err)
+
+		b, err := BinaryToJSON(10, nil, `
+			function Decode(fPort, bytes) {
+				return {"json": JSON.stringify([1]), "join": [1, 2].join("-")};
+			}
+		`, []byte{1})
+		assert.NoError(err)
+		assert.Equal(`{"join":"1-2","json":"[1]"}`, string(b))
+	})
+
+	assert.Len(pool.tokens, 0)
+}
+
+func TestLRUCache(t *testing.T) {
+	assert := require.New(t)
+
+	c := newLRUCache(2)
+	c.add("a", 1)
+	c.add("b", 2)
+
+	_, ok := c.get("a")
+	assert.True(ok)
+
+	// b is the least recently used item
+	c.add("c", 3)
+	assert.Equal(2, c.len())
+
+	_, ok = c.get("b")
+	assert.False(ok)
+
+	v, ok := c.get("a")
+	assert.True(ok)
+	assert.Equal(1, v)
+
+	v, ok = c.get("c")
+	assert.True(ok)
+	assert.Equal(3, v)
+}
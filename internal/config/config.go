@@ -39,19 +39,40 @@ type Config struct {
 				ClientSecret            string `mapstructure:"client_secret"`
 				RedirectURL             string `mapstructure:"redirect_url"`
 				LoginLabel              string `mapstructure:"login_label"`
+
+				GroupsClaim   string             `mapstructure:"groups_claim"`
+				GroupMappings []OIDCGroupMapping `mapstructure:"group_mapping"`
 			} `mapstructure:"openid_connect"`
+
+			MFA struct {
+				Issuer           string        `mapstructure:"issuer"`
+				RequireForAdmins bool          `mapstructure:"require_for_admins"`
+				ChallengeTTL     time.Duration `mapstructure:"challenge_ttl"`
+			} `mapstructure:"mfa"`
 		} `mapstructure:"user_authentication"`
 
 		Codec struct {
 			JS struct {
 				MaxExecutionTime time.Duration `mapstructure:"max_execution_time"`
+				PoolSize         int           `mapstructure:"pool_size"`
+				ScriptCacheSize  int           `mapstructure:"script_cache_size"`
 			} `mapstructure:"js"`
 		} `mapstructure:"codec"`
 
+		UplinkDeduplication struct {
+			TTL time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"uplink_deduplication"`
+
+		DeviceEventLog struct {
+			MaxLength int64         `mapstructure:"max_length"`
+			TTL       time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"device_event_log"`
+
 		Integration struct {
 			Marshaler       string                      `mapstructure:"marshaler"`
 			Backend         string                      `mapstructure:"backend"` // deprecated
 			Enabled         []string                    `mapstructure:"enabled"`
+			Retry           IntegrationRetryConfig      `mapstructure:"retry"`
 			AWSSNS          IntegrationAWSSNSConfig     `mapstructure:"aws_sns"`
 			AzureServiceBus IntegrationAzureConfig      `mapstructure:"azure_service_bus"`
 			MQTT            IntegrationMQTTConfig       `mapstructure:"mqtt"`
@@ -94,6 +115,17 @@ type Config struct {
 			FragIndex int `mapstructure:"frag_index"`
 		} `mapstructure:"fuota_deployment"`
 
+		GatewayStatus struct {
+			CheckInterval    time.Duration `mapstructure:"check_interval"`
+			CheckBatchSize   int           `mapstructure:"check_batch_size"`
+			OfflineThreshold time.Duration `mapstructure:"offline_threshold"`
+		} `mapstructure:"gateway_status"`
+
+		DeviceAlert struct {
+			CheckInterval  time.Duration `mapstructure:"check_interval"`
+			CheckBatchSize int           `mapstructure:"check_batch_size"`
+		} `mapstructure:"device_alert"`
+
 		Branding struct {
 			Footer       string
 			Registration string
@@ -140,6 +172,25 @@ type Config struct {
 	} `mapstructure:"monitoring"`
 }
 
+// OIDCGroupMapping holds the mapping of an OpenID Connect group to an
+// organization membership.
+type OIDCGroupMapping struct {
+	Group          string `mapstructure:"group"`
+	OrganizationID int64  `mapstructure:"organization_id"`
+	IsAdmin        bool   `mapstructure:"is_admin"`
+	IsDeviceAdmin  bool   `mapstructure:"is_device_admin"`
+	IsGatewayAdmin bool   `mapstructure:"is_gateway_admin"`
+}
+
+// IntegrationRetryConfig holds the integration retry configuration.
+type IntegrationRetryConfig struct {
+	MaxAttempts         int           `mapstructure:"max_attempts"`
+	InitialInterval     time.Duration `mapstructure:"initial_interval"`
+	MaxInterval         time.Duration `mapstructure:"max_interval"`
+	MaxPending          int           `mapstructure:"max_pending"`
+	DeadLetterRetention time.Duration `mapstructure:"dead_letter_retention"`
+}
+
 // IntegrationMQTTConfig holds the configuration for the MQTT integration.
 type IntegrationMQTTConfig struct {
 	Server               string        `mapstructure:"server"`
@@ -156,6 +207,8 @@ type IntegrationMQTTConfig struct {
 	CommandTopicTemplate string        `mapstructure:"command_topic_template"`
 	RetainEvents         bool          `mapstructure:"retain_events"`
 
+	GatewayEventTopicTemplate string `mapstructure:"gateway_event_topic_template"`
+
 	// For backards compatibility
 	UplinkTopicTemplate        string `mapstructure:"uplink_topic_template"`
 	DownlinkTopicTemplate      string `mapstructure:"downlink_topic_template"`
@@ -211,8 +264,12 @@ type IntegrationPostgreSQLConfig struct {
 
 // IntegrationAMQPConfig holds the AMQP integration configuration.
 type IntegrationAMQPConfig struct {
-	URL                     string `mapstructure:"url"`
-	EventRoutingKeyTemplate string `mapstructure:"event_routing_key_template"`
+	URL                       string `mapstructure:"url"`
+	EventRoutingKeyTemplate   string `mapstructure:"event_routing_key_template"`
+	CommandRoutingKeyTemplate string `mapstructure:"command_routing_key_template"`
+	CommandQueueName          string `mapstructure:"command_queue_name"`
+	DeadLetterExchangeName    string `mapstructure:"dead_letter_exchange_name"`
+	DeadLetterQueueName       string `mapstructure:"dead_letter_queue_name"`
 }
 
 // IntegrationKafkaConfig holds the Kafka integration configuration.
@@ -220,6 +277,8 @@ type IntegrationKafkaConfig struct {
 	Brokers          []string `mapstructure:"brokers"`
 	Topic            string   `mapstructure:"topic"`
 	EventKeyTemplate string   `mapstructure:"event_key_template"`
+	CommandTopic     string   `mapstructure:"command_topic"`
+	ConsumerGroupID  string   `mapstructure:"consumer_group_id"`
 }
 
 // AzurePublishMode defines the publish-mode type.
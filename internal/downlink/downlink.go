@@ -31,12 +31,17 @@ func HandleDataDownPayloads(downChan chan models.DataDownPayload) {
 			ctx := context.Background()
 			ctx = context.WithValue(ctx, logging.ContextIDKey, ctxID)
 
-			if err := handleDataDownPayload(ctx, pl); err != nil {
+			err = handleDataDownPayload(ctx, pl)
+			if err != nil {
 				log.WithFields(log.Fields{
 					"dev_eui":        pl.DevEUI,
 					"application_id": pl.ApplicationID,
 				}).Errorf("handle data-down payload error: %s", err)
 			}
+
+			if pl.Callback != nil {
+				pl.Callback(err)
+			}
 		}(pl)
 	}
 }
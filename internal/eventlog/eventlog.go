@@ -4,103 +4,222 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/go-redis/redis/v7"
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/brocaar/chirpstack-application-server/internal/config"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 	"github.com/brocaar/lorawan"
 )
 
 const (
-	deviceEventUplinkPubSubKeyTempl = "lora:as:device:%s:pubsub:event"
+	deviceEventStreamKeyTempl = "lora:as:device:%s:stream:event"
 )
 
 // Event types.
 const (
-	Uplink      = "up"
-	ACK         = "ack"
-	Join        = "join"
-	Error       = "error"
-	Status      = "status"
-	Location    = "location"
-	TxAck       = "txack"
-	Integration = "integration"
+	Uplink        = "up"
+	ACK           = "ack"
+	Join          = "join"
+	Error         = "error"
+	Status        = "status"
+	Location      = "location"
+	TxAck         = "txack"
+	Integration   = "integration"
+	Management    = "management"
+	Alert         = "alert"
+	GatewayStatus = "gateway_status"
+)
+
+var (
+	maxLength int64 = 100
+	ttl             = time.Hour * 24 * 7
+
+	// blockDuration defines the max. duration that a stream read blocks
+	// before the context is checked for cancellation.
+	blockDuration = time.Second
 )
 
 // EventLog contains an event log.
 type EventLog struct {
+	ID      string
 	Type    string
 	Payload json.RawMessage
 }
 
-// LogEventForDevice logs an event for the given device.
-func LogEventForDevice(devEUI lorawan.EUI64, t string, msg proto.Message) error {
-	b, err := marshaler.Marshal(marshaler.ProtobufJSON, msg)
-	if err != nil {
-		return errors.Wrap(err, "marshal protobuf json error")
+// Setup configures the eventlog package.
+func Setup(conf config.Config) error {
+	if conf.ApplicationServer.DeviceEventLog.MaxLength > 0 {
+		maxLength = conf.ApplicationServer.DeviceEventLog.MaxLength
 	}
 
-	el := EventLog{
-		Type:    t,
-		Payload: json.RawMessage(b),
+	if conf.ApplicationServer.DeviceEventLog.TTL > 0 {
+		ttl = conf.ApplicationServer.DeviceEventLog.TTL
 	}
 
-	key := fmt.Sprintf(deviceEventUplinkPubSubKeyTempl, devEUI)
-	b, err = json.Marshal(el)
+	return nil
+}
+
+// LogEventForDevice logs an event for the given device. The event is added
+// to the event stream of the device, which is capped to the configured max
+// length and expires after the configured TTL.
+func LogEventForDevice(devEUI lorawan.EUI64, t string, msg proto.Message) error {
+	b, err := marshaler.Marshal(marshaler.ProtobufJSON, msg)
 	if err != nil {
-		return errors.Wrap(err, "json encode error")
+		return errors.Wrap(err, "marshal protobuf json error")
 	}
 
-	err = storage.RedisClient().Publish(key, b).Err()
-	if err != nil {
-		return errors.Wrap(err, "publish device event error")
+	key := fmt.Sprintf(deviceEventStreamKeyTempl, devEUI)
+
+	pipe := storage.RedisClient().TxPipeline()
+	pipe.XAdd(&redis.XAddArgs{
+		Stream:       key,
+		MaxLenApprox: maxLength,
+		Values: map[string]interface{}{
+			"type":    t,
+			"payload": b,
+		},
+	})
+	pipe.PExpire(key, ttl)
+
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "add device event error")
 	}
 
 	return nil
 }
 
-// GetEventLogForDevice subscribes to the device events for the given DevEUI
-// and sends this to the given channel.
-func GetEventLogForDevice(ctx context.Context, devEUI lorawan.EUI64, eventsChan chan EventLog) error {
-	key := fmt.Sprintf(deviceEventUplinkPubSubKeyTempl, devEUI)
+// GetEventLogForDevice reads the device events for the given DevEUI and sends
+// these to the given channel. When fromID is set, it starts with the events
+// logged after the event with the given ID, else it only sends new events.
+// As the stream is read using blocking reads, a dedicated Redis connection is
+// used for each call, so that subscribers do not exhaust the shared pool.
+func GetEventLogForDevice(ctx context.Context, devEUI lorawan.EUI64, fromID string, eventsChan chan EventLog) error {
+	key := fmt.Sprintf(deviceEventStreamKeyTempl, devEUI)
+
+	client := storage.NewRedisClient(1)
+	defer client.Close()
+
+	lastID := fromID
+	if lastID == "" {
+		// Use the ID of the last event in the stream, rather than "$", so
+		// that no events are missed in between two reads.
+		msgs, err := client.XRevRangeN(key, "+", "-", 1).Result()
+		if err != nil {
+			return errors.Wrap(err, "read stream error")
+		}
 
-	sub := storage.RedisClient().Subscribe(key)
-	_, err := sub.Receive()
-	if err != nil {
-		return errors.Wrap(err, "subscribe error")
+		lastID = "0-0"
+		if len(msgs) != 0 {
+			lastID = msgs[0].ID
+		}
 	}
 
-	ch := sub.Channel()
-
 	for {
 		select {
-		case msg := <-ch:
-			if msg == nil {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		streams, err := client.XRead(&redis.XReadArgs{
+			Streams: []string{key, lastID},
+			Block:   blockDuration,
+		}).Result()
+		if err != nil {
+			if err == redis.Nil {
 				continue
 			}
+			return errors.Wrap(err, "read stream error")
+		}
 
-			el, err := redisMessageToEventLog(msg)
-			if err != nil {
-				log.WithError(err).Error("decode message error")
-			} else {
-				eventsChan <- el
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastID = msg.ID
+
+				el, err := redisMessageToEventLog(msg)
+				if err != nil {
+					log.WithError(err).Error("decode message error")
+					continue
+				}
+
+				select {
+				case eventsChan <- el:
+				case <-ctx.Done():
+					return nil
+				}
 			}
-		case <-ctx.Done():
-			sub.Close()
-			return nil
 		}
 	}
 }
 
-func redisMessageToEventLog(msg *redis.Message) (EventLog, error) {
-	var el EventLog
-	if err := json.Unmarshal([]byte(msg.Payload), &el); err != nil {
-		return el, errors.Wrap(err, "unmarshal message error")
+// GetEventLogsForDevice returns the logged events for the given DevEUI, most
+// recent events first. When before is set, only the events logged before the
+// event with the given ID are returned.
+func GetEventLogsForDevice(devEUI lorawan.EUI64, before string, limit int) ([]EventLog, error) {
+	key := fmt.Sprintf(deviceEventStreamKeyTempl, devEUI)
+
+	end := "+"
+	count := int64(limit)
+	if before != "" {
+		// the end of the range is inclusive
+		end = before
+		count++
+	}
+
+	msgs, err := storage.RedisClient().XRevRangeN(key, end, "-", count).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "read stream error")
+	}
+
+	var out []EventLog
+	for _, msg := range msgs {
+		if msg.ID == before || len(out) == limit {
+			continue
+		}
+
+		el, err := redisMessageToEventLog(msg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, el)
 	}
 
-	return el, nil
+	return out, nil
+}
+
+// GetEventLogCountForDevice returns the number of logged events for the given
+// DevEUI.
+func GetEventLogCountForDevice(devEUI lorawan.EUI64) (int, error) {
+	key := fmt.Sprintf(deviceEventStreamKeyTempl, devEUI)
+
+	count, err := storage.RedisClient().XLen(key).Result()
+	if err != nil {
+		return 0, errors.Wrap(err, "get stream length error")
+	}
+
+	return int(count), nil
+}
+
+func redisMessageToEventLog(msg redis.XMessage) (EventLog, error) {
+	t, ok := msg.Values["type"].(string)
+	if !ok {
+		return EventLog{}, fmt.Errorf("invalid or missing type field in message %s", msg.ID)
+	}
+
+	pl, ok := msg.Values["payload"].(string)
+	if !ok {
+		return EventLog{}, fmt.Errorf("invalid or missing payload field in message %s", msg.ID)
+	}
+
+	return EventLog{
+		ID:      msg.ID,
+		Type:    t,
+		Payload: json.RawMessage(pl),
+	}, nil
 }
@@ -3,6 +3,7 @@ package eventlog
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"log"
 	"testing"
 	"time"
@@ -37,7 +38,7 @@ func TestEventLog(t *testing.T) {
 		defer cancel()
 
 		go func() {
-			if err := GetEventLogForDevice(cctx, devEUI, logChannel); err != nil {
+			if err := GetEventLogForDevice(cctx, devEUI, "", logChannel); err != nil {
 				log.Fatal(err)
 			}
 		}()
@@ -58,7 +59,91 @@ func TestEventLog(t *testing.T) {
 			assert.NoError(um.Unmarshal(bytes.NewReader(el.Payload), &pl))
 
 			assert.Equal(Uplink, el.Type)
+			assert.NotEqual("", el.ID)
 			assert.True(proto.Equal(&upEvent, &pl))
 		})
 	})
+
+	t.Run("GetEventLogsForDevice", func(t *testing.T) {
+		assert := require.New(t)
+		devEUI := lorawan.EUI64{2, 2, 3, 4, 5, 6, 7, 8}
+
+		for _, typ := range []string{Join, Uplink, Status, Location, ACK, Error} {
+			assert.NoError(LogEventForDevice(devEUI, typ, &upEvent))
+		}
+
+		count, err := GetEventLogCountForDevice(devEUI)
+		assert.NoError(err)
+		assert.Equal(6, count)
+
+		ttl, err := storage.RedisClient().PTTL(fmt.Sprintf(deviceEventStreamKeyTempl, devEUI)).Result()
+		assert.NoError(err)
+		assert.True(ttl > 0)
+
+		t.Run("First page", func(t *testing.T) {
+			assert := require.New(t)
+
+			els, err := GetEventLogsForDevice(devEUI, "", 4)
+			assert.NoError(err)
+			assert.Len(els, 4)
+			assert.Equal([]string{Error, ACK, Location, Status}, eventTypes(els))
+
+			t.Run("Second page", func(t *testing.T) {
+				assert := require.New(t)
+
+				els, err := GetEventLogsForDevice(devEUI, els[3].ID, 4)
+				assert.NoError(err)
+				assert.Equal([]string{Uplink, Join}, eventTypes(els))
+			})
+		})
+
+		t.Run("Resume from ID", func(t *testing.T) {
+			assert := require.New(t)
+
+			els, err := GetEventLogsForDevice(devEUI, "", 6)
+			assert.NoError(err)
+
+			logChannel := make(chan EventLog, 6)
+			cctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			go func() {
+				if err := GetEventLogForDevice(cctx, devEUI, els[2].ID, logChannel); err != nil {
+					log.Fatal(err)
+				}
+			}()
+
+			assert.Equal(els[1], <-logChannel)
+			assert.Equal(els[0], <-logChannel)
+		})
+	})
+
+	t.Run("Max length", func(t *testing.T) {
+		assert := require.New(t)
+		devEUI := lorawan.EUI64{3, 2, 3, 4, 5, 6, 7, 8}
+
+		oldMaxLength := maxLength
+		maxLength = 1
+		defer func() {
+			maxLength = oldMaxLength
+		}()
+
+		// the stream is trimmed approximately, add enough items to make
+		// sure that trimming happened
+		for i := 0; i < 500; i++ {
+			assert.NoError(LogEventForDevice(devEUI, Uplink, &upEvent))
+		}
+
+		count, err := GetEventLogCountForDevice(devEUI)
+		assert.NoError(err)
+		assert.True(count < 500)
+	})
+}
+
+func eventTypes(els []EventLog) []string {
+	var out []string
+	for _, el := range els {
+		out = append(out, el.Type)
+	}
+	return out
 }
@@ -0,0 +1,26 @@
+package uplink
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cd = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "uplink_codec_decode_duration_seconds",
+		Help: "The duration of decoding the uplink payload (per device-profile and codec).",
+	}, []string{"device_profile_id", "codec"})
+
+	dc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "uplink_duplicate_count",
+		Help: "The number of uplinks that were dropped as duplicate.",
+	})
+)
+
+func codecDecodeDuration(deviceProfileID, codec string) prometheus.Observer {
+	return cd.With(prometheus.Labels{"device_profile_id": deviceProfileID, "codec": codec})
+}
+
+func uplinkDuplicateCounter() prometheus.Counter {
+	return dc
+}
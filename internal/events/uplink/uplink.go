@@ -28,6 +28,10 @@ import (
 	"github.com/brocaar/lorawan/gps"
 )
 
+const (
+	uplinkDeduplicationKeyTempl = "lora:as:device:%s:up:dedup:%s:%d"
+)
+
 type uplinkContext struct {
 	uplinkDataReq as.HandleUplinkDataRequest
 
@@ -38,10 +42,15 @@ type uplinkContext struct {
 
 	data       []byte
 	objectJSON string
+
+	deduplicationKey string
 }
 
+// deduplicateUplink must be the first task after retrieving the device, so
+// that a duplicate uplink does not update the device.
 var tasks = []func(*uplinkContext) error{
 	getDevice,
+	deduplicateUplink,
 	getApplication,
 	getDeviceProfile,
 	updateDeviceLastSeenAndDR,
@@ -64,6 +73,10 @@ func Handle(ctx context.Context, req as.HandleUplinkDataRequest) error {
 			if err == ErrAbort {
 				return nil
 			}
+
+			// the uplink was not handled, make sure that a retry of the
+			// network-server is not dropped as duplicate
+			releaseDeduplicationKey(&uc)
 			return err
 		}
 	}
@@ -176,6 +189,60 @@ func updateDeviceActivation(ctx *uplinkContext) error {
 	return nil
 }
 
+// deduplicateUplink aborts the handling of the uplink when the same uplink
+// (DevEUI, DevAddr and FCnt) has already been handled within the configured
+// deduplication TTL, e.g. in case of a retry by the network-server. When the
+// uplink contains a new device activation context, its DevAddr is used as
+// the device has not been updated yet.
+func deduplicateUplink(ctx *uplinkContext) error {
+	ttl := config.C.ApplicationServer.UplinkDeduplication.TTL
+	if ttl == 0 {
+		return nil
+	}
+
+	devAddr := ctx.device.DevAddr
+	if da := ctx.uplinkDataReq.DeviceActivationContext; da != nil {
+		copy(devAddr[:], da.DevAddr)
+	}
+
+	key := fmt.Sprintf(uplinkDeduplicationKeyTempl, ctx.device.DevEUI, devAddr, ctx.uplinkDataReq.FCnt)
+	set, err := storage.RedisClient().SetNX(key, "", ttl).Result()
+	if err != nil {
+		return errors.Wrap(err, "set deduplication key error")
+	}
+
+	if !set {
+		uplinkDuplicateCounter().Inc()
+
+		log.WithFields(log.Fields{
+			"dev_eui":  ctx.device.DevEUI,
+			"dev_addr": ctx.device.DevAddr,
+			"f_cnt":    ctx.uplinkDataReq.FCnt,
+			"ctx_id":   ctx.ctx.Value(logging.ContextIDKey),
+		}).Warning("duplicate uplink received, skipping")
+		return ErrAbort
+	}
+
+	ctx.deduplicationKey = key
+
+	return nil
+}
+
+// releaseDeduplicationKey removes the deduplication key set by
+// deduplicateUplink (if any).
+func releaseDeduplicationKey(ctx *uplinkContext) {
+	if ctx.deduplicationKey == "" {
+		return
+	}
+
+	if err := storage.RedisClient().Del(ctx.deduplicationKey).Err(); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"dev_eui": ctx.device.DevEUI,
+			"ctx_id":  ctx.ctx.Value(logging.ContextIDKey),
+		}).Error("delete uplink deduplication key error")
+	}
+}
+
 func decryptPayload(ctx *uplinkContext) error {
 	var err error
 
@@ -187,24 +254,28 @@ func decryptPayload(ctx *uplinkContext) error {
 }
 
 func handleApplicationLayers(ctx *uplinkContext) error {
-	// TODO: make application layer configurable
-	// * make ports configurable
-	// * disable application-layer features
-	if ctx.uplinkDataReq.FPort != 200 && ctx.uplinkDataReq.FPort != 201 && ctx.uplinkDataReq.FPort != 202 {
+	dp := ctx.deviceProfile
+	fPort := ctx.uplinkDataReq.FPort
+
+	isMulticastSetup := dp.MulticastSetupEnabled && fPort == uint32(dp.MulticastSetupFPort)
+	isFragmentation := dp.FragmentationEnabled && fPort == uint32(dp.FragmentationFPort)
+	isClockSync := dp.ClockSyncEnabled && fPort == uint32(dp.ClockSyncFPort)
+
+	if !isMulticastSetup && !isFragmentation && !isClockSync {
 		return nil
 	}
 
 	return storage.Transaction(func(db sqlx.Ext) error {
-		switch ctx.uplinkDataReq.FPort {
-		case 200:
+		switch {
+		case isMulticastSetup:
 			if err := multicastsetup.HandleRemoteMulticastSetupCommand(ctx.ctx, db, ctx.device.DevEUI, ctx.data); err != nil {
 				return errors.Wrap(err, "handle remote multicast setup command error")
 			}
-		case 201:
+		case isFragmentation:
 			if err := fragmentation.HandleRemoteFragmentationSessionCommand(ctx.ctx, db, ctx.device.DevEUI, ctx.data); err != nil {
 				return errors.Wrap(err, "handle remote fragmentation session command error")
 			}
-		case 202:
+		case isClockSync:
 			var timeSinceGPSEpoch time.Duration
 			var timeField time.Time
 			var err error
@@ -234,7 +305,7 @@ func handleApplicationLayers(ctx *uplinkContext) error {
 				timeSinceGPSEpoch = gps.Time(timeField).TimeSinceGPSEpoch()
 			}
 
-			if err := clocksync.HandleClockSyncCommand(ctx.ctx, db, ctx.device.DevEUI, timeSinceGPSEpoch, ctx.data); err != nil {
+			if err := clocksync.HandleClockSyncCommand(ctx.ctx, db, ctx.device.DevEUI, uint8(fPort), timeSinceGPSEpoch, ctx.data); err != nil {
 				return errors.Wrap(err, "handle clocksync command error")
 			}
 		}
@@ -257,6 +328,7 @@ func handleCodec(ctx *uplinkContext) error {
 
 	start := time.Now()
 	b, err := codec.BinaryToJSON(codecType, uint8(ctx.uplinkDataReq.FPort), ctx.device.Variables, decoderScript, ctx.data)
+	codecDecodeDuration(ctx.device.DeviceProfileID.String(), string(codecType)).Observe(time.Since(start).Seconds())
 	if err != nil {
 		log.WithFields(log.Fields{
 			"codec":          codecType,
@@ -0,0 +1,98 @@
+package uplink
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-api/go/v3/as"
+	"github.com/brocaar/chirpstack-application-server/internal/config"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/test"
+	"github.com/brocaar/lorawan"
+)
+
+func TestDeduplicateUplink(t *testing.T) {
+	assert := require.New(t)
+
+	conf := test.GetConfig()
+	assert.NoError(storage.Setup(conf))
+	storage.RedisClient().FlushAll()
+
+	config.C.ApplicationServer.UplinkDeduplication.TTL = time.Minute
+	defer func() {
+		config.C.ApplicationServer.UplinkDeduplication.TTL = 0
+	}()
+
+	newContext := func(devAddr lorawan.DevAddr, fCnt uint32) *uplinkContext {
+		return &uplinkContext{
+			ctx: context.Background(),
+			device: storage.Device{
+				DevEUI:  lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+				DevAddr: devAddr,
+			},
+			uplinkDataReq: as.HandleUplinkDataRequest{
+				FCnt: fCnt,
+			},
+		}
+	}
+
+	tests := []struct {
+		Name          string
+		DevAddr       lorawan.DevAddr
+		FCnt          uint32
+		ExpectedError error
+	}{
+		{
+			Name:    "first uplink",
+			DevAddr: lorawan.DevAddr{1, 2, 3, 4},
+			FCnt:    10,
+		},
+		{
+			Name:          "duplicate uplink",
+			DevAddr:       lorawan.DevAddr{1, 2, 3, 4},
+			FCnt:          10,
+			ExpectedError: ErrAbort,
+		},
+		{
+			Name:    "next frame-counter",
+			DevAddr: lorawan.DevAddr{1, 2, 3, 4},
+			FCnt:    11,
+		},
+		{
+			Name:    "same frame-counter after re-activation",
+			DevAddr: lorawan.DevAddr{4, 3, 2, 1},
+			FCnt:    10,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.ExpectedError, deduplicateUplink(newContext(tst.DevAddr, tst.FCnt)))
+		})
+	}
+
+	t.Run("new activation context", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := newContext(lorawan.DevAddr{1, 2, 3, 4}, 10)
+		ctx.uplinkDataReq.DeviceActivationContext = &as.DeviceActivationContext{
+			DevAddr: []byte{5, 6, 7, 8},
+		}
+		assert.NoError(deduplicateUplink(ctx))
+		assert.Equal(ErrAbort, deduplicateUplink(newContext(lorawan.DevAddr{5, 6, 7, 8}, 10)))
+	})
+
+	t.Run("released after error", func(t *testing.T) {
+		assert := require.New(t)
+
+		ctx := newContext(lorawan.DevAddr{1, 2, 3, 4}, 20)
+		assert.NoError(deduplicateUplink(ctx))
+		releaseDeduplicationKey(ctx)
+
+		assert.NoError(deduplicateUplink(newContext(lorawan.DevAddr{1, 2, 3, 4}, 20)))
+	})
+}
@@ -20,8 +20,12 @@ import (
 	"github.com/brocaar/lorawan"
 	"github.com/brocaar/lorawan/applayer/fragmentation"
 	"github.com/brocaar/lorawan/applayer/multicastsetup"
+	"github.com/brocaar/lorawan/gps"
 )
 
+// beaconPeriod defines the Class-B beacon-period.
+const beaconPeriod = 128 * time.Second
+
 var (
 	interval                          = time.Second
 	batchSize                         = 1
@@ -94,6 +98,8 @@ func fuotaDeployment(ctx context.Context, db sqlx.Ext, item storage.FUOTADeploym
 		return stepMulticastSetup(ctx, db, item)
 	case storage.FUOTADeploymentFragmentationSessSetup:
 		return stepFragmentationSessSetup(ctx, db, item)
+	case storage.FUOTADeploymentMulticastSessBSetup:
+		return stepMulticastSessBSetup(ctx, db, item)
 	case storage.FUOTADeploymentMulticastSessCSetup:
 		return stepMulticastSessCSetup(ctx, db, item)
 	case storage.FUOTADeploymentEnqueue:
@@ -102,6 +108,8 @@ func fuotaDeployment(ctx context.Context, db sqlx.Ext, item storage.FUOTADeploym
 		return stepStatusRequest(ctx, db, item)
 	case storage.FUOTADeploymentSetDeviceStatus:
 		return stepSetDeviceStatus(ctx, db, item)
+	case storage.FUOTADeploymentUnicastRetransmit:
+		return stepUnicastRetransmit(ctx, db, item)
 	case storage.FUOTADeploymentCleanup:
 		return stepCleanup(ctx, db, item)
 	default:
@@ -324,7 +332,12 @@ func stepFragmentationSessSetup(ctx context.Context, db sqlx.Ext, item storage.F
 		}
 	}
 
-	item.State = storage.FUOTADeploymentMulticastSessCSetup
+	switch item.GroupType {
+	case storage.FUOTADeploymentGroupTypeB:
+		item.State = storage.FUOTADeploymentMulticastSessBSetup
+	default:
+		item.State = storage.FUOTADeploymentMulticastSessCSetup
+	}
 	item.NextStepAfter = time.Now().Add(time.Duration(remoteFragmentationSessionRetries) * item.UnicastTimeout)
 
 	err = storage.UpdateFUOTADeployment(ctx, db, &item)
@@ -335,6 +348,83 @@ func stepFragmentationSessSetup(ctx context.Context, db sqlx.Ext, item storage.F
 	return nil
 }
 
+func stepMulticastSessBSetup(ctx context.Context, db sqlx.Ext, item storage.FUOTADeployment) error {
+	if item.MulticastGroupID == nil {
+		return errors.New("MulticastGroupID must not be nil")
+	}
+
+	mcg, err := storage.GetMulticastGroup(ctx, db, *item.MulticastGroupID, false, false)
+	if err != nil {
+		return errors.Wrap(err, "get multicast group error")
+	}
+
+	periodicity, err := PingSlotPeriodicity(int(mcg.MulticastGroup.PingSlotPeriod))
+	if err != nil {
+		return errors.Wrap(err, "get ping-slot periodicity error")
+	}
+
+	// query all devices with complete fragmentation session setup
+	var devEUIs []lorawan.EUI64
+	err = sqlx.Select(db, &devEUIs, `
+		select
+			rms.dev_eui
+		from
+			remote_multicast_setup rms
+		inner join
+			remote_fragmentation_session rfs
+		on
+			rfs.dev_eui = rms.dev_eui
+			and rfs.frag_index = $1
+		where
+			rms.multicast_group_id = $2
+			and rms.state = $3
+			and rms.state_provisioned = $4
+			and rfs.state = $3
+			and rfs.state_provisioned = $4`,
+		fragIndex,
+		item.MulticastGroupID,
+		storage.RemoteMulticastSetupSetup,
+		true,
+	)
+	if err != nil {
+		return errors.Wrap(err, "get devices with fragmentation session setup error")
+	}
+
+	// the Class-B session must start at the beginning of a beacon-period
+	sinceEpoch := gps.Time(time.Now().Add(time.Duration(remoteMulticastSetupRetries) * item.UnicastTimeout)).TimeSinceGPSEpoch()
+	sinceEpoch = sinceEpoch - (sinceEpoch % beaconPeriod) + beaconPeriod
+	sessionTime := time.Time(gps.NewFromTimeSinceGPSEpoch(sinceEpoch))
+
+	for _, devEUI := range devEUIs {
+		rmcbs := storage.RemoteMulticastClassBSession{
+			DevEUI:           devEUI,
+			MulticastGroupID: *item.MulticastGroupID,
+			McGroupID:        mcGroupID,
+			DLFrequency:      int(mcg.MulticastGroup.Frequency),
+			DR:               int(mcg.MulticastGroup.Dr),
+			SessionTime:      sessionTime,
+			SessionTimeOut:   item.MulticastTimeout,
+			Periodicity:      periodicity,
+			RetryInterval:    item.UnicastTimeout,
+		}
+		err = storage.CreateRemoteMulticastClassBSession(ctx, db, &rmcbs)
+		if err != nil {
+			return errors.Wrap(err, "create remote multicast class-b session error")
+		}
+	}
+
+	// the fragments are enqueued when the session starts
+	item.State = storage.FUOTADeploymentEnqueue
+	item.NextStepAfter = sessionTime
+
+	err = storage.UpdateFUOTADeployment(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update fuota deployment error")
+	}
+
+	return nil
+}
+
 func stepMulticastSessCSetup(ctx context.Context, db sqlx.Ext, item storage.FUOTADeployment) error {
 	if item.MulticastGroupID == nil {
 		return errors.New("MulticastGroupID must not be nil")
@@ -433,15 +523,41 @@ func stepEnqueue(ctx context.Context, db sqlx.Ext, item storage.FUOTADeployment)
 		payloads = append(payloads, b)
 	}
 
-	// enqueue the payloads
-	_, err = multicast.EnqueueMultiple(ctx, db, *item.MulticastGroupID, fragmentation.DefaultFPort, payloads)
+	// the fragments are sent on the fragmentation fPort of the device-profile
+	// of the devices within the deployment
+	devices, err := storage.GetFUOTADeploymentDevices(ctx, db, item.ID, 1, 0)
 	if err != nil {
-		return errors.Wrap(err, "enqueue multiple error")
+		return errors.Wrap(err, "get fuota deployment devices error")
+	}
+	if len(devices) == 0 {
+		return errors.New("fuota deployment has no devices")
+	}
+
+	dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, devices[0].DevEUI)
+	if err != nil {
+		return errors.Wrap(err, "get device-profile error")
+	}
+
+	// enqueue the payloads, unless the fragmentation package has been
+	// disabled since the deployment was created, in which case the devices
+	// will be set to the error state as they do not report the session status
+	if dp.FragmentationEnabled {
+		_, err = multicast.EnqueueMultiple(ctx, db, *item.MulticastGroupID, dp.FragmentationFPort, payloads)
+		if err != nil {
+			return errors.Wrap(err, "enqueue multiple error")
+		}
+	} else {
+		log.WithFields(log.Fields{
+			"id":     item.ID,
+			"ctx_id": ctx.Value(logging.ContextIDKey),
+		}).Warning("fuota: fragmentation package is disabled for device-profile, fragments not enqueued")
 	}
 
 	item.State = storage.FUOTADeploymentStatusRequest
 
 	switch item.GroupType {
+	case storage.FUOTADeploymentGroupTypeB:
+		item.NextStepAfter = time.Now().Add(beaconPeriod * time.Duration(1<<uint(item.MulticastTimeout)))
 	case storage.FUOTADeploymentGroupTypeC:
 		item.NextStepAfter = time.Now().Add(time.Second * time.Duration(1<<uint(item.MulticastTimeout)))
 	default:
@@ -461,7 +577,7 @@ func stepStatusRequest(ctx context.Context, db sqlx.Ext, item storage.FUOTADeplo
 		return errors.New("MulticastGroupID must not be nil")
 	}
 
-	// query all devices with complete fragmentation session setup
+	// query all pending devices with complete fragmentation session setup
 	var devEUIs []lorawan.EUI64
 	err := sqlx.Select(db, &devEUIs, `
 		select
@@ -473,16 +589,24 @@ func stepStatusRequest(ctx context.Context, db sqlx.Ext, item storage.FUOTADeplo
 		on
 			rfs.dev_eui = rms.dev_eui
 			and rfs.frag_index = $1
+		inner join
+			fuota_deployment_device fdd
+		on
+			fdd.dev_eui = rms.dev_eui
+			and fdd.fuota_deployment_id = $5
 		where
 			rms.multicast_group_id = $2
 			and rms.state = $3
 			and rms.state_provisioned = $4
 			and rfs.state = $3
-			and rfs.state_provisioned = $4`,
+			and rfs.state_provisioned = $4
+			and fdd.state = $6`,
 		fragIndex,
 		item.MulticastGroupID,
 		storage.RemoteMulticastSetupSetup,
 		true,
+		item.ID,
+		storage.FUOTADeploymentDevicePending,
 	)
 	if err != nil {
 		return errors.Wrap(err, "get devices with fragmentation session setup error")
@@ -503,7 +627,15 @@ func stepStatusRequest(ctx context.Context, db sqlx.Ext, item storage.FUOTADeplo
 			return errors.Wrap(err, "marshal binary error")
 		}
 
-		_, err = storage.EnqueueDownlinkPayload(ctx, db, devEUI, false, fragmentation.DefaultFPort, b)
+		dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, devEUI)
+		if err != nil {
+			return errors.Wrap(err, "get device-profile error")
+		}
+		if !dp.FragmentationEnabled {
+			continue
+		}
+
+		_, err = storage.EnqueueDownlinkPayload(ctx, db, devEUI, false, dp.FragmentationFPort, b)
 		if err != nil {
 			return errors.Wrap(err, "enqueue downlink payload error")
 		}
@@ -606,6 +738,148 @@ func stepSetDeviceStatus(ctx context.Context, db sqlx.Ext, item storage.FUOTADep
 	item.State = storage.FUOTADeploymentCleanup
 	item.NextStepAfter = time.Now()
 
+	// retransmit the missing fragments as unicast (when enabled) before
+	// giving up on the devices that reported missing fragments
+	if item.UnicastRetransmissionCount < item.UnicastRetransmissions {
+		var count int
+		err = sqlx.Get(db, &count, `
+			select
+				count(*)
+			from
+				fuota_deployment_device
+			where
+				fuota_deployment_id = $1
+				and state = $2
+				and missing_frag > 0`,
+			item.ID,
+			storage.FUOTADeploymentDeviceError,
+		)
+		if err != nil {
+			return errors.Wrap(err, "get fuota deployment devices with missing fragments count error")
+		}
+
+		if count > 0 {
+			item.State = storage.FUOTADeploymentUnicastRetransmit
+		}
+	}
+
+	err = storage.UpdateFUOTADeployment(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update fuota deployment error")
+	}
+
+	return nil
+}
+
+func stepUnicastRetransmit(ctx context.Context, db sqlx.Ext, item storage.FUOTADeployment) error {
+	var devices []storage.FUOTADeploymentDevice
+	err := sqlx.Select(db, &devices, `
+		select
+			*
+		from
+			fuota_deployment_device
+		where
+			fuota_deployment_id = $1
+			and state = $2
+			and missing_frag > 0`,
+		item.ID,
+		storage.FUOTADeploymentDeviceError,
+	)
+	if err != nil {
+		return errors.Wrap(err, "get fuota deployment devices with missing fragments error")
+	}
+
+	// The FragSessionStatusAns only reports the number of missing fragments.
+	// As the device is able to reconstruct the payload using any of the coded
+	// fragments, each device is sent the number of missing fragments, using
+	// the redundant fragments that have not yet been sent to the device.
+	var redundancy int
+	for _, fdd := range devices {
+		if r := fdd.RetransmittedFrag + fdd.MissingFrag; r > redundancy {
+			redundancy = r
+		}
+	}
+
+	// fragment the payload
+	padding := (item.FragSize - (len(item.Payload) % item.FragSize)) % item.FragSize
+	data := append(item.Payload, make([]byte, padding)...)
+	fragments, err := fragmentation.Encode(data, item.FragSize, item.Redundancy+redundancy)
+	if err != nil {
+		return errors.Wrap(err, "fragment payload error")
+	}
+
+	// index of the first redundant fragment not sent over multicast
+	offset := len(data)/item.FragSize + item.Redundancy
+
+	// the max. number of fragments enqueued for a single device
+	var enqueued int
+
+	for _, fdd := range devices {
+		dp, err := storage.GetDeviceProfileForDevEUI(ctx, db, fdd.DevEUI)
+		if err != nil {
+			return errors.Wrap(err, "get device-profile error")
+		}
+		if !dp.FragmentationEnabled {
+			continue
+		}
+
+		start := offset + fdd.RetransmittedFrag
+		for i := start; i < start+fdd.MissingFrag; i++ {
+			cmd := fragmentation.Command{
+				CID: fragmentation.DataFragment,
+				Payload: &fragmentation.DataFragmentPayload{
+					IndexAndN: fragmentation.DataFragmentPayloadIndexAndN{
+						FragIndex: uint8(fragIndex),
+						N:         uint16(i + 1),
+					},
+					Payload: fragments[i],
+				},
+			}
+			b, err := cmd.MarshalBinary()
+			if err != nil {
+				return errors.Wrap(err, "marshal binary error")
+			}
+
+			_, err = storage.EnqueueDownlinkPayload(ctx, db, fdd.DevEUI, false, dp.FragmentationFPort, b)
+			if err != nil {
+				return errors.Wrap(err, "enqueue downlink payload error")
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"dev_eui":             fdd.DevEUI,
+			"fuota_deployment_id": item.ID,
+			"fragment_count":      fdd.MissingFrag,
+			"ctx_id":              ctx.Value(logging.ContextIDKey),
+		}).Info("fuota deployment missing fragments enqueued as unicast")
+
+		if fdd.MissingFrag > enqueued {
+			enqueued = fdd.MissingFrag
+		}
+
+		// the device is pending again until it answers the next
+		// FragSessionStatusReq
+		fdd.State = storage.FUOTADeploymentDevicePending
+		fdd.ErrorMessage = ""
+		fdd.RetransmittedFrag += fdd.MissingFrag
+		fdd.MissingFrag = 0
+
+		if err := storage.UpdateFUOTADeploymentDevice(ctx, db, &fdd); err != nil {
+			return errors.Wrap(err, "update fuota deployment device error")
+		}
+	}
+
+	// each fragment in the device queue is delivered on its own downlink,
+	// thus the time needed to drain the queue scales with the number of
+	// fragments enqueued
+	if enqueued == 0 {
+		enqueued = 1
+	}
+
+	item.UnicastRetransmissionCount++
+	item.State = storage.FUOTADeploymentStatusRequest
+	item.NextStepAfter = time.Now().Add(time.Duration(enqueued) * item.UnicastTimeout)
+
 	err = storage.UpdateFUOTADeployment(ctx, db, &item)
 	if err != nil {
 		return errors.Wrap(err, "update fuota deployment error")
@@ -631,3 +905,235 @@ func stepCleanup(ctx context.Context, db sqlx.Ext, item storage.FUOTADeployment)
 
 	return nil
 }
+
+// CancelDeployment cancels the FUOTA deployment matching the given ID. It
+// flushes the multicast-group queue and requests the devices to delete the
+// fragmentation session and multicast-group. The deployment is set to the
+// CLEANUP state, after the time needed to sync these requests.
+func CancelDeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
+	item, err := storage.GetFUOTADeployment(ctx, db, id, true)
+	if err != nil {
+		return errors.Wrap(err, "get fuota deployment error")
+	}
+
+	switch item.State {
+	case storage.FUOTADeploymentCleanup, storage.FUOTADeploymentDone:
+		return storage.ErrFUOTADeploymentInvalidState
+	}
+
+	now := time.Now()
+
+	if item.MulticastGroupID != nil {
+		if err := multicast.FlushQueue(ctx, db, *item.MulticastGroupID); err != nil {
+			return errors.Wrap(err, "flush multicast queue error")
+		}
+
+		// stop setting up the multicast class-b and class-c sessions
+		_, err = db.Exec(`
+			delete from
+				remote_multicast_class_b_session
+			where
+				multicast_group_id = $1`,
+			*item.MulticastGroupID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "delete remote multicast class-b sessions error")
+		}
+
+		_, err = db.Exec(`
+			delete from
+				remote_multicast_class_c_session
+			where
+				multicast_group_id = $1`,
+			*item.MulticastGroupID,
+		)
+		if err != nil {
+			return errors.Wrap(err, "delete remote multicast class-c sessions error")
+		}
+
+		// send McGroupDeleteReq to the devices
+		_, err = db.Exec(`
+			update
+				remote_multicast_setup
+			set
+				updated_at = $3,
+				state = $2,
+				state_provisioned = false,
+				retry_count = 0,
+				retry_after = $3
+			where
+				multicast_group_id = $1`,
+			*item.MulticastGroupID,
+			storage.RemoteMulticastSetupDelete,
+			now,
+		)
+		if err != nil {
+			return errors.Wrap(err, "set remote multicast setup delete error")
+		}
+	}
+
+	// the fragmentation sessions are setup when leaving the FRAG_SESS_SETUP
+	// state, send FragSessionDeleteReq to the devices
+	switch item.State {
+	case storage.FUOTADeploymentMulticastSessBSetup,
+		storage.FUOTADeploymentMulticastSessCSetup,
+		storage.FUOTADeploymentEnqueue,
+		storage.FUOTADeploymentStatusRequest,
+		storage.FUOTADeploymentSetDeviceStatus,
+		storage.FUOTADeploymentUnicastRetransmit:
+		// the mc_group_ids are removed, so that the request is sent as unicast
+		// regardless the state of the multicast-group
+		_, err = db.Exec(`
+			update
+				remote_fragmentation_session rfs
+			set
+				updated_at = $4,
+				mc_group_ids = '{}',
+				state = $3,
+				state_provisioned = false,
+				retry_count = 0,
+				retry_after = $4
+			from
+				fuota_deployment_device fdd
+			where
+				fdd.fuota_deployment_id = $1
+				and rfs.frag_index = $2
+
+				-- join the two tables
+				and fdd.dev_eui = rfs.dev_eui`,
+			item.ID,
+			fragIndex,
+			storage.RemoteMulticastSetupDelete,
+			now,
+		)
+		if err != nil {
+			return errors.Wrap(err, "set remote fragmentation session delete error")
+		}
+	}
+
+	_, err = db.Exec(`
+		update
+			fuota_deployment_device
+		set
+			updated_at = $3,
+			state = $4,
+			error_message = $5
+		where
+			fuota_deployment_id = $1
+			and state = $2`,
+		item.ID,
+		storage.FUOTADeploymentDevicePending,
+		now,
+		storage.FUOTADeploymentDeviceError,
+		"The FUOTA deployment was cancelled.",
+	)
+	if err != nil {
+		return errors.Wrap(err, "set cancelled fuota deployment error")
+	}
+
+	retries := remoteMulticastSetupRetries
+	if remoteFragmentationSessionRetries > retries {
+		retries = remoteFragmentationSessionRetries
+	}
+
+	item.State = storage.FUOTADeploymentCleanup
+	item.PausedAt = nil
+	item.NextStepAfter = now.Add(time.Duration(retries) * item.UnicastTimeout)
+
+	err = storage.UpdateFUOTADeployment(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update fuota deployment error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":     item.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("fuota deployment cancelled")
+
+	return nil
+}
+
+// PauseDeployment pauses the FUOTA deployment matching the given ID. While
+// paused, the deployment does not proceed to the next step. As the
+// multicast session times sent to the devices are absolute, the deployment
+// can not be paused once the multicast sessions have been set up (ENQUEUE
+// state and later). Because of this, the multicast-group queue never contains
+// fragments of a paused deployment.
+func PauseDeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
+	item, err := storage.GetFUOTADeployment(ctx, db, id, true)
+	if err != nil {
+		return errors.Wrap(err, "get fuota deployment error")
+	}
+
+	if item.PausedAt != nil {
+		return storage.ErrFUOTADeploymentInvalidState
+	}
+
+	switch item.State {
+	case storage.FUOTADeploymentEnqueue,
+		storage.FUOTADeploymentStatusRequest,
+		storage.FUOTADeploymentSetDeviceStatus,
+		storage.FUOTADeploymentUnicastRetransmit,
+		storage.FUOTADeploymentCleanup,
+		storage.FUOTADeploymentDone:
+		return storage.ErrFUOTADeploymentInvalidState
+	}
+
+	now := time.Now()
+	item.PausedAt = &now
+
+	err = storage.UpdateFUOTADeployment(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update fuota deployment error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":     item.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("fuota deployment paused")
+
+	return nil
+}
+
+// ResumeDeployment resumes the paused FUOTA deployment matching the given ID.
+// The next step is delayed by the time the deployment was paused. This is
+// safe as the multicast session times are only set when leaving the
+// MC_SESS_B_SETUP or MC_SESS_C_SETUP state, which does not happen while
+// paused.
+func ResumeDeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
+	item, err := storage.GetFUOTADeployment(ctx, db, id, true)
+	if err != nil {
+		return errors.Wrap(err, "get fuota deployment error")
+	}
+
+	if item.PausedAt == nil {
+		return storage.ErrFUOTADeploymentInvalidState
+	}
+
+	item.NextStepAfter = item.NextStepAfter.Add(time.Since(*item.PausedAt))
+	item.PausedAt = nil
+
+	err = storage.UpdateFUOTADeployment(ctx, db, &item)
+	if err != nil {
+		return errors.Wrap(err, "update fuota deployment error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":     item.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("fuota deployment resumed")
+
+	return nil
+}
+
+// PingSlotPeriodicity returns the Class-B ping-slot periodicity for the given
+// ping-slot period (expressed in number of ping-slots, 32 * 2^periodicity).
+func PingSlotPeriodicity(pingSlotPeriod int) (int, error) {
+	for periodicity := 0; periodicity < 8; periodicity++ {
+		if pingSlotPeriod == 32<<uint(periodicity) {
+			return periodicity, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid ping-slot period: %d", pingSlotPeriod)
+}
@@ -2,6 +2,7 @@ package fuota
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/test"
 	"github.com/brocaar/lorawan"
 	"github.com/brocaar/lorawan/applayer/fragmentation"
+	"github.com/brocaar/lorawan/gps"
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -82,9 +84,15 @@ func (ts *FUOTATestSuite) SetupTest() {
 	assert.NoError(storage.CreateApplication(context.Background(), ts.tx, &ts.Application))
 
 	ts.DeviceProfile = storage.DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  ts.Organization.ID,
-		NetworkServerID: ts.NetworkServer.ID,
+		Name:                  "test-dp",
+		OrganizationID:        ts.Organization.ID,
+		NetworkServerID:       ts.NetworkServer.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
+		ClockSyncEnabled:      true,
+		ClockSyncFPort:        202,
 	}
 	assert.NoError(storage.CreateDeviceProfile(context.Background(), ts.tx, &ts.DeviceProfile))
 	var dpID uuid.UUID
@@ -325,6 +333,37 @@ func (ts *FUOTATestSuite) TestFUOTADeploymentFragmentationSessionSetup() {
 	assert.True(fdUpdated.NextStepAfter.After(time.Now()))
 }
 
+func (ts *FUOTATestSuite) TestFUOTADeploymentFragmentationSessionSetupClassB() {
+	assert := require.New(ts.T())
+
+	mcg := storage.MulticastGroup{
+		Name: "test-mg",
+	}
+	copy(mcg.ServiceProfileID[:], ts.ServiceProfile.ServiceProfile.Id)
+	assert.NoError(storage.CreateMulticastGroup(context.Background(), ts.tx, &mcg))
+	var mcgID uuid.UUID
+	copy(mcgID[:], mcg.MulticastGroup.Id)
+
+	fd := storage.FUOTADeployment{
+		Name:             "test-deployment",
+		MulticastGroupID: &mcgID,
+		GroupType:        storage.FUOTADeploymentGroupTypeB,
+		UnicastTimeout:   time.Second,
+		State:            storage.FUOTADeploymentFragmentationSessSetup,
+		Payload:          []byte{1, 2, 3, 4, 5},
+		FragSize:         2,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	// run
+	assert.NoError(fuotaDeployments(context.Background(), ts.tx))
+
+	// validate fuota deployment record
+	fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+	assert.NoError(err)
+	assert.Equal(storage.FUOTADeploymentMulticastSessBSetup, fdUpdated.State)
+}
+
 func (ts *FUOTATestSuite) TestFUOTADeploymentFragmentationSessionSetupMulticastSetupNotCompleted() {
 	assert := require.New(ts.T())
 
@@ -370,6 +409,86 @@ func (ts *FUOTATestSuite) TestFUOTADeploymentFragmentationSessionSetupMulticastS
 	assert.Len(items, 0)
 }
 
+func (ts *FUOTATestSuite) TestFUOTADeploymentMulticastSessBSetup() {
+	assert := require.New(ts.T())
+
+	mcg := storage.MulticastGroup{
+		Name: "test-mg",
+		MulticastGroup: ns.MulticastGroup{
+			Frequency:      869525000,
+			Dr:             3,
+			PingSlotPeriod: 32 * 4,
+			GroupType:      ns.MulticastGroupType_CLASS_B,
+		},
+	}
+	copy(mcg.ServiceProfileID[:], ts.ServiceProfile.ServiceProfile.Id)
+	assert.NoError(storage.CreateMulticastGroup(context.Background(), ts.tx, &mcg))
+	var mcgID uuid.UUID
+	copy(mcgID[:], mcg.MulticastGroup.Id)
+	mcgReq := <-ts.nsClient.CreateMulticastGroupChan
+	ts.nsClient.GetMulticastGroupResponse.MulticastGroup = mcgReq.MulticastGroup
+
+	fd := storage.FUOTADeployment{
+		Name:             "test-deployment",
+		MulticastGroupID: &mcgID,
+		GroupType:        storage.FUOTADeploymentGroupTypeB,
+		PingSlotPeriod:   32 * 4,
+		UnicastTimeout:   time.Second,
+		MulticastTimeout: 2,
+		State:            storage.FUOTADeploymentMulticastSessBSetup,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	rms := storage.RemoteMulticastSetup{
+		DevEUI:           ts.Device.DevEUI,
+		MulticastGroupID: mcgID,
+		State:            storage.RemoteMulticastSetupSetup,
+		StateProvisioned: true,
+	}
+	assert.NoError(storage.CreateRemoteMulticastSetup(context.Background(), ts.tx, &rms))
+
+	rfs := storage.RemoteFragmentationSession{
+		DevEUI:           ts.Device.DevEUI,
+		State:            storage.RemoteMulticastSetupSetup,
+		StateProvisioned: true,
+	}
+	assert.NoError(storage.CreateRemoteFragmentationSession(context.Background(), ts.tx, &rfs))
+
+	// run
+	assert.NoError(fuotaDeployments(context.Background(), ts.tx))
+
+	// validate class-b sessions
+	items, err := storage.GetPendingRemoteMulticastClassBSessions(context.Background(), ts.tx, 10, 10)
+	assert.NoError(err)
+	assert.Len(items, 1)
+
+	items[0].CreatedAt = time.Time{}
+	items[0].UpdatedAt = time.Time{}
+	items[0].RetryAfter = time.Time{}
+
+	// the session must start at the beginning of a beacon-period
+	sessionTime := items[0].SessionTime
+	assert.True(sessionTime.After(time.Now()))
+	assert.Equal(time.Duration(0), gps.Time(sessionTime).TimeSinceGPSEpoch()%beaconPeriod)
+	items[0].SessionTime = time.Time{}
+
+	assert.Equal(storage.RemoteMulticastClassBSession{
+		DevEUI:           ts.Device.DevEUI,
+		MulticastGroupID: mcgID,
+		DLFrequency:      869525000,
+		DR:               3,
+		SessionTimeOut:   2,
+		Periodicity:      2,
+		RetryInterval:    time.Second,
+	}, items[0])
+
+	// validate fuota deployment record
+	fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+	assert.NoError(err)
+	assert.Equal(storage.FUOTADeploymentEnqueue, fdUpdated.State)
+	assert.True(fdUpdated.NextStepAfter.Equal(sessionTime))
+}
+
 func (ts *FUOTATestSuite) TestFUOTADeploymentMulticastSessCSetup() {
 	assert := require.New(ts.T())
 
@@ -619,6 +738,132 @@ func (ts *FUOTATestSuite) TestFUOTADeploymentSetDeviceStatusGenericError() {
 	assert.True(fdUpdated.NextStepAfter.Before(time.Now()))
 }
 
+func (ts *FUOTATestSuite) TestFUOTADeploymentSetDeviceStatusUnicastRetransmit() {
+	assert := require.New(ts.T())
+
+	mcg := storage.MulticastGroup{
+		Name: "test-mg",
+	}
+	copy(mcg.ServiceProfileID[:], ts.ServiceProfile.ServiceProfile.Id)
+	assert.NoError(storage.CreateMulticastGroup(context.Background(), ts.tx, &mcg))
+	var mcgID uuid.UUID
+	copy(mcgID[:], mcg.MulticastGroup.Id)
+
+	fd := storage.FUOTADeployment{
+		Name:                   "test-deployment",
+		MulticastGroupID:       &mcgID,
+		State:                  storage.FUOTADeploymentSetDeviceStatus,
+		UnicastRetransmissions: 1,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	fdd, err := storage.GetPendingFUOTADeploymentDevice(context.Background(), ts.tx, ts.Device.DevEUI)
+	assert.NoError(err)
+	fdd.State = storage.FUOTADeploymentDeviceError
+	fdd.ErrorMessage = "2 fragments missed (1 received)."
+	fdd.MissingFrag = 2
+	assert.NoError(storage.UpdateFUOTADeploymentDevice(context.Background(), ts.tx, &fdd))
+
+	ts.T().Run("Retransmission", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(fuotaDeployments(context.Background(), ts.tx))
+
+		fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+		assert.NoError(err)
+		assert.Equal(storage.FUOTADeploymentUnicastRetransmit, fdUpdated.State)
+		assert.True(fdUpdated.NextStepAfter.Before(time.Now()))
+	})
+
+	ts.T().Run("Retransmissions exhausted", func(t *testing.T) {
+		assert := require.New(t)
+
+		fd.State = storage.FUOTADeploymentSetDeviceStatus
+		fd.UnicastRetransmissionCount = 1
+		assert.NoError(storage.UpdateFUOTADeployment(context.Background(), ts.tx, &fd))
+
+		assert.NoError(fuotaDeployments(context.Background(), ts.tx))
+
+		fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+		assert.NoError(err)
+		assert.Equal(storage.FUOTADeploymentCleanup, fdUpdated.State)
+	})
+}
+
+func (ts *FUOTATestSuite) TestFUOTADeploymentUnicastRetransmit() {
+	assert := require.New(ts.T())
+
+	mcg := storage.MulticastGroup{
+		Name: "test-mg",
+	}
+	copy(mcg.ServiceProfileID[:], ts.ServiceProfile.ServiceProfile.Id)
+	assert.NoError(storage.CreateMulticastGroup(context.Background(), ts.tx, &mcg))
+	var mcgID uuid.UUID
+	copy(mcgID[:], mcg.MulticastGroup.Id)
+
+	fd := storage.FUOTADeployment{
+		Name:                   "test-deployment",
+		MulticastGroupID:       &mcgID,
+		Payload:                []byte{1, 2, 3, 4},
+		FragSize:               2,
+		Redundancy:             1,
+		State:                  storage.FUOTADeploymentUnicastRetransmit,
+		GroupType:              storage.FUOTADeploymentGroupTypeC,
+		UnicastTimeout:         time.Minute,
+		UnicastRetransmissions: 2,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	fdd, err := storage.GetPendingFUOTADeploymentDevice(context.Background(), ts.tx, ts.Device.DevEUI)
+	assert.NoError(err)
+	fdd.State = storage.FUOTADeploymentDeviceError
+	fdd.ErrorMessage = "2 fragments missed (1 received)."
+	fdd.MissingFrag = 2
+	fdd.RetransmittedFrag = 1
+	assert.NoError(storage.UpdateFUOTADeploymentDevice(context.Background(), ts.tx, &fdd))
+
+	assert.NoError(fuotaDeployments(context.Background(), ts.tx))
+
+	// the 2 data fragments + 1 redundant fragment were sent over multicast
+	// and 1 redundant fragment was already retransmitted, thus the next
+	// fragments are 5 and 6
+	fragments, err := fragmentation.Encode([]byte{1, 2, 3, 4}, 2, 4)
+	assert.NoError(err)
+
+	for _, n := range []uint16{5, 6} {
+		req := <-ts.nsClient.CreateDeviceQueueItemChan
+		assert.Equal(ts.Device.DevEUI[:], req.Item.DevEui)
+		assert.Equal(uint32(fragmentation.DefaultFPort), req.Item.FPort)
+
+		var cmd fragmentation.Command
+		assert.NoError(cmd.UnmarshalBinary(false, req.Item.FrmPayload))
+		assert.Equal(fragmentation.DataFragment, cmd.CID)
+
+		pl, ok := cmd.Payload.(*fragmentation.DataFragmentPayload)
+		assert.True(ok)
+		assert.Equal(n, pl.IndexAndN.N)
+		assert.Equal(fragments[n-1], pl.Payload)
+	}
+
+	// validate fuota deployment device record
+	fddUpdated, err := storage.GetFUOTADeploymentDevice(context.Background(), ts.tx, fd.ID, ts.Device.DevEUI)
+	assert.NoError(err)
+	assert.Equal(storage.FUOTADeploymentDevicePending, fddUpdated.State)
+	assert.Equal("", fddUpdated.ErrorMessage)
+	assert.Equal(0, fddUpdated.MissingFrag)
+	assert.Equal(3, fddUpdated.RetransmittedFrag)
+
+	// validate fuota deployment record
+	fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+	assert.NoError(err)
+	assert.Equal(storage.FUOTADeploymentStatusRequest, fdUpdated.State)
+	assert.Equal(1, fdUpdated.UnicastRetransmissionCount)
+
+	// 2 fragments were enqueued, thus the wait is 2 x the unicast timeout
+	assert.True(fdUpdated.NextStepAfter.After(time.Now().Add(time.Minute + 50*time.Second)))
+	assert.True(fdUpdated.NextStepAfter.Before(time.Now().Add(2 * time.Minute)))
+}
+
 func (ts *FUOTATestSuite) TestFUOTADeploymentSetDeviceStatusRemoteMulticastSetupError() {
 	assert := require.New(ts.T())
 
@@ -732,6 +977,148 @@ func (ts *FUOTATestSuite) TestFUOTADeploymentCleanup() {
 	assert.Equal(storage.ErrDoesNotExist, err)
 }
 
+func (ts *FUOTATestSuite) TestFUOTADeploymentCancel() {
+	assert := require.New(ts.T())
+
+	mcg := storage.MulticastGroup{
+		Name: "test-mg",
+	}
+	copy(mcg.ServiceProfileID[:], ts.ServiceProfile.ServiceProfile.Id)
+	assert.NoError(storage.CreateMulticastGroup(context.Background(), ts.tx, &mcg))
+	var mcgID uuid.UUID
+	copy(mcgID[:], mcg.MulticastGroup.Id)
+
+	fd := storage.FUOTADeployment{
+		Name:             "test-deployment",
+		MulticastGroupID: &mcgID,
+		UnicastTimeout:   time.Second,
+		State:            storage.FUOTADeploymentStatusRequest,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	rms := storage.RemoteMulticastSetup{
+		DevEUI:           ts.Device.DevEUI,
+		MulticastGroupID: mcgID,
+		State:            storage.RemoteMulticastSetupSetup,
+		StateProvisioned: true,
+	}
+	assert.NoError(storage.CreateRemoteMulticastSetup(context.Background(), ts.tx, &rms))
+
+	rfs := storage.RemoteFragmentationSession{
+		DevEUI:           ts.Device.DevEUI,
+		FragIndex:        fragIndex,
+		MCGroupIDs:       []int{mcGroupID},
+		State:            storage.RemoteMulticastSetupSetup,
+		StateProvisioned: true,
+	}
+	assert.NoError(storage.CreateRemoteFragmentationSession(context.Background(), ts.tx, &rfs))
+
+	assert.NoError(CancelDeployment(context.Background(), ts.tx, fd.ID))
+
+	// validate the multicast queue has been flushed
+	flushReq := <-ts.nsClient.FlushMulticastQueueForMulticastGroupChan
+	assert.Equal(mcgID.Bytes(), flushReq.MulticastGroupId)
+
+	// validate the remote multicast setup will be deleted
+	rmsItems, err := storage.GetPendingRemoteMulticastSetupItems(context.Background(), ts.tx, 10, 10)
+	assert.NoError(err)
+	assert.Len(rmsItems, 1)
+	assert.Equal(storage.RemoteMulticastSetupDelete, rmsItems[0].State)
+
+	// validate the remote fragmentation session will be deleted
+	rfsItems, err := storage.GetPendingRemoteFragmentationSessions(context.Background(), ts.tx, 10, 10)
+	assert.NoError(err)
+	assert.Len(rfsItems, 1)
+	assert.Equal(storage.RemoteMulticastSetupDelete, rfsItems[0].State)
+
+	// validate the device status
+	items, err := storage.GetFUOTADeploymentDevices(context.Background(), ts.tx, fd.ID, 10, 0)
+	assert.NoError(err)
+	assert.Len(items, 1)
+	assert.Equal(storage.FUOTADeploymentDeviceError, items[0].State)
+	assert.Equal("The FUOTA deployment was cancelled.", items[0].ErrorMessage)
+
+	// validate fuota deployment record
+	fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+	assert.NoError(err)
+	assert.Equal(storage.FUOTADeploymentCleanup, fdUpdated.State)
+	assert.True(fdUpdated.NextStepAfter.After(time.Now()))
+
+	// a deployment can not be cancelled twice
+	assert.Equal(storage.ErrFUOTADeploymentInvalidState, CancelDeployment(context.Background(), ts.tx, fd.ID))
+}
+
+func (ts *FUOTATestSuite) TestFUOTADeploymentPauseResume() {
+	assert := require.New(ts.T())
+
+	fd := storage.FUOTADeployment{
+		Name:      "test-deployment",
+		GroupType: storage.FUOTADeploymentGroupTypeC,
+	}
+	assert.NoError(storage.CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, ts.Device.DevEUI))
+
+	assert.NoError(PauseDeployment(context.Background(), ts.tx, fd.ID))
+	assert.Equal(storage.ErrFUOTADeploymentInvalidState, PauseDeployment(context.Background(), ts.tx, fd.ID))
+
+	// validate the paused deployment is not pending
+	pending, err := storage.GetPendingFUOTADeployments(context.Background(), ts.tx, 10)
+	assert.NoError(err)
+	assert.Len(pending, 0)
+
+	assert.NoError(ResumeDeployment(context.Background(), ts.tx, fd.ID))
+	assert.Equal(storage.ErrFUOTADeploymentInvalidState, ResumeDeployment(context.Background(), ts.tx, fd.ID))
+
+	// validate the next step has been delayed by the paused duration
+	fdUpdated, err := storage.GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+	assert.NoError(err)
+	assert.Nil(fdUpdated.PausedAt)
+	assert.Equal(storage.FUOTADeploymentMulticastCreate, fdUpdated.State)
+	assert.True(fdUpdated.NextStepAfter.After(fd.NextStepAfter))
+
+	// validate the deployment can not be paused once the multicast sessions
+	// have been set up
+	for _, state := range []storage.FUOTADeploymentState{
+		storage.FUOTADeploymentEnqueue,
+		storage.FUOTADeploymentStatusRequest,
+		storage.FUOTADeploymentSetDeviceStatus,
+		storage.FUOTADeploymentUnicastRetransmit,
+	} {
+		fdUpdated.State = state
+		assert.NoError(storage.UpdateFUOTADeployment(context.Background(), ts.tx, &fdUpdated))
+		assert.Equal(storage.ErrFUOTADeploymentInvalidState, PauseDeployment(context.Background(), ts.tx, fd.ID))
+	}
+}
+
+func TestPingSlotPeriodicity(t *testing.T) {
+	tests := []struct {
+		pingSlotPeriod int
+		periodicity    int
+		err            bool
+	}{
+		{pingSlotPeriod: 32, periodicity: 0},
+		{pingSlotPeriod: 32 * 4, periodicity: 2},
+		{pingSlotPeriod: 32 * 128, periodicity: 7},
+		{pingSlotPeriod: 0, err: true},
+		{pingSlotPeriod: 100, err: true},
+		{pingSlotPeriod: 32 * 256, err: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(fmt.Sprintf("%d", tst.pingSlotPeriod), func(t *testing.T) {
+			assert := require.New(t)
+
+			periodicity, err := PingSlotPeriodicity(tst.pingSlotPeriod)
+			if tst.err {
+				assert.Error(err)
+				return
+			}
+
+			assert.NoError(err)
+			assert.Equal(tst.periodicity, periodicity)
+		})
+	}
+}
+
 func TestFUOTA(t *testing.T) {
 	suite.Run(t, new(FUOTATestSuite))
 }
@@ -0,0 +1,138 @@
+// Package gwstatus implements the gateway online / offline detection.
+package gwstatus
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/config"
+	"github.com/brocaar/chirpstack-application-server/internal/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+var (
+	checkInterval    = time.Minute
+	checkBatchSize   = 100
+	offlineThreshold time.Duration
+)
+
+// Setup configures the package and starts the gateway status check loop.
+func Setup(conf config.Config) error {
+	checkInterval = conf.ApplicationServer.GatewayStatus.CheckInterval
+	checkBatchSize = conf.ApplicationServer.GatewayStatus.CheckBatchSize
+	offlineThreshold = conf.ApplicationServer.GatewayStatus.OfflineThreshold
+
+	go checkLoop()
+
+	return nil
+}
+
+func checkLoop() {
+	for {
+		ctxID, err := uuid.NewV4()
+		if err != nil {
+			log.WithError(err).Error("new uuid error")
+		}
+
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, logging.ContextIDKey, ctxID)
+
+		if err := CheckGatewayStatus(ctx, time.Now()); err != nil {
+			log.WithError(err).Error("gwstatus: check gateway status error")
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// CheckGatewayStatus detects the gateways which went offline or came back
+// online at the given time. For each transition, the new state and the
+// transition are stored and a gateway status event is sent to the
+// integrations of the organization of the gateway.
+func CheckGatewayStatus(ctx context.Context, now time.Time) error {
+	var transitions []storage.GatewayStatusTransition
+	var gws []storage.Gateway
+
+	err := storage.Transaction(func(tx sqlx.Ext) error {
+		var err error
+		gws, err = storage.GetGatewaysForStatusTransition(ctx, tx, now, offlineThreshold, checkBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "get gateways for status transition error")
+		}
+
+		for _, gw := range gws {
+			t := storage.GatewayStatusTransition{
+				GatewayID:  gw.MAC,
+				Online:     gw.IsOffline,
+				LastSeenAt: gw.LastSeenAt,
+			}
+
+			if err := storage.SetGatewayOffline(ctx, tx, gw.MAC, !t.Online); err != nil {
+				return errors.Wrap(err, "set gateway offline error")
+			}
+
+			if err := storage.CreateGatewayStatusTransition(ctx, tx, &t); err != nil {
+				return errors.Wrap(err, "create gateway status transition error")
+			}
+
+			transitions = append(transitions, t)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The events are sent after the transaction has been committed, so that
+	// no event is sent for a transition which has been rolled back.
+	for i, gw := range gws {
+		if err := sendGatewayStatusEvent(ctx, gw, transitions[i]); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"gateway_id": gw.MAC,
+				"ctx_id":     ctx.Value(logging.ContextIDKey),
+			}).Error("gwstatus: send gateway status event error")
+		}
+	}
+
+	return nil
+}
+
+func sendGatewayStatusEvent(ctx context.Context, gw storage.Gateway, t storage.GatewayStatusTransition) error {
+	pl := pb.GatewayStatusEvent{
+		GatewayId:      gw.MAC[:],
+		GatewayName:    gw.Name,
+		OrganizationId: gw.OrganizationID,
+		Online:         t.Online,
+		Tags:           make(map[string]string),
+	}
+
+	if t.LastSeenAt != nil {
+		var err error
+		pl.LastSeenAt, err = ptypes.TimestampProto(*t.LastSeenAt)
+		if err != nil {
+			return errors.Wrap(err, "timestamp proto error")
+		}
+	}
+
+	for k, v := range gw.Tags.Map {
+		if v.Valid {
+			pl.Tags[k] = v.String
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": gw.MAC,
+		"online":     t.Online,
+		"ctx_id":     ctx.Value(logging.ContextIDKey),
+	}).Info("gwstatus: gateway status changed")
+
+	return integration.ForOrganizationID(gw.OrganizationID).HandleGatewayStatusEvent(ctx, nil, pl)
+}
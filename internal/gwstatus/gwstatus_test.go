@@ -0,0 +1,91 @@
+package gwstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-application-server/internal/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/test"
+	"github.com/brocaar/lorawan"
+)
+
+func TestCheckGatewayStatus(t *testing.T) {
+	assert := require.New(t)
+
+	conf := test.GetConfig()
+	assert.NoError(storage.Setup(conf))
+	test.MustResetDB(storage.DB().DB)
+
+	h := mock.New()
+	integration.SetMockIntegration(h)
+	defer integration.SetMockIntegration(nil)
+
+	offlineThreshold = 5 * time.Minute
+
+	n := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &n))
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	lastSeen := time.Now().Add(-10 * time.Minute)
+	gw := storage.Gateway{
+		MAC:             lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		Name:            "test-gw",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+		LastSeenAt:      &lastSeen,
+	}
+	assert.NoError(storage.CreateGateway(context.Background(), storage.DB(), &gw))
+
+	t.Run("Offline", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(CheckGatewayStatus(context.Background(), time.Now()))
+
+		pl := <-h.SendGatewayStatusNotificationChan
+		assert.Equal(gw.MAC[:], pl.GatewayId)
+		assert.Equal("test-gw", pl.GatewayName)
+		assert.Equal(org.ID, pl.OrganizationId)
+		assert.False(pl.Online)
+		assert.NotNil(pl.LastSeenAt)
+
+		gwGet, err := storage.GetGateway(context.Background(), storage.DB(), gw.MAC, false)
+		assert.NoError(err)
+		assert.True(gwGet.IsOffline)
+
+		t.Run("Still offline", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(CheckGatewayStatus(context.Background(), time.Now()))
+			assert.Len(h.SendGatewayStatusNotificationChan, 0)
+		})
+
+		t.Run("Online", func(t *testing.T) {
+			assert := require.New(t)
+
+			lastSeen := time.Now()
+			gwGet.LastSeenAt = &lastSeen
+			assert.NoError(storage.UpdateGateway(context.Background(), storage.DB(), &gwGet))
+
+			assert.NoError(CheckGatewayStatus(context.Background(), time.Now()))
+
+			pl := <-h.SendGatewayStatusNotificationChan
+			assert.True(pl.Online)
+
+			count, err := storage.GetGatewayStatusTransitionCount(context.Background(), storage.DB(), gw.MAC)
+			assert.NoError(err)
+			assert.Equal(2, count)
+		})
+	})
+}
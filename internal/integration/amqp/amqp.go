@@ -3,7 +3,12 @@ package amqp
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
@@ -21,9 +26,16 @@ import (
 // Integration implements an AMQP integration.
 type Integration struct {
 	chPool *pool
+	config config.IntegrationAMQPConfig
 
 	marshaler       marshaler.Type
 	eventRoutingKey *template.Template
+
+	dataDownChan         chan models.DataDownPayload
+	commandBindingKey    string
+	commandRoutingKeyExp *regexp.Regexp
+	wg                   sync.WaitGroup
+	closed               chan struct{}
 }
 
 // New creates a new AMQP integration.
@@ -31,6 +43,8 @@ func New(m marshaler.Type, conf config.IntegrationAMQPConfig) (*Integration, err
 	var err error
 	i := Integration{
 		marshaler: m,
+		config:    conf,
+		closed:    make(chan struct{}),
 	}
 
 	log.Info("integration/amqp: connecting to amqp broker")
@@ -44,6 +58,35 @@ func New(m marshaler.Type, conf config.IntegrationAMQPConfig) (*Integration, err
 		return nil, errors.Wrap(err, "parse event routing-key template error")
 	}
 
+	if conf.CommandQueueName != "" {
+		commandRoutingKey, err := template.New("command").Parse(conf.CommandRoutingKeyTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse command routing-key template error")
+		}
+
+		// binding-key matching all applications and devices
+		i.commandBindingKey, err = executeCommandTemplate(commandRoutingKey, "*", "*", "down")
+		if err != nil {
+			return nil, errors.Wrap(err, "get command binding-key error")
+		}
+
+		// regexp for retrieving the application id and deveui from the
+		// routing-key
+		exp, err := executeCommandTemplate(commandRoutingKey, `(?P<application_id>\w+)`, `(?P<dev_eui>\w+)`, `(?P<command_type>\w+)`)
+		if err != nil {
+			return nil, errors.Wrap(err, "get command routing-key regexp error")
+		}
+		i.commandRoutingKeyExp, err = regexp.Compile(exp)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile command routing-key regexp error")
+		}
+
+		i.dataDownChan = make(chan models.DataDownPayload)
+
+		i.wg.Add(1)
+		go i.consumeCommandsLoop()
+	}
+
 	return &i, nil
 }
 
@@ -87,13 +130,37 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return i.publishEvent(ctx, pl.ApplicationId, pl.DevEui, "integration", &pl)
 }
 
-// DataDownChan returns nil
-func (i *Integration) DataDownChan() chan models.DataDownPayload {
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	return i.publishEvent(ctx, pl.ApplicationId, pl.DevEui, "management", &pl)
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	return i.publishEvent(ctx, pl.ApplicationId, pl.DevEui, "alert", &pl)
+}
+
+// HandleGatewayStatusEvent is not implemented.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
 	return nil
 }
 
+// DataDownChan returns the channel containing the received DataDownPayload.
+// When no command queue is configured, this returns nil.
+func (i *Integration) DataDownChan() chan models.DataDownPayload {
+	return i.dataDownChan
+}
+
 // Close closes the integration.
 func (i *Integration) Close() error {
+	close(i.closed)
+
+	if i.dataDownChan != nil {
+		log.Info("integration/amqp: stopping command consumer")
+		i.wg.Wait()
+		close(i.dataDownChan)
+	}
+
 	return i.chPool.close()
 }
 
@@ -152,3 +219,275 @@ func (i *Integration) publishEvent(ctx context.Context, applicationID uint64, de
 
 	return nil
 }
+
+// consumeCommandsLoop consumes the downlink commands from the command queue.
+// In case of an error (e.g. the connection to the broker was lost), it will
+// re-setup the consumer after a second.
+func (i *Integration) consumeCommandsLoop() {
+	defer i.wg.Done()
+
+	for {
+		err := i.consumeCommands()
+
+		select {
+		case <-i.closed:
+			return
+		default:
+		}
+
+		log.WithError(err).Error("integration/amqp: consume commands error, will retry in 1s")
+		time.Sleep(time.Second)
+	}
+}
+
+func (i *Integration) consumeCommands() error {
+	_, conn := i.chPool.getChansAndConn()
+	if conn == nil {
+		return errClosed
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "open channel error")
+	}
+
+	// deliveries are acknowledged (or rejected) after the downlink handler
+	// completed, wait for the outstanding deliveries before closing the
+	// channel as they can only be acknowledged on the channel they were
+	// received on
+	var pending sync.WaitGroup
+	defer func() {
+		pending.Wait()
+		ch.Close()
+	}()
+
+	if err := i.setupCommandQueue(ch); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"queue":       i.config.CommandQueueName,
+		"binding_key": i.commandBindingKey,
+	}).Info("integration/amqp: consuming downlink commands")
+
+	deliveries, err := ch.Consume(
+		i.config.CommandQueueName,
+		"",
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return errors.Wrap(err, "consume queue error")
+	}
+
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("delivery channel closed")
+			}
+			i.handleCommand(d, &pending)
+		case <-i.closed:
+			return nil
+		}
+	}
+}
+
+// setupCommandQueue declares the dead-letter exchange (and queue) and the
+// command queue, bound to the amq.topic exchange.
+func (i *Integration) setupCommandQueue(ch *amqp.Channel) error {
+	var args amqp.Table
+
+	if i.config.DeadLetterExchangeName != "" {
+		err := ch.ExchangeDeclare(
+			i.config.DeadLetterExchangeName,
+			"fanout",
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+		if err != nil {
+			return errors.Wrap(err, "declare dead-letter exchange error")
+		}
+
+		if i.config.DeadLetterQueueName != "" {
+			_, err := ch.QueueDeclare(
+				i.config.DeadLetterQueueName,
+				true,
+				false,
+				false,
+				false,
+				nil,
+			)
+			if err != nil {
+				return errors.Wrap(err, "declare dead-letter queue error")
+			}
+
+			err = ch.QueueBind(
+				i.config.DeadLetterQueueName,
+				"",
+				i.config.DeadLetterExchangeName,
+				false,
+				nil,
+			)
+			if err != nil {
+				return errors.Wrap(err, "bind dead-letter queue error")
+			}
+		}
+
+		args = amqp.Table{
+			"x-dead-letter-exchange": i.config.DeadLetterExchangeName,
+		}
+	}
+
+	_, err := ch.QueueDeclare(
+		i.config.CommandQueueName,
+		true,
+		false,
+		false,
+		false,
+		args,
+	)
+	if err != nil {
+		return errors.Wrap(err, "declare command queue error")
+	}
+
+	err = ch.QueueBind(
+		i.config.CommandQueueName,
+		i.commandBindingKey,
+		"amq.topic",
+		false,
+		nil,
+	)
+	if err != nil {
+		return errors.Wrap(err, "bind command queue error")
+	}
+
+	return nil
+}
+
+// handleCommand decodes the given delivery and sends it to the data-down
+// channel. The delivery is acknowledged after the downlink has been enqueued.
+// Malformed commands and commands that could not be enqueued are rejected
+// (and thus routed to the dead-letter exchange). The given WaitGroup is done
+// once the delivery has been acknowledged or rejected.
+func (i *Integration) handleCommand(d amqp.Delivery, pending *sync.WaitGroup) {
+	log.WithField("routing_key", d.RoutingKey).Info("integration/amqp: downlink command received")
+
+	applicationID, devEUI, err := i.getCommandRoutingKeyVariables(d.RoutingKey)
+	if err != nil {
+		log.WithError(err).WithField("routing_key", d.RoutingKey).Error("integration/amqp: get variables from routing-key error")
+		rejectCommand(d)
+		return
+	}
+
+	var pl models.DataDownPayload
+	if err := marshaler.UnmarshalDataDownPayload(i.marshaler, d.Body, &pl); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"data_base64": base64.StdEncoding.EncodeToString(d.Body),
+		}).Error("integration/amqp: unmarshal downlink command error")
+		rejectCommand(d)
+		return
+	}
+
+	pl.ApplicationID = applicationID
+	pl.DevEUI = devEUI
+
+	if pl.FPort == 0 || pl.FPort > 224 {
+		log.WithFields(log.Fields{
+			"routing_key": d.RoutingKey,
+			"dev_eui":     pl.DevEUI,
+			"f_port":      pl.FPort,
+		}).Error("integration/amqp: fPort must be between 1 - 224")
+		rejectCommand(d)
+		return
+	}
+
+	pending.Add(1)
+	pl.Callback = func(err error) {
+		defer pending.Done()
+
+		if err != nil {
+			rejectCommand(d)
+			return
+		}
+
+		if err := d.Ack(false); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"routing_key":  d.RoutingKey,
+				"delivery_tag": d.DeliveryTag,
+			}).Error("integration/amqp: ack downlink command error")
+		}
+	}
+
+	select {
+	case i.dataDownChan <- pl:
+	case <-i.closed:
+		// the delivery is not acknowledged and will be re-delivered by the
+		// broker once the channel has been closed
+		pending.Done()
+	}
+}
+
+func (i *Integration) getCommandRoutingKeyVariables(routingKey string) (int64, lorawan.EUI64, error) {
+	var applicationID int64
+	var devEUI lorawan.EUI64
+
+	match := i.commandRoutingKeyExp.FindStringSubmatch(routingKey)
+	if len(match) != len(i.commandRoutingKeyExp.SubexpNames()) {
+		return applicationID, devEUI, errors.New("routing-key regexp match error")
+	}
+
+	result := make(map[string]string)
+	for i, name := range i.commandRoutingKeyExp.SubexpNames() {
+		if i != 0 && name != "" {
+			result[name] = match[i]
+		}
+	}
+
+	idStr, ok := result["application_id"]
+	if !ok {
+		return applicationID, devEUI, errors.New("routing-key regexp does not contain application id")
+	}
+	applicationID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return applicationID, devEUI, errors.Wrap(err, "parse application id error")
+	}
+
+	devEUIStr, ok := result["dev_eui"]
+	if !ok {
+		return applicationID, devEUI, errors.New("routing-key regexp does not contain deveui")
+	}
+	if err := devEUI.UnmarshalText([]byte(devEUIStr)); err != nil {
+		return applicationID, devEUI, errors.Wrap(err, "parse deveui error")
+	}
+
+	return applicationID, devEUI, nil
+}
+
+func executeCommandTemplate(t *template.Template, applicationID, devEUI, commandType string) (string, error) {
+	b := bytes.NewBuffer(nil)
+	err := t.Execute(b, struct {
+		ApplicationID string
+		DevEUI        string
+		CommandType   string
+	}{applicationID, devEUI, commandType})
+	if err != nil {
+		return "", errors.Wrap(err, "execute template error")
+	}
+	return b.String(), nil
+}
+
+func rejectCommand(d amqp.Delivery) {
+	if err := d.Reject(false); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"routing_key":  d.RoutingKey,
+			"delivery_tag": d.DeliveryTag,
+		}).Error("integration/amqp: reject downlink command error")
+	}
+}
@@ -3,14 +3,17 @@ package amqp
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
 	"github.com/brocaar/chirpstack-application-server/internal/test"
 	"github.com/brocaar/lorawan"
 )
@@ -74,6 +77,22 @@ func (ts *IntegrationTestSuite) SetupSuite() {
 
 	ts.integration, err = New(marshaler.Protobuf, conf.ApplicationServer.Integration.AMQP)
 	assert.NoError(err)
+
+	// wait until the command queue consumer has been setup
+	for i := 0; i < 50; i++ {
+		// a failed inspect closes the channel, therefore use a new channel
+		ch, err := ts.amqpConn.Channel()
+		assert.NoError(err)
+
+		q, err := ch.QueueInspect(conf.ApplicationServer.Integration.AMQP.CommandQueueName)
+		if err == nil {
+			ch.Close()
+			if q.Consumers > 0 {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
 func (ts *IntegrationTestSuite) TearDownSuite() {
@@ -251,6 +270,93 @@ func (ts *IntegrationTestSuite) TestIntegrationEvent() {
 	assert.True(proto.Equal(&pl, &plReceived))
 }
 
+func (ts *IntegrationTestSuite) TestDownlinkCommand() {
+	conf := test.GetConfig()
+
+	ts.T().Run("Valid", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.amqpChan.Publish(
+			"amq.topic",
+			"application.10.device.0102030405060708.command.down",
+			false,
+			false,
+			amqp.Publishing{
+				Body: []byte(`{"confirmed": true, "fPort": 10, "data": "AQID"}`),
+			},
+		))
+
+		pl := <-ts.integration.DataDownChan()
+		assert.NotNil(pl.Callback)
+		pl.Callback(nil)
+		pl.Callback = nil
+
+		assert.Equal(models.DataDownPayload{
+			ApplicationID: int64(ts.applicationID),
+			DevEUI:        ts.devEUI,
+			Confirmed:     true,
+			FPort:         10,
+			Data:          []byte{1, 2, 3},
+		}, pl)
+	})
+
+	ts.T().Run("Handler error", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.amqpChan.Publish(
+			"amq.topic",
+			"application.10.device.0102030405060708.command.down",
+			false,
+			false,
+			amqp.Publishing{
+				Body: []byte(`{"fPort": 20, "data": "AQID"}`),
+			},
+		))
+
+		pl := <-ts.integration.DataDownChan()
+		pl.Callback(errors.New("enqueue error"))
+
+		var msg amqp.Delivery
+		var ok bool
+		var err error
+		for i := 0; i < 50 && !ok; i++ {
+			msg, ok, err = ts.amqpChan.Get(conf.ApplicationServer.Integration.AMQP.DeadLetterQueueName, true)
+			assert.NoError(err)
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		assert.True(ok)
+		assert.Equal(`{"fPort": 20, "data": "AQID"}`, string(msg.Body))
+	})
+
+	ts.T().Run("Malformed", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.amqpChan.Publish(
+			"amq.topic",
+			"application.10.device.0102030405060708.command.down",
+			false,
+			false,
+			amqp.Publishing{
+				Body: []byte(`{"fPort": 0}`),
+			},
+		))
+
+		var msg amqp.Delivery
+		var ok bool
+		var err error
+		for i := 0; i < 50 && !ok; i++ {
+			msg, ok, err = ts.amqpChan.Get(conf.ApplicationServer.Integration.AMQP.DeadLetterQueueName, true)
+			assert.NoError(err)
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		assert.True(ok)
+		assert.Equal("application.10.device.0102030405060708.command.down", msg.RoutingKey)
+		assert.Equal(`{"fPort": 0}`, string(msg.Body))
+	})
+}
+
 func TestIntegration(t *testing.T) {
 	suite.Run(t, new(IntegrationTestSuite))
 }
@@ -100,6 +100,21 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return i.publish(ctx, "integration", pl.ApplicationId, pl.DevEui, &pl)
 }
 
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	return i.publish(ctx, "management", pl.ApplicationId, pl.DevEui, &pl)
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	return i.publish(ctx, "alert", pl.ApplicationId, pl.DevEui, &pl)
+}
+
+// HandleGatewayStatusEvent is not implemented.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	return nil
+}
+
 // DataDownChan return nil.
 func (i *Integration) DataDownChan() chan models.DataDownPayload {
 	return nil
@@ -0,0 +1,318 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/multi"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+)
+
+var (
+	applicationHandlers  = newHandlerCache()
+	organizationHandlers = newHandlerCache()
+)
+
+// handlerCache caches the integration handlers by application or
+// organization ID, so that these are not setup again for every event.
+type handlerCache struct {
+	sync.Mutex
+
+	// generation is incremented on every eviction, so that handlers which
+	// were setup before the eviction are not stored in the cache.
+	generation uint64
+	items      map[int64]*handlerSet
+}
+
+// handlerSet contains the handlers of a cache entry. refs is the number of
+// events being handled by these. Evicted handlers are closed once they are
+// no longer referenced.
+type handlerSet struct {
+	handlers []multi.Handler
+	refs     int
+	evicted  bool
+}
+
+// drainer is implemented by handlers which can complete their pending
+// events (e.g. retries) before being closed.
+type drainer interface {
+	Drain()
+}
+
+func newHandlerCache() *handlerCache {
+	return &handlerCache{
+		items: make(map[int64]*handlerSet),
+	}
+}
+
+// acquire returns the cached handlers for the given ID. On a cache miss, the
+// handlers are setup using the given function. When it returns an error,
+// the returned handlers are not cached. The returned handlers must be
+// released after use.
+func (c *handlerCache) acquire(id int64, setup func() ([]multi.Handler, error)) *handlerSet {
+	c.Lock()
+	set, ok := c.items[id]
+	if ok {
+		set.refs++
+	}
+	generation := c.generation
+	c.Unlock()
+
+	if ok {
+		return set
+	}
+
+	handlers, err := setup()
+
+	// handlers which are not cached are closed after being released
+	set = &handlerSet{
+		handlers: handlers,
+		refs:     1,
+		evicted:  true,
+	}
+	if err != nil {
+		return set
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// an other go-routine could have setup the handlers in the meantime
+	if cached, ok := c.items[id]; ok {
+		closeHandlers(handlers)
+		cached.refs++
+		return cached
+	}
+
+	// the handlers could have been setup from data which is already outdated
+	if generation != c.generation {
+		return set
+	}
+
+	set.evicted = false
+	c.items[id] = set
+	return set
+}
+
+// release releases the given handlers, these are closed when evicted and no
+// longer referenced.
+func (c *handlerCache) release(set *handlerSet) {
+	c.Lock()
+	defer c.Unlock()
+
+	set.refs--
+	if set.evicted && set.refs == 0 {
+		closeHandlers(set.handlers)
+	}
+}
+
+// evict removes the handlers for the given ID from the cache.
+func (c *handlerCache) evict(id int64) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.generation++
+	if set, ok := c.items[id]; ok {
+		delete(c.items, id)
+		c.evictSet(set)
+	}
+}
+
+// flush removes all the handlers from the cache.
+func (c *handlerCache) flush() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.generation++
+	for id, set := range c.items {
+		delete(c.items, id)
+		c.evictSet(set)
+	}
+}
+
+func (c *handlerCache) evictSet(set *handlerSet) {
+	set.evicted = true
+	if set.refs == 0 {
+		closeHandlers(set.handlers)
+	}
+}
+
+// closeHandlers closes the given handlers in the background. Before closing,
+// the handlers complete their pending events, so that these are not stored
+// as dead-letter because of the eviction.
+func closeHandlers(handlers []multi.Handler) {
+	if len(handlers) == 0 {
+		return
+	}
+
+	go func() {
+		for _, h := range handlers {
+			if d, ok := h.IntegrationHandler.(drainer); ok {
+				d.Drain()
+			}
+
+			if err := h.Close(); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"integration": fmt.Sprintf("%T", h.IntegrationHandler),
+				}).Error("integration: close integration error")
+			}
+		}
+	}()
+}
+
+// cachedIntegration implements models.Integration using the cached handlers
+// for the given ID. The handlers are acquired for the duration of each call,
+// so that these are not closed while handling the event.
+type cachedIntegration struct {
+	global []models.IntegrationHandler
+	cache  *handlerCache
+	id     int64
+	setup  func() ([]multi.Handler, error)
+}
+
+func (i *cachedIntegration) acquire() (*multi.Integration, func()) {
+	set := i.cache.acquire(i.id, i.setup)
+	return multi.New(i.global, set.handlers), func() {
+		i.cache.release(set)
+	}
+}
+
+// HandleUplinkEvent sends an UplinkEvent.
+func (i *cachedIntegration) HandleUplinkEvent(ctx context.Context, vars map[string]string, pl pb.UplinkEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleUplinkEvent(ctx, vars, pl)
+}
+
+// HandleJoinEvent sends a JoinEvent.
+func (i *cachedIntegration) HandleJoinEvent(ctx context.Context, vars map[string]string, pl pb.JoinEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleJoinEvent(ctx, vars, pl)
+}
+
+// HandleAckEvent sends an AckEvent.
+func (i *cachedIntegration) HandleAckEvent(ctx context.Context, vars map[string]string, pl pb.AckEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleAckEvent(ctx, vars, pl)
+}
+
+// HandleErrorEvent sends an ErrorEvent.
+func (i *cachedIntegration) HandleErrorEvent(ctx context.Context, vars map[string]string, pl pb.ErrorEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleErrorEvent(ctx, vars, pl)
+}
+
+// HandleStatusEvent sends a StatusEvent.
+func (i *cachedIntegration) HandleStatusEvent(ctx context.Context, vars map[string]string, pl pb.StatusEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleStatusEvent(ctx, vars, pl)
+}
+
+// HandleLocationEvent sends a LocationEvent.
+func (i *cachedIntegration) HandleLocationEvent(ctx context.Context, vars map[string]string, pl pb.LocationEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleLocationEvent(ctx, vars, pl)
+}
+
+// HandleTxAckEvent sends a TxAckEvent.
+func (i *cachedIntegration) HandleTxAckEvent(ctx context.Context, vars map[string]string, pl pb.TxAckEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleTxAckEvent(ctx, vars, pl)
+}
+
+// HandleIntegrationEvent sends an IntegrationEvent.
+func (i *cachedIntegration) HandleIntegrationEvent(ctx context.Context, vars map[string]string, pl pb.IntegrationEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleIntegrationEvent(ctx, vars, pl)
+}
+
+// HandleManagementEvent sends a ManagementEvent.
+func (i *cachedIntegration) HandleManagementEvent(ctx context.Context, vars map[string]string, pl pb.ManagementEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleManagementEvent(ctx, vars, pl)
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *cachedIntegration) HandleAlertEvent(ctx context.Context, vars map[string]string, pl pb.AlertEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleAlertEvent(ctx, vars, pl)
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *cachedIntegration) HandleGatewayStatusEvent(ctx context.Context, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	m, release := i.acquire()
+	defer release()
+	return m.HandleGatewayStatusEvent(ctx, vars, pl)
+}
+
+// DataDownChan returns the channel containing the received DataDownPayload.
+// Only the global integrations provide such a channel.
+func (i *cachedIntegration) DataDownChan() chan models.DataDownPayload {
+	return multi.New(i.global, nil).DataDownChan()
+}
+
+// handleIntegrationChanges subscribes to the integration changes, published
+// by all the instances and evicts the affected cached handlers.
+func handleIntegrationChanges() {
+	pubsub := storage.RedisClient().Subscribe(storage.IntegrationChangeChannel)
+
+	for {
+		msg, err := pubsub.Receive()
+		if err != nil {
+			log.WithError(err).Error("integration: receive integration change error")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			// changes could have been missed while not subscribed
+			applicationHandlers.flush()
+			organizationHandlers.flush()
+		case *redis.Message:
+			var c storage.IntegrationChange
+			if err := json.Unmarshal([]byte(msg.Payload), &c); err != nil {
+				log.WithError(err).Error("integration: unmarshal integration change error")
+				continue
+			}
+			handleIntegrationChange(c)
+		}
+	}
+}
+
+// handleIntegrationChange evicts the cached handlers affected by the given
+// change. As an organization integration is used by all the applications of
+// the organization, all the application handlers are evicted on an
+// organization integration change.
+func handleIntegrationChange(c storage.IntegrationChange) {
+	log.WithFields(log.Fields{
+		"application_id":  c.ApplicationID,
+		"organization_id": c.OrganizationID,
+	}).Debug("integration: evicting cached integrations")
+
+	if c.ApplicationID != 0 {
+		applicationHandlers.evict(c.ApplicationID)
+	}
+
+	if c.OrganizationID != 0 {
+		applicationHandlers.flush()
+		organizationHandlers.evict(c.OrganizationID)
+	}
+}
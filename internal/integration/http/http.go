@@ -278,6 +278,42 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return nil
 }
 
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], pl.DevEui)
+
+	for _, url := range getURLs(i.getEventEndpointURL("management")) {
+		i.sendEvent(ctx, "management", url, devEUI, &pl)
+	}
+
+	return nil
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], pl.DevEui)
+
+	for _, url := range getURLs(i.getEventEndpointURL("alert")) {
+		i.sendEvent(ctx, "alert", url, devEUI, &pl)
+	}
+
+	return nil
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], pl.GatewayId)
+
+	for _, url := range getURLs(i.getEventEndpointURL("gateway_status")) {
+		i.sendEvent(ctx, "gateway_status", url, gatewayID, &pl)
+	}
+
+	return nil
+}
+
 // DataDownChan return nil.
 func (i *Integration) DataDownChan() chan models.DataDownPayload {
 	return nil
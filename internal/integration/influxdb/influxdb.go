@@ -312,6 +312,21 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return nil
 }
 
+// HandleManagementEvent is not implemented.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	return nil
+}
+
+// HandleAlertEvent is not implemented.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	return nil
+}
+
+// HandleGatewayStatusEvent is not implemented.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	return nil
+}
+
 // DataDownChan return nil.
 func (i *Integration) DataDownChan() chan models.DataDownPayload {
 	return nil
@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -25,7 +27,9 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/integration/multi"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/mydevices"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/postgresql"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/retry"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/thingsboard"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 )
 
@@ -46,6 +50,10 @@ var (
 	mockIntegration    models.Integration
 	marshalType        marshaler.Type
 	globalIntegrations []models.IntegrationHandler
+	retryConfig        retry.Config
+
+	deadLetterRetention   time.Duration
+	deadLetterCleanupTick = time.Hour
 )
 
 // Setup configures the integration package.
@@ -64,6 +72,14 @@ func Setup(conf config.Config) error {
 		marshalType = marshaler.JSONV3
 	}
 
+	retryConfig = retry.Config{
+		MaxAttempts:     conf.ApplicationServer.Integration.Retry.MaxAttempts,
+		InitialInterval: conf.ApplicationServer.Integration.Retry.InitialInterval,
+		MaxInterval:     conf.ApplicationServer.Integration.Retry.MaxInterval,
+		MaxPending:      conf.ApplicationServer.Integration.Retry.MaxPending,
+	}
+	deadLetterRetention = conf.ApplicationServer.Integration.Retry.DeadLetterRetention
+
 	// configure logger integration (for device events in web-interface)
 	i, err := logger.New(logger.Config{})
 	if err != nil {
@@ -99,17 +115,47 @@ func Setup(conf config.Config) error {
 			return errors.Wrap(err, "new integration error")
 		}
 
-		ints = append(ints, i)
+		ints = append(ints, retry.New(name, i, retryConfig))
 	}
 	globalIntegrations = ints
 
+	// evict the cached integrations on changes made by any instance
+	go handleIntegrationChanges()
+
+	if deadLetterRetention != 0 {
+		go deadLetterCleanupLoop()
+	}
+
 	return nil
 }
 
+// deadLetterCleanupLoop periodically deletes the dead-letters which are
+// older than the configured retention.
+func deadLetterCleanupLoop() {
+	for {
+		ctxID, err := uuid.NewV4()
+		if err != nil {
+			log.WithError(err).Error("new uuid error")
+		}
+
+		ctx := context.Background()
+		ctx = context.WithValue(ctx, logging.ContextIDKey, ctxID)
+
+		if _, err := storage.DeleteIntegrationDeadLettersBefore(ctx, storage.DB(), time.Now().Add(-deadLetterRetention)); err != nil {
+			log.WithError(err).Error("integration: delete dead-letters error")
+		}
+		time.Sleep(deadLetterCleanupTick)
+	}
+}
+
 // ForApplicationID returns the integration handler for the given application ID.
-// The returned handler will be a "multi-handler", containing both the global
-// integrations and the integrations setup specifically for the given
-// application ID.
+// The returned handler will be a "multi-handler", containing the global
+// integrations, the integrations setup for the organization of the given
+// application ID and the integrations setup specifically for the given
+// application ID. An application integration overrides the organization
+// integration of the same kind. The application and organization
+// integrations are cached until these are changed or the application is
+// deleted.
 // When the given application ID equals 0, only the global integrations are
 // returned.
 func ForApplicationID(id int64) models.Integration {
@@ -118,154 +164,267 @@ func ForApplicationID(id int64) models.Integration {
 		return mockIntegration
 	}
 
-	var appints []storage.Integration
-	var err error
-
-	// retrieve application integrations when ID != 0
-	if id != 0 {
-		appints, err = storage.GetIntegrationsForApplicationID(context.TODO(), storage.DB(), id)
-		if err != nil {
-			log.WithError(err).WithFields(log.Fields{
-				"application_id": id,
-			}).Error("integrations: get application integrations error")
-		}
+	if id == 0 {
+		return multi.New(globalIntegrations, nil)
 	}
 
-	// parse integration configs and setup integrations
-	var ints []models.IntegrationHandler
-	for _, appint := range appints {
-		var i models.IntegrationHandler
-		var err error
-
-		switch appint.Kind {
-		case HTTP:
-			// read config
-			var conf http.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read http configuration error")
-				continue
-			}
-
-			// create new http integration
-			i, err = http.New(marshalType, conf)
-		case InfluxDB:
-			// read config
-			var conf influxdb.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read influxdb configuration error")
-				continue
-			}
-
-			// create new influxdb integration
-			i, err = influxdb.New(conf)
-		case ThingsBoard:
-			// read config
-			var conf thingsboard.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read thingsboard configuration error")
-				continue
-			}
-
-			// create new thingsboard integration
-			i, err = thingsboard.New(conf)
-		case MyDevices:
-			// read config
-			var conf mydevices.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read mydevices configuration error")
-				continue
-			}
+	return &cachedIntegration{
+		global: globalIntegrations,
+		cache:  applicationHandlers,
+		id:     id,
+		setup: func() ([]multi.Handler, error) {
+			return setupApplicationHandlers(id)
+		},
+	}
+}
 
-			// create new mydevices integration
-			i, err = mydevices.New(conf)
-		case LoRaCloud:
-			// read config
-			var conf loracloud.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read loracloud configuration error")
-				continue
-			}
+// ForOrganizationID returns the integration handler for events which are
+// not related to a single application (e.g. gateway events) of the given
+// organization ID. The returned handler contains both the global
+// integrations and the integrations setup for the given organization ID.
+func ForOrganizationID(id int64) models.Integration {
+	// for testing, return mock integration
+	if mockIntegration != nil {
+		return mockIntegration
+	}
 
-			// create new loracloud integration
-			i, err = loracloud.New(conf)
-		case GCPPubSub:
-			// read config
-			var conf config.IntegrationGCPConfig
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+	return &cachedIntegration{
+		global: globalIntegrations,
+		cache:  organizationHandlers,
+		id:     id,
+		setup: func() ([]multi.Handler, error) {
+			orgints, err := storage.GetOrganizationIntegrationsForOrganizationID(context.TODO(), storage.DB(), id)
+			if err != nil {
 				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read gcp pubsub configuration error")
-				continue
+					"organization_id": id,
+				}).Error("integrations: get organization integrations error")
+				return nil, err
 			}
 
-			// create new gcp pubsub integration
-			i, err = gcppubsub.New(marshalType, conf)
-		case AWSSNS:
-			// read config
-			var conf config.IntegrationAWSSNSConfig
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read aws sns configuration error")
-				continue
-			}
+			return newOrganizationHandlers(orgints), nil
+		},
+	}
+}
 
-			// create new aws sns integration
-			i, err = awssns.New(marshalType, conf)
-		case AzureServiceBus:
-			// read config
-			var conf config.IntegrationAzureConfig
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read azure service-bus configuration error")
-				continue
-			}
+// setupApplicationHandlers sets up the integrations for the given
+// application ID. An error is returned when the integrations could not be
+// retrieved, in which case the returned integrations are incomplete.
+func setupApplicationHandlers(id int64) ([]multi.Handler, error) {
+	var ints []multi.Handler
 
-			// create new aws sns integration
-			i, err = azureservicebus.New(marshalType, conf)
-		case Konker:
-			// read config
-			var conf http.Config
-			if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
-				log.WithError(err).WithFields(log.Fields{
-					"application_id": id,
-				}).Error("integrtations: read konker configuration error")
-				continue
-			}
+	appints, err := storage.GetIntegrationsForApplicationID(context.TODO(), storage.DB(), id)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"application_id": id,
+		}).Error("integrations: get application integrations error")
+		return nil, err
+	}
 
-			// create new konker integration
-			i, err = http.New(marshalType, conf)
-		default:
-			log.WithFields(log.Fields{
+	// parse integration configs and setup integrations
+	for _, appint := range appints {
+		i, err := newApplicationIntegration(appint)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
 				"application_id": id,
 				"kind":           appint.Kind,
-			}).Error("integrations: unknown integration type")
+			}).Error("integrations: new integration error")
 			continue
 		}
 
+		ints = append(ints, multi.Handler{
+			IntegrationHandler: retry.New(appint.Kind, i, retryConfig),
+			Filter:             appint.Filter,
+		})
+	}
+
+	// the organization integrations overridden by an application
+	// integration are already excluded by the storage query
+	orgints, err := storage.GetOrganizationIntegrationsForApplicationID(context.TODO(), storage.DB(), id)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"application_id": id,
+		}).Error("integrations: get organization integrations error")
+		return ints, err
+	}
+
+	return append(ints, newOrganizationHandlers(orgints)...), nil
+}
+
+// newOrganizationHandlers parses the given organization integration configs
+// and sets up the integrations.
+func newOrganizationHandlers(orgints []storage.OrganizationIntegration) []multi.Handler {
+	var ints []multi.Handler
+	for _, orgint := range orgints {
+		i, err := newApplicationIntegration(orgint.Integration())
 		if err != nil {
 			log.WithError(err).WithFields(log.Fields{
-				"application_id": id,
-				"kind":           appint.Kind,
+				"organization_id": orgint.OrganizationID,
+				"kind":            orgint.Kind,
 			}).Error("integrations: new integration error")
 			continue
 		}
 
-		ints = append(ints, i)
+		ints = append(ints, multi.Handler{
+			IntegrationHandler: retry.New(orgint.Kind, i, retryConfig),
+			Filter:             orgint.Filter,
+		})
+	}
+	return ints
+}
+
+// ReplayDeadLetter sends the given dead-lettered event to the integration
+// for which the delivery failed. On success the dead-letter is removed, else
+// its attempts and last error are updated. Note that events generated by the
+// integration while replaying (e.g. a LocationEvent) are only sent to the
+// global integrations.
+func ReplayDeadLetter(ctx context.Context, dl storage.IntegrationDeadLetter) error {
+	var h models.IntegrationHandler
+
+	for _, gi := range globalIntegrations {
+		if ri, ok := gi.(*retry.Integration); ok && ri.Name() == dl.Integration {
+			h = ri.Handler()
+		}
+	}
+
+	if h == nil {
+		appint, err := storage.GetIntegrationByApplicationID(ctx, storage.DB(), dl.ApplicationID, dl.Integration)
+		if errors.Cause(err) == storage.ErrDoesNotExist {
+			// the event could have been sent by the organization integration
+			appint, err = getOrganizationIntegrationForApplicationID(ctx, dl.ApplicationID, dl.Integration)
+		}
+		if err != nil {
+			return errors.Wrap(err, "get application integration error")
+		}
+
+		h, err = newApplicationIntegration(appint)
+		if err != nil {
+			return errors.Wrap(err, "new integration error")
+		}
+		defer h.Close()
 	}
 
-	return multi.New(globalIntegrations, ints)
+	if err := retry.Replay(ctx, h, multi.New(globalIntegrations, nil), dl); err != nil {
+		dl.Attempts++
+		dl.LastError = err.Error()
+		if err := storage.UpdateIntegrationDeadLetter(ctx, storage.DB(), &dl); err != nil {
+			return errors.Wrap(err, "update dead-letter error")
+		}
+
+		return errors.Wrap(err, "replay event error")
+	}
+
+	if err := storage.DeleteIntegrationDeadLetter(ctx, storage.DB(), dl.ID); err != nil {
+		return errors.Wrap(err, "delete dead-letter error")
+	}
+
+	return nil
+}
+
+// getOrganizationIntegrationForApplicationID returns the organization
+// integration of the given kind of the organization to which the given
+// application belongs.
+func getOrganizationIntegrationForApplicationID(ctx context.Context, applicationID int64, kind string) (storage.Integration, error) {
+	app, err := storage.GetApplication(ctx, storage.DB(), applicationID)
+	if err != nil {
+		return storage.Integration{}, errors.Wrap(err, "get application error")
+	}
+
+	orgint, err := storage.GetOrganizationIntegration(ctx, storage.DB(), app.OrganizationID, kind)
+	if err != nil {
+		return storage.Integration{}, errors.Wrap(err, "get organization integration error")
+	}
+
+	return orgint.Integration(), nil
+}
+
+// newApplicationIntegration creates the integration handler for the given
+// application integration.
+func newApplicationIntegration(appint storage.Integration) (models.IntegrationHandler, error) {
+	switch appint.Kind {
+	case HTTP:
+		// read config
+		var conf http.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read http configuration error")
+		}
+
+		// create new http integration
+		return http.New(marshalType, conf)
+	case InfluxDB:
+		// read config
+		var conf influxdb.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read influxdb configuration error")
+		}
+
+		// create new influxdb integration
+		return influxdb.New(conf)
+	case ThingsBoard:
+		// read config
+		var conf thingsboard.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read thingsboard configuration error")
+		}
+
+		// create new thingsboard integration
+		return thingsboard.New(conf)
+	case MyDevices:
+		// read config
+		var conf mydevices.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read mydevices configuration error")
+		}
+
+		// create new mydevices integration
+		return mydevices.New(conf)
+	case LoRaCloud:
+		// read config
+		var conf loracloud.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read loracloud configuration error")
+		}
+
+		// create new loracloud integration
+		return loracloud.New(conf)
+	case GCPPubSub:
+		// read config
+		var conf config.IntegrationGCPConfig
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read gcp pubsub configuration error")
+		}
+
+		// create new gcp pubsub integration
+		return gcppubsub.New(marshalType, conf)
+	case AWSSNS:
+		// read config
+		var conf config.IntegrationAWSSNSConfig
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read aws sns configuration error")
+		}
+
+		// create new aws sns integration
+		return awssns.New(marshalType, conf)
+	case AzureServiceBus:
+		// read config
+		var conf config.IntegrationAzureConfig
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read azure service-bus configuration error")
+		}
+
+		// create new aws sns integration
+		return azureservicebus.New(marshalType, conf)
+	case Konker:
+		// read config
+		var conf http.Config
+		if err := json.NewDecoder(bytes.NewReader(appint.Settings)).Decode(&conf); err != nil {
+			return nil, errors.Wrap(err, "read konker configuration error")
+		}
+
+		// create new konker integration
+		return http.New(marshalType, conf)
+	default:
+		return nil, fmt.Errorf("unknown integration type: %s", appint.Kind)
+	}
 }
 
 // SetMockIntegration mocks the integration.
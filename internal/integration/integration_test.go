@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,7 @@ import (
 	httpint "github.com/brocaar/chirpstack-application-server/internal/integration/http"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/multi"
 	"github.com/brocaar/chirpstack-application-server/internal/storage"
 	"github.com/brocaar/chirpstack-application-server/internal/test"
 )
@@ -41,6 +43,7 @@ type IntegrationTestSuite struct {
 	httpServer   *httptest.Server
 	httpRequests chan *http.Request
 	integration  models.Integration
+	app          storage.Application
 }
 
 func (ts *IntegrationTestSuite) SetupSuite() {
@@ -109,6 +112,7 @@ func (ts *IntegrationTestSuite) SetupSuite() {
 	}))
 
 	ts.integration = ForApplicationID(app.ID)
+	ts.app = app
 }
 
 func (ts *IntegrationTestSuite) TearDownSuite() {
@@ -129,6 +133,180 @@ func (ts *IntegrationTestSuite) TestHandleUplinkEvent() {
 	assert.Equal("/rx", req.URL.Path)
 }
 
+// TestHandlerCache tests that the application integrations are cached until
+// the integration change has been handled.
+func (ts *IntegrationTestSuite) TestHandlerCache() {
+	assert := require.New(ts.T())
+
+	app := storage.Application{
+		OrganizationID:   ts.app.OrganizationID,
+		Name:             "test-app-cache",
+		ServiceProfileID: ts.app.ServiceProfileID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	configJSON, err := json.Marshal(httpint.Config{
+		DataUpURL: ts.httpServer.URL + "/cache-1",
+	})
+	assert.NoError(err)
+
+	appint := storage.Integration{
+		ApplicationID: app.ID,
+		Kind:          HTTP,
+		Settings:      configJSON,
+	}
+	assert.NoError(storage.CreateIntegration(context.Background(), storage.DB(), &appint))
+
+	sendUplink := func() string {
+		assert.NoError(ForApplicationID(app.ID).HandleUplinkEvent(context.Background(), nil, pb.UplinkEvent{
+			ApplicationId: uint64(app.ID),
+			DevEui:        []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		}))
+
+		req := <-ts.httpRequests
+		return req.URL.Path
+	}
+
+	assert.Equal("/cache-1", sendUplink())
+
+	appint.Settings, err = json.Marshal(httpint.Config{
+		DataUpURL: ts.httpServer.URL + "/cache-2",
+	})
+	assert.NoError(err)
+	assert.NoError(storage.UpdateIntegration(context.Background(), storage.DB(), &appint))
+
+	ts.T().Run("Cached", func(t *testing.T) {
+		assert := require.New(t)
+		assert.Equal("/cache-1", sendUplink())
+	})
+
+	ts.T().Run("Evicted", func(t *testing.T) {
+		assert := require.New(t)
+
+		handleIntegrationChange(storage.IntegrationChange{ApplicationID: app.ID})
+		assert.Equal("/cache-2", sendUplink())
+	})
+
+	ts.T().Run("Application deleted", func(t *testing.T) {
+		assert := require.New(t)
+
+		pubsub := storage.RedisClient().Subscribe(storage.IntegrationChangeChannel)
+		defer pubsub.Close()
+		_, err := pubsub.Receive()
+		assert.NoError(err)
+
+		assert.NoError(storage.DeleteApplication(context.Background(), storage.DB(), app.ID))
+
+		msg, err := pubsub.ReceiveMessage()
+		assert.NoError(err)
+
+		var c storage.IntegrationChange
+		assert.NoError(json.Unmarshal([]byte(msg.Payload), &c))
+		assert.Equal(storage.IntegrationChange{ApplicationID: app.ID}, c)
+
+		handleIntegrationChange(c)
+
+		applicationHandlers.Lock()
+		_, ok := applicationHandlers.items[app.ID]
+		applicationHandlers.Unlock()
+		assert.False(ok)
+	})
+}
+
+// testCloseHandler records that the handler has been closed.
+type testCloseHandler struct {
+	models.IntegrationHandler
+
+	closed chan struct{}
+}
+
+func (h *testCloseHandler) Close() error {
+	close(h.closed)
+	return nil
+}
+
+// TestHandlerCacheRelease tests that evicted handlers are only closed once
+// these are no longer used.
+func TestHandlerCacheRelease(t *testing.T) {
+	assert := require.New(t)
+
+	c := newHandlerCache()
+	h := testCloseHandler{
+		closed: make(chan struct{}),
+	}
+
+	set := c.acquire(1, func() ([]multi.Handler, error) {
+		return []multi.Handler{{IntegrationHandler: &h}}, nil
+	})
+	c.evict(1)
+
+	select {
+	case <-h.closed:
+		t.Fatal("handler closed while in use")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.release(set)
+
+	select {
+	case <-h.closed:
+	case <-time.After(time.Second):
+		t.Fatal("handler not closed after release")
+	}
+
+	assert.Len(c.items, 0)
+}
+
+// TestOrganizationIntegration tests that the organization integrations are
+// used for the applications of the organization, unless the application has
+// an integration of the same kind.
+func (ts *IntegrationTestSuite) TestOrganizationIntegration() {
+	assert := require.New(ts.T())
+
+	app := storage.Application{
+		OrganizationID:   ts.app.OrganizationID,
+		Name:             "test-app-2",
+		ServiceProfileID: ts.app.ServiceProfileID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &app))
+
+	configJSON, err := json.Marshal(httpint.Config{
+		DataUpURL: ts.httpServer.URL + "/org-rx",
+	})
+	assert.NoError(err)
+
+	assert.NoError(storage.CreateOrganizationIntegration(context.Background(), storage.DB(), &storage.OrganizationIntegration{
+		OrganizationID: app.OrganizationID,
+		Kind:           HTTP,
+		Settings:       configJSON,
+	}))
+
+	ts.T().Run("Organization integration", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ForApplicationID(app.ID).HandleUplinkEvent(context.Background(), nil, pb.UplinkEvent{
+			ApplicationId: uint64(app.ID),
+			DevEui:        []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		}))
+
+		req := <-ts.httpRequests
+		assert.Equal("/org-rx", req.URL.Path)
+	})
+
+	ts.T().Run("Application override", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ForApplicationID(ts.app.ID).HandleUplinkEvent(context.Background(), nil, pb.UplinkEvent{
+			ApplicationId: uint64(ts.app.ID),
+			DevEui:        []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		}))
+
+		req := <-ts.httpRequests
+		assert.Equal("/rx", req.URL.Path)
+		assert.Len(ts.httpRequests, 0)
+	})
+}
+
 func TestIntegration(t *testing.T) {
 	suite.Run(t, new(IntegrationTestSuite))
 }
@@ -3,8 +3,11 @@ package kafka
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
@@ -24,8 +27,14 @@ import (
 type Integration struct {
 	marshaler        marshaler.Type
 	writer           *kafka.Writer
+	reader           *kafka.Reader
+	dataDownChan     chan models.DataDownPayload
 	eventKeyTemplate *template.Template
 	config           config.IntegrationKafkaConfig
+
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // New creates a new Kafka integration.
@@ -47,6 +56,25 @@ func New(m marshaler.Type, conf config.IntegrationKafkaConfig) (*Integration, er
 		eventKeyTemplate: kt,
 		config:           conf,
 	}
+
+	if conf.CommandTopic != "" {
+		i.reader = kafka.NewReader(kafka.ReaderConfig{
+			Brokers: conf.Brokers,
+			GroupID: conf.ConsumerGroupID,
+			Topic:   conf.CommandTopic,
+		})
+		i.dataDownChan = make(chan models.DataDownPayload)
+		i.ctx, i.cancel = context.WithCancel(context.Background())
+
+		log.WithFields(log.Fields{
+			"topic":    conf.CommandTopic,
+			"group_id": conf.ConsumerGroupID,
+		}).Info("integration/kafka: consuming downlink commands")
+
+		i.wg.Add(1)
+		go i.consumeLoop()
+	}
+
 	return &i, nil
 }
 
@@ -90,21 +118,31 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return i.publish(ctx, pl.ApplicationId, pl.DevEui, "integration", &pl)
 }
 
-func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB []byte, event string, msg proto.Message) error {
-	if i.writer == nil {
-		return fmt.Errorf("integration closed")
-	}
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	return i.publish(ctx, pl.ApplicationId, pl.DevEui, "management", &pl)
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	return i.publish(ctx, pl.ApplicationId, pl.DevEui, "alert", &pl)
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], pl.GatewayId)
+
+	key := fmt.Sprintf("organization.%d.gateway.%s.event.gateway_status", pl.OrganizationId, gatewayID)
+	return i.write(ctx, []byte(key), "gateway_status", &pl)
+}
 
+func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB []byte, event string, msg proto.Message) error {
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], devEUIB)
 
-	b, err := marshaler.Marshal(i.marshaler, msg)
-	if err != nil {
-		return err
-	}
-
 	keyBuf := bytes.NewBuffer(nil)
-	err = i.eventKeyTemplate.Execute(keyBuf, struct {
+	err := i.eventKeyTemplate.Execute(keyBuf, struct {
 		ApplicationID uint64
 		DevEUI        lorawan.EUI64
 		EventType     string
@@ -112,7 +150,19 @@ func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB
 	if err != nil {
 		return errors.Wrap(err, "executing template")
 	}
-	key := keyBuf.Bytes()
+
+	return i.write(ctx, keyBuf.Bytes(), event, msg)
+}
+
+func (i *Integration) write(ctx context.Context, key []byte, event string, msg proto.Message) error {
+	if i.writer == nil {
+		return fmt.Errorf("integration closed")
+	}
+
+	b, err := marshaler.Marshal(i.marshaler, msg)
+	if err != nil {
+		return err
+	}
 
 	kmsg := kafka.Message{
 		Value: b,
@@ -138,17 +188,134 @@ func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB
 	return nil
 }
 
-// DataDownChan return nil.
+// DataDownChan returns the channel containing the received DataDownPayload.
+// When no command topic is configured, this returns nil.
 func (i *Integration) DataDownChan() chan models.DataDownPayload {
-	return nil
+	return i.dataDownChan
 }
 
-// Close shuts down the integration, closing the Kafka writer.
+// Close shuts down the integration, closing the Kafka writer and reader.
 func (i *Integration) Close() error {
 	if i.writer == nil {
 		return fmt.Errorf("integration already closed")
 	}
+
+	if i.reader != nil {
+		log.Info("integration/kafka: handling last downlink commands")
+		i.cancel()
+		i.wg.Wait()
+		close(i.dataDownChan)
+
+		if err := i.reader.Close(); err != nil {
+			log.WithError(err).Error("integration/kafka: close reader error")
+		}
+		i.reader = nil
+	}
+
 	err := i.writer.Close()
 	i.writer = nil
 	return err
 }
+
+// consumeLoop reads the downlink commands from the command topic. The offset
+// of a message is only committed after the downlink has been enqueued by the
+// downlink handler, so that on a restart or re-balance of the consumer-group
+// uncommitted messages are consumed again.
+func (i *Integration) consumeLoop() {
+	defer i.wg.Done()
+
+	for {
+		msg, err := i.reader.FetchMessage(i.ctx)
+		if err != nil {
+			if i.ctx.Err() != nil {
+				return
+			}
+
+			log.WithError(err).Error("integration/kafka: fetch message error")
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if err := i.handleCommand(msg); err != nil {
+			// the context has been cancelled before the downlink was
+			// enqueued, do not commit its offset
+			return
+		}
+
+		if err := i.reader.CommitMessages(i.ctx, msg); err != nil {
+			if i.ctx.Err() != nil {
+				return
+			}
+
+			log.WithError(err).WithFields(log.Fields{
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+			}).Error("integration/kafka: commit message error")
+		}
+	}
+}
+
+// handleCommand decodes the given message, sends it to the data-down channel
+// and waits until the downlink handler has enqueued it. When the downlink
+// handler returns an error, the command is handed over again after a second.
+// Invalid messages are logged and skipped, an error is only returned when the
+// integration is being closed.
+func (i *Integration) handleCommand(msg kafka.Message) error {
+	log.WithFields(log.Fields{
+		"key":       string(msg.Key),
+		"partition": msg.Partition,
+		"offset":    msg.Offset,
+	}).Info("integration/kafka: downlink command received")
+
+	var pl models.DataDownPayload
+	if err := marshaler.UnmarshalDataDownPayload(i.marshaler, msg.Value, &pl); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"data_base64": base64.StdEncoding.EncodeToString(msg.Value),
+		}).Error("integration/kafka: unmarshal downlink command error")
+		return nil
+	}
+
+	if pl.FPort == 0 || pl.FPort > 224 {
+		log.WithFields(log.Fields{
+			"dev_eui": pl.DevEUI,
+			"f_port":  pl.FPort,
+		}).Error("integration/kafka: fPort must be between 1 - 224")
+		return nil
+	}
+
+	for {
+		done := make(chan error, 1)
+		pl.Callback = func(err error) {
+			done <- err
+		}
+
+		select {
+		case i.dataDownChan <- pl:
+		case <-i.ctx.Done():
+			return i.ctx.Err()
+		}
+
+		var err error
+		select {
+		case err = <-done:
+		case <-i.ctx.Done():
+			return i.ctx.Err()
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		log.WithError(err).WithFields(log.Fields{
+			"dev_eui":   pl.DevEUI,
+			"partition": msg.Partition,
+			"offset":    msg.Offset,
+		}).Error("integration/kafka: handle downlink command error, will retry in 1s")
+
+		select {
+		case <-time.After(time.Second):
+		case <-i.ctx.Done():
+			return i.ctx.Err()
+		}
+	}
+}
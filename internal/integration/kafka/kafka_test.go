@@ -3,13 +3,16 @@ package kafka
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
 	"github.com/brocaar/chirpstack-application-server/internal/test"
 	"github.com/brocaar/lorawan"
 
@@ -23,7 +26,8 @@ type IntegrationTestSuite struct {
 	applicationID uint64
 	devEUI        lorawan.EUI64
 
-	conn *kafka.Conn
+	conn          *kafka.Conn
+	commandWriter *kafka.Writer
 }
 
 func (ts *IntegrationTestSuite) SetupSuite() {
@@ -52,10 +56,17 @@ func (ts *IntegrationTestSuite) SetupSuite() {
 
 	ts.integration, err = New(marshaler.Protobuf, kafkaConf)
 	assert.NoError(err)
+
+	ts.commandWriter = kafka.NewWriter(kafka.WriterConfig{
+		Brokers: kafkaConf.Brokers,
+		Topic:   kafkaConf.CommandTopic,
+	})
 }
 
 func (ts *IntegrationTestSuite) TearDownSuite() {
 	assert := require.New(ts.T())
+	assert.NoError(ts.commandWriter.Close())
+	assert.NoError(ts.integration.Close())
 	assert.NoError(ts.conn.Close())
 }
 
@@ -69,6 +80,66 @@ func (ts *IntegrationTestSuite) TestUplink() {
 	ts.checkMessage(err, &tx, &rx)
 }
 
+func (ts *IntegrationTestSuite) TestDownlinkCommand() {
+	ts.T().Run("Valid", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.commandWriter.WriteMessages(context.Background(), kafka.Message{
+			Value: []byte(`{"applicationID": "10", "devEUI": "0102030405060708", "confirmed": true, "fPort": 10, "data": "AQID"}`),
+		}))
+
+		select {
+		case pl := <-ts.integration.DataDownChan():
+			assert.NotNil(pl.Callback)
+			pl.Callback(nil)
+			pl.Callback = nil
+
+			assert.Equal(models.DataDownPayload{
+				ApplicationID: int64(ts.applicationID),
+				DevEUI:        ts.devEUI,
+				Confirmed:     true,
+				FPort:         10,
+				Data:          []byte{1, 2, 3},
+			}, pl)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for downlink command")
+		}
+	})
+
+	ts.T().Run("Handler error", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.commandWriter.WriteMessages(context.Background(), kafka.Message{
+			Value: []byte(`{"applicationID": "10", "devEUI": "0102030405060708", "fPort": 20, "data": "AQID"}`),
+		}))
+
+		// the command is handed over again after the handler failed
+		for _, err := range []error{errors.New("enqueue error"), nil} {
+			select {
+			case pl := <-ts.integration.DataDownChan():
+				assert.Equal(uint8(20), pl.FPort)
+				pl.Callback(err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("timeout waiting for downlink command")
+			}
+		}
+	})
+
+	ts.T().Run("Invalid fPort", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(ts.commandWriter.WriteMessages(context.Background(), kafka.Message{
+			Value: []byte(`{"applicationID": "10", "devEUI": "0102030405060708", "fPort": 0, "data": "AQID"}`),
+		}))
+
+		select {
+		case <-ts.integration.DataDownChan():
+			t.Fatal("unexpected downlink command")
+		case <-time.After(time.Second):
+		}
+	})
+}
+
 func (ts *IntegrationTestSuite) checkMessage(err error, tx, rx proto.Message) {
 	assert := require.New(ts.T())
 
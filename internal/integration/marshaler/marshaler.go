@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
@@ -42,6 +43,19 @@ func Marshal(t Type, msg proto.Message) ([]byte, error) {
 	}
 }
 
+// UnmarshalDataDownPayload unmarshals the given downlink payload.
+// As there is no Protobuf message defined for the downlink payload, all
+// marshaler types expect the JSON encoded DataDownPayload (as is the case
+// for the MQTT integration).
+func UnmarshalDataDownPayload(t Type, b []byte, pl *models.DataDownPayload) error {
+	switch t {
+	case Protobuf, ProtobufJSON, JSONV3:
+		return json.Unmarshal(b, pl)
+	default:
+		return fmt.Errorf("unknown marshaler type: %v", t)
+	}
+}
+
 func marshalProtobuf(msg proto.Message) ([]byte, error) {
 	return proto.Marshal(msg)
 }
@@ -80,6 +94,12 @@ func marshalJSONV3(msg proto.Message) ([]byte, error) {
 		return jsonv3MarshalTxAckEvent(v)
 	case *integration.IntegrationEvent:
 		return jsonv3MarshalIntegrationEvent(v)
+	case *integration.ManagementEvent:
+		return jsonv3MarshalManagementEvent(v)
+	case *integration.AlertEvent:
+		return jsonv3MarshalAlertEvent(v)
+	case *integration.GatewayStatusEvent:
+		return jsonv3MarshalGatewayStatusEvent(v)
 	default:
 		return nil, fmt.Errorf("unknown message type: %T", msg)
 	}
@@ -312,3 +332,78 @@ func jsonv3MarshalIntegrationEvent(msg *integration.IntegrationEvent) ([]byte, e
 	copy(m.DevEUI[:], msg.DevEui)
 	return json.Marshal(m)
 }
+
+func jsonv3MarshalManagementEvent(msg *integration.ManagementEvent) ([]byte, error) {
+	var oldState, newState interface{}
+	if msg.OldStateJson != "" {
+		if err := json.Unmarshal([]byte(msg.OldStateJson), &oldState); err != nil {
+			log.WithError(err).Error("integration/marshaler: unmarshal json error")
+		}
+	}
+	if msg.NewStateJson != "" {
+		if err := json.Unmarshal([]byte(msg.NewStateJson), &newState); err != nil {
+			log.WithError(err).Error("integration/marshaler: unmarshal json error")
+		}
+	}
+
+	m := models.ManagementNotification{
+		ApplicationID:   int64(msg.ApplicationId),
+		ApplicationName: msg.ApplicationName,
+		DeviceName:      msg.DeviceName,
+		Type:            strings.ToLower(msg.Type.String()),
+		Tags:            msg.Tags,
+		OldState:        oldState,
+		NewState:        newState,
+	}
+
+	copy(m.DevEUI[:], msg.DevEui)
+	return json.Marshal(m)
+}
+
+func jsonv3MarshalAlertEvent(msg *integration.AlertEvent) ([]byte, error) {
+	m := models.AlertNotification{
+		ApplicationID:   int64(msg.ApplicationId),
+		ApplicationName: msg.ApplicationName,
+		DeviceName:      msg.DeviceName,
+		AlertRuleID:     msg.AlertRuleId,
+		AlertRuleName:   msg.AlertRuleName,
+		Type:            strings.ToLower(msg.Type.String()),
+		State:           strings.ToLower(msg.State.String()),
+		BatteryLevel:    msg.BatteryLevel,
+		Margin:          int(msg.Margin),
+		Tags:            msg.Tags,
+	}
+
+	copy(m.DevEUI[:], msg.DevEui)
+
+	if msg.LastSeenAt != nil {
+		t, err := ptypes.Timestamp(msg.LastSeenAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "get last seen timestamp error")
+		}
+		m.LastSeenAt = &t
+	}
+
+	return json.Marshal(m)
+}
+
+func jsonv3MarshalGatewayStatusEvent(msg *integration.GatewayStatusEvent) ([]byte, error) {
+	m := models.GatewayStatusNotification{
+		GatewayName:    msg.GatewayName,
+		OrganizationID: msg.OrganizationId,
+		Online:         msg.Online,
+		Tags:           msg.Tags,
+	}
+
+	copy(m.GatewayID[:], msg.GatewayId)
+
+	if msg.LastSeenAt != nil {
+		t, err := ptypes.Timestamp(msg.LastSeenAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "get last seen timestamp error")
+		}
+		m.LastSeenAt = &t
+	}
+
+	return json.Marshal(m)
+}
@@ -233,6 +233,21 @@ func (ts *MarshalerTestSuite) GetIntegrationEvent() integration.IntegrationEvent
 	}
 }
 
+func (ts *MarshalerTestSuite) GetManagementEvent() integration.ManagementEvent {
+	return integration.ManagementEvent{
+		ApplicationId:   123,
+		ApplicationName: "test-application",
+		DeviceName:      "test-device",
+		DevEui:          []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		Type:            integration.ManagementEventType_UPDATE,
+		OldStateJson:    `{"name":"old-device"}`,
+		NewStateJson:    `{"name":"test-device"}`,
+		Tags: map[string]string{
+			"test": "tag",
+		},
+	}
+}
+
 func (ts *MarshalerTestSuite) TestProtobuf() {
 	uplinkEvent := ts.GetUplinkEvent()
 
@@ -498,6 +513,117 @@ func (ts *MarshalerTestSuite) TestJSONV3() {
 			},
 		}, pl)
 	})
+
+	ts.T().Run("ManagementNotification", func(t *testing.T) {
+		event := ts.GetManagementEvent()
+
+		assert := require.New(t)
+		b, err := Marshal(JSONV3, &event)
+		assert.NoError(err)
+
+		var pl models.ManagementNotification
+		assert.NoError(json.Unmarshal(b, &pl))
+
+		assert.Equal(models.ManagementNotification{
+			ApplicationID:   123,
+			ApplicationName: "test-application",
+			DeviceName:      "test-device",
+			DevEUI:          lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Type:            "update",
+			OldState: map[string]interface{}{
+				"name": "old-device",
+			},
+			NewState: map[string]interface{}{
+				"name": "test-device",
+			},
+			Tags: map[string]string{
+				"test": "tag",
+			},
+		}, pl)
+	})
+
+	ts.T().Run("AlertNotification", func(t *testing.T) {
+		assert := require.New(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		nowPB, err := ptypes.TimestampProto(now)
+		assert.NoError(err)
+
+		event := integration.AlertEvent{
+			ApplicationId:   123,
+			ApplicationName: "test-application",
+			DeviceName:      "test-device",
+			DevEui:          []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			AlertRuleId:     "b8a3bc8e-8f4b-4b3e-9b6a-2c6f0b2c1e5d",
+			AlertRuleName:   "no-uplink",
+			Type:            integration.AlertType_INACTIVITY,
+			State:           integration.AlertState_RESOLVED,
+			LastSeenAt:      nowPB,
+			BatteryLevel:    75.5,
+			Margin:          10,
+			Tags: map[string]string{
+				"test": "tag",
+			},
+		}
+
+		b, err := Marshal(JSONV3, &event)
+		assert.NoError(err)
+
+		var pl models.AlertNotification
+		assert.NoError(json.Unmarshal(b, &pl))
+
+		assert.Equal(models.AlertNotification{
+			ApplicationID:   123,
+			ApplicationName: "test-application",
+			DeviceName:      "test-device",
+			DevEUI:          lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			AlertRuleID:     "b8a3bc8e-8f4b-4b3e-9b6a-2c6f0b2c1e5d",
+			AlertRuleName:   "no-uplink",
+			Type:            "inactivity",
+			State:           "resolved",
+			LastSeenAt:      &now,
+			BatteryLevel:    75.5,
+			Margin:          10,
+			Tags: map[string]string{
+				"test": "tag",
+			},
+		}, pl)
+	})
+
+	ts.T().Run("GatewayStatusNotification", func(t *testing.T) {
+		assert := require.New(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		nowPB, err := ptypes.TimestampProto(now)
+		assert.NoError(err)
+
+		event := integration.GatewayStatusEvent{
+			GatewayId:      []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			GatewayName:    "test-gateway",
+			OrganizationId: 123,
+			LastSeenAt:     nowPB,
+			Tags: map[string]string{
+				"test": "tag",
+			},
+		}
+
+		b, err := Marshal(JSONV3, &event)
+		assert.NoError(err)
+
+		var pl models.GatewayStatusNotification
+		assert.NoError(json.Unmarshal(b, &pl))
+
+		assert.Equal(models.GatewayStatusNotification{
+			GatewayID:      lorawan.EUI64{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			GatewayName:    "test-gateway",
+			OrganizationID: 123,
+			Online:         false,
+			LastSeenAt:     &now,
+			Tags: map[string]string{
+				"test": "tag",
+			},
+		}, pl)
+	})
 }
 
 func TestMarshaler(t *testing.T) {
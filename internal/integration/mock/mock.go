@@ -9,29 +9,35 @@ import (
 
 // Integration implements a mock integration.
 type Integration struct {
-	SendDataUpChan                  chan pb.UplinkEvent
-	SendJoinNotificationChan        chan pb.JoinEvent
-	SendACKNotificationChan         chan pb.AckEvent
-	SendErrorNotificationChan       chan pb.ErrorEvent
-	DataDownPayloadChan             chan models.DataDownPayload
-	SendStatusNotificationChan      chan pb.StatusEvent
-	SendLocationNotificationChan    chan pb.LocationEvent
-	SendTxAckNotificationChan       chan pb.TxAckEvent
-	SendIntegrationNotificationChan chan pb.IntegrationEvent
+	SendDataUpChan                    chan pb.UplinkEvent
+	SendJoinNotificationChan          chan pb.JoinEvent
+	SendACKNotificationChan           chan pb.AckEvent
+	SendErrorNotificationChan         chan pb.ErrorEvent
+	DataDownPayloadChan               chan models.DataDownPayload
+	SendStatusNotificationChan        chan pb.StatusEvent
+	SendLocationNotificationChan      chan pb.LocationEvent
+	SendTxAckNotificationChan         chan pb.TxAckEvent
+	SendIntegrationNotificationChan   chan pb.IntegrationEvent
+	SendManagementNotificationChan    chan pb.ManagementEvent
+	SendAlertNotificationChan         chan pb.AlertEvent
+	SendGatewayStatusNotificationChan chan pb.GatewayStatusEvent
 }
 
 // New creates a new mock integration.
 func New() *Integration {
 	return &Integration{
-		SendDataUpChan:                  make(chan pb.UplinkEvent, 100),
-		SendJoinNotificationChan:        make(chan pb.JoinEvent, 100),
-		SendACKNotificationChan:         make(chan pb.AckEvent, 100),
-		SendErrorNotificationChan:       make(chan pb.ErrorEvent, 100),
-		DataDownPayloadChan:             make(chan models.DataDownPayload, 100),
-		SendStatusNotificationChan:      make(chan pb.StatusEvent, 100),
-		SendLocationNotificationChan:    make(chan pb.LocationEvent, 100),
-		SendTxAckNotificationChan:       make(chan pb.TxAckEvent, 100),
-		SendIntegrationNotificationChan: make(chan pb.IntegrationEvent, 100),
+		SendDataUpChan:                    make(chan pb.UplinkEvent, 100),
+		SendJoinNotificationChan:          make(chan pb.JoinEvent, 100),
+		SendACKNotificationChan:           make(chan pb.AckEvent, 100),
+		SendErrorNotificationChan:         make(chan pb.ErrorEvent, 100),
+		DataDownPayloadChan:               make(chan models.DataDownPayload, 100),
+		SendStatusNotificationChan:        make(chan pb.StatusEvent, 100),
+		SendLocationNotificationChan:      make(chan pb.LocationEvent, 100),
+		SendTxAckNotificationChan:         make(chan pb.TxAckEvent, 100),
+		SendIntegrationNotificationChan:   make(chan pb.IntegrationEvent, 100),
+		SendManagementNotificationChan:    make(chan pb.ManagementEvent, 100),
+		SendAlertNotificationChan:         make(chan pb.AlertEvent, 100),
+		SendGatewayStatusNotificationChan: make(chan pb.GatewayStatusEvent, 100),
 	}
 }
 
@@ -92,3 +98,21 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, vars map[strin
 	i.SendIntegrationNotificationChan <- payload
 	return nil
 }
+
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, vars map[string]string, payload pb.ManagementEvent) error {
+	i.SendManagementNotificationChan <- payload
+	return nil
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, vars map[string]string, payload pb.AlertEvent) error {
+	i.SendAlertNotificationChan <- payload
+	return nil
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, vars map[string]string, payload pb.GatewayStatusEvent) error {
+	i.SendGatewayStatusNotificationChan <- payload
+	return nil
+}
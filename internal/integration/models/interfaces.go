@@ -16,6 +16,9 @@ type Integration interface {
 	HandleLocationEvent(ctx context.Context, vars map[string]string, pl integration.LocationEvent) error
 	HandleTxAckEvent(ctx context.Context, vars map[string]string, pl integration.TxAckEvent) error
 	HandleIntegrationEvent(ctx context.Context, vars map[string]string, pl integration.IntegrationEvent) error
+	HandleManagementEvent(ctx context.Context, vars map[string]string, pl integration.ManagementEvent) error
+	HandleAlertEvent(ctx context.Context, vars map[string]string, pl integration.AlertEvent) error
+	HandleGatewayStatusEvent(ctx context.Context, vars map[string]string, pl integration.GatewayStatusEvent) error
 	DataDownChan() chan DataDownPayload
 }
 
@@ -33,6 +36,9 @@ type IntegrationHandler interface {
 	HandleLocationEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.LocationEvent) error
 	HandleTxAckEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.TxAckEvent) error
 	HandleIntegrationEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.IntegrationEvent) error
+	HandleManagementEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.ManagementEvent) error
+	HandleAlertEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.AlertEvent) error
+	HandleGatewayStatusEvent(ctx context.Context, i Integration, vars map[string]string, pl integration.GatewayStatusEvent) error
 	DataDownChan() chan DataDownPayload
 	Close() error
 }
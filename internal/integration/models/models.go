@@ -57,6 +57,11 @@ type DataDownPayload struct {
 	FPort         uint8           `json:"fPort"`
 	Data          []byte          `json:"data"`
 	Object        json.RawMessage `json:"object"`
+
+	// Callback (when set) is called after the payload has been handled, with
+	// the error (if any) of the downlink handler. This makes it possible for
+	// integrations to acknowledge a command once it has been enqueued.
+	Callback func(error) `json:"-"`
 }
 
 // JoinNotification defines the payload sent to the application on
@@ -148,3 +153,41 @@ type IntegrationNotification struct {
 	Tags            map[string]string `json:"tags,omitempty"`
 	Object          interface{}       `json:"object"`
 }
+
+// ManagementNotification defines the payload for the management event.
+type ManagementNotification struct {
+	ApplicationID   int64             `json:"applicationID,string"`
+	ApplicationName string            `json:"applicationName"`
+	DeviceName      string            `json:"deviceName"`
+	DevEUI          lorawan.EUI64     `json:"devEUI"`
+	Type            string            `json:"type"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	OldState        interface{}       `json:"oldState"`
+	NewState        interface{}       `json:"newState"`
+}
+
+// AlertNotification defines the payload for the alert event.
+type AlertNotification struct {
+	ApplicationID   int64             `json:"applicationID,string"`
+	ApplicationName string            `json:"applicationName"`
+	DeviceName      string            `json:"deviceName"`
+	DevEUI          lorawan.EUI64     `json:"devEUI"`
+	AlertRuleID     string            `json:"alertRuleID"`
+	AlertRuleName   string            `json:"alertRuleName"`
+	Type            string            `json:"type"`
+	State           string            `json:"state"`
+	LastSeenAt      *time.Time        `json:"lastSeenAt,omitempty"`
+	BatteryLevel    float32           `json:"batteryLevel"`
+	Margin          int               `json:"margin"`
+	Tags            map[string]string `json:"tags,omitempty"`
+}
+
+// GatewayStatusNotification defines the payload for the gateway status event.
+type GatewayStatusNotification struct {
+	GatewayID      lorawan.EUI64     `json:"gatewayID"`
+	GatewayName    string            `json:"gatewayName"`
+	OrganizationID int64             `json:"organizationID,string"`
+	Online         bool              `json:"online"`
+	LastSeenAt     *time.Time        `json:"lastSeenAt,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
@@ -44,6 +44,9 @@ type Integration struct {
 	downlinkRegexp       *regexp.Regexp
 	retainEvents         bool
 
+	// Gateway events.
+	gatewayEventTopicTemplate *template.Template
+
 	// For backwards compatibility.
 	uplinkTemplate      *template.Template
 	downlinkTemplate    *template.Template
@@ -82,6 +85,10 @@ func New(m marshaler.Type, conf config.IntegrationMQTTConfig) (*Integration, err
 	if err != nil {
 		return nil, errors.Wrap(err, "parse command template error")
 	}
+	i.gatewayEventTopicTemplate, err = template.New("gateway_event").Parse(i.config.GatewayEventTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse gateway event template error")
+	}
 
 	// For backwards compatibility.
 	if i.config.UplinkTopicTemplate != "" {
@@ -286,6 +293,34 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, _ models.Integ
 	return i.publish(ctx, payload.ApplicationId, payload.DevEui, "integration", &payload)
 }
 
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, _ models.Integration, vars map[string]string, payload pb.ManagementEvent) error {
+	return i.publish(ctx, payload.ApplicationId, payload.DevEui, "management", &payload)
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, _ models.Integration, vars map[string]string, payload pb.AlertEvent) error {
+	return i.publish(ctx, payload.ApplicationId, payload.DevEui, "alert", &payload)
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	var gatewayID lorawan.EUI64
+	copy(gatewayID[:], pl.GatewayId)
+
+	topic := bytes.NewBuffer(nil)
+	err := i.gatewayEventTopicTemplate.Execute(topic, struct {
+		OrganizationID int64
+		GatewayID      lorawan.EUI64
+		EventType      string
+	}{pl.OrganizationId, gatewayID, "gateway_status"})
+	if err != nil {
+		return errors.Wrap(err, "execute template error")
+	}
+
+	return i.publishTopic(ctx, topic.String(), i.getRetainEvents("gateway_status"), &pl)
+}
+
 func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB []byte, eventType string, msg proto.Message) error {
 	var devEUI lorawan.EUI64
 	copy(devEUI[:], devEUIB)
@@ -295,19 +330,20 @@ func (i *Integration) publish(ctx context.Context, applicationID uint64, devEUIB
 		return errors.Wrap(err, "get topic error")
 	}
 
-	retain := i.getRetainEvents(eventType)
+	return i.publishTopic(ctx, topic, i.getRetainEvents(eventType), msg)
+}
 
+func (i *Integration) publishTopic(ctx context.Context, topic string, retain bool, msg proto.Message) error {
 	b, err := marshaler.Marshal(i.marshaler, msg)
 	if err != nil {
 		return err
 	}
 
 	log.WithFields(log.Fields{
-		"dev_eui": devEUI,
-		"retain":  retain,
-		"topic":   topic,
-		"qos":     i.config.QOS,
-		"ctx_id":  ctx.Value(logging.ContextIDKey),
+		"retain": retain,
+		"topic":  topic,
+		"qos":    i.config.QOS,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
 	}).Info("integration/mqtt: publishing event")
 	if token := i.conn.Publish(topic, i.config.QOS, retain, b); token.Wait() && token.Error() != nil {
 		return token.Error()
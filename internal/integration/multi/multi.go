@@ -6,22 +6,42 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/gofrs/uuid"
 	log "github.com/sirupsen/logrus"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
 	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
 )
 
 // Integration implements the multi integration.
 type Integration struct {
 	wg                 sync.WaitGroup
 	globalIntegrations []models.IntegrationHandler
-	appIntegrations    []models.IntegrationHandler
+	appIntegrations    []Handler
+}
+
+// Handler contains an application integration handler together with the
+// filter which is evaluated before an event is dispatched to it.
+type Handler struct {
+	models.IntegrationHandler
+	Filter storage.IntegrationFilter
+}
+
+// event contains the event properties on which the integration filters are
+// evaluated.
+type event struct {
+	eventType string
+	devEUI    []byte
+	tags      map[string]string
+	fPort     *uint32
 }
 
 // New creates a new multi-integration.
-func New(global, app []models.IntegrationHandler) *Integration {
+func New(global []models.IntegrationHandler, app []Handler) *Integration {
 	return &Integration{
 		globalIntegrations: global,
 		appIntegrations:    app,
@@ -30,9 +50,14 @@ func New(global, app []models.IntegrationHandler) *Integration {
 
 // HandleUplinkEvent sends an UplinkEvent.
 func (i *Integration) HandleUplinkEvent(ctx context.Context, vars map[string]string, pl pb.UplinkEvent) error {
-	defer i.closeAppIntegrations()
-
-	for _, ii := range i.integrations() {
+	defer i.wait()
+
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Uplink,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+		fPort:     &pl.FPort,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -51,9 +76,13 @@ func (i *Integration) HandleUplinkEvent(ctx context.Context, vars map[string]str
 
 // HandleJoinEvent sends a JoinEvent.
 func (i *Integration) HandleJoinEvent(ctx context.Context, vars map[string]string, pl pb.JoinEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Join,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -72,9 +101,13 @@ func (i *Integration) HandleJoinEvent(ctx context.Context, vars map[string]strin
 
 // HandleAckEvent sends an AckEvent.
 func (i *Integration) HandleAckEvent(ctx context.Context, vars map[string]string, pl pb.AckEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.ACK,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -93,9 +126,13 @@ func (i *Integration) HandleAckEvent(ctx context.Context, vars map[string]string
 
 // HandleErrorEvent sends an ErrorEvent.
 func (i *Integration) HandleErrorEvent(ctx context.Context, vars map[string]string, pl pb.ErrorEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Error,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -114,9 +151,13 @@ func (i *Integration) HandleErrorEvent(ctx context.Context, vars map[string]stri
 
 // HandleStatusEvent sends a StatusEvent.
 func (i *Integration) HandleStatusEvent(ctx context.Context, vars map[string]string, pl pb.StatusEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Status,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -135,9 +176,13 @@ func (i *Integration) HandleStatusEvent(ctx context.Context, vars map[string]str
 
 // HandleLocationEvent sends a LocationEvent.
 func (i *Integration) HandleLocationEvent(ctx context.Context, vars map[string]string, pl pb.LocationEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Location,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -156,9 +201,13 @@ func (i *Integration) HandleLocationEvent(ctx context.Context, vars map[string]s
 
 // HandleTxAckEvent sends a TxAckEvent.
 func (i *Integration) HandleTxAckEvent(ctx context.Context, vars map[string]string, pl pb.TxAckEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.TxAck,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -177,9 +226,13 @@ func (i *Integration) HandleTxAckEvent(ctx context.Context, vars map[string]stri
 
 // HandleIntegrationEvent sends an IntegrationEvent.
 func (i *Integration) HandleIntegrationEvent(ctx context.Context, vars map[string]string, pl pb.IntegrationEvent) error {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
-	for _, ii := range i.integrations() {
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Integration,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
 		i.wg.Add(1)
 
 		go func(ii models.IntegrationHandler) {
@@ -196,48 +249,209 @@ func (i *Integration) HandleIntegrationEvent(ctx context.Context, vars map[strin
 	return nil
 }
 
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, vars map[string]string, pl pb.ManagementEvent) error {
+	defer i.wait()
+
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Management,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
+		i.wg.Add(1)
+
+		go func(ii models.IntegrationHandler) {
+			defer i.wg.Done()
+			if err := ii.HandleManagementEvent(ctx, i, vars, pl); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"integration": fmt.Sprintf("%T", ii),
+					"ctx_id":      ctx.Value(logging.ContextIDKey),
+				}).Error("integration/multi: integration error")
+			}
+		}(ii)
+	}
+
+	return nil
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, vars map[string]string, pl pb.AlertEvent) error {
+	defer i.wait()
+
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.Alert,
+		devEUI:    pl.DevEui,
+		tags:      pl.Tags,
+	}) {
+		i.wg.Add(1)
+
+		go func(ii models.IntegrationHandler) {
+			defer i.wg.Done()
+			if err := ii.HandleAlertEvent(ctx, i, vars, pl); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"integration": fmt.Sprintf("%T", ii),
+					"ctx_id":      ctx.Value(logging.ContextIDKey),
+				}).Error("integration/multi: integration error")
+			}
+		}(ii)
+	}
+
+	return nil
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	defer i.wait()
+
+	for _, ii := range i.integrations(ctx, event{
+		eventType: eventlog.GatewayStatus,
+	}) {
+		i.wg.Add(1)
+
+		go func(ii models.IntegrationHandler) {
+			defer i.wg.Done()
+			if err := ii.HandleGatewayStatusEvent(ctx, i, vars, pl); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"integration": fmt.Sprintf("%T", ii),
+					"ctx_id":      ctx.Value(logging.ContextIDKey),
+				}).Error("integration/multi: integration error")
+			}
+		}(ii)
+	}
+
+	return nil
+}
+
 // DataDownChan returns the channel containing the received DataDownPayload.
+// When multiple global integrations return a channel (e.g. MQTT and Kafka),
+// these are merged into a single channel.
 func (i *Integration) DataDownChan() chan models.DataDownPayload {
-	defer i.closeAppIntegrations()
+	defer i.wait()
 
+	var chans []chan models.DataDownPayload
 	for _, ii := range i.globalIntegrations {
 		if c := ii.DataDownChan(); c != nil {
-			return c
+			chans = append(chans, c)
 		}
 	}
 
-	return nil
-}
+	switch len(chans) {
+	case 0:
+		return nil
+	case 1:
+		return chans[0]
+	}
 
-// closeAppIntegrations closes the application integrations.
-func (i *Integration) closeAppIntegrations() {
-	log.Debug("integration/multi: waiting for integrations to complete")
-	i.wg.Wait()
+	var wg sync.WaitGroup
+	out := make(chan models.DataDownPayload)
 
-	log.Debug("integration/multi: closing integrations")
-	for _, ii := range i.appIntegrations {
-		if err := ii.Close(); err != nil {
-			log.WithError(err).WithFields(log.Fields{
-				"integration": fmt.Sprintf("%T", ii),
-			}).Error("integrations/multi: close integration error")
-		}
+	for _, c := range chans {
+		wg.Add(1)
+
+		go func(c chan models.DataDownPayload) {
+			defer wg.Done()
+			for pl := range c {
+				out <- pl
+			}
+		}(c)
 	}
 
-	log.Debug("integration/multi: integrations closed")
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
 }
 
-// integrations returns a slice with the global and application-integrations
-// combined.
-func (i *Integration) integrations() []models.IntegrationHandler {
+// wait waits for the integrations to complete. Note that the application
+// integrations are not closed, as these are owned by the caller (e.g. a
+// cache of integrations) and are re-used for other events.
+func (i *Integration) wait() {
+	log.Debug("integration/multi: waiting for integrations to complete")
+	i.wg.Wait()
+}
+
+// integrations returns a slice with the global integrations and the
+// application-integrations of which the filter matches the given event.
+func (i *Integration) integrations(ctx context.Context, e event) []models.IntegrationHandler {
 	var ints []models.IntegrationHandler
 
 	for _, ii := range i.globalIntegrations {
 		ints = append(ints, ii)
 	}
 
+	// the device-profile ID is only retrieved when needed by a filter
+	var dpID *uuid.UUID
+
 	for _, ii := range i.appIntegrations {
-		ints = append(ints, ii)
+		f := ii.Filter
+
+		// events which are not related to a device (e.g. gateway events)
+		// never match the device-profile filter
+		if f.DeviceProfileID != nil && dpID == nil && len(e.devEUI) != 0 {
+			var devEUI lorawan.EUI64
+			copy(devEUI[:], e.devEUI)
+
+			d, err := storage.GetDevice(ctx, storage.DB(), devEUI, false, true)
+			if err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"dev_eui": devEUI,
+					"ctx_id":  ctx.Value(logging.ContextIDKey),
+				}).Error("integration/multi: get device error")
+				continue
+			}
+			dpID = &d.DeviceProfileID
+		}
+
+		if !filterMatches(f, e, dpID) {
+			log.WithFields(log.Fields{
+				"integration": fmt.Sprintf("%T", ii.IntegrationHandler),
+				"event_type":  e.eventType,
+				"ctx_id":      ctx.Value(logging.ContextIDKey),
+			}).Debug("integration/multi: event does not match integration filter")
+			continue
+		}
+
+		ints = append(ints, ii.IntegrationHandler)
 	}
 
 	return ints
 }
+
+// filterMatches returns true when the given event matches the filter.
+func filterMatches(f storage.IntegrationFilter, e event, dpID *uuid.UUID) bool {
+	if len(f.EventTypes) != 0 {
+		var found bool
+		for _, t := range f.EventTypes {
+			if t == e.eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for k, v := range f.DeviceTags {
+		if tv, ok := e.tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+
+	if f.DeviceProfileID != nil && (dpID == nil || *f.DeviceProfileID != *dpID) {
+		return false
+	}
+
+	if e.fPort != nil {
+		if f.FPortMin != 0 && *e.fPort < uint32(f.FPortMin) {
+			return false
+		}
+		if f.FPortMax != 0 && *e.fPort > uint32(f.FPortMax) {
+			return false
+		}
+	}
+
+	return true
+}
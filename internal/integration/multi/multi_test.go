@@ -9,11 +9,13 @@ import (
 	"testing"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
 	"github.com/brocaar/chirpstack-application-server/internal/config"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
 	httpint "github.com/brocaar/chirpstack-application-server/internal/integration/http"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/marshaler"
 	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
@@ -102,7 +104,7 @@ func (ts *MultiTestSuite) SetupSuite() {
 		TxAckNotificationURL:    ts.httpServer.URL + "/txack",
 	})
 	assert.NoError(err)
-	appIntegrations := []models.IntegrationHandler{hi}
+	appIntegrations := []Handler{{IntegrationHandler: hi}}
 
 	ts.integration = New(globalIntegrations, appIntegrations)
 }
@@ -210,6 +212,90 @@ func (ts *MultiTestSuite) TestHandleTxAckEvent() {
 	assert.Equal("/txack", req.URL.Path)
 }
 
+func TestFilterMatches(t *testing.T) {
+	dpID := uuid.Must(uuid.NewV4())
+	otherDPID := uuid.Must(uuid.NewV4())
+	fPort := uint32(10)
+
+	tests := []struct {
+		name     string
+		filter   storage.IntegrationFilter
+		event    event
+		dpID     *uuid.UUID
+		expected bool
+	}{
+		{
+			name:     "empty filter",
+			event:    event{eventType: eventlog.Uplink},
+			expected: true,
+		},
+		{
+			name:     "event type matches",
+			filter:   storage.IntegrationFilter{EventTypes: []string{eventlog.Join, eventlog.Uplink}},
+			event:    event{eventType: eventlog.Uplink},
+			expected: true,
+		},
+		{
+			name:   "event type does not match",
+			filter: storage.IntegrationFilter{EventTypes: []string{eventlog.Join}},
+			event:  event{eventType: eventlog.Uplink},
+		},
+		{
+			name:     "device tags match",
+			filter:   storage.IntegrationFilter{DeviceTags: map[string]string{"type": "meter"}},
+			event:    event{eventType: eventlog.Uplink, tags: map[string]string{"type": "meter", "foo": "bar"}},
+			expected: true,
+		},
+		{
+			name:   "device tag value does not match",
+			filter: storage.IntegrationFilter{DeviceTags: map[string]string{"type": "meter"}},
+			event:  event{eventType: eventlog.Uplink, tags: map[string]string{"type": "sensor"}},
+		},
+		{
+			name:   "device tag missing",
+			filter: storage.IntegrationFilter{DeviceTags: map[string]string{"type": "meter"}},
+			event:  event{eventType: eventlog.Uplink},
+		},
+		{
+			name:     "device-profile matches",
+			filter:   storage.IntegrationFilter{DeviceProfileID: &dpID},
+			event:    event{eventType: eventlog.Uplink},
+			dpID:     &dpID,
+			expected: true,
+		},
+		{
+			name:   "device-profile does not match",
+			filter: storage.IntegrationFilter{DeviceProfileID: &dpID},
+			event:  event{eventType: eventlog.Uplink},
+			dpID:   &otherDPID,
+		},
+		{
+			name:     "fport in range",
+			filter:   storage.IntegrationFilter{FPortMin: 10, FPortMax: 20},
+			event:    event{eventType: eventlog.Uplink, fPort: &fPort},
+			expected: true,
+		},
+		{
+			name:   "fport out of range",
+			filter: storage.IntegrationFilter{FPortMin: 11},
+			event:  event{eventType: eventlog.Uplink, fPort: &fPort},
+		},
+		{
+			name:     "fport range ignored for events without fport",
+			filter:   storage.IntegrationFilter{FPortMin: 11},
+			event:    event{eventType: eventlog.Join},
+			expected: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			assert := require.New(t)
+			assert.Equal(tst.expected, filterMatches(tst.filter, tst.event, tst.dpID))
+		})
+	}
+}
+
 func TestMulti(t *testing.T) {
 	suite.Run(t, new(MultiTestSuite))
 }
@@ -0,0 +1,496 @@
+// Package retry implements an integration handler wrapper which retries
+// failed deliveries using an exponential backoff. The retries are performed
+// asynchronously, so that a failing integration does not block the caller.
+// Events which could not be delivered after the last attempt are stored in
+// the dead-letter table.
+package retry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lib/pq/hstore"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/lorawan"
+)
+
+// Config contains the retry configuration.
+type Config struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+
+	// MaxPending is the max. number of events of the integration that can be
+	// pending a retry. When reached, failed events are directly stored as
+	// dead-letter.
+	MaxPending int
+}
+
+// Integration implements the retry integration wrapper.
+type Integration struct {
+	name    string
+	handler models.IntegrationHandler
+	config  Config
+
+	// pending limits the number of events pending a retry
+	pending chan struct{}
+
+	// mux protects closed, timers and active, timers contains the events
+	// of which the next attempt is scheduled and wg the events of which an
+	// attempt is in progress
+	mux    sync.Mutex
+	closed bool
+	timers map[*event]*time.Timer
+	wg     sync.WaitGroup
+
+	// active is the number of events being handled or pending a retry, idle
+	// is signaled when it drops to zero
+	active int
+	idle   *sync.Cond
+}
+
+// event holds an event which is pending a retry.
+type event struct {
+	ctx           context.Context
+	eventType     string
+	applicationID uint64
+	devEUI        []byte
+	vars          map[string]string
+	msg           proto.Message
+	f             func(context.Context) error
+
+	attempts int
+	interval time.Duration
+	err      error
+}
+
+// New creates a new retry wrapper for the given integration handler. The
+// name is stored together with dead-lettered events, so that these can be
+// replayed to the same integration.
+func New(name string, handler models.IntegrationHandler, conf Config) *Integration {
+	if conf.MaxAttempts < 1 {
+		conf.MaxAttempts = 1
+	}
+	if conf.MaxPending < 1 {
+		conf.MaxPending = 1000
+	}
+
+	i := Integration{
+		name:    name,
+		handler: handler,
+		config:  conf,
+		pending: make(chan struct{}, conf.MaxPending),
+		timers:  make(map[*event]*time.Timer),
+	}
+	i.idle = sync.NewCond(&i.mux)
+
+	return &i
+}
+
+// Name returns the name of the wrapped integration.
+func (i *Integration) Name() string {
+	return i.name
+}
+
+// Handler returns the wrapped integration handler.
+func (i *Integration) Handler() models.IntegrationHandler {
+	return i.handler
+}
+
+// HandleUplinkEvent sends an UplinkEvent.
+func (i *Integration) HandleUplinkEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.UplinkEvent) error {
+	return i.handle(ctx, eventlog.Uplink, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleUplinkEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleJoinEvent sends a JoinEvent.
+func (i *Integration) HandleJoinEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.JoinEvent) error {
+	return i.handle(ctx, eventlog.Join, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleJoinEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleAckEvent sends an AckEvent.
+func (i *Integration) HandleAckEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.AckEvent) error {
+	return i.handle(ctx, eventlog.ACK, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleAckEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleErrorEvent sends an ErrorEvent.
+func (i *Integration) HandleErrorEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.ErrorEvent) error {
+	return i.handle(ctx, eventlog.Error, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleErrorEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleStatusEvent sends a StatusEvent.
+func (i *Integration) HandleStatusEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.StatusEvent) error {
+	return i.handle(ctx, eventlog.Status, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleStatusEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleLocationEvent sends a LocationEvent.
+func (i *Integration) HandleLocationEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.LocationEvent) error {
+	return i.handle(ctx, eventlog.Location, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleLocationEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleTxAckEvent sends a TxAckEvent.
+func (i *Integration) HandleTxAckEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.TxAckEvent) error {
+	return i.handle(ctx, eventlog.TxAck, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleTxAckEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleIntegrationEvent sends an IntegrationEvent.
+func (i *Integration) HandleIntegrationEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.IntegrationEvent) error {
+	return i.handle(ctx, eventlog.Integration, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleIntegrationEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleManagementEvent sends a ManagementEvent.
+func (i *Integration) HandleManagementEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.ManagementEvent) error {
+	return i.handle(ctx, eventlog.Management, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleManagementEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleAlertEvent sends an AlertEvent.
+func (i *Integration) HandleAlertEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.AlertEvent) error {
+	return i.handle(ctx, eventlog.Alert, pl.ApplicationId, pl.DevEui, vars, &pl, func(ctx context.Context) error {
+		return i.handler.HandleAlertEvent(ctx, ii, vars, pl)
+	})
+}
+
+// HandleGatewayStatusEvent sends a GatewayStatusEvent. As dead-letters are
+// stored per application, this event is not retried.
+func (i *Integration) HandleGatewayStatusEvent(ctx context.Context, ii models.Integration, vars map[string]string, pl pb.GatewayStatusEvent) error {
+	return i.handler.HandleGatewayStatusEvent(ctx, ii, vars, pl)
+}
+
+// DataDownChan returns the channel containing the received DataDownPayload.
+func (i *Integration) DataDownChan() chan models.DataDownPayload {
+	return i.handler.DataDownChan()
+}
+
+// Drain blocks until no events are being handled or pending a retry. Unlike
+// Close, the pending events are retried according to their schedule, until
+// these succeed or are stored as dead-letter after the last attempt.
+func (i *Integration) Drain() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	for i.active != 0 {
+		i.idle.Wait()
+	}
+}
+
+// Close closes the wrapped integration. Before closing, the events pending a
+// retry are retried a last time and stored as dead-letter when this fails.
+// Close blocks until all pending events have been handled.
+func (i *Integration) Close() error {
+	i.mux.Lock()
+	i.closed = true
+	var events []*event
+	for ev, t := range i.timers {
+		t.Stop()
+		events = append(events, ev)
+	}
+	i.timers = make(map[*event]*time.Timer)
+	i.mux.Unlock()
+
+	for _, ev := range events {
+		ev.attempts++
+		if ev.err = ev.f(ev.ctx); ev.err != nil {
+			i.deadLetter(ev)
+		}
+		i.release()
+	}
+
+	// wait for the attempts that were already in progress, failed events
+	// are stored as dead-letter as these can not be scheduled anymore
+	i.wg.Wait()
+
+	return i.handler.Close()
+}
+
+// handle calls f. When it fails, f is retried asynchronously until it
+// succeeds or the max. number of attempts has been reached. In the latter
+// case, the event is stored as dead-letter. The returned error is only
+// non-nil when the event could not be scheduled for a retry.
+func (i *Integration) handle(ctx context.Context, eventType string, applicationID uint64, devEUI []byte, vars map[string]string, msg proto.Message, f func(context.Context) error) error {
+	i.begin()
+	defer i.end()
+
+	err := f(ctx)
+	if err == nil {
+		return nil
+	}
+
+	ev := event{
+		// the context of the caller could be cancelled before the retry
+		ctx:           context.WithValue(context.Background(), logging.ContextIDKey, ctx.Value(logging.ContextIDKey)),
+		eventType:     eventType,
+		applicationID: applicationID,
+		devEUI:        devEUI,
+		vars:          vars,
+		msg:           msg,
+		f:             f,
+		attempts:      1,
+		interval:      i.config.InitialInterval,
+		err:           err,
+	}
+
+	if ev.attempts >= i.config.MaxAttempts {
+		i.deadLetter(&ev)
+		return errors.Wrapf(err, "%s integration failed after %d attempt(s)", i.name, ev.attempts)
+	}
+
+	select {
+	case i.pending <- struct{}{}:
+		i.begin()
+	default:
+		i.deadLetter(&ev)
+		return errors.Wrapf(err, "%s integration failed, max. pending retries reached", i.name)
+	}
+
+	if !i.schedule(&ev) {
+		i.deadLetter(&ev)
+		i.release()
+		return errors.Wrapf(err, "%s integration failed, integration closed", i.name)
+	}
+
+	return nil
+}
+
+// schedule schedules the next attempt of the given event. It returns false
+// when the integration has been closed.
+func (i *Integration) schedule(ev *event) bool {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	if i.closed {
+		return false
+	}
+
+	log.WithError(ev.err).WithFields(log.Fields{
+		"integration": i.name,
+		"event_type":  ev.eventType,
+		"attempt":     ev.attempts,
+		"retry_after": ev.interval,
+		"ctx_id":      ev.ctx.Value(logging.ContextIDKey),
+	}).Warning("integration/retry: integration error, retrying")
+
+	interval := ev.interval
+	ev.interval = ev.interval * 2
+	if i.config.MaxInterval != 0 && ev.interval > i.config.MaxInterval {
+		ev.interval = i.config.MaxInterval
+	}
+
+	i.timers[ev] = time.AfterFunc(interval, func() {
+		i.retry(ev)
+	})
+
+	return true
+}
+
+// retry performs the next attempt of the given event.
+func (i *Integration) retry(ev *event) {
+	i.mux.Lock()
+	if _, ok := i.timers[ev]; !ok {
+		// the integration has been closed, Close handles the event
+		i.mux.Unlock()
+		return
+	}
+	delete(i.timers, ev)
+	i.wg.Add(1)
+	i.mux.Unlock()
+
+	defer i.wg.Done()
+
+	ev.attempts++
+	if ev.err = ev.f(ev.ctx); ev.err == nil {
+		i.release()
+		return
+	}
+
+	if ev.attempts >= i.config.MaxAttempts {
+		log.WithError(ev.err).WithFields(log.Fields{
+			"integration": i.name,
+			"event_type":  ev.eventType,
+			"attempts":    ev.attempts,
+			"ctx_id":      ev.ctx.Value(logging.ContextIDKey),
+		}).Error("integration/retry: integration failed, storing dead-letter")
+
+		i.deadLetter(ev)
+		i.release()
+		return
+	}
+
+	if !i.schedule(ev) {
+		i.deadLetter(ev)
+		i.release()
+	}
+}
+
+// begin registers an event as being handled or pending a retry.
+func (i *Integration) begin() {
+	i.mux.Lock()
+	i.active++
+	i.mux.Unlock()
+}
+
+// end unregisters an event registered by begin.
+func (i *Integration) end() {
+	i.mux.Lock()
+	i.active--
+	if i.active == 0 {
+		i.idle.Broadcast()
+	}
+	i.mux.Unlock()
+}
+
+// release frees the pending slot of an event that is no longer pending a
+// retry.
+func (i *Integration) release() {
+	<-i.pending
+	i.end()
+}
+
+// deadLetter stores the given event as dead-letter.
+func (i *Integration) deadLetter(ev *event) {
+	var devEUI lorawan.EUI64
+	copy(devEUI[:], ev.devEUI)
+
+	b, err := proto.Marshal(ev.msg)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"integration": i.name,
+			"event_type":  ev.eventType,
+			"ctx_id":      ev.ctx.Value(logging.ContextIDKey),
+		}).Error("integration/retry: marshal protobuf error")
+		return
+	}
+
+	dl := storage.IntegrationDeadLetter{
+		ApplicationID: int64(ev.applicationID),
+		DevEUI:        devEUI,
+		Integration:   i.name,
+		EventType:     ev.eventType,
+		Event:         b,
+		Variables:     varsToHstore(ev.vars),
+		Attempts:      ev.attempts,
+		LastError:     ev.err.Error(),
+	}
+	if err := storage.CreateIntegrationDeadLetter(ev.ctx, storage.DB(), &dl); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"integration": i.name,
+			"event_type":  ev.eventType,
+			"ctx_id":      ev.ctx.Value(logging.ContextIDKey),
+		}).Error("integration/retry: create dead-letter error")
+	}
+}
+
+// Replay unmarshals the given dead-lettered event and sends it to the given
+// integration handler.
+func Replay(ctx context.Context, h models.IntegrationHandler, ii models.Integration, dl storage.IntegrationDeadLetter) error {
+	vars := make(map[string]string)
+	for k, v := range dl.Variables.Map {
+		if v.Valid {
+			vars[k] = v.String
+		}
+	}
+
+	msg, err := UnmarshalEvent(dl.EventType, dl.Event)
+	if err != nil {
+		return err
+	}
+
+	switch pl := msg.(type) {
+	case *pb.UplinkEvent:
+		return h.HandleUplinkEvent(ctx, ii, vars, *pl)
+	case *pb.JoinEvent:
+		return h.HandleJoinEvent(ctx, ii, vars, *pl)
+	case *pb.AckEvent:
+		return h.HandleAckEvent(ctx, ii, vars, *pl)
+	case *pb.ErrorEvent:
+		return h.HandleErrorEvent(ctx, ii, vars, *pl)
+	case *pb.StatusEvent:
+		return h.HandleStatusEvent(ctx, ii, vars, *pl)
+	case *pb.LocationEvent:
+		return h.HandleLocationEvent(ctx, ii, vars, *pl)
+	case *pb.TxAckEvent:
+		return h.HandleTxAckEvent(ctx, ii, vars, *pl)
+	case *pb.IntegrationEvent:
+		return h.HandleIntegrationEvent(ctx, ii, vars, *pl)
+	case *pb.ManagementEvent:
+		return h.HandleManagementEvent(ctx, ii, vars, *pl)
+	case *pb.AlertEvent:
+		return h.HandleAlertEvent(ctx, ii, vars, *pl)
+	default:
+		return fmt.Errorf("unexpected event type: %T", msg)
+	}
+}
+
+// UnmarshalEvent unmarshals the given protobuf encoded event of the given
+// event type.
+func UnmarshalEvent(eventType string, b []byte) (proto.Message, error) {
+	var msg proto.Message
+
+	switch eventType {
+	case eventlog.Uplink:
+		msg = &pb.UplinkEvent{}
+	case eventlog.Join:
+		msg = &pb.JoinEvent{}
+	case eventlog.ACK:
+		msg = &pb.AckEvent{}
+	case eventlog.Error:
+		msg = &pb.ErrorEvent{}
+	case eventlog.Status:
+		msg = &pb.StatusEvent{}
+	case eventlog.Location:
+		msg = &pb.LocationEvent{}
+	case eventlog.TxAck:
+		msg = &pb.TxAckEvent{}
+	case eventlog.Integration:
+		msg = &pb.IntegrationEvent{}
+	case eventlog.Management:
+		msg = &pb.ManagementEvent{}
+	case eventlog.Alert:
+		msg = &pb.AlertEvent{}
+	default:
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, errors.Wrap(err, "unmarshal event error")
+	}
+
+	return msg, nil
+}
+
+func varsToHstore(vars map[string]string) hstore.Hstore {
+	out := hstore.Hstore{
+		Map: make(map[string]sql.NullString),
+	}
+	for k, v := range vars {
+		out.Map[k] = sql.NullString{String: v, Valid: true}
+	}
+	return out
+}
@@ -0,0 +1,276 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	pb "github.com/brocaar/chirpstack-api/go/v3/as/integration"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	nsmock "github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/eventlog"
+	"github.com/brocaar/chirpstack-application-server/internal/integration/models"
+	"github.com/brocaar/chirpstack-application-server/internal/storage"
+	"github.com/brocaar/chirpstack-application-server/internal/test"
+)
+
+// testHandler fails the first n uplink events.
+type testHandler struct {
+	models.IntegrationHandler
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+	events   []pb.UplinkEvent
+}
+
+func (h *testHandler) HandleUplinkEvent(ctx context.Context, _ models.Integration, vars map[string]string, pl pb.UplinkEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("connection refused")
+	}
+	h.events = append(h.events, pl)
+	return nil
+}
+
+func (h *testHandler) Close() error {
+	return nil
+}
+
+func (h *testHandler) state() (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.calls, len(h.events)
+}
+
+// waitFor polls f until it returns true or the timeout has been reached.
+func waitFor(f func() bool) bool {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(5 * time.Millisecond) {
+		if f() {
+			return true
+		}
+	}
+	return false
+}
+
+type RetryTestSuite struct {
+	suite.Suite
+
+	app storage.Application
+}
+
+func (ts *RetryTestSuite) SetupSuite() {
+	assert := require.New(ts.T())
+
+	conf := test.GetConfig()
+	assert.NoError(storage.Setup(conf))
+	test.MustResetDB(storage.DB().DB)
+
+	networkserver.SetPool(nsmock.NewPool(nsmock.NewClient()))
+
+	ns := storage.NetworkServer{
+		Name:   "test-ns",
+		Server: "test:1234",
+	}
+	assert.NoError(storage.CreateNetworkServer(context.Background(), storage.DB(), &ns))
+
+	org := storage.Organization{
+		Name: "test-org",
+	}
+	assert.NoError(storage.CreateOrganization(context.Background(), storage.DB(), &org))
+
+	sp := storage.ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: ns.ID,
+	}
+	assert.NoError(storage.CreateServiceProfile(context.Background(), storage.DB(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	ts.app = storage.Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(storage.CreateApplication(context.Background(), storage.DB(), &ts.app))
+}
+
+func (ts *RetryTestSuite) TestHandle() {
+	conf := Config{
+		MaxAttempts:     3,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     2 * time.Millisecond,
+	}
+
+	pl := pb.UplinkEvent{
+		ApplicationId: uint64(ts.app.ID),
+		DevEui:        []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Data:          []byte{1, 2, 3},
+	}
+	vars := map[string]string{"foo": "bar"}
+
+	ts.T().Run("Succeeds after retry", func(t *testing.T) {
+		assert := require.New(t)
+
+		h := testHandler{failures: 2}
+		i := New("HTTP", &h, conf)
+
+		// the first attempt is performed by the caller, the retries are
+		// performed asynchronously
+		assert.NoError(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+		calls, _ := h.state()
+		assert.Equal(1, calls)
+
+		assert.True(waitFor(func() bool {
+			_, events := h.state()
+			return events == 1
+		}))
+		calls, _ = h.state()
+		assert.Equal(3, calls)
+
+		count, err := storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+		assert.Equal(0, count)
+	})
+
+	ts.T().Run("Dead-lettered and replayed", func(t *testing.T) {
+		assert := require.New(t)
+
+		h := testHandler{failures: 3}
+		i := New("HTTP", &h, conf)
+
+		assert.NoError(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+		assert.True(waitFor(func() bool {
+			count, err := storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+			return err == nil && count == 1
+		}))
+
+		calls, events := h.state()
+		assert.Equal(3, calls)
+		assert.Equal(0, events)
+
+		items, err := storage.GetIntegrationDeadLetters(context.Background(), storage.DB(), ts.app.ID, 10, 0)
+		assert.NoError(err)
+		assert.Len(items, 1)
+
+		dl := items[0]
+		assert.Equal("HTTP", dl.Integration)
+		assert.Equal(eventlog.Uplink, dl.EventType)
+		assert.Equal(3, dl.Attempts)
+		assert.Equal("connection refused", dl.LastError)
+
+		assert.NoError(Replay(context.Background(), &h, nil, dl))
+		_, events = h.state()
+		assert.Equal(1, events)
+		assert.Equal(pl.Data, h.events[0].Data)
+
+		_, err = storage.DeleteIntegrationDeadLettersForApplicationID(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+	})
+
+	ts.T().Run("Max. pending retries reached", func(t *testing.T) {
+		assert := require.New(t)
+
+		h := testHandler{failures: 10}
+		i := New("HTTP", &h, Config{
+			MaxAttempts:     3,
+			InitialInterval: time.Hour,
+			MaxPending:      1,
+		})
+
+		// the first event is pending a retry, the second event is directly
+		// dead-lettered
+		assert.NoError(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+		assert.Error(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+
+		items, err := storage.GetIntegrationDeadLetters(context.Background(), storage.DB(), ts.app.ID, 10, 0)
+		assert.NoError(err)
+		assert.Len(items, 1)
+		assert.Equal(1, items[0].Attempts)
+
+		// close dead-letters the pending event after its last attempt
+		assert.NoError(i.Close())
+		count, err := storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+		assert.Equal(2, count)
+
+		_, err = storage.DeleteIntegrationDeadLettersForApplicationID(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+	})
+
+	ts.T().Run("Closed while retry is pending", func(t *testing.T) {
+		assert := require.New(t)
+
+		h := testHandler{failures: 1}
+		i := New("HTTP", &h, Config{
+			MaxAttempts:     3,
+			InitialInterval: time.Hour,
+		})
+
+		assert.NoError(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+		calls, events := h.state()
+		assert.Equal(1, calls)
+		assert.Equal(0, events)
+
+		// the pending event is retried by Close, before closing the handler
+		assert.NoError(i.Close())
+		calls, events = h.state()
+		assert.Equal(2, calls)
+		assert.Equal(1, events)
+
+		count, err := storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+		assert.Equal(0, count)
+
+		// events failing after Close are directly dead-lettered
+		h.failures = 10
+		assert.Error(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+
+		count, err = storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+		assert.Equal(1, count)
+
+		_, err = storage.DeleteIntegrationDeadLettersForApplicationID(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+	})
+
+	ts.T().Run("Drain", func(t *testing.T) {
+		assert := require.New(t)
+
+		h := testHandler{failures: 2}
+		i := New("HTTP", &h, Config{
+			MaxAttempts:     5,
+			InitialInterval: 10 * time.Millisecond,
+		})
+
+		assert.NoError(i.HandleUplinkEvent(context.Background(), nil, vars, pl))
+
+		// Drain returns after the pending event has been retried according
+		// to its schedule
+		i.Drain()
+		calls, events := h.state()
+		assert.Equal(3, calls)
+		assert.Equal(1, events)
+
+		count, err := storage.GetIntegrationDeadLetterCount(context.Background(), storage.DB(), ts.app.ID)
+		assert.NoError(err)
+		assert.Equal(0, count)
+
+		assert.NoError(i.Close())
+	})
+}
+
+func TestRetry(t *testing.T) {
+	suite.Run(t, new(RetryTestSuite))
+}
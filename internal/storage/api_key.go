@@ -2,12 +2,14 @@ package storage
 
 import (
 	"context"
+	"net"
 	"strings"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	uuid "github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -16,16 +18,37 @@ import (
 
 // APIKey represents an API key.
 type APIKey struct {
-	ID             uuid.UUID `db:"id"`
-	CreatedAt      time.Time `db:"created_at"`
-	Name           string    `db:"name"`
-	IsAdmin        bool      `db:"is_admin"`
-	OrganizationID *int64    `db:"organization_id"`
-	ApplicationID  *int64    `db:"application_id"`
+	ID             uuid.UUID      `db:"id"`
+	CreatedAt      time.Time      `db:"created_at"`
+	Name           string         `db:"name"`
+	IsAdmin        bool           `db:"is_admin"`
+	OrganizationID *int64         `db:"organization_id"`
+	ApplicationID  *int64         `db:"application_id"`
+	ExpiresAt      *time.Time     `db:"expires_at"`
+	Scopes         pq.StringArray `db:"scopes"`
+	AllowedIPs     pq.StringArray `db:"allowed_ips"`
+	LastUsedAt     *time.Time     `db:"last_used_at"`
+}
+
+// Validate validates the API key data.
+func (a APIKey) Validate() error {
+	for _, ip := range a.AllowedIPs {
+		if _, _, err := net.ParseCIDR(ip); err == nil {
+			continue
+		}
+		if net.ParseIP(ip) == nil {
+			return ErrAPIKeyInvalidAllowedIP
+		}
+	}
+	return nil
 }
 
 // CreateAPIKey creates the given API key and returns the JWT.
 func CreateAPIKey(ctx context.Context, db sqlx.Ext, a *APIKey) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", errors.Wrap(err, "validate error")
+	}
+
 	id, err := uuid.NewV4()
 	if err != nil {
 		return "", errors.Wrap(err, "new uuid error")
@@ -41,14 +64,20 @@ func CreateAPIKey(ctx context.Context, db sqlx.Ext, a *APIKey) (string, error) {
 			name,
 			is_admin,
 			organization_id,
-			application_id
-		) values ($1, $2, $3, $4, $5, $6)`,
+			application_id,
+			expires_at,
+			scopes,
+			allowed_ips
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
 		a.ID,
 		a.CreatedAt,
 		a.Name,
 		a.IsAdmin,
 		a.OrganizationID,
 		a.ApplicationID,
+		a.ExpiresAt,
+		a.Scopes,
+		a.AllowedIPs,
 	)
 	if err != nil {
 		return "", handlePSQLError(Insert, err, "insert error")
@@ -59,13 +88,18 @@ func CreateAPIKey(ctx context.Context, db sqlx.Ext, a *APIKey) (string, error) {
 		"id":     a.ID,
 	}).Info("storage: api-key created")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"iss":        "as",
 		"aud":        "as",
 		"nbf":        time.Now().Unix(),
 		"sub":        "api_key",
 		"api_key_id": a.ID.String(),
-	})
+	}
+	if a.ExpiresAt != nil {
+		claims["exp"] = a.ExpiresAt.Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	jwt, err := token.SignedString(jwtsecret)
 	if err != nil {
@@ -95,6 +129,33 @@ func GetAPIKey(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (APIKey, erro
 	return a, nil
 }
 
+// UpdateAPIKeyLastUsedAt updates the last-used timestamp of the API key
+// with the given ID.
+func UpdateAPIKeyLastUsedAt(ctx context.Context, db sqlx.Execer, id uuid.UUID, ts time.Time) error {
+	res, err := db.Exec(`
+		update
+			api_key
+		set
+			last_used_at = $2
+		where
+			id = $1`,
+		id,
+		ts,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	return nil
+}
+
 // DeleteAPIKey deletes the API key for the given ID.
 func DeleteAPIKey(ctx context.Context, db sqlx.Ext, id uuid.UUID) error {
 	res, err := db.Exec(`
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	uuid "github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
@@ -169,5 +170,53 @@ func (ts *StorageTestSuite) TestAPIKey() {
 				})
 			}
 		})
+
+		t.Run("Scoped and expiring", func(t *testing.T) {
+			assert := require.New(t)
+
+			expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+			key := APIKey{
+				Name:          "scoped key",
+				ApplicationID: &app.ID,
+				ExpiresAt:     &expiresAt,
+				Scopes:        []string{"device:read", "device_queue:write"},
+				AllowedIPs:    []string{"10.0.0.0/8", "192.168.1.1"},
+			}
+			str, err := CreateAPIKey(context.Background(), ts.tx, &key)
+			assert.NoError(err)
+
+			var claims jwt.MapClaims
+			_, err = jwt.ParseWithClaims(str, &claims, func(token *jwt.Token) (interface{}, error) {
+				return jwtsecret, nil
+			})
+			assert.NoError(err)
+			assert.EqualValues(expiresAt.Unix(), claims["exp"])
+
+			res, err := GetAPIKey(context.Background(), ts.tx, key.ID)
+			assert.NoError(err)
+			assert.True(expiresAt.Equal(*res.ExpiresAt))
+			assert.Equal(key.Scopes, res.Scopes)
+			assert.Equal(key.AllowedIPs, res.AllowedIPs)
+			assert.Nil(res.LastUsedAt)
+
+			now := time.Now().Truncate(time.Millisecond)
+			assert.NoError(UpdateAPIKeyLastUsedAt(context.Background(), ts.tx, key.ID, now))
+
+			res, err = GetAPIKey(context.Background(), ts.tx, key.ID)
+			assert.NoError(err)
+			assert.True(now.Equal(*res.LastUsedAt))
+		})
+
+		t.Run("Invalid allowed ip", func(t *testing.T) {
+			assert := require.New(t)
+
+			key := APIKey{
+				Name:       "invalid",
+				IsAdmin:    true,
+				AllowedIPs: []string{"10.0.0.0/33"},
+			}
+			_, err := CreateAPIKey(context.Background(), ts.tx, &key)
+			assert.Equal(ErrAPIKeyInvalidAllowedIP, errors.Cause(err))
+		})
 	})
 }
@@ -41,6 +41,13 @@ func (a Application) Validate() error {
 		return ErrApplicationInvalidName
 	}
 
+	if err := codec.ValidateConfig(a.PayloadCodec, codec.Config{
+		EncoderScript: a.PayloadEncoderScript,
+		DecoderScript: a.PayloadDecoderScript,
+	}); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -262,6 +269,7 @@ func DeleteApplication(ctx context.Context, db sqlx.Ext, id int64) error {
 		return ErrDoesNotExist
 	}
 
+	publishIntegrationChange(ctx, IntegrationChange{ApplicationID: id})
 	log.WithFields(log.Fields{
 		"id":     id,
 		"ctx_id": ctx.Value(logging.ContextIDKey),
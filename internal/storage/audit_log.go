@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+)
+
+// Audit-log actions.
+const (
+	AuditLogCreate = "create"
+	AuditLogUpdate = "update"
+	AuditLogDelete = "delete"
+)
+
+// AuditLog defines a mutation performed through the external API.
+// Either the UserID or the APIKeyID is set, depending on the actor.
+type AuditLog struct {
+	ID             int64           `db:"id"`
+	CreatedAt      time.Time       `db:"created_at"`
+	OrganizationID *int64          `db:"organization_id"`
+	UserID         *int64          `db:"user_id"`
+	APIKeyID       *uuid.UUID      `db:"api_key_id"`
+	Action         string          `db:"action"`
+	Resource       string          `db:"resource"`
+	ResourceID     string          `db:"resource_id"`
+	Changes        AuditLogChanges `db:"changes"`
+}
+
+// AuditLogChange contains the before and after value of a single field.
+type AuditLogChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// AuditLogChanges contains the changed fields, keyed by field name.
+type AuditLogChanges map[string]AuditLogChange
+
+// Value implements the driver.Valuer interface.
+func (c AuditLogChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements the sql.Scanner interface.
+func (c *AuditLogChanges) Scan(src interface{}) error {
+	if src == nil {
+		*c = nil
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("expected []byte, got %T", src)
+	}
+
+	return json.Unmarshal(b, c)
+}
+
+// AuditLogFilters provides filters for filtering audit-log records.
+type AuditLogFilters struct {
+	OrganizationID int64     `db:"organization_id"`
+	UserID         int64     `db:"user_id"`
+	APIKeyID       uuid.UUID `db:"api_key_id"`
+	Resource       string    `db:"resource"`
+	ResourceID     string    `db:"resource_id"`
+	Since          time.Time `db:"since"`
+	Until          time.Time `db:"until"`
+
+	// Limit and Offset are added for convenience so that this struct can
+	// be given as the arguments.
+	Limit  int `db:"limit"`
+	Offset int `db:"offset"`
+}
+
+// SQL returns the SQL filter.
+func (f AuditLogFilters) SQL() string {
+	var filters []string
+
+	if f.OrganizationID != 0 {
+		filters = append(filters, "organization_id = :organization_id")
+	}
+
+	if f.UserID != 0 {
+		filters = append(filters, "user_id = :user_id")
+	}
+
+	if f.APIKeyID != uuid.Nil {
+		filters = append(filters, "api_key_id = :api_key_id")
+	}
+
+	if f.Resource != "" {
+		filters = append(filters, "resource = :resource")
+	}
+
+	if f.ResourceID != "" {
+		filters = append(filters, "resource_id = :resource_id")
+	}
+
+	if !f.Since.IsZero() {
+		filters = append(filters, "created_at >= :since")
+	}
+
+	if !f.Until.IsZero() {
+		filters = append(filters, "created_at < :until")
+	}
+
+	if len(filters) == 0 {
+		return ""
+	}
+
+	return "where " + strings.Join(filters, " and ")
+}
+
+// CreateAuditLog creates the given audit-log record.
+func CreateAuditLog(ctx context.Context, db sqlx.Queryer, al *AuditLog) error {
+	al.CreatedAt = time.Now()
+
+	err := sqlx.Get(db, &al.ID, `
+		insert into audit_log (
+			created_at,
+			organization_id,
+			user_id,
+			api_key_id,
+			action,
+			resource,
+			resource_id,
+			changes
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)
+		returning id`,
+		al.CreatedAt,
+		al.OrganizationID,
+		al.UserID,
+		al.APIKeyID,
+		al.Action,
+		al.Resource,
+		al.ResourceID,
+		al.Changes,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":          al.ID,
+		"action":      al.Action,
+		"resource":    al.Resource,
+		"resource_id": al.ResourceID,
+		"ctx_id":      ctx.Value(logging.ContextIDKey),
+	}).Info("audit-log created")
+	return nil
+}
+
+// GetAuditLogCount returns the number of audit-log records matching the
+// given filters.
+func GetAuditLogCount(ctx context.Context, db sqlx.Queryer, filters AuditLogFilters) (int, error) {
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, `
+		select
+			count(*)
+		from
+			audit_log
+	`+filters.SQL(), filters)
+	if err != nil {
+		return 0, errors.Wrap(err, "named query error")
+	}
+
+	var count int
+	if err := sqlx.Get(db, &count, query, args...); err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// GetAuditLogs returns a slice of audit-log records matching the given
+// filters, most recent first.
+func GetAuditLogs(ctx context.Context, db sqlx.Queryer, filters AuditLogFilters) ([]AuditLog, error) {
+	query, args, err := sqlx.BindNamed(sqlx.DOLLAR, `
+		select
+			*
+		from
+			audit_log
+	`+filters.SQL()+`
+	order by
+		created_at desc,
+		id desc
+	limit :limit
+	offset :offset
+	`, filters)
+	if err != nil {
+		return nil, errors.Wrap(err, "named query error")
+	}
+
+	var items []AuditLog
+	if err := sqlx.Select(db, &items, query, args...); err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return items, nil
+}
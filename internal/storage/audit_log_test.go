@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *StorageTestSuite) TestAuditLog() {
+	assert := require.New(ts.T())
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.tx, &org))
+
+	user := User{
+		IsActive: true,
+		Email:    "foo@bar.com",
+	}
+	assert.NoError(CreateUser(context.Background(), ts.tx, &user))
+
+	apiKeyID, err := uuid.NewV4()
+	assert.NoError(err)
+
+	logs := []AuditLog{
+		{
+			OrganizationID: &org.ID,
+			UserID:         &user.ID,
+			Action:         AuditLogCreate,
+			Resource:       "application",
+			ResourceID:     "1",
+			Changes: AuditLogChanges{
+				"name": {After: "test-app"},
+			},
+		},
+		{
+			OrganizationID: &org.ID,
+			APIKeyID:       &apiKeyID,
+			Action:         AuditLogUpdate,
+			Resource:       "device",
+			ResourceID:     "0102030405060708",
+			Changes: AuditLogChanges{
+				"name": {Before: "foo", After: "bar"},
+			},
+		},
+		{
+			UserID:     &user.ID,
+			Action:     AuditLogDelete,
+			Resource:   "organization",
+			ResourceID: "123",
+		},
+	}
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		for i := range logs {
+			assert.NoError(CreateAuditLog(context.Background(), ts.tx, &logs[i]))
+			assert.NotEqual(0, logs[i].ID)
+		}
+	})
+
+	ts.T().Run("Get", func(t *testing.T) {
+		tests := []struct {
+			Name        string
+			Filters     AuditLogFilters
+			ExpectedIDs []int64
+		}{
+			{
+				Name:        "organization",
+				Filters:     AuditLogFilters{OrganizationID: org.ID},
+				ExpectedIDs: []int64{logs[1].ID, logs[0].ID},
+			},
+			{
+				Name:        "user",
+				Filters:     AuditLogFilters{UserID: user.ID},
+				ExpectedIDs: []int64{logs[2].ID, logs[0].ID},
+			},
+			{
+				Name:        "api key",
+				Filters:     AuditLogFilters{OrganizationID: org.ID, APIKeyID: apiKeyID},
+				ExpectedIDs: []int64{logs[1].ID},
+			},
+			{
+				Name:        "resource",
+				Filters:     AuditLogFilters{Resource: "device", ResourceID: "0102030405060708"},
+				ExpectedIDs: []int64{logs[1].ID},
+			},
+			{
+				Name:    "until",
+				Filters: AuditLogFilters{Until: logs[0].CreatedAt.Add(-time.Second)},
+			},
+			{
+				Name:        "since",
+				Filters:     AuditLogFilters{Since: logs[0].CreatedAt.Add(-time.Second)},
+				ExpectedIDs: []int64{logs[2].ID, logs[1].ID, logs[0].ID},
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.Name, func(t *testing.T) {
+				assert := require.New(t)
+
+				tst.Filters.Limit = 10
+
+				count, err := GetAuditLogCount(context.Background(), ts.tx, tst.Filters)
+				assert.NoError(err)
+				assert.Equal(len(tst.ExpectedIDs), count)
+
+				items, err := GetAuditLogs(context.Background(), ts.tx, tst.Filters)
+				assert.NoError(err)
+
+				var ids []int64
+				for _, item := range items {
+					ids = append(ids, item.ID)
+				}
+				assert.Equal(tst.ExpectedIDs, ids)
+			})
+		}
+
+		t.Run("Changes", func(t *testing.T) {
+			assert := require.New(t)
+
+			items, err := GetAuditLogs(context.Background(), ts.tx, AuditLogFilters{Resource: "device", Limit: 1})
+			assert.NoError(err)
+			assert.Len(items, 1)
+
+			assert.Equal(&apiKeyID, items[0].APIKeyID)
+			assert.Nil(items[0].UserID)
+			assert.Equal(AuditLogChanges{
+				"name": {Before: "foo", After: "bar"},
+			}, items[0].Changes)
+		})
+	})
+}
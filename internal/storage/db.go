@@ -16,6 +16,14 @@ import (
 // redisClient holds the Redis client.
 var redisClient redis.UniversalClient
 
+// redisOptions, redisCluster and redisMasterName hold the Redis configuration
+// used by NewRedisClient.
+var (
+	redisOptions    *redis.Options
+	redisCluster    bool
+	redisMasterName string
+)
+
 // db holds the PostgreSQL connection pool.
 var db *DBLogger
 
@@ -118,6 +126,34 @@ func RedisClient() redis.UniversalClient {
 	return redisClient
 }
 
+// NewRedisClient returns a new Redis client, with its own connection pool of
+// the given size. This must be used for long blocking commands (e.g. XREAD),
+// so that these do not exhaust the connection pool of the client returned by
+// RedisClient. The returned client must be closed by the caller.
+func NewRedisClient(poolSize int) redis.UniversalClient {
+	if redisCluster {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    []string{redisOptions.Addr},
+			PoolSize: poolSize,
+			Password: redisOptions.Password,
+		})
+	}
+
+	if redisMasterName != "" {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       redisMasterName,
+			SentinelAddrs:    []string{redisOptions.Addr},
+			SentinelPassword: redisOptions.Password,
+			DB:               redisOptions.DB,
+			PoolSize:         poolSize,
+		})
+	}
+
+	opt := *redisOptions
+	opt.PoolSize = poolSize
+	return redis.NewClient(&opt)
+}
+
 // Transaction wraps the given function in a transaction. In case the given
 // functions returns an error, the transaction will be rolled back.
 func Transaction(f func(tx sqlx.Ext) error) error {
@@ -43,6 +43,7 @@ type Device struct {
 	AppSKey                   lorawan.AES128Key `db:"app_s_key"`
 	Variables                 hstore.Hstore     `db:"variables"`
 	Tags                      hstore.Hstore     `db:"tags"`
+	FirmwareVersion           string            `db:"firmware_version"`
 	IsDisabled                bool              `db:"-"`
 }
 
@@ -70,6 +71,26 @@ type DeviceKeys struct {
 
 // CreateDevice creates the given device.
 func CreateDevice(ctx context.Context, db sqlx.Ext, d *Device) error {
+	if err := CreateLocalDevice(ctx, db, d); err != nil {
+		return err
+	}
+
+	if err := CreateNetworkServerDevice(ctx, db, *d); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"dev_eui": d.DevEUI,
+		"ctx_id":  ctx.Value(logging.ContextIDKey),
+	}).Info("device created")
+
+	return nil
+}
+
+// CreateLocalDevice creates the local record of the given device, without
+// creating the device at the network-server. The device must be created at
+// the network-server using CreateNetworkServerDevice.
+func CreateLocalDevice(ctx context.Context, db sqlx.Ext, d *Device) error {
 	if err := d.Validate(); err != nil {
 		return errors.Wrap(err, "validate error")
 	}
@@ -124,6 +145,12 @@ func CreateDevice(ctx context.Context, db sqlx.Ext, d *Device) error {
 		return handlePSQLError(Insert, err, "insert error")
 	}
 
+	return nil
+}
+
+// CreateNetworkServerDevice creates the given device at the network-server.
+// The local record of the device must exist.
+func CreateNetworkServerDevice(ctx context.Context, db sqlx.Queryer, d Device) error {
 	app, err := GetApplication(ctx, db, d.ApplicationID)
 	if err != nil {
 		return errors.Wrap(err, "get application error")
@@ -154,11 +181,6 @@ func CreateDevice(ctx context.Context, db sqlx.Ext, d *Device) error {
 		return errors.Wrap(err, "create device error")
 	}
 
-	log.WithFields(log.Fields{
-		"dev_eui": d.DevEUI,
-		"ctx_id":  ctx.Value(logging.ContextIDKey),
-	}).Info("device created")
-
 	return nil
 }
 
@@ -535,6 +557,31 @@ func DeleteDevice(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64) error
 	return nil
 }
 
+// DeleteLocalDevice deletes the local record of the device matching the
+// given DevEUI, without deleting the device at the network-server. This is
+// used to undo CreateLocalDevice when the device could not be created at the
+// network-server.
+func DeleteLocalDevice(ctx context.Context, db sqlx.Execer, devEUI lorawan.EUI64) error {
+	res, err := db.Exec("delete from device where dev_eui = $1", devEUI[:])
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"dev_eui": devEUI,
+		"ctx_id":  ctx.Value(logging.ContextIDKey),
+	}).Info("local device deleted")
+
+	return nil
+}
+
 // CreateDeviceKeys creates the keys for the given device.
 func CreateDeviceKeys(ctx context.Context, db sqlx.Execer, dc *DeviceKeys) error {
 	now := time.Now()
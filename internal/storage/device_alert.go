@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// AlertType defines the type of a device alert-rule and of the alerts it
+// raises.
+type AlertType string
+
+// Alert types.
+const (
+	AlertTypeInactivity   AlertType = "INACTIVITY"
+	AlertTypeBatteryLevel AlertType = "BATTERY_LEVEL"
+	AlertTypeMargin       AlertType = "MARGIN"
+)
+
+// DeviceAlertRule defines an alert rule which applies to all the devices
+// of an application. Only the threshold matching the rule type is used.
+type DeviceAlertRule struct {
+	ID                    uuid.UUID     `db:"id"`
+	CreatedAt             time.Time     `db:"created_at"`
+	UpdatedAt             time.Time     `db:"updated_at"`
+	ApplicationID         int64         `db:"application_id"`
+	Name                  string        `db:"name"`
+	Type                  AlertType     `db:"type"`
+	InactivityThreshold   time.Duration `db:"inactivity_threshold"`
+	BatteryLevelThreshold float32       `db:"battery_level_threshold"`
+	MarginThreshold       int           `db:"margin_threshold"`
+}
+
+// Validate validates the device alert-rule data.
+func (r DeviceAlertRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" || len(r.Name) > 100 {
+		return ErrDeviceAlertRuleInvalidName
+	}
+
+	switch r.Type {
+	case AlertTypeInactivity:
+		if r.InactivityThreshold <= 0 {
+			return ErrDeviceAlertRuleInvalidThreshold
+		}
+	case AlertTypeBatteryLevel:
+		if r.BatteryLevelThreshold <= 0 || r.BatteryLevelThreshold > 100 {
+			return ErrDeviceAlertRuleInvalidThreshold
+		}
+	case AlertTypeMargin:
+		// The margin can be negative, any value is valid.
+	default:
+		return ErrDeviceAlertRuleInvalidType
+	}
+
+	return nil
+}
+
+// condition returns the SQL condition matching the devices for which the
+// rule fires, using $1 as placeholder for the returned argument.
+func (r DeviceAlertRule) condition(now time.Time) (string, interface{}, error) {
+	switch r.Type {
+	case AlertTypeInactivity:
+		return "d.last_seen_at < $1", now.Add(-r.InactivityThreshold), nil
+	case AlertTypeBatteryLevel:
+		return "d.device_status_battery < $1", r.BatteryLevelThreshold, nil
+	case AlertTypeMargin:
+		return "d.device_status_margin < $1", r.MarginThreshold, nil
+	default:
+		return "", nil, fmt.Errorf("unknown device alert-rule type: %s", r.Type)
+	}
+}
+
+// CreateDeviceAlertRule creates the given device alert-rule.
+func CreateDeviceAlertRule(ctx context.Context, db sqlx.Execer, r *DeviceAlertRule) error {
+	if err := r.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "new uuid error")
+	}
+
+	now := time.Now()
+	r.ID = id
+	r.CreatedAt = now
+	r.UpdatedAt = now
+
+	_, err = db.Exec(`
+		insert into device_alert_rule (
+			id,
+			created_at,
+			updated_at,
+			application_id,
+			name,
+			type,
+			inactivity_threshold,
+			battery_level_threshold,
+			margin_threshold
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		r.ID,
+		r.CreatedAt,
+		r.UpdatedAt,
+		r.ApplicationID,
+		r.Name,
+		r.Type,
+		r.InactivityThreshold,
+		r.BatteryLevelThreshold,
+		r.MarginThreshold,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":             r.ID,
+		"application_id": r.ApplicationID,
+		"ctx_id":         ctx.Value(logging.ContextIDKey),
+	}).Info("device alert-rule created")
+
+	return nil
+}
+
+// GetDeviceAlertRule returns the device alert-rule for the given ID.
+func GetDeviceAlertRule(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (DeviceAlertRule, error) {
+	var r DeviceAlertRule
+	err := sqlx.Get(db, &r, `
+		select
+			*
+		from
+			device_alert_rule
+		where
+			id = $1`,
+		id,
+	)
+	if err != nil {
+		return r, handlePSQLError(Select, err, "select error")
+	}
+
+	return r, nil
+}
+
+// UpdateDeviceAlertRule updates the given device alert-rule.
+func UpdateDeviceAlertRule(ctx context.Context, db sqlx.Execer, r *DeviceAlertRule) error {
+	if err := r.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
+	r.UpdatedAt = time.Now()
+
+	res, err := db.Exec(`
+		update device_alert_rule
+		set
+			updated_at = $2,
+			name = $3,
+			type = $4,
+			inactivity_threshold = $5,
+			battery_level_threshold = $6,
+			margin_threshold = $7
+		where
+			id = $1`,
+		r.ID,
+		r.UpdatedAt,
+		r.Name,
+		r.Type,
+		r.InactivityThreshold,
+		r.BatteryLevelThreshold,
+		r.MarginThreshold,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     r.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("device alert-rule updated")
+
+	return nil
+}
+
+// DeleteDeviceAlertRule deletes the device alert-rule matching the given ID.
+// The open alerts of the rule are removed without being resolved.
+func DeleteDeviceAlertRule(ctx context.Context, db sqlx.Execer, id uuid.UUID) error {
+	res, err := db.Exec(`
+		delete from device_alert_rule
+		where
+			id = $1`,
+		id,
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("device alert-rule deleted")
+
+	return nil
+}
+
+// GetDeviceAlertRuleCount returns the number of device alert-rules for the
+// given application. When the application ID is 0, all rules are counted.
+func GetDeviceAlertRuleCount(ctx context.Context, db sqlx.Queryer, applicationID int64) (int, error) {
+	var count int
+	err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			device_alert_rule
+		where
+			$1 = 0 or application_id = $1`,
+		applicationID,
+	)
+	if err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// GetDeviceAlertRules returns the device alert-rules for the given
+// application. When the application ID is 0, all rules are returned.
+func GetDeviceAlertRules(ctx context.Context, db sqlx.Queryer, applicationID int64, limit, offset int) ([]DeviceAlertRule, error) {
+	var rules []DeviceAlertRule
+	err := sqlx.Select(db, &rules, `
+		select
+			*
+		from
+			device_alert_rule
+		where
+			$1 = 0 or application_id = $1
+		order by
+			name,
+			id
+		limit $2
+		offset $3`,
+		applicationID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return rules, nil
+}
+
+// GetDevicesForDeviceAlert returns the devices for which the given rule
+// fires at the given time, but which do not have an open alert for this
+// rule yet.
+func GetDevicesForDeviceAlert(ctx context.Context, db sqlx.Queryer, r DeviceAlertRule, now time.Time, limit int) ([]Device, error) {
+	cond, arg, err := r.condition(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	err = sqlx.Select(db, &devices, `
+		select
+			d.*
+		from
+			device d
+		where
+			d.application_id = $2
+			and `+cond+`
+			and not exists (
+				select
+					1
+				from
+					device_alert da
+				where
+					da.device_alert_rule_id = $3
+					and da.dev_eui = d.dev_eui
+			)
+		limit $4`,
+		arg,
+		r.ApplicationID,
+		r.ID,
+		limit,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return devices, nil
+}
+
+// GetDevicesForDeviceAlertResolve returns the devices which have an open
+// alert for the given rule, but for which the rule no longer fires at the
+// given time.
+func GetDevicesForDeviceAlertResolve(ctx context.Context, db sqlx.Queryer, r DeviceAlertRule, now time.Time, limit int) ([]Device, error) {
+	cond, arg, err := r.condition(now)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	err = sqlx.Select(db, &devices, `
+		select
+			d.*
+		from
+			device_alert da
+		inner join device d
+			on d.dev_eui = da.dev_eui
+		where
+			da.device_alert_rule_id = $2
+			and not coalesce(`+cond+`, false)
+		limit $3`,
+		arg,
+		r.ID,
+		limit,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return devices, nil
+}
+
+// CreateDeviceAlert opens an alert for the given rule and device. It returns
+// ErrAlreadyExists when the alert is already open, e.g. because it was
+// opened by an other instance.
+func CreateDeviceAlert(ctx context.Context, db sqlx.Execer, ruleID uuid.UUID, devEUI lorawan.EUI64) error {
+	res, err := db.Exec(`
+		insert into device_alert (
+			device_alert_rule_id,
+			dev_eui,
+			created_at
+		) values ($1, $2, $3)
+		on conflict do nothing`,
+		ruleID,
+		devEUI[:],
+		time.Now(),
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrAlreadyExists
+	}
+
+	log.WithFields(log.Fields{
+		"device_alert_rule_id": ruleID,
+		"dev_eui":              devEUI,
+		"ctx_id":               ctx.Value(logging.ContextIDKey),
+	}).Info("device alert created")
+
+	return nil
+}
+
+// DeleteDeviceAlert closes the alert for the given rule and device. It
+// returns ErrDoesNotExist when there is no open alert.
+func DeleteDeviceAlert(ctx context.Context, db sqlx.Execer, ruleID uuid.UUID, devEUI lorawan.EUI64) error {
+	res, err := db.Exec(`
+		delete from device_alert
+		where
+			device_alert_rule_id = $1
+			and dev_eui = $2`,
+		ruleID,
+		devEUI[:],
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"device_alert_rule_id": ruleID,
+		"dev_eui":              devEUI,
+		"ctx_id":               ctx.Value(logging.ContextIDKey),
+	}).Info("device alert deleted")
+
+	return nil
+}
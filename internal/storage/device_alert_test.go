@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *StorageTestSuite) TestDeviceAlertRule() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.Tx(), &org))
+
+	n := NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.Tx(), &n))
+
+	sp := ServiceProfile{
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+		Name:            "test-sp",
+	}
+	assert.NoError(CreateServiceProfile(context.Background(), ts.Tx(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	dp := DeviceProfile{
+		NetworkServerID: n.ID,
+		OrganizationID:  org.ID,
+		Name:            "test-dp",
+	}
+	assert.NoError(CreateDeviceProfile(context.Background(), ts.Tx(), &dp))
+	dpID, err := uuid.FromBytes(dp.DeviceProfile.Id)
+	assert.NoError(err)
+
+	app := Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(CreateApplication(context.Background(), ts.Tx(), &app))
+
+	lastSeen := time.Now().Add(-2 * time.Hour)
+	battery := float32(10)
+	d := Device{
+		DevEUI:              lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		ApplicationID:       app.ID,
+		DeviceProfileID:     dpID,
+		Name:                "test-device",
+		LastSeenAt:          &lastSeen,
+		DeviceStatusBattery: &battery,
+	}
+	assert.NoError(CreateDevice(context.Background(), ts.Tx(), &d))
+
+	ts.T().Run("Validate", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			rule     DeviceAlertRule
+			expected error
+		}{
+			{
+				name:     "invalid name",
+				rule:     DeviceAlertRule{Type: AlertTypeMargin},
+				expected: ErrDeviceAlertRuleInvalidName,
+			},
+			{
+				name:     "invalid type",
+				rule:     DeviceAlertRule{Name: "test", Type: "FOO"},
+				expected: ErrDeviceAlertRuleInvalidType,
+			},
+			{
+				name:     "invalid inactivity threshold",
+				rule:     DeviceAlertRule{Name: "test", Type: AlertTypeInactivity},
+				expected: ErrDeviceAlertRuleInvalidThreshold,
+			},
+			{
+				name:     "invalid battery-level threshold",
+				rule:     DeviceAlertRule{Name: "test", Type: AlertTypeBatteryLevel, BatteryLevelThreshold: 101},
+				expected: ErrDeviceAlertRuleInvalidThreshold,
+			},
+			{
+				name: "valid",
+				rule: DeviceAlertRule{Name: "test", Type: AlertTypeBatteryLevel, BatteryLevelThreshold: 20},
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+				assert.Equal(tst.expected, tst.rule.Validate())
+			})
+		}
+	})
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		r := DeviceAlertRule{
+			ApplicationID:       app.ID,
+			Name:                "no-uplink",
+			Type:                AlertTypeInactivity,
+			InactivityThreshold: time.Hour,
+		}
+		assert.NoError(CreateDeviceAlertRule(context.Background(), ts.Tx(), &r))
+		r.CreatedAt = r.CreatedAt.Round(time.Second).UTC()
+		r.UpdatedAt = r.UpdatedAt.Round(time.Second).UTC()
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			rGet, err := GetDeviceAlertRule(context.Background(), ts.Tx(), r.ID)
+			assert.NoError(err)
+			rGet.CreatedAt = rGet.CreatedAt.Round(time.Second).UTC()
+			rGet.UpdatedAt = rGet.UpdatedAt.Round(time.Second).UTC()
+			assert.Equal(r, rGet)
+		})
+
+		t.Run("List", func(t *testing.T) {
+			assert := require.New(t)
+
+			count, err := GetDeviceAlertRuleCount(context.Background(), ts.Tx(), app.ID)
+			assert.NoError(err)
+			assert.Equal(1, count)
+
+			rules, err := GetDeviceAlertRules(context.Background(), ts.Tx(), app.ID, 10, 0)
+			assert.NoError(err)
+			assert.Len(rules, 1)
+			assert.Equal(r.ID, rules[0].ID)
+
+			count, err = GetDeviceAlertRuleCount(context.Background(), ts.Tx(), app.ID+1)
+			assert.NoError(err)
+			assert.Equal(0, count)
+		})
+
+		t.Run("Alerts", func(t *testing.T) {
+			assert := require.New(t)
+
+			devices, err := GetDevicesForDeviceAlert(context.Background(), ts.Tx(), r, time.Now(), 10)
+			assert.NoError(err)
+			assert.Len(devices, 1)
+			assert.Equal(d.DevEUI, devices[0].DevEUI)
+
+			assert.NoError(CreateDeviceAlert(context.Background(), ts.Tx(), r.ID, d.DevEUI))
+			assert.Equal(ErrAlreadyExists, errors.Cause(CreateDeviceAlert(context.Background(), ts.Tx(), r.ID, d.DevEUI)))
+
+			devices, err = GetDevicesForDeviceAlert(context.Background(), ts.Tx(), r, time.Now(), 10)
+			assert.NoError(err)
+			assert.Len(devices, 0)
+
+			devices, err = GetDevicesForDeviceAlertResolve(context.Background(), ts.Tx(), r, time.Now(), 10)
+			assert.NoError(err)
+			assert.Len(devices, 0)
+
+			devices, err = GetDevicesForDeviceAlertResolve(context.Background(), ts.Tx(), r, time.Now().Add(-2*time.Hour), 10)
+			assert.NoError(err)
+			assert.Len(devices, 1)
+
+			assert.NoError(DeleteDeviceAlert(context.Background(), ts.Tx(), r.ID, d.DevEUI))
+			assert.Equal(ErrDoesNotExist, errors.Cause(DeleteDeviceAlert(context.Background(), ts.Tx(), r.ID, d.DevEUI)))
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			r.Name = "low-battery"
+			r.Type = AlertTypeBatteryLevel
+			r.BatteryLevelThreshold = 20
+			assert.NoError(UpdateDeviceAlertRule(context.Background(), ts.Tx(), &r))
+
+			rGet, err := GetDeviceAlertRule(context.Background(), ts.Tx(), r.ID)
+			assert.NoError(err)
+			assert.Equal("low-battery", rGet.Name)
+			assert.Equal(AlertTypeBatteryLevel, rGet.Type)
+			assert.EqualValues(20, rGet.BatteryLevelThreshold)
+
+			devices, err := GetDevicesForDeviceAlert(context.Background(), ts.Tx(), rGet, time.Now(), 10)
+			assert.NoError(err)
+			assert.Len(devices, 1)
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(DeleteDeviceAlertRule(context.Background(), ts.Tx(), r.ID))
+			_, err := GetDeviceAlertRule(context.Background(), ts.Tx(), r.ID)
+			assert.Equal(ErrDoesNotExist, errors.Cause(err))
+		})
+	})
+}
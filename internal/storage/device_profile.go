@@ -17,6 +17,7 @@ import (
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
 	"github.com/brocaar/chirpstack-application-server/internal/codec"
 	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/lorawan"
 )
 
 // DeviceProfile defines the device-profile.
@@ -31,6 +32,14 @@ type DeviceProfile struct {
 	PayloadDecoderScript string           `db:"payload_decoder_script"`
 	Tags                 hstore.Hstore    `db:"tags"`
 	DeviceProfile        ns.DeviceProfile `db:"-"`
+
+	// Application-layer packages.
+	MulticastSetupEnabled bool  `db:"multicast_setup_enabled"`
+	MulticastSetupFPort   uint8 `db:"multicast_setup_f_port"`
+	FragmentationEnabled  bool  `db:"fragmentation_enabled"`
+	FragmentationFPort    uint8 `db:"fragmentation_f_port"`
+	ClockSyncEnabled      bool  `db:"clock_sync_enabled"`
+	ClockSyncFPort        uint8 `db:"clock_sync_f_port"`
 }
 
 // DeviceProfileMeta defines the device-profile meta record.
@@ -49,6 +58,39 @@ func (dp DeviceProfile) Validate() error {
 	if strings.TrimSpace(dp.Name) == "" || len(dp.Name) > 100 {
 		return ErrDeviceProfileInvalidName
 	}
+
+	if err := codec.ValidateConfig(dp.PayloadCodec, codec.Config{
+		EncoderScript: dp.PayloadEncoderScript,
+		DecoderScript: dp.PayloadDecoderScript,
+	}); err != nil {
+		return err
+	}
+
+	// the fPorts of the enabled application-layer packages must be valid
+	// and unique
+	fPorts := make(map[uint8]struct{})
+	for _, p := range []struct {
+		enabled bool
+		fPort   uint8
+	}{
+		{dp.MulticastSetupEnabled, dp.MulticastSetupFPort},
+		{dp.FragmentationEnabled, dp.FragmentationFPort},
+		{dp.ClockSyncEnabled, dp.ClockSyncFPort},
+	} {
+		if !p.enabled {
+			continue
+		}
+
+		if p.fPort == 0 || p.fPort > 223 {
+			return ErrDeviceProfileInvalidAppLayerFPort
+		}
+
+		if _, ok := fPorts[p.fPort]; ok {
+			return ErrDeviceProfileInvalidAppLayerFPort
+		}
+		fPorts[p.fPort] = struct{}{}
+	}
+
 	return nil
 }
 
@@ -81,8 +123,14 @@ func CreateDeviceProfile(ctx context.Context, db sqlx.Ext, dp *DeviceProfile) er
 			payload_codec,
 			payload_encoder_script,
 			payload_decoder_script,
-			tags
-		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			tags,
+			multicast_setup_enabled,
+			multicast_setup_f_port,
+			fragmentation_enabled,
+			fragmentation_f_port,
+			clock_sync_enabled,
+			clock_sync_f_port
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
 		dpID,
 		dp.NetworkServerID,
 		dp.OrganizationID,
@@ -93,6 +141,12 @@ func CreateDeviceProfile(ctx context.Context, db sqlx.Ext, dp *DeviceProfile) er
 		dp.PayloadEncoderScript,
 		dp.PayloadDecoderScript,
 		dp.Tags,
+		dp.MulticastSetupEnabled,
+		dp.MulticastSetupFPort,
+		dp.FragmentationEnabled,
+		dp.FragmentationFPort,
+		dp.ClockSyncEnabled,
+		dp.ClockSyncFPort,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -145,7 +199,13 @@ func GetDeviceProfile(ctx context.Context, db sqlx.Queryer, id uuid.UUID, forUpd
 			payload_codec,
 			payload_encoder_script,
 			payload_decoder_script,
-			tags
+			tags,
+			multicast_setup_enabled,
+			multicast_setup_f_port,
+			fragmentation_enabled,
+			fragmentation_f_port,
+			clock_sync_enabled,
+			clock_sync_f_port
 		from device_profile
 		where
 			device_profile_id = $1`+fu,
@@ -165,6 +225,12 @@ func GetDeviceProfile(ctx context.Context, db sqlx.Queryer, id uuid.UUID, forUpd
 		&dp.PayloadEncoderScript,
 		&dp.PayloadDecoderScript,
 		&dp.Tags,
+		&dp.MulticastSetupEnabled,
+		&dp.MulticastSetupFPort,
+		&dp.FragmentationEnabled,
+		&dp.FragmentationFPort,
+		&dp.ClockSyncEnabled,
+		&dp.ClockSyncFPort,
 	)
 	if err != nil {
 		return dp, handlePSQLError(Scan, err, "scan error")
@@ -199,6 +265,24 @@ func GetDeviceProfile(ctx context.Context, db sqlx.Queryer, id uuid.UUID, forUpd
 	return dp, nil
 }
 
+// GetDeviceProfileForDevEUI returns the device-profile (local data only) of
+// the device matching the given DevEUI.
+func GetDeviceProfileForDevEUI(ctx context.Context, db sqlx.Queryer, devEUI lorawan.EUI64) (DeviceProfile, error) {
+	var id uuid.UUID
+	err := sqlx.Get(db, &id, "select device_profile_id from device where dev_eui = $1", devEUI[:])
+	if err != nil {
+		return DeviceProfile{}, handlePSQLError(Select, err, "select error")
+	}
+
+	dp, err := GetDeviceProfile(ctx, db, id, false, true)
+	if err != nil {
+		return dp, err
+	}
+	dp.DeviceProfile.Id = id.Bytes()
+
+	return dp, nil
+}
+
 // UpdateDeviceProfile updates the given device-profile.
 func UpdateDeviceProfile(ctx context.Context, db sqlx.Ext, dp *DeviceProfile) error {
 	if err := dp.Validate(); err != nil {
@@ -237,7 +321,13 @@ func UpdateDeviceProfile(ctx context.Context, db sqlx.Ext, dp *DeviceProfile) er
 			payload_codec = $4,
 			payload_encoder_script = $5,
 			payload_decoder_script = $6,
-			tags = $7
+			tags = $7,
+			multicast_setup_enabled = $8,
+			multicast_setup_f_port = $9,
+			fragmentation_enabled = $10,
+			fragmentation_f_port = $11,
+			clock_sync_enabled = $12,
+			clock_sync_f_port = $13
 		where device_profile_id = $1`,
 		dpID,
 		dp.UpdatedAt,
@@ -246,6 +336,12 @@ func UpdateDeviceProfile(ctx context.Context, db sqlx.Ext, dp *DeviceProfile) er
 		dp.PayloadEncoderScript,
 		dp.PayloadDecoderScript,
 		dp.Tags,
+		dp.MulticastSetupEnabled,
+		dp.MulticastSetupFPort,
+		dp.FragmentationEnabled,
+		dp.FragmentationFPort,
+		dp.ClockSyncEnabled,
+		dp.ClockSyncFPort,
 	)
 	if err != nil {
 		return handlePSQLError(Update, err, "update error")
@@ -14,6 +14,8 @@ import (
 	"github.com/brocaar/chirpstack-api/go/v3/ns"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/chirpstack-application-server/internal/codec"
+	"github.com/brocaar/lorawan"
 	"github.com/brocaar/lorawan/band"
 )
 
@@ -27,12 +29,64 @@ func TestDeviceProfileValidate(t *testing.T) {
 				Name: "valid-name",
 			},
 		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:         "valid-name",
+				PayloadCodec: codec.CayenneLPPType,
+			},
+		},
 		{
 			DeviceProfile: DeviceProfile{
 				Name: "",
 			},
 			Error: ErrDeviceProfileInvalidName,
 		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:                  "valid-name",
+				MulticastSetupEnabled: true,
+				MulticastSetupFPort:   200,
+				FragmentationEnabled:  true,
+				FragmentationFPort:    201,
+				ClockSyncEnabled:      true,
+				ClockSyncFPort:        202,
+			},
+		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:                 "valid-name",
+				FragmentationEnabled: false,
+				FragmentationFPort:   0,
+				ClockSyncEnabled:     true,
+				ClockSyncFPort:       10,
+			},
+		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:                 "valid-name",
+				FragmentationEnabled: true,
+				FragmentationFPort:   0,
+			},
+			Error: ErrDeviceProfileInvalidAppLayerFPort,
+		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:                 "valid-name",
+				FragmentationEnabled: true,
+				FragmentationFPort:   224,
+			},
+			Error: ErrDeviceProfileInvalidAppLayerFPort,
+		},
+		{
+			DeviceProfile: DeviceProfile{
+				Name:                 "valid-name",
+				FragmentationEnabled: true,
+				FragmentationFPort:   201,
+				ClockSyncEnabled:     true,
+				ClockSyncFPort:       201,
+			},
+			Error: ErrDeviceProfileInvalidAppLayerFPort,
+		},
 		{
 			DeviceProfile: DeviceProfile{
 				Name: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
@@ -94,6 +148,12 @@ func (ts *StorageTestSuite) TestDeviceProfile() {
 					"foo": sql.NullString{Valid: true, String: "bar"},
 				},
 			},
+			MulticastSetupEnabled: true,
+			MulticastSetupFPort:   200,
+			FragmentationEnabled:  true,
+			FragmentationFPort:    201,
+			ClockSyncEnabled:      false,
+			ClockSyncFPort:        202,
 			DeviceProfile: ns.DeviceProfile{
 				SupportsClassB:     true,
 				ClassBTimeout:      10,
@@ -140,6 +200,44 @@ func (ts *StorageTestSuite) TestDeviceProfile() {
 			assert.Equal(dp, dpGet)
 		})
 
+		t.Run("GetDeviceProfileForDevEUI", func(t *testing.T) {
+			assert := require.New(t)
+
+			sp := ServiceProfile{
+				Name:            "test-sp",
+				OrganizationID:  org.ID,
+				NetworkServerID: n.ID,
+			}
+			assert.NoError(CreateServiceProfile(context.Background(), ts.Tx(), &sp))
+			spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+			assert.NoError(err)
+
+			app := Application{
+				Name:             "test-app",
+				OrganizationID:   org.ID,
+				ServiceProfileID: spID,
+			}
+			assert.NoError(CreateApplication(context.Background(), ts.Tx(), &app))
+
+			d := Device{
+				DevEUI:          lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+				ApplicationID:   app.ID,
+				DeviceProfileID: dpID,
+				Name:            "test-device",
+				Description:     "test device",
+			}
+			assert.NoError(CreateDevice(context.Background(), ts.Tx(), &d))
+
+			dpGet, err := GetDeviceProfileForDevEUI(context.Background(), ts.Tx(), d.DevEUI)
+			assert.NoError(err)
+			assert.Equal(dp.Name, dpGet.Name)
+			assert.Equal(dp.DeviceProfile.Id, dpGet.DeviceProfile.Id)
+			assert.Equal(dp.FragmentationFPort, dpGet.FragmentationFPort)
+			assert.Equal(dp.ClockSyncEnabled, dpGet.ClockSyncEnabled)
+
+			assert.NoError(DeleteDevice(context.Background(), ts.Tx(), d.DevEUI))
+		})
+
 		t.Run("Get all", func(t *testing.T) {
 			assert := require.New(t)
 
@@ -332,4 +332,38 @@ func (ts *StorageTestSuite) TestDevice() {
 			assert.Equal(ErrDoesNotExist, err)
 		})
 	})
+
+	ts.T().Run("CreateLocalDevice", func(t *testing.T) {
+		assert := require.New(t)
+
+		d := Device{
+			DevEUI:          lorawan.EUI64{2, 2, 3, 4, 5, 6, 7, 8},
+			ApplicationID:   app.ID,
+			DeviceProfileID: dpID,
+			Name:            "test-local-device",
+		}
+		assert.NoError(CreateLocalDevice(context.Background(), ts.Tx(), &d))
+
+		_, err := GetDevice(context.Background(), ts.Tx(), d.DevEUI, false, true)
+		assert.NoError(err)
+
+		t.Run("CreateNetworkServerDevice", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(CreateNetworkServerDevice(context.Background(), ts.Tx(), d))
+			createReq := <-nsClient.CreateDeviceChan
+			assert.Equal(d.DevEUI[:], createReq.Device.DevEui)
+		})
+
+		t.Run("DeleteLocalDevice", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(DeleteLocalDevice(context.Background(), ts.Tx(), d.DevEUI))
+			assert.Len(nsClient.DeleteDeviceChan, 0)
+
+			_, err := GetDevice(context.Background(), ts.Tx(), d.DevEUI, false, true)
+			assert.Equal(ErrDoesNotExist, err)
+			assert.Equal(ErrDoesNotExist, DeleteLocalDevice(context.Background(), ts.Tx(), d.DevEUI))
+		})
+	})
 }
@@ -21,25 +21,45 @@ const (
 
 // errors
 var (
-	ErrAlreadyExists                   = errors.New("object already exists")
-	ErrDoesNotExist                    = errors.New("object does not exist")
-	ErrUsedByOtherObjects              = errors.New("this object is used by other objects, remove them first")
-	ErrApplicationInvalidName          = errors.New("invalid application name")
-	ErrNodeInvalidName                 = errors.New("invalid node name")
-	ErrNodeMaxRXDelay                  = errors.New("max value of RXDelay is 15")
-	ErrCFListTooManyChannels           = errors.New("too many channels in channel-list")
-	ErrUserInvalidUsername             = errors.New("username name may only be composed of upper and lower case characters and digits")
-	ErrUserPasswordLength              = errors.New("passwords must be at least 6 characters long")
-	ErrInvalidUsernameOrPassword       = errors.New("invalid username or password")
-	ErrOrganizationInvalidName         = errors.New("invalid organization name")
-	ErrGatewayInvalidName              = errors.New("invalid gateway name")
-	ErrInvalidEmail                    = errors.New("invalid e-mail")
-	ErrInvalidGatewayDiscoveryInterval = errors.New("invalid gateway-discovery interval, it must be greater than 0")
-	ErrDeviceProfileInvalidName        = errors.New("invalid device-profile name")
-	ErrServiceProfileInvalidName       = errors.New("invalid service-profile name")
-	ErrMulticastGroupInvalidName       = errors.New("invalid multicast-group name")
-	ErrOrganizationMaxDeviceCount      = errors.New("organization reached max. device count")
-	ErrOrganizationMaxGatewayCount     = errors.New("organization reached max. gateway count")
+	ErrAlreadyExists                       = errors.New("object already exists")
+	ErrDoesNotExist                        = errors.New("object does not exist")
+	ErrUsedByOtherObjects                  = errors.New("this object is used by other objects, remove them first")
+	ErrApplicationInvalidName              = errors.New("invalid application name")
+	ErrNodeInvalidName                     = errors.New("invalid node name")
+	ErrNodeMaxRXDelay                      = errors.New("max value of RXDelay is 15")
+	ErrCFListTooManyChannels               = errors.New("too many channels in channel-list")
+	ErrUserInvalidUsername                 = errors.New("username name may only be composed of upper and lower case characters and digits")
+	ErrUserPasswordLength                  = errors.New("passwords must be at least 6 characters long")
+	ErrInvalidUsernameOrPassword           = errors.New("invalid username or password")
+	ErrOrganizationInvalidName             = errors.New("invalid organization name")
+	ErrGatewayInvalidName                  = errors.New("invalid gateway name")
+	ErrInvalidEmail                        = errors.New("invalid e-mail")
+	ErrInvalidGatewayDiscoveryInterval     = errors.New("invalid gateway-discovery interval, it must be greater than 0")
+	ErrDeviceProfileInvalidName            = errors.New("invalid device-profile name")
+	ErrDeviceProfileInvalidAppLayerFPort   = errors.New("invalid or duplicate device-profile application-layer fPort")
+	ErrServiceProfileInvalidName           = errors.New("invalid service-profile name")
+	ErrMulticastGroupInvalidName           = errors.New("invalid multicast-group name")
+	ErrOrganizationMaxDeviceCount          = errors.New("organization reached max. device count")
+	ErrOrganizationMaxGatewayCount         = errors.New("organization reached max. gateway count")
+	ErrIntegrationFilterInvalidFPortRange  = errors.New("invalid integration filter fPort range")
+	ErrAPIKeyInvalidAllowedIP              = errors.New("invalid api key allowed ip, it must be an ip address or cidr range")
+	ErrInvalidMFACode                      = errors.New("invalid mfa code")
+	ErrInvalidMFAChallenge                 = errors.New("invalid or expired mfa challenge")
+	ErrMFAAlreadyEnabled                   = errors.New("mfa is already enabled")
+	ErrMFANotEnabled                       = errors.New("mfa is not enabled")
+	ErrMFATooManyFailures                  = errors.New("too many invalid mfa codes, try again later")
+	ErrDeviceAlertRuleInvalidName          = errors.New("invalid device alert-rule name")
+	ErrDeviceAlertRuleInvalidType          = errors.New("invalid device alert-rule type")
+	ErrDeviceAlertRuleInvalidThreshold     = errors.New("invalid device alert-rule threshold")
+	ErrFUOTADeploymentNoDevices            = errors.New("fuota deployment must have at least one device")
+	ErrFUOTADeploymentIncompatibleDevices  = errors.New("fuota deployment devices must share the same service-profile and fragmentation fPort")
+	ErrFUOTADeploymentInvalidFirmwareImage = errors.New("fuota deployment devices must use the device-profile of the firmware image")
+	ErrFUOTADeploymentInvalidState         = errors.New("fuota deployment state does not allow this operation")
+	ErrFUOTADeploymentAppLayerDisabled     = errors.New("fuota deployment devices must have the multicast-setup and fragmentation packages enabled")
+	ErrFUOTADeploymentDeviceInProgress     = errors.New("fuota deployment devices must not be part of another fuota deployment in progress")
+	ErrFUOTADeploymentInvalidDevEUIs       = errors.New("fuota deployment devices must exist and belong to the application")
+	ErrFirmwareImageInvalidVersion         = errors.New("invalid firmware image version")
+	ErrFirmwareImageInvalidChecksum        = errors.New("firmware image checksum does not match the payload")
 )
 
 func handlePSQLError(action Action, err error, description string) error {
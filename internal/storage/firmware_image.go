@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+)
+
+// FirmwareImage defines a firmware image which can be used by FUOTA
+// deployments. A firmware image belongs to a device-profile and is
+// identified by its version within the device-profile.
+type FirmwareImage struct {
+	ID              uuid.UUID `db:"id"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	DeviceProfileID uuid.UUID `db:"device_profile_id"`
+	Version         string    `db:"version"`
+	Checksum        []byte    `db:"checksum"`
+	ReleaseNotes    string    `db:"release_notes"`
+	Payload         []byte    `db:"payload"`
+}
+
+// FirmwareImageListItem defines the firmware image as list item. It does
+// not contain the payload.
+type FirmwareImageListItem struct {
+	ID              uuid.UUID `db:"id"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	DeviceProfileID uuid.UUID `db:"device_profile_id"`
+	Version         string    `db:"version"`
+	Checksum        []byte    `db:"checksum"`
+}
+
+// Validate validates the firmware image data. When the checksum is set, it
+// must match the SHA256 checksum of the payload.
+func (i FirmwareImage) Validate() error {
+	if strings.TrimSpace(i.Version) == "" || len(i.Version) > 100 {
+		return ErrFirmwareImageInvalidVersion
+	}
+
+	if len(i.Checksum) != 0 {
+		checksum := sha256.Sum256(i.Payload)
+		if !bytes.Equal(checksum[:], i.Checksum) {
+			return ErrFirmwareImageInvalidChecksum
+		}
+	}
+
+	return nil
+}
+
+// CreateFirmwareImage creates the given firmware image. When no checksum is
+// set, the SHA256 checksum of the payload is used.
+func CreateFirmwareImage(ctx context.Context, db sqlx.Execer, i *FirmwareImage) error {
+	if err := i.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
+	if len(i.Checksum) == 0 {
+		checksum := sha256.Sum256(i.Payload)
+		i.Checksum = checksum[:]
+	}
+
+	var err error
+	i.ID, err = uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "new uuid error")
+	}
+
+	now := time.Now()
+	i.CreatedAt = now
+	i.UpdatedAt = now
+
+	_, err = db.Exec(`
+		insert into firmware_image (
+			id,
+			created_at,
+			updated_at,
+			device_profile_id,
+			version,
+			checksum,
+			release_notes,
+			payload
+		) values ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		i.ID,
+		i.CreatedAt,
+		i.UpdatedAt,
+		i.DeviceProfileID,
+		i.Version,
+		i.Checksum,
+		i.ReleaseNotes,
+		i.Payload,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":                i.ID,
+		"device_profile_id": i.DeviceProfileID,
+		"version":           i.Version,
+		"ctx_id":            ctx.Value(logging.ContextIDKey),
+	}).Info("firmware image created")
+
+	return nil
+}
+
+// GetFirmwareImage returns the firmware image for the given ID.
+func GetFirmwareImage(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (FirmwareImage, error) {
+	var i FirmwareImage
+	err := sqlx.Get(db, &i, "select * from firmware_image where id = $1", id)
+	if err != nil {
+		return i, handlePSQLError(Select, err, "select error")
+	}
+
+	return i, nil
+}
+
+// GetFirmwareImageCount returns the number of firmware images for the given
+// device-profile ID.
+func GetFirmwareImageCount(ctx context.Context, db sqlx.Queryer, deviceProfileID uuid.UUID) (int, error) {
+	var count int
+	err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			firmware_image
+		where
+			device_profile_id = $1`,
+		deviceProfileID,
+	)
+	if err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// GetFirmwareImages returns a slice of firmware images for the given
+// device-profile ID, sorted by creation date (newest first).
+func GetFirmwareImages(ctx context.Context, db sqlx.Queryer, deviceProfileID uuid.UUID, limit, offset int) ([]FirmwareImageListItem, error) {
+	var items []FirmwareImageListItem
+	err := sqlx.Select(db, &items, `
+		select
+			id,
+			created_at,
+			updated_at,
+			device_profile_id,
+			version,
+			checksum
+		from
+			firmware_image
+		where
+			device_profile_id = $1
+		order by
+			created_at desc
+		limit $2
+		offset $3`,
+		deviceProfileID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return items, nil
+}
+
+// UpdateFirmwareImage updates the release notes of the given firmware image.
+// As FUOTA deployments and devices refer to the version of the image, the
+// version and payload can not be updated.
+func UpdateFirmwareImage(ctx context.Context, db sqlx.Execer, i *FirmwareImage) error {
+	i.UpdatedAt = time.Now()
+
+	res, err := db.Exec(`
+		update firmware_image
+		set
+			updated_at = $2,
+			release_notes = $3
+		where
+			id = $1`,
+		i.ID,
+		i.UpdatedAt,
+		i.ReleaseNotes,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     i.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("firmware image updated")
+
+	return nil
+}
+
+// DeleteFirmwareImage deletes the firmware image matching the given ID.
+// A firmware image which is used by a FUOTA deployment can not be deleted.
+func DeleteFirmwareImage(ctx context.Context, db sqlx.Execer, id uuid.UUID) error {
+	res, err := db.Exec("delete from firmware_image where id = $1", id)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("firmware image deleted")
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	nsmock "github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *StorageTestSuite) TestFirmwareImage() {
+	assert := require.New(ts.T())
+
+	nsClient := nsmock.NewClient()
+	networkserver.SetPool(nsmock.NewPool(nsClient))
+
+	n := NetworkServer{
+		Name:   "test",
+		Server: "test:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.tx, &n))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.tx, &org))
+
+	sp := ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(CreateServiceProfile(context.Background(), ts.tx, &sp))
+	var spID uuid.UUID
+	copy(spID[:], sp.ServiceProfile.Id)
+
+	app := Application{
+		Name:             "test-app",
+		OrganizationID:   org.ID,
+		ServiceProfileID: spID,
+	}
+	assert.NoError(CreateApplication(context.Background(), ts.tx, &app))
+
+	dp := DeviceProfile{
+		Name:                  "test-dp",
+		OrganizationID:        org.ID,
+		NetworkServerID:       n.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
+	}
+	assert.NoError(CreateDeviceProfile(context.Background(), ts.tx, &dp))
+	var dpID uuid.UUID
+	copy(dpID[:], dp.DeviceProfile.Id)
+
+	d := Device{
+		DevEUI:          lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		ApplicationID:   app.ID,
+		DeviceProfileID: dpID,
+		Name:            "test-device",
+	}
+	assert.NoError(CreateDevice(context.Background(), ts.tx, &d))
+
+	ts.T().Run("Create invalid", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			image FirmwareImage
+			err   error
+		}{
+			{
+				name: "no version",
+				image: FirmwareImage{
+					DeviceProfileID: dpID,
+					Payload:         []byte{1, 2, 3},
+				},
+				err: ErrFirmwareImageInvalidVersion,
+			},
+			{
+				name: "invalid checksum",
+				image: FirmwareImage{
+					DeviceProfileID: dpID,
+					Version:         "1.0.0",
+					Checksum:        []byte{1, 2, 3},
+					Payload:         []byte{1, 2, 3},
+				},
+				err: ErrFirmwareImageInvalidChecksum,
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+				err := CreateFirmwareImage(context.Background(), ts.tx, &tst.image)
+				assert.Equal(tst.err, errors.Cause(err))
+			})
+		}
+	})
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		fi := FirmwareImage{
+			DeviceProfileID: dpID,
+			Version:         "1.0.0",
+			ReleaseNotes:    "Initial release.",
+			Payload:         []byte{1, 2, 3, 4, 5},
+		}
+		assert.NoError(CreateFirmwareImage(context.Background(), ts.tx, &fi))
+		fi.CreatedAt = fi.CreatedAt.UTC().Round(time.Millisecond)
+		fi.UpdatedAt = fi.UpdatedAt.UTC().Round(time.Millisecond)
+
+		checksum := sha256.Sum256(fi.Payload)
+		assert.Equal(checksum[:], fi.Checksum)
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			fiGet, err := GetFirmwareImage(context.Background(), ts.tx, fi.ID)
+			assert.NoError(err)
+			fiGet.CreatedAt = fiGet.CreatedAt.UTC().Round(time.Millisecond)
+			fiGet.UpdatedAt = fiGet.UpdatedAt.UTC().Round(time.Millisecond)
+			assert.Equal(fi, fiGet)
+		})
+
+		t.Run("List", func(t *testing.T) {
+			assert := require.New(t)
+
+			count, err := GetFirmwareImageCount(context.Background(), ts.tx, dpID)
+			assert.NoError(err)
+			assert.Equal(1, count)
+
+			items, err := GetFirmwareImages(context.Background(), ts.tx, dpID, 10, 0)
+			assert.NoError(err)
+			assert.Len(items, 1)
+			assert.Equal(fi.ID, items[0].ID)
+			assert.Equal(fi.Version, items[0].Version)
+			assert.Equal(fi.Checksum, items[0].Checksum)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			fi.ReleaseNotes = "Updated release notes."
+			assert.NoError(UpdateFirmwareImage(context.Background(), ts.tx, &fi))
+
+			fiGet, err := GetFirmwareImage(context.Background(), ts.tx, fi.ID)
+			assert.NoError(err)
+			assert.Equal(fi.ReleaseNotes, fiGet.ReleaseNotes)
+		})
+
+		t.Run("FUOTA deployment", func(t *testing.T) {
+			assert := require.New(t)
+
+			fd := FUOTADeployment{
+				Name:             "test deployment",
+				FirmwareImageID:  &fi.ID,
+				UnicastTimeout:   time.Minute,
+				FragSize:         10,
+				Redundancy:       5,
+				MulticastTimeout: 3,
+				GroupType:        FUOTADeploymentGroupTypeC,
+			}
+			assert.NoError(CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, d.DevEUI))
+
+			fdGet, err := GetFUOTADeployment(context.Background(), ts.tx, fd.ID, false)
+			assert.NoError(err)
+			assert.Equal(&fi.ID, fdGet.FirmwareImageID)
+			assert.Equal(fi.Payload, fdGet.Payload)
+
+			t.Run("Set device firmware version on success", func(t *testing.T) {
+				assert := require.New(t)
+
+				fdd, err := GetPendingFUOTADeploymentDevice(context.Background(), ts.tx, d.DevEUI)
+				assert.NoError(err)
+
+				fdd.State = FUOTADeploymentDeviceSuccess
+				assert.NoError(UpdateFUOTADeploymentDevice(context.Background(), ts.tx, &fdd))
+
+				dGet, err := GetDevice(context.Background(), ts.tx, d.DevEUI, false, true)
+				assert.NoError(err)
+				assert.Equal(fi.Version, dGet.FirmwareVersion)
+			})
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			fi2 := FirmwareImage{
+				DeviceProfileID: dpID,
+				Version:         "1.0.1",
+				Payload:         []byte{1, 2, 3},
+			}
+			assert.NoError(CreateFirmwareImage(context.Background(), ts.tx, &fi2))
+			assert.NoError(DeleteFirmwareImage(context.Background(), ts.tx, fi2.ID))
+
+			_, err := GetFirmwareImage(context.Background(), ts.tx, fi2.ID)
+			assert.Equal(ErrDoesNotExist, err)
+			assert.Equal(ErrDoesNotExist, DeleteFirmwareImage(context.Background(), ts.tx, fi2.ID))
+		})
+	})
+}
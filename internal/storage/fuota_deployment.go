@@ -8,6 +8,8 @@ import (
 
 	uuid "github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/lib/pq/hstore"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -23,10 +25,12 @@ const (
 	FUOTADeploymentMulticastCreate        FUOTADeploymentState = "MC_CREATE"
 	FUOTADeploymentMulticastSetup         FUOTADeploymentState = "MC_SETUP"
 	FUOTADeploymentFragmentationSessSetup FUOTADeploymentState = "FRAG_SESS_SETUP"
+	FUOTADeploymentMulticastSessBSetup    FUOTADeploymentState = "MC_SESS_B_SETUP"
 	FUOTADeploymentMulticastSessCSetup    FUOTADeploymentState = "MC_SESS_C_SETUP"
 	FUOTADeploymentEnqueue                FUOTADeploymentState = "ENQUEUE"
 	FUOTADeploymentStatusRequest          FUOTADeploymentState = "STATUS_REQUEST"
 	FUOTADeploymentSetDeviceStatus        FUOTADeploymentState = "SET_DEVICE_STATUS"
+	FUOTADeploymentUnicastRetransmit      FUOTADeploymentState = "UNICAST_RETRANSMIT"
 	FUOTADeploymentCleanup                FUOTADeploymentState = "CLEANUP"
 	FUOTADeploymentDone                   FUOTADeploymentState = "DONE"
 )
@@ -52,25 +56,29 @@ const (
 
 // FUOTADeployment defiles a firmware update over the air deployment.
 type FUOTADeployment struct {
-	ID                  uuid.UUID                `db:"id"`
-	CreatedAt           time.Time                `db:"created_at"`
-	UpdatedAt           time.Time                `db:"updated_at"`
-	Name                string                   `db:"name"`
-	MulticastGroupID    *uuid.UUID               `db:"multicast_group_id"`
-	GroupType           FUOTADeploymentGroupType `db:"group_type"`
-	DR                  int                      `db:"dr"`
-	Frequency           int                      `db:"frequency"`
-	PingSlotPeriod      int                      `db:"ping_slot_period"`
-	FragmentationMatrix uint8                    `db:"fragmentation_matrix"`
-	Descriptor          [4]byte                  `db:"descriptor"`
-	Payload             []byte                   `db:"payload"`
-	FragSize            int                      `db:"frag_size"`
-	Redundancy          int                      `db:"redundancy"`
-	BlockAckDelay       int                      `db:"block_ack_delay"`
-	MulticastTimeout    int                      `db:"multicast_timeout"`
-	State               FUOTADeploymentState     `db:"state"`
-	UnicastTimeout      time.Duration            `db:"unicast_timeout"`
-	NextStepAfter       time.Time                `db:"next_step_after"`
+	ID                         uuid.UUID                `db:"id"`
+	CreatedAt                  time.Time                `db:"created_at"`
+	UpdatedAt                  time.Time                `db:"updated_at"`
+	Name                       string                   `db:"name"`
+	MulticastGroupID           *uuid.UUID               `db:"multicast_group_id"`
+	GroupType                  FUOTADeploymentGroupType `db:"group_type"`
+	DR                         int                      `db:"dr"`
+	Frequency                  int                      `db:"frequency"`
+	PingSlotPeriod             int                      `db:"ping_slot_period"`
+	FragmentationMatrix        uint8                    `db:"fragmentation_matrix"`
+	Descriptor                 [4]byte                  `db:"descriptor"`
+	Payload                    []byte                   `db:"payload"`
+	FirmwareImageID            *uuid.UUID               `db:"firmware_image_id"`
+	FragSize                   int                      `db:"frag_size"`
+	Redundancy                 int                      `db:"redundancy"`
+	BlockAckDelay              int                      `db:"block_ack_delay"`
+	MulticastTimeout           int                      `db:"multicast_timeout"`
+	State                      FUOTADeploymentState     `db:"state"`
+	UnicastTimeout             time.Duration            `db:"unicast_timeout"`
+	UnicastRetransmissions     int                      `db:"unicast_retransmissions"`
+	UnicastRetransmissionCount int                      `db:"unicast_retransmission_count"`
+	NextStepAfter              time.Time                `db:"next_step_after"`
+	PausedAt                   *time.Time               `db:"paused_at"`
 }
 
 // FUOTADeploymentListItem defines a FUOTA deployment item for listing.
@@ -81,6 +89,7 @@ type FUOTADeploymentListItem struct {
 	Name          string               `db:"name"`
 	State         FUOTADeploymentState `db:"state"`
 	NextStepAfter time.Time            `db:"next_step_after"`
+	PausedAt      *time.Time           `db:"paused_at"`
 }
 
 // FUOTADeploymentDevice defines the device record of a FUOTA deployment.
@@ -91,6 +100,8 @@ type FUOTADeploymentDevice struct {
 	UpdatedAt         time.Time                  `db:"updated_at"`
 	State             FUOTADeploymentDeviceState `db:"state"`
 	ErrorMessage      string                     `db:"error_message"`
+	MissingFrag       int                        `db:"missing_frag"`
+	RetransmittedFrag int                        `db:"retransmitted_frag"`
 }
 
 // FUOTADeploymentDeviceListItem defines the Device as FUOTA deployment list item.
@@ -136,11 +147,97 @@ func (f FUOTADeploymentFilters) SQL() string {
 	return "where " + strings.Join(filters, " and ")
 }
 
+// FUOTADeploymentTarget defines the devices of an application targeted by a
+// FUOTA deployment. Note that empty values are not used as filter, thus an
+// empty target (besides the application ID) targets all the devices of the
+// application.
+type FUOTADeploymentTarget struct {
+	ApplicationID   int64
+	DeviceProfileID uuid.UUID
+	Tags            hstore.Hstore
+	DevEUIs         []lorawan.EUI64
+}
+
 // CreateFUOTADeploymentForDevice creates and initializes a FUOTA deployment
 // for the given device.
 func CreateFUOTADeploymentForDevice(ctx context.Context, db sqlx.Ext, fd *FUOTADeployment, devEUI lorawan.EUI64) error {
+	return CreateFUOTADeployment(ctx, db, fd, []lorawan.EUI64{devEUI})
+}
+
+// CreateFUOTADeployment creates and initializes a FUOTA deployment for the
+// given devices. As the deployment uses a single multicast-group and
+// fragmentation-session, the devices must share the same service-profile
+// and fragmentation fPort and must have the multicast-setup and fragmentation
+// packages enabled. As the fragmentation-session index and multicast-group
+// ID are fixed, the devices must not be part of another deployment which is
+// not done yet. When the deployment refers to a firmware image, the devices
+// must use the device-profile of the image and the payload of the image is
+// used.
+func CreateFUOTADeployment(ctx context.Context, db sqlx.Ext, fd *FUOTADeployment, devEUIs []lorawan.EUI64) error {
+	if len(devEUIs) == 0 {
+		return ErrFUOTADeploymentNoDevices
+	}
+
+	devEUIsB := make([][]byte, len(devEUIs))
+	for i := range devEUIs {
+		devEUIsB[i] = devEUIs[i][:]
+	}
+
+	var compat struct {
+		ServiceProfiles int `db:"service_profiles"`
+		FPorts          int `db:"fports"`
+		FirmwareImage   int `db:"firmware_image"`
+		AppLayer        int `db:"app_layer"`
+		InProgress      int `db:"in_progress"`
+	}
+	err := sqlx.Get(db, &compat, `
+		select
+			count(distinct a.service_profile_id) as service_profiles,
+			count(distinct dp.fragmentation_f_port) as fports,
+			count(fi.id) filter (where fi.device_profile_id != d.device_profile_id) as firmware_image,
+			count(*) filter (where not dp.multicast_setup_enabled or not dp.fragmentation_enabled) as app_layer,
+			count(*) filter (where exists (
+				select
+					1
+				from
+					fuota_deployment_device fdd
+				inner join fuota_deployment fd
+					on fd.id = fdd.fuota_deployment_id
+				where
+					fdd.dev_eui = d.dev_eui
+					and fd.state != $3
+			)) as in_progress
+		from
+			device d
+		inner join application a
+			on a.id = d.application_id
+		inner join device_profile dp
+			on dp.device_profile_id = d.device_profile_id
+		left join firmware_image fi
+			on fi.id = $2
+		where
+			d.dev_eui = any($1)`,
+		pq.ByteaArray(devEUIsB),
+		fd.FirmwareImageID,
+		FUOTADeploymentDone,
+	)
+	if err != nil {
+		return handlePSQLError(Select, err, "select error")
+	}
+	if compat.ServiceProfiles > 1 || compat.FPorts > 1 {
+		return ErrFUOTADeploymentIncompatibleDevices
+	}
+	if compat.FirmwareImage > 0 {
+		return ErrFUOTADeploymentInvalidFirmwareImage
+	}
+	if compat.AppLayer > 0 {
+		return ErrFUOTADeploymentAppLayerDisabled
+	}
+	if compat.InProgress > 0 {
+		return ErrFUOTADeploymentDeviceInProgress
+	}
+
 	now := time.Now()
-	var err error
 	fd.ID, err = uuid.NewV4()
 	if err != nil {
 		return errors.Wrap(err, "new uuid error")
@@ -174,8 +271,11 @@ func CreateFUOTADeploymentForDevice(ctx context.Context, db sqlx.Ext, fd *FUOTAD
 			group_type,
 			dr,
 			frequency,
-			ping_slot_period
-		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+			ping_slot_period,
+			firmware_image_id,
+			unicast_retransmissions,
+			unicast_retransmission_count
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
 		fd.ID,
 		fd.CreatedAt,
 		fd.UpdatedAt,
@@ -183,7 +283,7 @@ func CreateFUOTADeploymentForDevice(ctx context.Context, db sqlx.Ext, fd *FUOTAD
 		fd.MulticastGroupID,
 		[]byte{fd.FragmentationMatrix},
 		fd.Descriptor[:],
-		fd.Payload,
+		fd.storedPayload(),
 		fd.State,
 		fd.NextStepAfter,
 		fd.UnicastTimeout,
@@ -195,6 +295,9 @@ func CreateFUOTADeploymentForDevice(ctx context.Context, db sqlx.Ext, fd *FUOTAD
 		fd.DR,
 		fd.Frequency,
 		fd.PingSlotPeriod,
+		fd.FirmwareImageID,
+		fd.UnicastRetransmissions,
+		fd.UnicastRetransmissionCount,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -208,27 +311,107 @@ func CreateFUOTADeploymentForDevice(ctx context.Context, db sqlx.Ext, fd *FUOTAD
 			updated_at,
 			state,
 			error_message
-		) values ($1, $2, $3, $4, $5, $6)`,
+		)
+		select
+			$1,
+			dev_eui,
+			$3,
+			$3,
+			$4,
+			''
+		from
+			unnest($2::bytea[]) as dev_eui`,
 		fd.ID,
-		devEUI,
-		now,
+		pq.ByteaArray(devEUIsB),
 		now,
 		FUOTADeploymentDevicePending,
-		"",
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
 	}
 
 	log.WithFields(log.Fields{
-		"dev_eui": devEUI,
-		"id":      fd.ID,
-		"ctx_id":  ctx.Value(logging.ContextIDKey),
-	}).Info("fuota deploymented created for device")
+		"device_count": len(devEUIs),
+		"id":           fd.ID,
+		"ctx_id":       ctx.Value(logging.ContextIDKey),
+	}).Info("fuota deployment created")
 
 	return nil
 }
 
+// GetDevEUIsForFUOTADeploymentTarget returns the DevEUIs of the devices
+// matching the given FUOTA deployment target. It returns
+// ErrFUOTADeploymentInvalidDevEUIs when the target contains DevEUIs of
+// devices which do not exist or belong to an other application.
+func GetDevEUIsForFUOTADeploymentTarget(ctx context.Context, db sqlx.Queryer, target FUOTADeploymentTarget) ([]lorawan.EUI64, error) {
+	filters := []string{"d.application_id = $1"}
+	args := []interface{}{target.ApplicationID}
+
+	if target.DeviceProfileID != uuid.Nil {
+		args = append(args, target.DeviceProfileID)
+		filters = append(filters, fmt.Sprintf("d.device_profile_id = $%d", len(args)))
+	}
+
+	if len(target.Tags.Map) != 0 {
+		args = append(args, target.Tags)
+		filters = append(filters, fmt.Sprintf("d.tags @> $%d", len(args)))
+	}
+
+	if len(target.DevEUIs) != 0 {
+		devEUIsB := make([][]byte, len(target.DevEUIs))
+		for i := range target.DevEUIs {
+			devEUIsB[i] = target.DevEUIs[i][:]
+		}
+
+		var invalid int
+		err := sqlx.Get(db, &invalid, `
+			select
+				count(*)
+			from
+				unnest($1::bytea[]) as t(dev_eui)
+			where
+				not exists (
+					select
+						1
+					from
+						device d
+					where
+						d.dev_eui = t.dev_eui
+						and d.application_id = $2
+				)`,
+			pq.ByteaArray(devEUIsB),
+			target.ApplicationID,
+		)
+		if err != nil {
+			return nil, handlePSQLError(Select, err, "select error")
+		}
+		if invalid > 0 {
+			return nil, ErrFUOTADeploymentInvalidDevEUIs
+		}
+
+		args = append(args, pq.ByteaArray(devEUIsB))
+		filters = append(filters, fmt.Sprintf("d.dev_eui = any($%d)", len(args)))
+	}
+
+	var out []lorawan.EUI64
+	err := sqlx.Select(db, &out, `
+		select
+			d.dev_eui
+		from
+			device d
+		where
+			`+strings.Join(filters, " and ")+`
+		order by
+			d.dev_eui`,
+		args...,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return out, nil
+}
+
 // GetFUOTADeployment returns the FUOTA deployment for the given ID.
 func GetFUOTADeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID, forUpdate bool) (FUOTADeployment, error) {
 	var fu string
@@ -245,7 +428,8 @@ func GetFUOTADeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID, forUpdat
 			multicast_group_id,
 			fragmentation_matrix,
 			descriptor,
-			payload,
+			coalesce((select fi.payload from firmware_image fi where fi.id = fd.firmware_image_id), fd.payload) as payload,
+			firmware_image_id,
 			state,
 			next_step_after,
 			unicast_timeout,
@@ -256,9 +440,12 @@ func GetFUOTADeployment(ctx context.Context, db sqlx.Ext, id uuid.UUID, forUpdat
 			group_type,
 			dr,
 			frequency,
-			ping_slot_period
+			ping_slot_period,
+			unicast_retransmissions,
+			unicast_retransmission_count,
+			paused_at
 		from
-			fuota_deployment
+			fuota_deployment fd
 		where
 			id = $1`+fu,
 		id,
@@ -280,7 +467,8 @@ func GetPendingFUOTADeployments(ctx context.Context, db sqlx.Ext, batchSize int)
 			multicast_group_id,
 			fragmentation_matrix,
 			descriptor,
-			payload,
+			coalesce((select fi.payload from firmware_image fi where fi.id = fd.firmware_image_id), fd.payload) as payload,
+			firmware_image_id,
 			state,
 			next_step_after,
 			unicast_timeout,
@@ -291,12 +479,16 @@ func GetPendingFUOTADeployments(ctx context.Context, db sqlx.Ext, batchSize int)
 			group_type,
 			dr,
 			frequency,
-			ping_slot_period
+			ping_slot_period,
+			unicast_retransmissions,
+			unicast_retransmission_count,
+			paused_at
 		from
-			fuota_deployment
+			fuota_deployment fd
 		where
 			state != $1
 			and next_step_after <= $2
+			and paused_at is null
 		limit $3
 		for update
 		skip locked`,
@@ -343,7 +535,10 @@ func UpdateFUOTADeployment(ctx context.Context, db sqlx.Ext, fd *FUOTADeployment
 			group_type = $15,
 			dr = $16,
 			frequency = $17,
-			ping_slot_period = $18
+			ping_slot_period = $18,
+			paused_at = $19,
+			unicast_retransmissions = $20,
+			unicast_retransmission_count = $21
 		where
 			id = $1`,
 		fd.ID,
@@ -352,7 +547,7 @@ func UpdateFUOTADeployment(ctx context.Context, db sqlx.Ext, fd *FUOTADeployment
 		fd.MulticastGroupID,
 		[]byte{fd.FragmentationMatrix},
 		fd.Descriptor[:],
-		fd.Payload,
+		fd.storedPayload(),
 		fd.State,
 		fd.NextStepAfter,
 		fd.UnicastTimeout,
@@ -364,6 +559,9 @@ func UpdateFUOTADeployment(ctx context.Context, db sqlx.Ext, fd *FUOTADeployment
 		fd.DR,
 		fd.Frequency,
 		fd.PingSlotPeriod,
+		fd.PausedAt,
+		fd.UnicastRetransmissions,
+		fd.UnicastRetransmissionCount,
 	)
 	if err != nil {
 		return handlePSQLError(Update, err, "update error")
@@ -423,7 +621,8 @@ func GetFUOTADeployments(ctx context.Context, db sqlx.Queryer, filters FUOTADepl
 			fd.updated_at,
 			fd.name,
 			fd.state,
-			fd.next_step_after
+			fd.next_step_after,
+			fd.paused_at
 		from
 			fuota_deployment fd
 		inner join
@@ -506,7 +705,9 @@ func UpdateFUOTADeploymentDevice(ctx context.Context, db sqlx.Ext, fdd *FUOTADep
 		set
 			updated_at = $3,
 			state = $4,
-			error_message = $5
+			error_message = $5,
+			missing_frag = $6,
+			retransmitted_frag = $7
 		where
 			dev_eui = $1
 			and fuota_deployment_id = $2`,
@@ -515,6 +716,8 @@ func UpdateFUOTADeploymentDevice(ctx context.Context, db sqlx.Ext, fdd *FUOTADep
 		fdd.UpdatedAt,
 		fdd.State,
 		fdd.ErrorMessage,
+		fdd.MissingFrag,
+		fdd.RetransmittedFrag,
 	)
 	if err != nil {
 		return handlePSQLError(Update, err, "update error")
@@ -527,6 +730,29 @@ func UpdateFUOTADeploymentDevice(ctx context.Context, db sqlx.Ext, fdd *FUOTADep
 		return ErrDoesNotExist
 	}
 
+	if fdd.State == FUOTADeploymentDeviceSuccess {
+		// the device is now running the firmware image of the deployment
+		_, err = db.Exec(`
+			update
+				device d
+			set
+				firmware_version = fi.version
+			from
+				fuota_deployment fd
+			inner join
+				firmware_image fi
+				on fi.id = fd.firmware_image_id
+			where
+				d.dev_eui = $1
+				and fd.id = $2`,
+			fdd.DevEUI,
+			fdd.FUOTADeploymentID,
+		)
+		if err != nil {
+			return handlePSQLError(Update, err, "update error")
+		}
+	}
+
 	log.WithFields(log.Fields{
 		"dev_eui":             fdd.DevEUI,
 		"fuota_deployment_id": fdd.FUOTADeploymentID,
@@ -622,6 +848,16 @@ func GetServiceProfileIDForFUOTADeployment(ctx context.Context, db sqlx.Ext, fuo
 	return out, nil
 }
 
+// storedPayload returns the payload to store in the fuota_deployment table.
+// When the deployment refers to a firmware image, the payload is read from
+// the image and therefore not stored again.
+func (fd FUOTADeployment) storedPayload() []byte {
+	if fd.FirmwareImageID != nil {
+		return []byte{}
+	}
+	return fd.Payload
+}
+
 func scanFUOTADeployment(row sqlx.ColScanner) (FUOTADeployment, error) {
 	var fd FUOTADeployment
 
@@ -637,6 +873,7 @@ func scanFUOTADeployment(row sqlx.ColScanner) (FUOTADeployment, error) {
 		&fragmentationMatrix,
 		&descriptor,
 		&fd.Payload,
+		&fd.FirmwareImageID,
 		&fd.State,
 		&fd.NextStepAfter,
 		&fd.UnicastTimeout,
@@ -648,6 +885,9 @@ func scanFUOTADeployment(row sqlx.ColScanner) (FUOTADeployment, error) {
 		&fd.DR,
 		&fd.Frequency,
 		&fd.PingSlotPeriod,
+		&fd.UnicastRetransmissions,
+		&fd.UnicastRetransmissionCount,
+		&fd.PausedAt,
 	)
 	if err != nil {
 		return fd, handlePSQLError(Select, err, "select error")
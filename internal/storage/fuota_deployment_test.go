@@ -2,10 +2,13 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
 	uuid "github.com/gofrs/uuid"
+	"github.com/lib/pq/hstore"
 	"github.com/stretchr/testify/require"
 
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
@@ -47,9 +50,13 @@ func (ts *StorageTestSuite) TestFUOTADeployment() {
 	assert.NoError(CreateApplication(context.Background(), ts.tx, &app))
 
 	dp := DeviceProfile{
-		Name:            "test-dp",
-		OrganizationID:  org.ID,
-		NetworkServerID: n.ID,
+		Name:                  "test-dp",
+		OrganizationID:        org.ID,
+		NetworkServerID:       n.ID,
+		MulticastSetupEnabled: true,
+		MulticastSetupFPort:   200,
+		FragmentationEnabled:  true,
+		FragmentationFPort:    201,
 	}
 	assert.NoError(CreateDeviceProfile(context.Background(), ts.tx, &dp))
 	var dpID uuid.UUID
@@ -78,20 +85,21 @@ func (ts *StorageTestSuite) TestFUOTADeployment() {
 		assert := require.New(t)
 
 		fd := FUOTADeployment{
-			Name:                "test deployment",
-			MulticastGroupID:    &mgID,
-			FragmentationMatrix: 3,
-			Descriptor:          [4]byte{1, 2, 3, 4},
-			Payload:             []byte{5, 6, 7, 8},
-			UnicastTimeout:      time.Minute,
-			FragSize:            10,
-			Redundancy:          20,
-			BlockAckDelay:       6,
-			MulticastTimeout:    3,
-			GroupType:           FUOTADeploymentGroupTypeB,
-			DR:                  3,
-			Frequency:           868100000,
-			PingSlotPeriod:      2,
+			Name:                   "test deployment",
+			MulticastGroupID:       &mgID,
+			FragmentationMatrix:    3,
+			Descriptor:             [4]byte{1, 2, 3, 4},
+			Payload:                []byte{5, 6, 7, 8},
+			UnicastTimeout:         time.Minute,
+			FragSize:               10,
+			Redundancy:             20,
+			BlockAckDelay:          6,
+			MulticastTimeout:       3,
+			GroupType:              FUOTADeploymentGroupTypeB,
+			DR:                     3,
+			Frequency:              868100000,
+			PingSlotPeriod:         2,
+			UnicastRetransmissions: 2,
 		}
 		assert.NoError(CreateFUOTADeploymentForDevice(context.Background(), ts.tx, &fd, d.DevEUI))
 		fd.CreatedAt = fd.CreatedAt.UTC().Round(time.Millisecond)
@@ -216,10 +224,17 @@ func (ts *StorageTestSuite) TestFUOTADeployment() {
 
 				fdd.State = FUOTADeploymentDeviceError
 				fdd.ErrorMessage = "BOOM!"
+				fdd.MissingFrag = 5
+				fdd.RetransmittedFrag = 3
 
 				assert.NoError(UpdateFUOTADeploymentDevice(context.Background(), ts.tx, &fdd))
 
-				_, err := GetPendingFUOTADeploymentDevice(context.Background(), ts.tx, d.DevEUI)
+				fddGet, err := GetFUOTADeploymentDevice(context.Background(), ts.tx, fd.ID, d.DevEUI)
+				assert.NoError(err)
+				assert.Equal(5, fddGet.MissingFrag)
+				assert.Equal(3, fddGet.RetransmittedFrag)
+
+				_, err = GetPendingFUOTADeploymentDevice(context.Background(), ts.tx, d.DevEUI)
 				assert.Equal(ErrDoesNotExist, err)
 
 				devices, err := GetFUOTADeploymentDevices(context.Background(), ts.tx, fd.ID, 10, 0)
@@ -249,6 +264,8 @@ func (ts *StorageTestSuite) TestFUOTADeployment() {
 			fd.DR = 4
 			fd.Frequency = 868300000
 			fd.PingSlotPeriod = 0
+			fd.UnicastRetransmissions = 3
+			fd.UnicastRetransmissionCount = 1
 
 			assert.NoError(UpdateFUOTADeployment(context.Background(), ts.tx, &fd))
 			fd.UpdatedAt = fd.UpdatedAt.UTC().Round(time.Millisecond)
@@ -272,3 +289,236 @@ func (ts *StorageTestSuite) TestFUOTADeployment() {
 		})
 	})
 }
+
+func (ts *StorageTestSuite) TestFUOTADeploymentForTarget() {
+	assert := require.New(ts.T())
+
+	nsClient := nsmock.NewClient()
+	networkserver.SetPool(nsmock.NewPool(nsClient))
+
+	n := NetworkServer{
+		Name:   "test",
+		Server: "test:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.tx, &n))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.tx, &org))
+
+	sp := ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(CreateServiceProfile(context.Background(), ts.tx, &sp))
+	var spID uuid.UUID
+	copy(spID[:], sp.ServiceProfile.Id)
+
+	app := Application{
+		Name:             "test-app",
+		OrganizationID:   org.ID,
+		ServiceProfileID: spID,
+	}
+	assert.NoError(CreateApplication(context.Background(), ts.tx, &app))
+
+	var dpIDs []uuid.UUID
+	for i, fPort := range []uint8{201, 202} {
+		dp := DeviceProfile{
+			Name:                  fmt.Sprintf("test-dp-%d", i),
+			OrganizationID:        org.ID,
+			NetworkServerID:       n.ID,
+			MulticastSetupEnabled: true,
+			MulticastSetupFPort:   200,
+			FragmentationEnabled:  true,
+			FragmentationFPort:    fPort,
+		}
+		assert.NoError(CreateDeviceProfile(context.Background(), ts.tx, &dp))
+		var dpID uuid.UUID
+		copy(dpID[:], dp.DeviceProfile.Id)
+		dpIDs = append(dpIDs, dpID)
+	}
+
+	devices := []Device{
+		{
+			DevEUI:          lorawan.EUI64{1, 1, 1, 1, 1, 1, 1, 1},
+			ApplicationID:   app.ID,
+			DeviceProfileID: dpIDs[0],
+			Name:            "device-1",
+			Tags: hstore.Hstore{
+				Map: map[string]sql.NullString{
+					"firmware": {Valid: true, String: "1.0"},
+				},
+			},
+		},
+		{
+			DevEUI:          lorawan.EUI64{2, 2, 2, 2, 2, 2, 2, 2},
+			ApplicationID:   app.ID,
+			DeviceProfileID: dpIDs[0],
+			Name:            "device-2",
+		},
+		{
+			DevEUI:          lorawan.EUI64{3, 3, 3, 3, 3, 3, 3, 3},
+			ApplicationID:   app.ID,
+			DeviceProfileID: dpIDs[1],
+			Name:            "device-3",
+		},
+	}
+	for i := range devices {
+		assert.NoError(CreateDevice(context.Background(), ts.tx, &devices[i]))
+	}
+
+	ts.T().Run("Get DevEUIs for target", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			target   FUOTADeploymentTarget
+			expected []lorawan.EUI64
+			err      error
+		}{
+			{
+				name:     "application",
+				target:   FUOTADeploymentTarget{ApplicationID: app.ID},
+				expected: []lorawan.EUI64{devices[0].DevEUI, devices[1].DevEUI, devices[2].DevEUI},
+			},
+			{
+				name:     "device-profile",
+				target:   FUOTADeploymentTarget{ApplicationID: app.ID, DeviceProfileID: dpIDs[0]},
+				expected: []lorawan.EUI64{devices[0].DevEUI, devices[1].DevEUI},
+			},
+			{
+				name: "tags",
+				target: FUOTADeploymentTarget{
+					ApplicationID: app.ID,
+					Tags: hstore.Hstore{
+						Map: map[string]sql.NullString{
+							"firmware": {Valid: true, String: "1.0"},
+						},
+					},
+				},
+				expected: []lorawan.EUI64{devices[0].DevEUI},
+			},
+			{
+				name:     "dev_euis",
+				target:   FUOTADeploymentTarget{ApplicationID: app.ID, DevEUIs: []lorawan.EUI64{devices[2].DevEUI}},
+				expected: []lorawan.EUI64{devices[2].DevEUI},
+			},
+			{
+				name:   "unknown dev_eui",
+				target: FUOTADeploymentTarget{ApplicationID: app.ID, DevEUIs: []lorawan.EUI64{devices[2].DevEUI, {9, 9, 9, 9, 9, 9, 9, 9}}},
+				err:    ErrFUOTADeploymentInvalidDevEUIs,
+			},
+			{
+				name:   "dev_eui of other application",
+				target: FUOTADeploymentTarget{ApplicationID: app.ID + 1, DevEUIs: []lorawan.EUI64{devices[2].DevEUI}},
+				err:    ErrFUOTADeploymentInvalidDevEUIs,
+			},
+			{
+				name:   "other application",
+				target: FUOTADeploymentTarget{ApplicationID: app.ID + 1},
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+
+				devEUIs, err := GetDevEUIsForFUOTADeploymentTarget(context.Background(), ts.tx, tst.target)
+				assert.Equal(tst.err, err)
+				assert.Equal(tst.expected, devEUIs)
+			})
+		}
+	})
+
+	ts.T().Run("Create fuota deployment", func(t *testing.T) {
+		t.Run("No devices", func(t *testing.T) {
+			assert := require.New(t)
+
+			var fd FUOTADeployment
+			assert.Equal(ErrFUOTADeploymentNoDevices, CreateFUOTADeployment(context.Background(), ts.tx, &fd, nil))
+		})
+
+		t.Run("Incompatible devices", func(t *testing.T) {
+			assert := require.New(t)
+
+			var fd FUOTADeployment
+			assert.Equal(ErrFUOTADeploymentIncompatibleDevices, CreateFUOTADeployment(context.Background(), ts.tx, &fd, []lorawan.EUI64{devices[0].DevEUI, devices[2].DevEUI}))
+		})
+
+		t.Run("Packages disabled", func(t *testing.T) {
+			assert := require.New(t)
+
+			dp := DeviceProfile{
+				Name:               "test-dp-disabled",
+				OrganizationID:     org.ID,
+				NetworkServerID:    n.ID,
+				FragmentationFPort: 201,
+			}
+			assert.NoError(CreateDeviceProfile(context.Background(), ts.tx, &dp))
+			var dpID uuid.UUID
+			copy(dpID[:], dp.DeviceProfile.Id)
+
+			d := Device{
+				DevEUI:          lorawan.EUI64{4, 4, 4, 4, 4, 4, 4, 4},
+				ApplicationID:   app.ID,
+				DeviceProfileID: dpID,
+				Name:            "device-4",
+			}
+			assert.NoError(CreateDevice(context.Background(), ts.tx, &d))
+
+			var fd FUOTADeployment
+			assert.Equal(ErrFUOTADeploymentAppLayerDisabled, CreateFUOTADeployment(context.Background(), ts.tx, &fd, []lorawan.EUI64{d.DevEUI}))
+		})
+
+		t.Run("Multiple devices", func(t *testing.T) {
+			assert := require.New(t)
+
+			fd := FUOTADeployment{
+				Name:             "test deployment",
+				Payload:          []byte{1, 2, 3, 4},
+				UnicastTimeout:   time.Minute,
+				FragSize:         10,
+				Redundancy:       5,
+				MulticastTimeout: 3,
+				GroupType:        FUOTADeploymentGroupTypeC,
+			}
+			assert.NoError(CreateFUOTADeployment(context.Background(), ts.tx, &fd, []lorawan.EUI64{devices[0].DevEUI, devices[1].DevEUI}))
+
+			count, err := GetFUOTADeploymentDeviceCount(context.Background(), ts.tx, fd.ID)
+			assert.NoError(err)
+			assert.Equal(2, count)
+
+			items, err := GetFUOTADeploymentDevices(context.Background(), ts.tx, fd.ID, 10, 0)
+			assert.NoError(err)
+			assert.Len(items, 2)
+			for _, item := range items {
+				assert.Equal(FUOTADeploymentDevicePending, item.State)
+			}
+
+			t.Run("Device in other deployment", func(t *testing.T) {
+				assert := require.New(t)
+
+				fd2 := fd
+				assert.Equal(ErrFUOTADeploymentDeviceInProgress, CreateFUOTADeployment(context.Background(), ts.tx, &fd2, []lorawan.EUI64{devices[1].DevEUI}))
+			})
+
+			t.Run("Device in done deployment", func(t *testing.T) {
+				assert := require.New(t)
+
+				fd.State = FUOTADeploymentDone
+				assert.NoError(UpdateFUOTADeployment(context.Background(), ts.tx, &fd))
+
+				fd2 := FUOTADeployment{
+					Name:             "test deployment 2",
+					Payload:          []byte{1, 2, 3, 4},
+					UnicastTimeout:   time.Minute,
+					FragSize:         10,
+					Redundancy:       5,
+					MulticastTimeout: 3,
+					GroupType:        FUOTADeploymentGroupTypeC,
+				}
+				assert.NoError(CreateFUOTADeployment(context.Background(), ts.tx, &fd2, []lorawan.EUI64{devices[1].DevEUI}))
+			})
+		})
+	})
+}
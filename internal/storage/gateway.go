@@ -46,6 +46,8 @@ type Gateway struct {
 	Altitude         float64       `db:"altitude"`
 	Tags             hstore.Hstore `db:"tags"`
 	Metadata         hstore.Hstore `db:"metadata"`
+	OfflineThreshold time.Duration `db:"offline_threshold"`
+	IsOffline        bool          `db:"is_offline"`
 }
 
 // GatewayListItem defines the gateway as list item.
@@ -146,8 +148,9 @@ func CreateGateway(ctx context.Context, db sqlx.Execer, gw *Gateway) error {
 			longitude,
 			altitude,
 			tags,
-			metadata
-		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+			metadata,
+			offline_threshold
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
 		gw.MAC[:],
 		gw.CreatedAt,
 		gw.UpdatedAt,
@@ -166,6 +169,7 @@ func CreateGateway(ctx context.Context, db sqlx.Execer, gw *Gateway) error {
 		gw.Altitude,
 		gw.Tags,
 		gw.Metadata,
+		gw.OfflineThreshold,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -204,7 +208,8 @@ func UpdateGateway(ctx context.Context, db sqlx.Execer, gw *Gateway) error {
 			longitude = $14,
 			altitude = $15,
 			tags = $16,
-			metadata = $17
+			metadata = $17,
+			offline_threshold = $18
 		where
 			mac = $1`,
 		gw.MAC[:],
@@ -224,6 +229,7 @@ func UpdateGateway(ctx context.Context, db sqlx.Execer, gw *Gateway) error {
 		gw.Altitude,
 		gw.Tags,
 		gw.Metadata,
+		gw.OfflineThreshold,
 	)
 	if err != nil {
 		return handlePSQLError(Update, err, "update error")
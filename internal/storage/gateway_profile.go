@@ -31,11 +31,12 @@ type ExtraChannel struct {
 
 // GatewayProfile defines a gateway-profile.
 type GatewayProfile struct {
-	NetworkServerID int64             `db:"network_server_id"`
-	CreatedAt       time.Time         `db:"created_at"`
-	UpdatedAt       time.Time         `db:"updated_at"`
-	Name            string            `db:"name"`
-	GatewayProfile  ns.GatewayProfile `db:"-"`
+	NetworkServerID  int64             `db:"network_server_id"`
+	CreatedAt        time.Time         `db:"created_at"`
+	UpdatedAt        time.Time         `db:"updated_at"`
+	Name             string            `db:"name"`
+	OfflineThreshold time.Duration     `db:"offline_threshold"`
+	GatewayProfile   ns.GatewayProfile `db:"-"`
 }
 
 // GatewayProfileMeta defines the gateway-profile meta record.
@@ -69,14 +70,16 @@ func CreateGatewayProfile(ctx context.Context, db sqlx.Ext, gp *GatewayProfile)
 			network_server_id,
 			created_at,
 			updated_at,
-			name
-		) values ($1, $2, $3, $4, $5)`,
+			name,
+			offline_threshold
+		) values ($1, $2, $3, $4, $5, $6)`,
 
 		gpID,
 		gp.NetworkServerID,
 		gp.CreatedAt,
 		gp.UpdatedAt,
 		gp.Name,
+		gp.OfflineThreshold,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -114,6 +117,7 @@ func GetGatewayProfile(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (Gate
 		select
 			network_server_id,
 			name,
+			offline_threshold,
 			created_at,
 			updated_at
 		from gateway_profile
@@ -164,13 +168,15 @@ func UpdateGatewayProfile(ctx context.Context, db sqlx.Ext, gp *GatewayProfile)
 		set
 			updated_at = $2,
 			network_server_id = $3,
-			name = $4
+			name = $4,
+			offline_threshold = $5
 		where
 			gateway_profile_id = $1`,
 		gpID,
 		gp.UpdatedAt,
 		gp.NetworkServerID,
 		gp.Name,
+		gp.OfflineThreshold,
 	)
 	if err != nil {
 		return handlePSQLError(Update, err, "update gateway-profile error")
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// GatewayStatusTransition defines a gateway online / offline transition.
+type GatewayStatusTransition struct {
+	ID         int64         `db:"id"`
+	CreatedAt  time.Time     `db:"created_at"`
+	GatewayID  lorawan.EUI64 `db:"gateway_id"`
+	Online     bool          `db:"online"`
+	LastSeenAt *time.Time    `db:"last_seen_at"`
+}
+
+// GetGatewaysForStatusTransition returns the gateways of which the offline
+// state does not match the last seen timestamp, using the given time as
+// reference. The offline threshold of the gateway is used, or the threshold
+// of its gateway-profile when not set, or else the given default threshold.
+// Gateways with a resulting threshold of 0 are not monitored. The returned
+// gateways are locked for update, gateways locked by an other transaction
+// are skipped.
+func GetGatewaysForStatusTransition(ctx context.Context, db sqlx.Queryer, now time.Time, defaultThreshold time.Duration, limit int) ([]Gateway, error) {
+	var gws []Gateway
+	err := sqlx.Select(db, &gws, `
+		select
+			g.*
+		from
+			gateway g
+		left join gateway_profile gp
+			on gp.gateway_profile_id = g.gateway_profile_id
+		where
+			g.last_seen_at is not null
+			and coalesce(nullif(g.offline_threshold, 0), nullif(gp.offline_threshold, 0), $2) > 0
+			and g.is_offline != (g.last_seen_at < $1::timestamp with time zone - interval '1 microsecond' * (coalesce(nullif(g.offline_threshold, 0), nullif(gp.offline_threshold, 0), $2) / 1000))
+		limit $3
+		for update of g skip locked`,
+		now,
+		defaultThreshold,
+		limit,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return gws, nil
+}
+
+// SetGatewayOffline sets the offline state of the given gateway.
+func SetGatewayOffline(ctx context.Context, db sqlx.Execer, mac lorawan.EUI64, offline bool) error {
+	res, err := db.Exec(`
+		update gateway
+		set
+			is_offline = $2
+		where
+			mac = $1`,
+		mac[:],
+		offline,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	return nil
+}
+
+// CreateGatewayStatusTransition creates the given gateway status transition.
+func CreateGatewayStatusTransition(ctx context.Context, db sqlx.Queryer, t *GatewayStatusTransition) error {
+	t.CreatedAt = time.Now()
+
+	err := sqlx.Get(db, &t.ID, `
+		insert into gateway_status_transition (
+			created_at,
+			gateway_id,
+			online,
+			last_seen_at
+		) values ($1, $2, $3, $4)
+		returning id`,
+		t.CreatedAt,
+		t.GatewayID[:],
+		t.Online,
+		t.LastSeenAt,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"gateway_id": t.GatewayID,
+		"online":     t.Online,
+		"ctx_id":     ctx.Value(logging.ContextIDKey),
+	}).Info("storage: gateway status transition created")
+
+	return nil
+}
+
+// GetGatewayStatusTransitionCount returns the number of status transitions
+// of the given gateway.
+func GetGatewayStatusTransitionCount(ctx context.Context, db sqlx.Queryer, mac lorawan.EUI64) (int, error) {
+	var count int
+	err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			gateway_status_transition
+		where
+			gateway_id = $1`,
+		mac[:],
+	)
+	if err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// GetGatewayStatusTransitions returns the status transitions of the given
+// gateway, most recent first.
+func GetGatewayStatusTransitions(ctx context.Context, db sqlx.Queryer, mac lorawan.EUI64, limit, offset int) ([]GatewayStatusTransition, error) {
+	var out []GatewayStatusTransition
+	err := sqlx.Select(db, &out, `
+		select
+			*
+		from
+			gateway_status_transition
+		where
+			gateway_id = $1
+		order by
+			created_at desc,
+			id desc
+		limit $2
+		offset $3`,
+		mac[:],
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *StorageTestSuite) TestGatewayStatus() {
+	assert := require.New(ts.T())
+
+	n := NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.Tx(), &n))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.Tx(), &org))
+
+	lastSeen := time.Now().Add(-10 * time.Minute)
+	gw := Gateway{
+		MAC:             lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+		Name:            "test-gw",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+		LastSeenAt:      &lastSeen,
+	}
+	assert.NoError(CreateGateway(context.Background(), ts.Tx(), &gw))
+
+	ts.T().Run("GetGatewaysForStatusTransition", func(t *testing.T) {
+		tests := []struct {
+			name             string
+			offline          bool
+			gwThreshold      time.Duration
+			defaultThreshold time.Duration
+			expected         int
+		}{
+			{
+				name:     "monitoring disabled",
+				expected: 0,
+			},
+			{
+				name:             "online within default threshold",
+				defaultThreshold: time.Hour,
+				expected:         0,
+			},
+			{
+				name:             "offline by default threshold",
+				defaultThreshold: 5 * time.Minute,
+				expected:         1,
+			},
+			{
+				name:             "gateway threshold overrides default",
+				gwThreshold:      time.Hour,
+				defaultThreshold: 5 * time.Minute,
+				expected:         0,
+			},
+			{
+				name:             "already offline",
+				offline:          true,
+				defaultThreshold: 5 * time.Minute,
+				expected:         0,
+			},
+			{
+				name:             "back online",
+				offline:          true,
+				defaultThreshold: time.Hour,
+				expected:         1,
+			},
+		}
+
+		for _, tst := range tests {
+			t.Run(tst.name, func(t *testing.T) {
+				assert := require.New(t)
+
+				gw.OfflineThreshold = tst.gwThreshold
+				assert.NoError(UpdateGateway(context.Background(), ts.Tx(), &gw))
+				assert.NoError(SetGatewayOffline(context.Background(), ts.Tx(), gw.MAC, tst.offline))
+
+				gws, err := GetGatewaysForStatusTransition(context.Background(), ts.Tx(), time.Now(), tst.defaultThreshold, 10)
+				assert.NoError(err)
+				assert.Len(gws, tst.expected)
+			})
+		}
+	})
+
+	ts.T().Run("Transitions", func(t *testing.T) {
+		assert := require.New(t)
+
+		offline := GatewayStatusTransition{
+			GatewayID:  gw.MAC,
+			LastSeenAt: &lastSeen,
+		}
+		assert.NoError(CreateGatewayStatusTransition(context.Background(), ts.Tx(), &offline))
+
+		online := GatewayStatusTransition{
+			GatewayID: gw.MAC,
+			Online:    true,
+		}
+		assert.NoError(CreateGatewayStatusTransition(context.Background(), ts.Tx(), &online))
+
+		count, err := GetGatewayStatusTransitionCount(context.Background(), ts.Tx(), gw.MAC)
+		assert.NoError(err)
+		assert.Equal(2, count)
+
+		items, err := GetGatewayStatusTransitions(context.Background(), ts.Tx(), gw.MAC, 10, 0)
+		assert.NoError(err)
+		assert.Len(items, 2)
+		assert.Equal(online.ID, items[0].ID)
+		assert.True(items[0].Online)
+		assert.Equal(offline.ID, items[1].ID)
+		assert.False(items[1].Online)
+		assert.True(items[1].LastSeenAt.Equal(lastSeen.Truncate(time.Microsecond)))
+	})
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq/hstore"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// IntegrationDeadLetter defines an event which could not be delivered to
+// an integration, after all retry attempts failed.
+type IntegrationDeadLetter struct {
+	ID            uuid.UUID     `db:"id"`
+	CreatedAt     time.Time     `db:"created_at"`
+	UpdatedAt     time.Time     `db:"updated_at"`
+	ApplicationID int64         `db:"application_id"`
+	DevEUI        lorawan.EUI64 `db:"dev_eui"`
+	Integration   string        `db:"integration"`
+	EventType     string        `db:"event_type"`
+	Event         []byte        `db:"event"`
+	Variables     hstore.Hstore `db:"variables"`
+	Attempts      int           `db:"attempts"`
+	LastError     string        `db:"last_error"`
+}
+
+// CreateIntegrationDeadLetter creates the given dead-letter.
+func CreateIntegrationDeadLetter(ctx context.Context, db sqlx.Execer, dl *IntegrationDeadLetter) error {
+	var err error
+	dl.ID, err = uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "new uuid v4 error")
+	}
+
+	now := time.Now()
+	dl.CreatedAt = now
+	dl.UpdatedAt = now
+
+	_, err = db.Exec(`
+		insert into integration_dead_letter (
+			id,
+			created_at,
+			updated_at,
+			application_id,
+			dev_eui,
+			integration,
+			event_type,
+			event,
+			variables,
+			attempts,
+			last_error
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		dl.ID,
+		dl.CreatedAt,
+		dl.UpdatedAt,
+		dl.ApplicationID,
+		dl.DevEUI[:],
+		dl.Integration,
+		dl.EventType,
+		dl.Event,
+		dl.Variables,
+		dl.Attempts,
+		dl.LastError,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":             dl.ID,
+		"application_id": dl.ApplicationID,
+		"dev_eui":        dl.DevEUI,
+		"integration":    dl.Integration,
+		"event_type":     dl.EventType,
+		"ctx_id":         ctx.Value(logging.ContextIDKey),
+	}).Info("integration dead-letter created")
+	return nil
+}
+
+// GetIntegrationDeadLetter returns the dead-letter for the given ID.
+func GetIntegrationDeadLetter(ctx context.Context, db sqlx.Queryer, id uuid.UUID) (IntegrationDeadLetter, error) {
+	var dl IntegrationDeadLetter
+	if err := sqlx.Get(db, &dl, `
+		select
+			*
+		from
+			integration_dead_letter
+		where
+			id = $1`,
+		id,
+	); err != nil {
+		return dl, handlePSQLError(Select, err, "select error")
+	}
+
+	return dl, nil
+}
+
+// GetIntegrationDeadLetterCount returns the number of dead-letters for the
+// given application ID.
+func GetIntegrationDeadLetterCount(ctx context.Context, db sqlx.Queryer, applicationID int64) (int, error) {
+	var count int
+	if err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			integration_dead_letter
+		where
+			application_id = $1`,
+		applicationID,
+	); err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// GetIntegrationDeadLetters returns a slice of dead-letters for the given
+// application ID, most recent first.
+func GetIntegrationDeadLetters(ctx context.Context, db sqlx.Queryer, applicationID int64, limit, offset int) ([]IntegrationDeadLetter, error) {
+	var items []IntegrationDeadLetter
+	if err := sqlx.Select(db, &items, `
+		select
+			*
+		from
+			integration_dead_letter
+		where
+			application_id = $1
+		order by
+			created_at desc
+		limit $2
+		offset $3`,
+		applicationID,
+		limit,
+		offset,
+	); err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return items, nil
+}
+
+// UpdateIntegrationDeadLetter updates the attempts and last error of the
+// given dead-letter.
+func UpdateIntegrationDeadLetter(ctx context.Context, db sqlx.Execer, dl *IntegrationDeadLetter) error {
+	dl.UpdatedAt = time.Now()
+
+	res, err := db.Exec(`
+		update
+			integration_dead_letter
+		set
+			updated_at = $2,
+			attempts = $3,
+			last_error = $4
+		where
+			id = $1`,
+		dl.ID,
+		dl.UpdatedAt,
+		dl.Attempts,
+		dl.LastError,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     dl.ID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("integration dead-letter updated")
+	return nil
+}
+
+// DeleteIntegrationDeadLetter deletes the dead-letter with the given ID.
+func DeleteIntegrationDeadLetter(ctx context.Context, db sqlx.Execer, id uuid.UUID) error {
+	res, err := db.Exec(`
+		delete from integration_dead_letter
+		where
+			id = $1`,
+		id,
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     id,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("integration dead-letter deleted")
+	return nil
+}
+
+// DeleteIntegrationDeadLettersForApplicationID deletes all the dead-letters
+// for the given application ID. It returns the number of deleted items.
+func DeleteIntegrationDeadLettersForApplicationID(ctx context.Context, db sqlx.Execer, applicationID int64) (int, error) {
+	res, err := db.Exec(`
+		delete from integration_dead_letter
+		where
+			application_id = $1`,
+		applicationID,
+	)
+	if err != nil {
+		return 0, handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "get rows affected error")
+	}
+
+	log.WithFields(log.Fields{
+		"application_id": applicationID,
+		"count":          ra,
+		"ctx_id":         ctx.Value(logging.ContextIDKey),
+	}).Info("integration dead-letters deleted")
+	return int(ra), nil
+}
+
+// DeleteIntegrationDeadLettersBefore deletes all the dead-letters created
+// before the given time. It returns the number of deleted items.
+func DeleteIntegrationDeadLettersBefore(ctx context.Context, db sqlx.Execer, before time.Time) (int, error) {
+	res, err := db.Exec(`
+		delete from integration_dead_letter
+		where
+			created_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "get rows affected error")
+	}
+
+	log.WithFields(log.Fields{
+		"before": before,
+		"count":  ra,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("integration dead-letters deleted")
+	return int(ra), nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/lib/pq/hstore"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	nsmock "github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+	"github.com/brocaar/lorawan"
+)
+
+func (ts *StorageTestSuite) TestIntegrationDeadLetter() {
+	assert := require.New(ts.T())
+
+	nsClient := nsmock.NewClient()
+	networkserver.SetPool(nsmock.NewPool(nsClient))
+
+	n := NetworkServer{
+		Name:   "test",
+		Server: "test:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.tx, &n))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.tx, &org))
+
+	sp := ServiceProfile{
+		Name:            "test-sp",
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+	}
+	assert.NoError(CreateServiceProfile(context.Background(), ts.tx, &sp))
+	var spID uuid.UUID
+	copy(spID[:], sp.ServiceProfile.Id)
+
+	app := Application{
+		Name:             "test-app",
+		OrganizationID:   org.ID,
+		ServiceProfileID: spID,
+	}
+	assert.NoError(CreateApplication(context.Background(), ts.tx, &app))
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		dl := IntegrationDeadLetter{
+			ApplicationID: app.ID,
+			DevEUI:        lorawan.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+			Integration:   "HTTP",
+			EventType:     "up",
+			Event:         []byte{1, 2, 3},
+			Variables: hstore.Hstore{
+				Map: map[string]sql.NullString{
+					"foo": sql.NullString{String: "bar", Valid: true},
+				},
+			},
+			Attempts:  3,
+			LastError: "connection refused",
+		}
+		assert.NoError(CreateIntegrationDeadLetter(context.Background(), ts.tx, &dl))
+		dl.CreatedAt = dl.CreatedAt.Round(time.Second).UTC()
+		dl.UpdatedAt = dl.UpdatedAt.Round(time.Second).UTC()
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			dlGet, err := GetIntegrationDeadLetter(context.Background(), ts.tx, dl.ID)
+			assert.NoError(err)
+			dlGet.CreatedAt = dlGet.CreatedAt.Round(time.Second).UTC()
+			dlGet.UpdatedAt = dlGet.UpdatedAt.Round(time.Second).UTC()
+			assert.Equal(dl, dlGet)
+		})
+
+		t.Run("Count and list", func(t *testing.T) {
+			assert := require.New(t)
+
+			count, err := GetIntegrationDeadLetterCount(context.Background(), ts.tx, app.ID)
+			assert.NoError(err)
+			assert.Equal(1, count)
+
+			items, err := GetIntegrationDeadLetters(context.Background(), ts.tx, app.ID, 10, 0)
+			assert.NoError(err)
+			assert.Len(items, 1)
+			assert.Equal(dl.ID, items[0].ID)
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			dl.Attempts = 4
+			dl.LastError = "timeout"
+			assert.NoError(UpdateIntegrationDeadLetter(context.Background(), ts.tx, &dl))
+
+			dlGet, err := GetIntegrationDeadLetter(context.Background(), ts.tx, dl.ID)
+			assert.NoError(err)
+			assert.Equal(4, dlGet.Attempts)
+			assert.Equal("timeout", dlGet.LastError)
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(DeleteIntegrationDeadLetter(context.Background(), ts.tx, dl.ID))
+			assert.Equal(ErrDoesNotExist, DeleteIntegrationDeadLetter(context.Background(), ts.tx, dl.ID))
+
+			_, err := GetIntegrationDeadLetter(context.Background(), ts.tx, dl.ID)
+			assert.Equal(ErrDoesNotExist, err)
+		})
+
+		t.Run("Delete for application", func(t *testing.T) {
+			assert := require.New(t)
+
+			for i := 0; i < 2; i++ {
+				assert.NoError(CreateIntegrationDeadLetter(context.Background(), ts.tx, &IntegrationDeadLetter{
+					ApplicationID: app.ID,
+					Integration:   "mqtt",
+					EventType:     "join",
+					Event:         []byte{1},
+				}))
+			}
+
+			count, err := DeleteIntegrationDeadLettersForApplicationID(context.Background(), ts.tx, app.ID)
+			assert.NoError(err)
+			assert.Equal(2, count)
+
+			count, err = GetIntegrationDeadLetterCount(context.Background(), ts.tx, app.ID)
+			assert.NoError(err)
+			assert.Equal(0, count)
+		})
+
+		t.Run("Delete before", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(CreateIntegrationDeadLetter(context.Background(), ts.tx, &IntegrationDeadLetter{
+				ApplicationID: app.ID,
+				Integration:   "mqtt",
+				EventType:     "join",
+				Event:         []byte{1},
+			}))
+
+			count, err := DeleteIntegrationDeadLettersBefore(context.Background(), ts.tx, time.Now().Add(-time.Hour))
+			assert.NoError(err)
+			assert.Equal(0, count)
+
+			count, err = DeleteIntegrationDeadLettersBefore(context.Background(), ts.tx, time.Now().Add(time.Minute))
+			assert.NoError(err)
+			assert.Equal(1, count)
+
+			count, err = GetIntegrationDeadLetterCount(context.Background(), ts.tx, app.ID)
+			assert.NoError(err)
+			assert.Equal(0, count)
+		})
+	})
+}
@@ -3,9 +3,12 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/gofrs/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -16,16 +19,96 @@ import (
 
 // Integration represents an integration.
 type Integration struct {
-	ID            int64           `db:"id"`
-	CreatedAt     time.Time       `db:"created_at"`
-	UpdatedAt     time.Time       `db:"updated_at"`
-	ApplicationID int64           `db:"application_id"`
-	Kind          string          `db:"kind"`
-	Settings      json.RawMessage `db:"settings"`
+	ID            int64             `db:"id"`
+	CreatedAt     time.Time         `db:"created_at"`
+	UpdatedAt     time.Time         `db:"updated_at"`
+	ApplicationID int64             `db:"application_id"`
+	Kind          string            `db:"kind"`
+	Settings      json.RawMessage   `db:"settings"`
+	Filter        IntegrationFilter `db:"filter"`
+}
+
+// IntegrationChangeChannel is the Redis pub/sub channel on which the
+// IntegrationChange messages are published.
+const IntegrationChangeChannel = "lora:as:integration:change"
+
+// IntegrationChange is published when an application or organization
+// integration has been created, updated or deleted, or when the application
+// or organization itself has been deleted, so that the integration handlers
+// cached by the (other) instances can be invalidated.
+type IntegrationChange struct {
+	ApplicationID  int64 `json:"applicationID,omitempty"`
+	OrganizationID int64 `json:"organizationID,omitempty"`
+}
+
+// publishIntegrationChange publishes the given IntegrationChange. As the
+// change has already been stored at this point, errors are logged but not
+// returned.
+func publishIntegrationChange(ctx context.Context, c IntegrationChange) {
+	b, err := json.Marshal(c)
+	if err == nil {
+		err = RedisClient().Publish(IntegrationChangeChannel, b).Err()
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"application_id":  c.ApplicationID,
+			"organization_id": c.OrganizationID,
+			"ctx_id":          ctx.Value(logging.ContextIDKey),
+		}).Error("storage: publish integration change error")
+	}
+}
+
+// IntegrationFilter defines the event filter of an integration. An event is
+// only sent to the integration when it matches all the filter fields.
+// Empty fields are not used as filter. Note that the fPort range is only
+// evaluated for uplink events.
+type IntegrationFilter struct {
+	EventTypes      []string          `json:"eventTypes,omitempty"`
+	DeviceTags      map[string]string `json:"deviceTags,omitempty"`
+	DeviceProfileID *uuid.UUID        `json:"deviceProfileID,omitempty"`
+	FPortMin        uint8             `json:"fPortMin,omitempty"`
+	FPortMax        uint8             `json:"fPortMax,omitempty"`
+}
+
+// IsEmpty returns true when none of the filter fields are set.
+func (f IntegrationFilter) IsEmpty() bool {
+	return len(f.EventTypes) == 0 && len(f.DeviceTags) == 0 && f.DeviceProfileID == nil && f.FPortMin == 0 && f.FPortMax == 0
+}
+
+// Validate validates the integration filter.
+func (f IntegrationFilter) Validate() error {
+	if f.FPortMax != 0 && f.FPortMin > f.FPortMax {
+		return ErrIntegrationFilterInvalidFPortRange
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (f IntegrationFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements the sql.Scanner interface.
+func (f *IntegrationFilter) Scan(src interface{}) error {
+	if src == nil {
+		*f = IntegrationFilter{}
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("expected []byte, got %T", src)
+	}
+
+	return json.Unmarshal(b, f)
 }
 
 // CreateIntegration creates the given Integration.
 func CreateIntegration(ctx context.Context, db sqlx.Queryer, i *Integration) error {
+	if err := i.Filter.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
 	now := time.Now()
 	err := sqlx.Get(db, &i.ID, `
 		insert into integration (
@@ -33,13 +116,15 @@ func CreateIntegration(ctx context.Context, db sqlx.Queryer, i *Integration) err
 			updated_at,
 			application_id,
 			kind,
-			settings
-		) values ($1, $2, $3, $4, $5) returning id`,
+			settings,
+			filter
+		) values ($1, $2, $3, $4, $5, $6) returning id`,
 		now,
 		now,
 		i.ApplicationID,
 		i.Kind,
 		i.Settings,
+		i.Filter,
 	)
 	if err != nil {
 		switch err := err.(type) {
@@ -57,6 +142,7 @@ func CreateIntegration(ctx context.Context, db sqlx.Queryer, i *Integration) err
 
 	i.CreatedAt = now
 	i.UpdatedAt = now
+	publishIntegrationChange(ctx, IntegrationChange{ApplicationID: i.ApplicationID})
 	log.WithFields(log.Fields{
 		"id":             i.ID,
 		"kind":           i.Kind,
@@ -112,6 +198,10 @@ func GetIntegrationsForApplicationID(ctx context.Context, db sqlx.Queryer, appli
 
 // UpdateIntegration updates the given Integration.
 func UpdateIntegration(ctx context.Context, db sqlx.Execer, i *Integration) error {
+	if err := i.Filter.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
 	now := time.Now()
 	res, err := db.Exec(`
 		update integration
@@ -119,7 +209,8 @@ func UpdateIntegration(ctx context.Context, db sqlx.Execer, i *Integration) erro
 			updated_at = $2,
 			application_id = $3,
 			kind = $4,
-			settings = $5
+			settings = $5,
+			filter = $6
 		where
 			id = $1`,
 		i.ID,
@@ -127,6 +218,7 @@ func UpdateIntegration(ctx context.Context, db sqlx.Execer, i *Integration) erro
 		i.ApplicationID,
 		i.Kind,
 		i.Settings,
+		i.Filter,
 	)
 
 	if err != nil {
@@ -152,6 +244,7 @@ func UpdateIntegration(ctx context.Context, db sqlx.Execer, i *Integration) erro
 	}
 
 	i.UpdatedAt = now
+	publishIntegrationChange(ctx, IntegrationChange{ApplicationID: i.ApplicationID})
 	log.WithFields(log.Fields{
 		"id":             i.ID,
 		"kind":           i.Kind,
@@ -162,19 +255,17 @@ func UpdateIntegration(ctx context.Context, db sqlx.Execer, i *Integration) erro
 }
 
 // DeleteIntegration deletes the integration matching the given id.
-func DeleteIntegration(ctx context.Context, db sqlx.Execer, id int64) error {
-	res, err := db.Exec("delete from integration where id = $1", id)
+func DeleteIntegration(ctx context.Context, db sqlx.Queryer, id int64) error {
+	var applicationID int64
+	err := sqlx.Get(db, &applicationID, "delete from integration where id = $1 returning application_id", id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDoesNotExist
+		}
 		return errors.Wrap(err, "delete error")
 	}
-	ra, err := res.RowsAffected()
-	if err != nil {
-		return errors.Wrap(err, "get rows affected error")
-	}
-	if ra == 0 {
-		return ErrDoesNotExist
-	}
 
+	publishIntegrationChange(ctx, IntegrationChange{ApplicationID: applicationID})
 	log.WithFields(log.Fields{
 		"id":     id,
 		"ctx_id": ctx.Value(logging.ContextIDKey),
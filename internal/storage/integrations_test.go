@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
@@ -129,6 +130,33 @@ func TestIntegration(t *testing.T) {
 				So(s, ShouldResemble, settings)
 			})
 
+			Convey("Then the filter can be updated", func() {
+				dpID, err := uuid.NewV4()
+				So(err, ShouldBeNil)
+
+				intgr.Filter = IntegrationFilter{
+					EventTypes:      []string{"up"},
+					DeviceTags:      map[string]string{"type": "meter"},
+					DeviceProfileID: &dpID,
+					FPortMin:        1,
+					FPortMax:        10,
+				}
+				So(UpdateIntegration(context.Background(), db, &intgr), ShouldBeNil)
+
+				i, err := GetIntegration(context.Background(), db, intgr.ID)
+				So(err, ShouldBeNil)
+				So(i.Filter, ShouldResemble, intgr.Filter)
+			})
+
+			Convey("Then an invalid filter fPort range is rejected", func() {
+				intgr.Filter = IntegrationFilter{
+					FPortMin: 20,
+					FPortMax: 10,
+				}
+				err := UpdateIntegration(context.Background(), db, &intgr)
+				So(errors.Cause(err), ShouldEqual, ErrIntegrationFilterInvalidFPortRange)
+			})
+
 			Convey("Then it can be deleted", func() {
 				So(DeleteIntegration(context.Background(), db, intgr.ID), ShouldBeNil)
 				_, err := GetIntegration(context.Background(), db, intgr.ID)
@@ -25,6 +25,10 @@ type Organization struct {
 	CanHaveGateways bool      `db:"can_have_gateways"`
 	MaxDeviceCount  int       `db:"max_device_count"`
 	MaxGatewayCount int       `db:"max_gateway_count"`
+
+	// RequireMFAForAdmins requires organization admins to use a second
+	// authentication factor.
+	RequireMFAForAdmins bool `db:"require_mfa_for_admins"`
 }
 
 // Validate validates the data of the Organization.
@@ -62,8 +66,9 @@ func CreateOrganization(ctx context.Context, db sqlx.Queryer, org *Organization)
 			display_name,
 			can_have_gateways,
 			max_gateway_count,
-			max_device_count
-		) values ($1, $2, $3, $4, $5, $6, $7) returning id`,
+			max_device_count,
+			require_mfa_for_admins
+		) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`,
 		now,
 		now,
 		org.Name,
@@ -71,6 +76,7 @@ func CreateOrganization(ctx context.Context, db sqlx.Queryer, org *Organization)
 		org.CanHaveGateways,
 		org.MaxGatewayCount,
 		org.MaxDeviceCount,
+		org.RequireMFAForAdmins,
 	)
 	if err != nil {
 		return handlePSQLError(Insert, err, "insert error")
@@ -211,7 +217,8 @@ func UpdateOrganization(ctx context.Context, db sqlx.Execer, org *Organization)
 			can_have_gateways = $4,
 			updated_at = $5,
 			max_gateway_count = $6,
-			max_device_count = $7
+			max_device_count = $7,
+			require_mfa_for_admins = $8
 		where id = $1`,
 		org.ID,
 		org.Name,
@@ -220,6 +227,7 @@ func UpdateOrganization(ctx context.Context, db sqlx.Execer, org *Organization)
 		now,
 		org.MaxGatewayCount,
 		org.MaxDeviceCount,
+		org.RequireMFAForAdmins,
 	)
 
 	if err != nil {
@@ -271,6 +279,7 @@ func DeleteOrganization(ctx context.Context, db sqlx.Ext, id int64) error {
 		return ErrDoesNotExist
 	}
 
+	publishIntegrationChange(ctx, IntegrationChange{OrganizationID: id})
 	log.WithFields(log.Fields{
 		"id":     id,
 		"ctx_id": ctx.Value(logging.ContextIDKey),
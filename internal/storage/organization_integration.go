@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+)
+
+// OrganizationIntegration represents an integration which is used by all
+// the applications of an organization. An application integration of the
+// same kind overrides the organization integration for that application.
+type OrganizationIntegration struct {
+	ID             int64             `db:"id"`
+	CreatedAt      time.Time         `db:"created_at"`
+	UpdatedAt      time.Time         `db:"updated_at"`
+	OrganizationID int64             `db:"organization_id"`
+	Kind           string            `db:"kind"`
+	Settings       json.RawMessage   `db:"settings"`
+	Filter         IntegrationFilter `db:"filter"`
+}
+
+// Integration returns the organization integration as Integration, so that
+// it can be set up in the same way as an application integration.
+func (i OrganizationIntegration) Integration() Integration {
+	return Integration{
+		ID:        i.ID,
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+		Kind:      i.Kind,
+		Settings:  i.Settings,
+		Filter:    i.Filter,
+	}
+}
+
+// CreateOrganizationIntegration creates the given organization integration.
+func CreateOrganizationIntegration(ctx context.Context, db sqlx.Queryer, i *OrganizationIntegration) error {
+	if err := i.Filter.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
+	now := time.Now()
+	err := sqlx.Get(db, &i.ID, `
+		insert into organization_integration (
+			created_at,
+			updated_at,
+			organization_id,
+			kind,
+			settings,
+			filter
+		) values ($1, $2, $3, $4, $5, $6) returning id`,
+		now,
+		now,
+		i.OrganizationID,
+		i.Kind,
+		i.Settings,
+		i.Filter,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	i.CreatedAt = now
+	i.UpdatedAt = now
+	publishIntegrationChange(ctx, IntegrationChange{OrganizationID: i.OrganizationID})
+	log.WithFields(log.Fields{
+		"id":              i.ID,
+		"kind":            i.Kind,
+		"organization_id": i.OrganizationID,
+		"ctx_id":          ctx.Value(logging.ContextIDKey),
+	}).Info("organization integration created")
+	return nil
+}
+
+// GetOrganizationIntegration returns the organization integration for the
+// given organization id and kind.
+func GetOrganizationIntegration(ctx context.Context, db sqlx.Queryer, organizationID int64, kind string) (OrganizationIntegration, error) {
+	var i OrganizationIntegration
+	err := sqlx.Get(db, &i, "select * from organization_integration where organization_id = $1 and kind = $2", organizationID, kind)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return i, ErrDoesNotExist
+		}
+		return i, errors.Wrap(err, "select error")
+	}
+	return i, nil
+}
+
+// GetOrganizationIntegrationsForOrganizationID returns the integrations for
+// the given organization id.
+func GetOrganizationIntegrationsForOrganizationID(ctx context.Context, db sqlx.Queryer, organizationID int64) ([]OrganizationIntegration, error) {
+	var is []OrganizationIntegration
+	err := sqlx.Select(db, &is, `
+		select *
+		from organization_integration
+		where organization_id = $1
+		order by kind`,
+		organizationID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "select error")
+	}
+	return is, nil
+}
+
+// GetOrganizationIntegrationsForApplicationID returns the integrations of
+// the organization to which the given application belongs, excluding the
+// kinds for which the application has its own integration.
+func GetOrganizationIntegrationsForApplicationID(ctx context.Context, db sqlx.Queryer, applicationID int64) ([]OrganizationIntegration, error) {
+	var is []OrganizationIntegration
+	err := sqlx.Select(db, &is, `
+		select oi.*
+		from organization_integration oi
+		inner join application a
+			on a.organization_id = oi.organization_id
+		where
+			a.id = $1
+			and not exists (
+				select 1
+				from integration i
+				where
+					i.application_id = a.id
+					and i.kind = oi.kind
+			)
+		order by oi.kind`,
+		applicationID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "select error")
+	}
+	return is, nil
+}
+
+// UpdateOrganizationIntegration updates the given organization integration.
+func UpdateOrganizationIntegration(ctx context.Context, db sqlx.Execer, i *OrganizationIntegration) error {
+	if err := i.Filter.Validate(); err != nil {
+		return errors.Wrap(err, "validate error")
+	}
+
+	now := time.Now()
+	res, err := db.Exec(`
+		update organization_integration
+		set
+			updated_at = $2,
+			settings = $3,
+			filter = $4
+		where
+			id = $1`,
+		i.ID,
+		now,
+		i.Settings,
+		i.Filter,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	i.UpdatedAt = now
+	publishIntegrationChange(ctx, IntegrationChange{OrganizationID: i.OrganizationID})
+	log.WithFields(log.Fields{
+		"id":              i.ID,
+		"kind":            i.Kind,
+		"organization_id": i.OrganizationID,
+		"ctx_id":          ctx.Value(logging.ContextIDKey),
+	}).Info("organization integration updated")
+	return nil
+}
+
+// DeleteOrganizationIntegration deletes the organization integration
+// matching the given id.
+func DeleteOrganizationIntegration(ctx context.Context, db sqlx.Queryer, id int64) error {
+	var organizationID int64
+	err := sqlx.Get(db, &organizationID, "delete from organization_integration where id = $1 returning organization_id", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDoesNotExist
+		}
+		return errors.Wrap(err, "delete error")
+	}
+
+	publishIntegrationChange(ctx, IntegrationChange{OrganizationID: organizationID})
+	log.WithFields(log.Fields{
+		"id":     id,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("organization integration deleted")
+	return nil
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver"
+	"github.com/brocaar/chirpstack-application-server/internal/backend/networkserver/mock"
+)
+
+func (ts *StorageTestSuite) TestOrganizationIntegration() {
+	assert := require.New(ts.T())
+
+	nsClient := mock.NewClient()
+	networkserver.SetPool(mock.NewPool(nsClient))
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.Tx(), &org))
+
+	n := NetworkServer{
+		Name:   "test-ns",
+		Server: "test-ns:1234",
+	}
+	assert.NoError(CreateNetworkServer(context.Background(), ts.Tx(), &n))
+
+	sp := ServiceProfile{
+		OrganizationID:  org.ID,
+		NetworkServerID: n.ID,
+		Name:            "test-sp",
+	}
+	assert.NoError(CreateServiceProfile(context.Background(), ts.Tx(), &sp))
+	spID, err := uuid.FromBytes(sp.ServiceProfile.Id)
+	assert.NoError(err)
+
+	app := Application{
+		OrganizationID:   org.ID,
+		Name:             "test-app",
+		ServiceProfileID: spID,
+	}
+	assert.NoError(CreateApplication(context.Background(), ts.Tx(), &app))
+
+	ts.T().Run("Create", func(t *testing.T) {
+		assert := require.New(t)
+
+		oi := OrganizationIntegration{
+			OrganizationID: org.ID,
+			Kind:           "HTTP",
+			Settings:       []byte(`{"dataUpURL": "http://localhost/rx"}`),
+			Filter: IntegrationFilter{
+				EventTypes: []string{"up"},
+			},
+		}
+		assert.NoError(CreateOrganizationIntegration(context.Background(), ts.Tx(), &oi))
+
+		t.Run("Get", func(t *testing.T) {
+			assert := require.New(t)
+
+			oiGet, err := GetOrganizationIntegration(context.Background(), ts.Tx(), org.ID, "HTTP")
+			assert.NoError(err)
+			assert.Equal(oi.ID, oiGet.ID)
+			assert.Equal(oi.Filter, oiGet.Filter)
+			assert.JSONEq(string(oi.Settings), string(oiGet.Settings))
+
+			items, err := GetOrganizationIntegrationsForOrganizationID(context.Background(), ts.Tx(), org.ID)
+			assert.NoError(err)
+			assert.Len(items, 1)
+		})
+
+		t.Run("Get for application", func(t *testing.T) {
+			assert := require.New(t)
+
+			items, err := GetOrganizationIntegrationsForApplicationID(context.Background(), ts.Tx(), app.ID)
+			assert.NoError(err)
+			assert.Len(items, 1)
+			assert.Equal(oi.ID, items[0].ID)
+
+			t.Run("Application override", func(t *testing.T) {
+				assert := require.New(t)
+
+				appint := Integration{
+					ApplicationID: app.ID,
+					Kind:          "HTTP",
+				}
+				assert.NoError(CreateIntegration(context.Background(), ts.Tx(), &appint))
+
+				items, err := GetOrganizationIntegrationsForApplicationID(context.Background(), ts.Tx(), app.ID)
+				assert.NoError(err)
+				assert.Len(items, 0)
+
+				assert.NoError(DeleteIntegration(context.Background(), ts.Tx(), appint.ID))
+			})
+		})
+
+		t.Run("Update", func(t *testing.T) {
+			assert := require.New(t)
+
+			oi.Settings = []byte(`{"dataUpURL": "http://localhost/uplink"}`)
+			oi.Filter = IntegrationFilter{}
+			assert.NoError(UpdateOrganizationIntegration(context.Background(), ts.Tx(), &oi))
+
+			oiGet, err := GetOrganizationIntegration(context.Background(), ts.Tx(), org.ID, "HTTP")
+			assert.NoError(err)
+			assert.Equal(IntegrationFilter{}, oiGet.Filter)
+			assert.JSONEq(string(oi.Settings), string(oiGet.Settings))
+		})
+
+		t.Run("Delete", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(DeleteOrganizationIntegration(context.Background(), ts.Tx(), oi.ID))
+			assert.Equal(ErrDoesNotExist, errors.Cause(DeleteOrganizationIntegration(context.Background(), ts.Tx(), oi.ID)))
+
+			_, err := GetOrganizationIntegration(context.Background(), ts.Tx(), org.ID, "HTTP")
+			assert.Equal(ErrDoesNotExist, errors.Cause(err))
+		})
+	})
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+	"github.com/brocaar/lorawan"
+)
+
+// RemoteMulticastClassBSession defines a remote multicast-setup Class-B session record.
+type RemoteMulticastClassBSession struct {
+	DevEUI           lorawan.EUI64 `db:"dev_eui"`
+	MulticastGroupID uuid.UUID     `db:"multicast_group_id"`
+	CreatedAt        time.Time     `db:"created_at"`
+	UpdatedAt        time.Time     `db:"updated_at"`
+	McGroupID        int           `db:"mc_group_id"`
+	SessionTime      time.Time     `db:"session_time"`
+	SessionTimeOut   int           `db:"session_time_out"`
+	Periodicity      int           `db:"periodicity"`
+	DLFrequency      int           `db:"dl_frequency"`
+	DR               int           `db:"dr"`
+	StateProvisioned bool          `db:"state_provisioned"`
+	RetryAfter       time.Time     `db:"retry_after"`
+	RetryCount       int           `db:"retry_count"`
+	RetryInterval    time.Duration `db:"retry_interval"`
+}
+
+// CreateRemoteMulticastClassBSession creates the given multicast Class-B session.
+func CreateRemoteMulticastClassBSession(ctx context.Context, db sqlx.Ext, sess *RemoteMulticastClassBSession) error {
+	now := time.Now()
+	sess.CreatedAt = now
+	sess.UpdatedAt = now
+
+	_, err := db.Exec(`
+		insert into remote_multicast_class_b_session (
+			dev_eui,
+			multicast_group_id,
+			created_at,
+			updated_at,
+			mc_group_id,
+			session_time,
+			session_time_out,
+			periodicity,
+			dl_frequency,
+			dr,
+			state_provisioned,
+			retry_after,
+			retry_count,
+			retry_interval
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		sess.DevEUI,
+		sess.MulticastGroupID,
+		sess.CreatedAt,
+		sess.UpdatedAt,
+		sess.McGroupID,
+		sess.SessionTime,
+		sess.SessionTimeOut,
+		sess.Periodicity,
+		sess.DLFrequency,
+		sess.DR,
+		sess.StateProvisioned,
+		sess.RetryAfter,
+		sess.RetryCount,
+		sess.RetryInterval,
+	)
+	if err != nil {
+		return handlePSQLError(Insert, err, "insert error")
+	}
+
+	log.WithFields(log.Fields{
+		"dev_eui":            sess.DevEUI,
+		"multicast_group_id": sess.MulticastGroupID,
+		"ctx_id":             ctx.Value(logging.ContextIDKey),
+	}).Info("remote multicast class-b session created")
+
+	return nil
+}
+
+// GetRemoteMulticastClassBSession returns the multicast Class-B session given
+// a DevEUI and multicast-group ID.
+func GetRemoteMulticastClassBSession(ctx context.Context, db sqlx.Queryer, devEUI lorawan.EUI64, multicastGroupID uuid.UUID, forUpdate bool) (RemoteMulticastClassBSession, error) {
+	var fu string
+	if forUpdate {
+		fu = " for update"
+	}
+
+	var sess RemoteMulticastClassBSession
+	if err := sqlx.Get(db, &sess, `
+		select
+			*
+		from
+			remote_multicast_class_b_session
+		where
+			dev_eui = $1
+			and multicast_group_id = $2`+fu,
+		devEUI,
+		multicastGroupID,
+	); err != nil {
+		return sess, handlePSQLError(Select, err, "select error")
+	}
+
+	return sess, nil
+}
+
+// GetRemoteMulticastClassBSessionByGroupID returns the multicast Class-B session given
+// a DevEUI and McGroupID.
+func GetRemoteMulticastClassBSessionByGroupID(ctx context.Context, db sqlx.Queryer, devEUI lorawan.EUI64, mcGroupID int, forUpdate bool) (RemoteMulticastClassBSession, error) {
+	var fu string
+	if forUpdate {
+		fu = " for update"
+	}
+
+	var sess RemoteMulticastClassBSession
+	if err := sqlx.Get(db, &sess, `
+		select
+			*
+		from
+			remote_multicast_class_b_session
+		where
+			dev_eui = $1
+			and mc_group_id = $2`+fu,
+		devEUI,
+		mcGroupID,
+	); err != nil {
+		return sess, handlePSQLError(Select, err, "select error")
+	}
+
+	return sess, nil
+}
+
+// GetPendingRemoteMulticastClassBSessions returns a slice of pending remote
+// multicast Class-B sessions.
+func GetPendingRemoteMulticastClassBSessions(ctx context.Context, db sqlx.Queryer, limit, maxRetryCount int) ([]RemoteMulticastClassBSession, error) {
+	var items []RemoteMulticastClassBSession
+
+	if err := sqlx.Select(db, &items, `
+		select
+			sess.*
+		from
+			remote_multicast_class_b_session sess
+		inner join
+			remote_multicast_setup ms
+			on
+				sess.dev_eui = ms.dev_eui
+				and sess.multicast_group_id = ms.multicast_group_id
+				and sess.mc_group_id = ms.mc_group_id
+		where
+			ms.state_provisioned = true
+			and ms.state = $3
+			and sess.state_provisioned = false
+			and sess.retry_count < $1
+			and sess.retry_after < $2
+		limit $4
+		for update
+		skip locked`,
+		maxRetryCount,
+		time.Now(),
+		RemoteMulticastSetupSetup,
+		limit,
+	); err != nil {
+		return nil, handlePSQLError(Select, err, "select error")
+	}
+
+	return items, nil
+}
+
+// UpdateRemoteMulticastClassBSession updates the given remote multicast
+// Class-B session.
+func UpdateRemoteMulticastClassBSession(ctx context.Context, db sqlx.Ext, sess *RemoteMulticastClassBSession) error {
+	sess.UpdatedAt = time.Now()
+
+	res, err := db.Exec(`
+		update
+			remote_multicast_class_b_session
+		set
+			updated_at = $3,
+			mc_group_id = $4,
+			session_time = $5,
+			session_time_out = $6,
+			periodicity = $7,
+			dl_frequency = $8,
+			dr = $9,
+			state_provisioned = $10,
+			retry_after = $11,
+			retry_count = $12,
+			retry_interval = $13
+		where
+			dev_eui = $1
+			and multicast_group_id = $2`,
+		sess.DevEUI,
+		sess.MulticastGroupID,
+		sess.UpdatedAt,
+		sess.McGroupID,
+		sess.SessionTime,
+		sess.SessionTimeOut,
+		sess.Periodicity,
+		sess.DLFrequency,
+		sess.DR,
+		sess.StateProvisioned,
+		sess.RetryAfter,
+		sess.RetryCount,
+		sess.RetryInterval,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"dev_eui":            sess.DevEUI,
+		"multicast_group_id": sess.MulticastGroupID,
+		"ctx_id":             ctx.Value(logging.ContextIDKey),
+	}).Info("remote multicast class-b session updated")
+	return nil
+}
+
+// DeleteRemoteMulticastClassBSession deletes the multicast Class-B session
+// given a DevEUI and multicast-group ID.
+func DeleteRemoteMulticastClassBSession(ctx context.Context, db sqlx.Ext, devEUI lorawan.EUI64, multicastGroupID uuid.UUID) error {
+	res, err := db.Exec(`
+		delete from remote_multicast_class_b_session
+		where
+			dev_eui = $1
+			and multicast_group_id = $2`,
+		devEUI,
+		multicastGroupID,
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+	log.WithFields(log.Fields{
+		"dev_eui":            devEUI,
+		"multicast_group_id": multicastGroupID,
+		"ctx_id":             ctx.Value(logging.ContextIDKey),
+	}).Info("remote multicast class-b session deleted")
+	return nil
+}
@@ -28,6 +28,9 @@ func Setup(c config.Config) error {
 
 	jwtsecret = []byte(c.ApplicationServer.ExternalAPI.JWTSecret)
 	HashIterations = c.General.PasswordHashIterations
+	if c.ApplicationServer.UserAuthentication.MFA.ChallengeTTL != 0 {
+		mfaChallengeTTL = c.ApplicationServer.UserAuthentication.MFA.ChallengeTTL
+	}
 
 	if err := applicationServerID.UnmarshalText([]byte(c.ApplicationServer.ID)); err != nil {
 		return errors.Wrap(err, "decode application_server.id error")
@@ -61,24 +64,10 @@ func Setup(c config.Config) error {
 	if err != nil {
 		return errors.Wrap(err, "parse redis url error")
 	}
-	opt.PoolSize = c.Redis.PoolSize
-	if c.Redis.Cluster {
-		redisClient = redis.NewClusterClient(&redis.ClusterOptions{
-			Addrs:    []string{opt.Addr},
-			PoolSize: opt.PoolSize,
-			Password: opt.Password,
-		})
-	} else if c.Redis.MasterName != "" {
-		redisClient = redis.NewFailoverClient(&redis.FailoverOptions{
-			MasterName:       c.Redis.MasterName,
-			SentinelAddrs:    []string{opt.Addr},
-			SentinelPassword: opt.Password,
-			DB:               opt.DB,
-			PoolSize:         opt.PoolSize,
-		})
-	} else {
-		redisClient = redis.NewClient(opt)
-	}
+	redisOptions = opt
+	redisCluster = c.Redis.Cluster
+	redisMasterName = c.Redis.MasterName
+	redisClient = NewRedisClient(c.Redis.PoolSize)
 
 	log.Info("storage: connecting to PostgreSQL database")
 	d, err := sqlx.Open("postgres", c.PostgreSQL.DSN)
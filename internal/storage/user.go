@@ -47,6 +47,9 @@ type User struct {
 	EmailOld      string    `db:"email_old"`
 	Note          string    `db:"note"`
 	ExternalID    *string   `db:"external_id"` // must be pointer for unique index
+	TOTPSecret    *string   `db:"totp_secret"`
+	TOTPEnabled   bool      `db:"totp_enabled"`
+	TOTPLastStep  int64     `db:"totp_last_step"`
 }
 
 // Validate validates the user data.
@@ -346,6 +349,17 @@ func DeleteUser(ctx context.Context, db sqlx.Execer, id int64) error {
 // LoginUserByPassword returns a JWT token for the user matching the given email
 // and password combination.
 func LoginUserByPassword(ctx context.Context, db sqlx.Queryer, email string, password string) (string, error) {
+	user, err := GetUserByEmailAndPassword(ctx, db, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	return GetUserToken(user)
+}
+
+// GetUserByEmailAndPassword returns the user matching the given email and
+// password combination.
+func GetUserByEmailAndPassword(ctx context.Context, db sqlx.Queryer, email string, password string) (User, error) {
 	// get the user by email
 	var user User
 	err := sqlx.Get(db, &user, `
@@ -358,17 +372,17 @@ func LoginUserByPassword(ctx context.Context, db sqlx.Queryer, email string, pas
 	`, email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", ErrInvalidUsernameOrPassword
+			return user, ErrInvalidUsernameOrPassword
 		}
-		return "", errors.Wrap(err, "select error")
+		return user, errors.Wrap(err, "select error")
 	}
 
 	// Compare the passed in password with the hash in the database.
 	if !hashCompare(password, user.PasswordHash) {
-		return "", ErrInvalidUsernameOrPassword
+		return User{}, ErrInvalidUsernameOrPassword
 	}
 
-	return GetUserToken(user)
+	return user, nil
 }
 
 // GetProfile returns the user profile (user, applications and organizations
@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v7"
+	"github.com/gofrs/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/brocaar/chirpstack-application-server/internal/logging"
+)
+
+// RecoveryCodeCount defines the number of recovery codes generated for a
+// user.
+const RecoveryCodeCount = 10
+
+// mfaChallengeSubject defines the subject of the MFA challenge token. As
+// this differs from the user subject, the challenge token can not be used
+// to access the API.
+const mfaChallengeSubject = "mfa_challenge"
+
+// mfaChallengeMaxAttempts defines the max. number of codes that can be
+// presented for a single challenge token.
+const mfaChallengeMaxAttempts = 5
+
+const mfaChallengeAttemptsKeyTempl = "lora:as:mfa:challenge:%s:attempts"
+
+// mfaChallengeTTL defines the TTL of the MFA challenge token.
+var mfaChallengeTTL = 5 * time.Minute
+
+// mfaMaxFailures defines the max. number of invalid second factors that can
+// be presented for a user, across all challenge tokens, within
+// mfaFailuresTTL. When reached, the second factor is rejected until no
+// failures have been registered for mfaFailuresTTL.
+const mfaMaxFailures = 10
+
+const mfaFailuresKeyTempl = "lora:as:mfa:user:%d:failures"
+
+// mfaFailuresTTL defines the duration for which the failures are counted.
+var mfaFailuresTTL = 15 * time.Minute
+
+// recoveryCodeEncoding is used to encode the random recovery codes. It
+// excludes padding and uses lowercase characters for readability.
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// SetUserTOTPSecret stores the given TOTP secret for the user. The second
+// factor is not enabled until EnableUserTOTP is called, which must only
+// happen after the user has confirmed the enrollment with a valid code.
+func SetUserTOTPSecret(ctx context.Context, db sqlx.Execer, userID int64, secret string) error {
+	res, err := db.Exec(`
+		update "user"
+		set
+			totp_secret = $2,
+			totp_enabled = false,
+			totp_last_step = 0,
+			updated_at = $3
+		where
+			id = $1`,
+		userID,
+		secret,
+		time.Now(),
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     userID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("storage: user totp secret set")
+
+	return nil
+}
+
+// EnableUserTOTP enables the TOTP second factor for the given user. The
+// step is the time-step of the code used to confirm the enrollment.
+func EnableUserTOTP(ctx context.Context, db sqlx.Execer, userID int64, step int64) error {
+	res, err := db.Exec(`
+		update "user"
+		set
+			totp_enabled = true,
+			totp_last_step = $2,
+			updated_at = $3
+		where
+			id = $1
+			and totp_secret is not null`,
+		userID,
+		step,
+		time.Now(),
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	log.WithFields(log.Fields{
+		"id":     userID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("storage: user totp enabled")
+
+	return nil
+}
+
+// DisableUserTOTP disables the TOTP second factor for the given user and
+// removes the secret and recovery codes.
+func DisableUserTOTP(ctx context.Context, db sqlx.Execer, userID int64) error {
+	res, err := db.Exec(`
+		update "user"
+		set
+			totp_secret = null,
+			totp_enabled = false,
+			totp_last_step = 0,
+			updated_at = $2
+		where
+			id = $1`,
+		userID,
+		time.Now(),
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrDoesNotExist
+	}
+
+	_, err = db.Exec(`
+		delete from
+			user_recovery_code
+		where
+			user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return handlePSQLError(Delete, err, "delete error")
+	}
+
+	log.WithFields(log.Fields{
+		"id":     userID,
+		"ctx_id": ctx.Value(logging.ContextIDKey),
+	}).Info("storage: user totp disabled")
+
+	return nil
+}
+
+// UpdateUserTOTPLastStep stores the time-step of the last used TOTP code.
+// It returns ErrInvalidMFACode when the given step is not after the stored
+// step, which means that the code has already been used.
+func UpdateUserTOTPLastStep(ctx context.Context, db sqlx.Execer, userID int64, step int64) error {
+	res, err := db.Exec(`
+		update "user"
+		set
+			totp_last_step = $2
+		where
+			id = $1
+			and totp_last_step < $2`,
+		userID,
+		step,
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// CreateUserRecoveryCodes replaces the recovery codes of the given user by
+// RecoveryCodeCount new codes. The plain-text codes are returned, only
+// their hashes are stored. As the codes are random and of sufficient
+// length, a single SHA-256 round is used instead of the password hash.
+func CreateUserRecoveryCodes(ctx context.Context, db sqlx.Execer, userID int64) ([]string, error) {
+	_, err := db.Exec(`
+		delete from
+			user_recovery_code
+		where
+			user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return nil, handlePSQLError(Delete, err, "delete error")
+	}
+
+	now := time.Now()
+	var codes []string
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Wrap(err, "read random bytes error")
+		}
+		s := recoveryCodeEncoding.EncodeToString(b)
+		code := s[:8] + "-" + s[8:]
+
+		_, err := db.Exec(`
+			insert into user_recovery_code (
+				created_at,
+				user_id,
+				code_hash
+			) values ($1, $2, $3)`,
+			now,
+			userID,
+			recoveryCodeHash(code),
+		)
+		if err != nil {
+			return nil, handlePSQLError(Insert, err, "insert error")
+		}
+
+		codes = append(codes, code)
+	}
+
+	log.WithFields(log.Fields{
+		"user_id": userID,
+		"ctx_id":  ctx.Value(logging.ContextIDKey),
+	}).Info("storage: user recovery codes created")
+
+	return codes, nil
+}
+
+// UseUserRecoveryCode marks the given recovery code of the user as used.
+// It returns ErrInvalidMFACode when the code does not match an unused
+// recovery code.
+func UseUserRecoveryCode(ctx context.Context, db sqlx.Execer, userID int64, code string) error {
+	res, err := db.Exec(`
+		update user_recovery_code
+		set
+			used_at = $3
+		where
+			user_id = $1
+			and code_hash = $2
+			and used_at is null`,
+		userID,
+		recoveryCodeHash(code),
+		time.Now(),
+	)
+	if err != nil {
+		return handlePSQLError(Update, err, "update error")
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "get rows affected error")
+	}
+	if ra == 0 {
+		return ErrInvalidMFACode
+	}
+
+	log.WithFields(log.Fields{
+		"user_id": userID,
+		"ctx_id":  ctx.Value(logging.ContextIDKey),
+	}).Info("storage: user recovery code used")
+
+	return nil
+}
+
+// GetUserRecoveryCodeCount returns the number of unused recovery codes of
+// the given user.
+func GetUserRecoveryCodeCount(ctx context.Context, db sqlx.Queryer, userID int64) (int, error) {
+	var count int
+	err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			user_recovery_code
+		where
+			user_id = $1
+			and used_at is null`,
+		userID,
+	)
+	if err != nil {
+		return 0, handlePSQLError(Select, err, "select error")
+	}
+
+	return count, nil
+}
+
+// IsUserMFARequired returns true when the given user is required to use a
+// second factor. This is the case when the user is an admin of an
+// organization which requires MFA for its admins. When forAdmins is set,
+// this returns true for every global or organization admin.
+func IsUserMFARequired(ctx context.Context, db sqlx.Queryer, u User, forAdmins bool) (bool, error) {
+	if forAdmins && u.IsAdmin {
+		return true, nil
+	}
+
+	var count int
+	err := sqlx.Get(db, &count, `
+		select
+			count(*)
+		from
+			organization_user ou
+		inner join organization o
+			on o.id = ou.organization_id
+		where
+			ou.user_id = $1
+			and ou.is_admin = true
+			and (o.require_mfa_for_admins = true or $2 = true)`,
+		u.ID,
+		forAdmins,
+	)
+	if err != nil {
+		return false, handlePSQLError(Select, err, "select error")
+	}
+
+	return count != 0, nil
+}
+
+// GetUserMFAChallengeToken returns a short-lived token for the given user,
+// which must be presented together with the second factor to obtain the
+// user (session) token.
+func GetUserMFAChallengeToken(u User) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Wrap(err, "new uuid error")
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "chirpstack-application-server",
+		"aud": "chirpstack-application-server",
+		"nbf": now.Unix(),
+		"exp": now.Add(mfaChallengeTTL).Unix(),
+		"sub": mfaChallengeSubject,
+		"jti": id.String(),
+		"id":  u.ID,
+	})
+
+	jwt, err := token.SignedString(jwtsecret)
+	if err != nil {
+		return jwt, errors.Wrap(err, "get jwt signed string error")
+	}
+	return jwt, nil
+}
+
+// GetUserIDFromMFAChallengeToken validates the given MFA challenge token
+// and returns the ID of the user. Each call counts as an attempt, after
+// mfaChallengeMaxAttempts attempts the token is rejected.
+func GetUserIDFromMFAChallengeToken(ctx context.Context, tokenStr string) (int64, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["alg"] != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtsecret, nil
+	})
+	if err != nil {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	if sub, _ := claims["sub"].(string); sub != mfaChallengeSubject {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	jti, _ := claims["jti"].(string)
+	id, ok := claims["id"].(float64)
+	if !ok || jti == "" {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	key := fmt.Sprintf(mfaChallengeAttemptsKeyTempl, jti)
+	pipe := RedisClient().TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.PExpire(key, mfaChallengeTTL)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, errors.Wrap(err, "redis exec error")
+	}
+
+	if incr.Val() > mfaChallengeMaxAttempts {
+		log.WithFields(log.Fields{
+			"user_id": int64(id),
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warning("storage: max mfa challenge attempts exceeded")
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	return int64(id), nil
+}
+
+// ValidateUserMFAFailures returns ErrMFATooManyFailures when the max.
+// number of invalid second factors has been reached for the given user.
+func ValidateUserMFAFailures(ctx context.Context, userID int64) error {
+	count, err := RedisClient().Get(fmt.Sprintf(mfaFailuresKeyTempl, userID)).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return nil
+		}
+		return errors.Wrap(err, "redis get error")
+	}
+
+	if count >= mfaMaxFailures {
+		log.WithFields(log.Fields{
+			"user_id": userID,
+			"ctx_id":  ctx.Value(logging.ContextIDKey),
+		}).Warning("storage: max mfa failures exceeded")
+		return ErrMFATooManyFailures
+	}
+
+	return nil
+}
+
+// RegisterUserMFAFailure increments the number of invalid second factors
+// presented for the given user.
+func RegisterUserMFAFailure(ctx context.Context, userID int64) error {
+	key := fmt.Sprintf(mfaFailuresKeyTempl, userID)
+	pipe := RedisClient().TxPipeline()
+	pipe.Incr(key)
+	pipe.PExpire(key, mfaFailuresTTL)
+	if _, err := pipe.Exec(); err != nil {
+		return errors.Wrap(err, "redis exec error")
+	}
+
+	return nil
+}
+
+// ResetUserMFAFailures resets the number of invalid second factors
+// presented for the given user.
+func ResetUserMFAFailures(ctx context.Context, userID int64) error {
+	if err := RedisClient().Del(fmt.Sprintf(mfaFailuresKeyTempl, userID)).Err(); err != nil {
+		return errors.Wrap(err, "redis del error")
+	}
+
+	return nil
+}
+
+// recoveryCodeHash returns the hash of the normalized recovery code.
+func recoveryCodeHash(code string) []byte {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	h := sha256.Sum256([]byte(code))
+	return h[:]
+}
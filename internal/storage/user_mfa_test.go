@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func (ts *StorageTestSuite) TestUserMFA() {
+	assert := require.New(ts.T())
+
+	org := Organization{
+		Name: "test-org",
+	}
+	assert.NoError(CreateOrganization(context.Background(), ts.tx, &org))
+
+	user := User{
+		IsActive: true,
+		Email:    "foo@bar.com",
+	}
+	assert.NoError(CreateUser(context.Background(), ts.tx, &user))
+	assert.NoError(CreateOrganizationUser(context.Background(), ts.tx, org.ID, user.ID, true, false, false))
+
+	ts.T().Run("IsUserMFARequired", func(t *testing.T) {
+		assert := require.New(t)
+
+		required, err := IsUserMFARequired(context.Background(), ts.tx, user, false)
+		assert.NoError(err)
+		assert.False(required)
+
+		required, err = IsUserMFARequired(context.Background(), ts.tx, user, true)
+		assert.NoError(err)
+		assert.True(required)
+
+		org.RequireMFAForAdmins = true
+		assert.NoError(UpdateOrganization(context.Background(), ts.tx, &org))
+
+		required, err = IsUserMFARequired(context.Background(), ts.tx, user, false)
+		assert.NoError(err)
+		assert.True(required)
+	})
+
+	ts.T().Run("TOTP", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(SetUserTOTPSecret(context.Background(), ts.tx, user.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"))
+		assert.NoError(EnableUserTOTP(context.Background(), ts.tx, user.ID, 100))
+
+		u, err := GetUser(context.Background(), ts.tx, user.ID)
+		assert.NoError(err)
+		assert.True(u.TOTPEnabled)
+		assert.Equal("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", *u.TOTPSecret)
+		assert.EqualValues(100, u.TOTPLastStep)
+
+		t.Run("Re-used step", func(t *testing.T) {
+			assert := require.New(t)
+
+			err := UpdateUserTOTPLastStep(context.Background(), ts.tx, user.ID, 100)
+			assert.Equal(ErrInvalidMFACode, errors.Cause(err))
+		})
+
+		t.Run("Next step", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(UpdateUserTOTPLastStep(context.Background(), ts.tx, user.ID, 101))
+		})
+	})
+
+	ts.T().Run("Recovery codes", func(t *testing.T) {
+		assert := require.New(t)
+
+		codes, err := CreateUserRecoveryCodes(context.Background(), ts.tx, user.ID)
+		assert.NoError(err)
+		assert.Len(codes, RecoveryCodeCount)
+
+		count, err := GetUserRecoveryCodeCount(context.Background(), ts.tx, user.ID)
+		assert.NoError(err)
+		assert.Equal(RecoveryCodeCount, count)
+
+		t.Run("Use", func(t *testing.T) {
+			assert := require.New(t)
+
+			assert.NoError(UseUserRecoveryCode(context.Background(), ts.tx, user.ID, codes[0]))
+
+			count, err := GetUserRecoveryCodeCount(context.Background(), ts.tx, user.ID)
+			assert.NoError(err)
+			assert.Equal(RecoveryCodeCount-1, count)
+		})
+
+		t.Run("Use normalized", func(t *testing.T) {
+			assert := require.New(t)
+
+			code := strings.ToUpper(strings.Replace(codes[1], "-", "", -1))
+			assert.NoError(UseUserRecoveryCode(context.Background(), ts.tx, user.ID, code))
+		})
+
+		t.Run("Re-use", func(t *testing.T) {
+			assert := require.New(t)
+
+			err := UseUserRecoveryCode(context.Background(), ts.tx, user.ID, codes[0])
+			assert.Equal(ErrInvalidMFACode, errors.Cause(err))
+		})
+
+		t.Run("Regenerate", func(t *testing.T) {
+			assert := require.New(t)
+
+			_, err := CreateUserRecoveryCodes(context.Background(), ts.tx, user.ID)
+			assert.NoError(err)
+
+			err = UseUserRecoveryCode(context.Background(), ts.tx, user.ID, codes[2])
+			assert.Equal(ErrInvalidMFACode, errors.Cause(err))
+		})
+	})
+
+	ts.T().Run("Challenge token", func(t *testing.T) {
+		assert := require.New(t)
+
+		token, err := GetUserMFAChallengeToken(user)
+		assert.NoError(err)
+
+		for i := 0; i < mfaChallengeMaxAttempts; i++ {
+			id, err := GetUserIDFromMFAChallengeToken(context.Background(), token)
+			assert.NoError(err)
+			assert.Equal(user.ID, id)
+		}
+
+		_, err = GetUserIDFromMFAChallengeToken(context.Background(), token)
+		assert.Equal(ErrInvalidMFAChallenge, errors.Cause(err))
+
+		t.Run("User token", func(t *testing.T) {
+			assert := require.New(t)
+
+			token, err := GetUserToken(user)
+			assert.NoError(err)
+
+			_, err = GetUserIDFromMFAChallengeToken(context.Background(), token)
+			assert.Equal(ErrInvalidMFAChallenge, errors.Cause(err))
+		})
+	})
+
+	ts.T().Run("MFA failures", func(t *testing.T) {
+		assert := require.New(t)
+
+		for i := 0; i < mfaMaxFailures; i++ {
+			assert.NoError(ValidateUserMFAFailures(context.Background(), user.ID))
+			assert.NoError(RegisterUserMFAFailure(context.Background(), user.ID))
+		}
+
+		assert.Equal(ErrMFATooManyFailures, ValidateUserMFAFailures(context.Background(), user.ID))
+
+		assert.NoError(ResetUserMFAFailures(context.Background(), user.ID))
+		assert.NoError(ValidateUserMFAFailures(context.Background(), user.ID))
+	})
+
+	ts.T().Run("DisableUserTOTP", func(t *testing.T) {
+		assert := require.New(t)
+
+		assert.NoError(DisableUserTOTP(context.Background(), ts.tx, user.ID))
+
+		u, err := GetUser(context.Background(), ts.tx, user.ID)
+		assert.NoError(err)
+		assert.False(u.TOTPEnabled)
+		assert.Nil(u.TOTPSecret)
+
+		count, err := GetUserRecoveryCodeCount(context.Background(), ts.tx, user.ID)
+		assert.NoError(err)
+		assert.Equal(0, count)
+	})
+}
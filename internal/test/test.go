@@ -27,8 +27,14 @@ func GetConfig() config.Config {
 	c.ApplicationServer.Integration.MQTT.Server = "tcp://localhost:1883"
 	c.ApplicationServer.ID = "6d5db27e-4ce2-4b2b-b5d7-91f069397978"
 	c.ApplicationServer.Integration.AMQP.EventRoutingKeyTemplate = "application.{{ .ApplicationID }}.device.{{ .DevEUI }}.event.{{ .EventType }}"
+	c.ApplicationServer.Integration.AMQP.CommandRoutingKeyTemplate = "application.{{ .ApplicationID }}.device.{{ .DevEUI }}.command.{{ .CommandType }}"
+	c.ApplicationServer.Integration.AMQP.CommandQueueName = "test-command-queue"
+	c.ApplicationServer.Integration.AMQP.DeadLetterExchangeName = "test-command-dlx"
+	c.ApplicationServer.Integration.AMQP.DeadLetterQueueName = "test-command-dlq"
 	c.ApplicationServer.Integration.Kafka.Topic = "chirpstack_as"
 	c.ApplicationServer.Integration.Kafka.EventKeyTemplate = "application.{{ .ApplicationID }}.device.{{ .DevEUI }}.event.{{ .EventType }}"
+	c.ApplicationServer.Integration.Kafka.CommandTopic = "chirpstack_as_command"
+	c.ApplicationServer.Integration.Kafka.ConsumerGroupID = "chirpstack_as_test"
 
 	if v := os.Getenv("TEST_POSTGRES_DSN"); v != "" {
 		c.PostgreSQL.DSN = v
@@ -0,0 +1,115 @@
+package totp
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the base32 encoding of the RFC 6238 SHA1 test secret
+// "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	// RFC 6238 Appendix B test vectors, truncated to 6 digits.
+	tests := []struct {
+		Time     int64
+		Expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tst := range tests {
+		t.Run(fmt.Sprintf("%d", tst.Time), func(t *testing.T) {
+			assert := require.New(t)
+
+			code, err := GenerateCode(rfcSecret, Step(time.Unix(tst.Time, 0)))
+			assert.NoError(err)
+			assert.Equal(tst.Expected, code)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		Name       string
+		Code       string
+		Time       time.Time
+		ExpectedOK bool
+	}{
+		{
+			Name:       "current step",
+			Code:       "005924",
+			Time:       now,
+			ExpectedOK: true,
+		},
+		{
+			Name:       "previous step",
+			Code:       "005924",
+			Time:       now.Add(period * time.Second),
+			ExpectedOK: true,
+		},
+		{
+			Name: "expired",
+			Code: "005924",
+			Time: now.Add(2 * period * time.Second),
+		},
+		{
+			Name: "invalid code",
+			Code: "123456",
+			Time: now,
+		},
+		{
+			Name: "invalid length",
+			Code: "5924",
+			Time: now,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.Name, func(t *testing.T) {
+			assert := require.New(t)
+
+			step, ok := Validate(rfcSecret, tst.Code, tst.Time)
+			assert.Equal(tst.ExpectedOK, ok)
+			if ok {
+				assert.Equal(Step(now), step)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	assert := require.New(t)
+
+	secret, err := GenerateSecret()
+	assert.NoError(err)
+	assert.Len(secret, 32)
+
+	code, err := GenerateCode(secret, Step(time.Now()))
+	assert.NoError(err)
+
+	_, ok := Validate(secret, code, time.Now())
+	assert.True(ok)
+}
+
+func TestURL(t *testing.T) {
+	assert := require.New(t)
+
+	u, err := url.Parse(URL("ChirpStack", "admin@example.com", rfcSecret))
+	assert.NoError(err)
+	assert.Equal("otpauth", u.Scheme)
+	assert.Equal("totp", u.Host)
+	assert.Equal("/ChirpStack:admin@example.com", u.Path)
+	assert.Equal(rfcSecret, u.Query().Get("secret"))
+	assert.Equal("ChirpStack", u.Query().Get("issuer"))
+}
@@ -0,0 +1,25 @@
+-- +migrate Up
+alter table device_profile
+    add column multicast_setup_enabled boolean not null default true,
+    add column multicast_setup_f_port smallint not null default 200,
+    add column fragmentation_enabled boolean not null default true,
+    add column fragmentation_f_port smallint not null default 201,
+    add column clock_sync_enabled boolean not null default true,
+    add column clock_sync_f_port smallint not null default 202;
+
+alter table device_profile
+    alter column multicast_setup_enabled drop default,
+    alter column multicast_setup_f_port drop default,
+    alter column fragmentation_enabled drop default,
+    alter column fragmentation_f_port drop default,
+    alter column clock_sync_enabled drop default,
+    alter column clock_sync_f_port drop default;
+
+-- +migrate Down
+alter table device_profile
+    drop column multicast_setup_enabled,
+    drop column multicast_setup_f_port,
+    drop column fragmentation_enabled,
+    drop column fragmentation_f_port,
+    drop column clock_sync_enabled,
+    drop column clock_sync_f_port;
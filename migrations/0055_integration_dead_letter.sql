@@ -0,0 +1,22 @@
+-- +migrate Up
+create table integration_dead_letter (
+    id uuid primary key,
+    created_at timestamp with time zone not null,
+    updated_at timestamp with time zone not null,
+    application_id bigint not null references application on delete cascade,
+    dev_eui bytea not null,
+    integration varchar(50) not null,
+    event_type varchar(20) not null,
+    event bytea not null,
+    variables hstore,
+    attempts integer not null,
+    last_error text not null
+);
+
+create index idx_integration_dead_letter_application_id on integration_dead_letter(application_id);
+create index idx_integration_dead_letter_created_at on integration_dead_letter(created_at);
+
+-- +migrate Down
+drop index idx_integration_dead_letter_created_at;
+drop index idx_integration_dead_letter_application_id;
+drop table integration_dead_letter;
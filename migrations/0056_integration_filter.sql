@@ -0,0 +1,10 @@
+-- +migrate Up
+alter table integration
+    add column filter jsonb not null default '{}';
+
+alter table integration
+    alter column filter drop default;
+
+-- +migrate Down
+alter table integration
+    drop column filter;
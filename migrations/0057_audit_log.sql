@@ -0,0 +1,22 @@
+-- +migrate Up
+create table audit_log (
+    id bigserial primary key,
+    created_at timestamp with time zone not null,
+    organization_id bigint,
+    user_id bigint,
+    api_key_id uuid,
+    action varchar(20) not null,
+    resource varchar(50) not null,
+    resource_id varchar(100) not null,
+    changes jsonb not null default '{}'
+);
+
+create index idx_audit_log_organization_id on audit_log(organization_id);
+create index idx_audit_log_created_at on audit_log(created_at);
+create index idx_audit_log_resource on audit_log(resource, resource_id);
+
+-- +migrate Down
+drop index idx_audit_log_resource;
+drop index idx_audit_log_created_at;
+drop index idx_audit_log_organization_id;
+drop table audit_log;
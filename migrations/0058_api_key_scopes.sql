@@ -0,0 +1,13 @@
+-- +migrate Up
+alter table api_key
+    add column expires_at timestamp with time zone,
+    add column scopes varchar(50)[],
+    add column allowed_ips varchar(50)[],
+    add column last_used_at timestamp with time zone;
+
+-- +migrate Down
+alter table api_key
+    drop column last_used_at,
+    drop column allowed_ips,
+    drop column scopes,
+    drop column expires_at;
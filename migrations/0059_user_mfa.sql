@@ -0,0 +1,30 @@
+-- +migrate Up
+alter table "user"
+    add column totp_secret varchar(64),
+    add column totp_enabled boolean not null default false,
+    add column totp_last_step bigint not null default 0;
+
+create table user_recovery_code (
+    id bigserial primary key,
+    created_at timestamp with time zone not null,
+    user_id bigint not null references "user" on delete cascade,
+    code_hash bytea not null,
+    used_at timestamp with time zone
+);
+
+create index idx_user_recovery_code_user_id on user_recovery_code(user_id);
+
+alter table organization
+    add column require_mfa_for_admins boolean not null default false;
+
+-- +migrate Down
+alter table organization
+    drop column require_mfa_for_admins;
+
+drop index idx_user_recovery_code_user_id;
+drop table user_recovery_code;
+
+alter table "user"
+    drop column totp_last_step,
+    drop column totp_enabled,
+    drop column totp_secret;
@@ -0,0 +1,28 @@
+-- +migrate Up
+alter table gateway_profile
+    add column offline_threshold bigint not null default 0;
+
+alter table gateway
+    add column offline_threshold bigint not null default 0,
+    add column is_offline boolean not null default false;
+
+create table gateway_status_transition (
+    id bigserial primary key,
+    created_at timestamp with time zone not null,
+    gateway_id bytea not null references gateway on delete cascade,
+    online boolean not null,
+    last_seen_at timestamp with time zone
+);
+
+create index idx_gateway_status_transition_gateway_id_created_at on gateway_status_transition(gateway_id, created_at);
+
+-- +migrate Down
+drop index idx_gateway_status_transition_gateway_id_created_at;
+drop table gateway_status_transition;
+
+alter table gateway
+    drop column is_offline,
+    drop column offline_threshold;
+
+alter table gateway_profile
+    drop column offline_threshold;
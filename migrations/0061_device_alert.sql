@@ -0,0 +1,31 @@
+-- +migrate Up
+create table device_alert_rule (
+    id uuid primary key,
+    created_at timestamp with time zone not null,
+    updated_at timestamp with time zone not null,
+    application_id bigint not null references application on delete cascade,
+    name varchar(100) not null,
+    type varchar(20) not null,
+    inactivity_threshold bigint not null default 0,
+    battery_level_threshold real not null default 0,
+    margin_threshold integer not null default 0
+);
+
+create index idx_device_alert_rule_application_id on device_alert_rule(application_id);
+
+create table device_alert (
+    device_alert_rule_id uuid not null references device_alert_rule on delete cascade,
+    dev_eui bytea not null references device on delete cascade,
+    created_at timestamp with time zone not null,
+
+    primary key(device_alert_rule_id, dev_eui)
+);
+
+create index idx_device_alert_dev_eui on device_alert(dev_eui);
+
+-- +migrate Down
+drop index idx_device_alert_dev_eui;
+drop table device_alert;
+
+drop index idx_device_alert_rule_application_id;
+drop table device_alert_rule;
@@ -0,0 +1,35 @@
+-- +migrate Up
+create table firmware_image (
+	id uuid primary key,
+	created_at timestamp with time zone not null,
+	updated_at timestamp with time zone not null,
+	device_profile_id uuid not null references device_profile on delete cascade,
+	version varchar(100) not null,
+	checksum bytea not null,
+	release_notes text not null,
+	payload bytea not null,
+
+	constraint firmware_image_device_profile_id_version unique (device_profile_id, version)
+);
+
+create index idx_firmware_image_device_profile_id on firmware_image(device_profile_id);
+
+alter table fuota_deployment
+	add column firmware_image_id uuid references firmware_image on delete restrict;
+
+create index idx_fuota_deployment_firmware_image_id on fuota_deployment(firmware_image_id);
+
+alter table device
+	add column firmware_version varchar(100) not null default '';
+
+-- +migrate Down
+alter table device
+	drop column firmware_version;
+
+drop index idx_fuota_deployment_firmware_image_id;
+
+alter table fuota_deployment
+	drop column firmware_image_id;
+
+drop index idx_firmware_image_device_profile_id;
+drop table firmware_image;
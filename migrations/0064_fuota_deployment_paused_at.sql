@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table fuota_deployment
+	add column paused_at timestamp with time zone;
+
+-- +migrate Down
+alter table fuota_deployment
+	drop column paused_at;
@@ -0,0 +1,21 @@
+-- +migrate Up
+alter table fuota_deployment
+	add column unicast_retransmissions smallint not null default 0,
+	add column unicast_retransmission_count smallint not null default 0;
+
+alter table fuota_deployment
+	alter column unicast_retransmissions drop default,
+	alter column unicast_retransmission_count drop default;
+
+alter table fuota_deployment_device
+	add column missing_frag integer not null default 0,
+	add column retransmitted_frag integer not null default 0;
+
+-- +migrate Down
+alter table fuota_deployment_device
+	drop column retransmitted_frag,
+	drop column missing_frag;
+
+alter table fuota_deployment
+	drop column unicast_retransmission_count,
+	drop column unicast_retransmissions;
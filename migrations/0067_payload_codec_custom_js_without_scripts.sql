@@ -0,0 +1,22 @@
+-- +migrate Up
+-- the custom JavaScript codec requires a decoder and / or encoder script,
+-- without scripts the codec has no effect
+update application
+set
+    payload_codec = ''
+where
+    payload_codec = 'CUSTOM_JS'
+    and payload_encoder_script = ''
+    and payload_decoder_script = '';
+
+update device_profile
+set
+    payload_codec = ''
+where
+    payload_codec = 'CUSTOM_JS'
+    and payload_encoder_script = ''
+    and payload_decoder_script = '';
+
+-- +migrate Down
+-- the codec type of the updated rows can not be restored, as without
+-- scripts the codec had no effect this is not needed
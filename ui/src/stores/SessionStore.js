@@ -109,9 +109,28 @@ class SessionStore extends EventEmitter {
     }
   }
 
-  login(login, callBackFunc) {
+  // login calls mfaCallbackFunc with the login response when a second
+  // factor is required, else it stores the token and calls callBackFunc.
+  login(login, callBackFunc, mfaCallbackFunc) {
     this.swagger.then(client => {
       client.apis.InternalService.Login({body: login})
+        .then(checkStatus)
+        .then(resp => {
+          if (resp.obj.mfaChallengeToken) {
+            mfaCallbackFunc(resp.obj);
+            return;
+          }
+
+          this.setToken(resp.obj.jwt);
+          this.fetchProfile(callBackFunc);
+        })
+        .catch(errorHandlerLogin);
+    });
+  }
+
+  loginMFA(req, callBackFunc) {
+    this.swagger.then(client => {
+      client.apis.InternalService.LoginMFA({body: req})
         .then(checkStatus)
         .then(resp => {
           this.setToken(resp.obj.jwt);
@@ -121,6 +140,42 @@ class SessionStore extends EventEmitter {
     });
   }
 
+  enrollTOTP(mfaChallengeToken, callbackFunc) {
+    this.swagger.then(client => {
+      client.apis.InternalService.EnrollTOTP({
+        body: {
+          mfaChallengeToken: mfaChallengeToken,
+        },
+      })
+        .then(checkStatus)
+        .then(resp => {
+          callbackFunc(resp.obj);
+        })
+        .catch(errorHandlerLogin);
+    });
+  }
+
+  // confirmTOTP stores the token returned on enrollment during login and
+  // calls callbackFunc with the response containing the recovery codes.
+  confirmTOTP(mfaChallengeToken, code, callbackFunc) {
+    this.swagger.then(client => {
+      client.apis.InternalService.ConfirmTOTP({
+        body: {
+          mfaChallengeToken: mfaChallengeToken,
+          code: code,
+        },
+      })
+        .then(checkStatus)
+        .then(resp => {
+          if (resp.obj.jwt) {
+            this.setToken(resp.obj.jwt);
+          }
+          callbackFunc(resp.obj);
+        })
+        .catch(errorHandlerLogin);
+    });
+  }
+
   openidConnectLogin(code, state, callbackFunc) {
     this.swagger.then(client => {
       client.apis.InternalService.OpenIDConnectLogin({
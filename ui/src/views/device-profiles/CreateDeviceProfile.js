@@ -32,6 +32,14 @@ class CreateDeviceProfile extends Component {
     super();
     this.state = {
       spDialog: false,
+      object: {
+        multicastSetupEnabled: true,
+        multicastSetupFPort: 200,
+        fragmentationEnabled: true,
+        fragmentationFPort: 201,
+        clockSyncEnabled: true,
+        clockSyncFPort: 202,
+      },
     };
     this.onSubmit = this.onSubmit.bind(this);
     this.closeDialog = this.closeDialog.bind(this);
@@ -96,6 +104,7 @@ class CreateDeviceProfile extends Component {
             <CardContent>
               <DeviceProfileForm
                 submitLabel="Create device-profile"
+                object={this.state.object}
                 onSubmit={this.onSubmit}
                 match={this.props.match}
               />
@@ -213,6 +213,7 @@ function Decode(fPort, bytes, variables) {
           <Tab label="Class-B" />
           <Tab label="Class-C" />
           <Tab label="Codec" />
+          <Tab label="Application layer" />
           <Tab label="Tags" />
         </Tabs>
 
@@ -481,6 +482,83 @@ function Decode(fPort, bytes, variables) {
         </div>}
 
         {this.state.tab === 5 && <div>
+          <FormControl fullWidth margin="normal">
+            <FormControlLabel
+              label="Remote multicast setup"
+              control={
+                <Checkbox
+                  id="multicastSetupEnabled"
+                  checked={!!this.state.object.multicastSetupEnabled}
+                  onChange={this.onChange}
+                  color="primary"
+                />
+              }
+            />
+            <FormHelperText>Select this option when the device implements the LoRaWAN Remote Multicast Setup package. This package is required for firmware updates over the air.</FormHelperText>
+          </FormControl>
+          {this.state.object.multicastSetupEnabled && <TextField
+            id="multicastSetupFPort"
+            label="Remote multicast setup fPort"
+            type="number"
+            margin="normal"
+            value={this.state.object.multicastSetupFPort || 0}
+            onChange={this.onChange}
+            required
+            fullWidth
+          />}
+
+          <FormControl fullWidth margin="normal">
+            <FormControlLabel
+              label="Fragmented data block transport"
+              control={
+                <Checkbox
+                  id="fragmentationEnabled"
+                  checked={!!this.state.object.fragmentationEnabled}
+                  onChange={this.onChange}
+                  color="primary"
+                />
+              }
+            />
+            <FormHelperText>Select this option when the device implements the LoRaWAN Fragmented Data Block Transport package. This package is required for firmware updates over the air.</FormHelperText>
+          </FormControl>
+          {this.state.object.fragmentationEnabled && <TextField
+            id="fragmentationFPort"
+            label="Fragmented data block transport fPort"
+            type="number"
+            margin="normal"
+            value={this.state.object.fragmentationFPort || 0}
+            onChange={this.onChange}
+            required
+            fullWidth
+          />}
+
+          <FormControl fullWidth margin="normal">
+            <FormControlLabel
+              label="Application layer clock synchronization"
+              control={
+                <Checkbox
+                  id="clockSyncEnabled"
+                  checked={!!this.state.object.clockSyncEnabled}
+                  onChange={this.onChange}
+                  color="primary"
+                />
+              }
+            />
+            <FormHelperText>Select this option when the device implements the LoRaWAN Application Layer Clock Synchronization package.</FormHelperText>
+          </FormControl>
+          {this.state.object.clockSyncEnabled && <TextField
+            id="clockSyncFPort"
+            label="Application layer clock synchronization fPort"
+            type="number"
+            margin="normal"
+            value={this.state.object.clockSyncFPort || 0}
+            onChange={this.onChange}
+            required
+            fullWidth
+          />}
+        </div>}
+
+        {this.state.tab === 6 && <div>
           <FormControl fullWidth margin="normal">
             <Typography variant="body1">
               Tags can be used to store additional key/value data.
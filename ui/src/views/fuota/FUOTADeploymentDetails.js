@@ -74,6 +74,7 @@ class FUOTADeploymentDetails extends Component {
       case "FRAG_SESS_SETUP":
         state = 2;
         break;
+      case "MC_SESS_B_SETUP":
       case "MC_SESS_C_SETUP":
         state = 3;
         break;
@@ -84,6 +85,7 @@ class FUOTADeploymentDetails extends Component {
         state = 5;
         break;
       case "SET_DEVICE_STATUS":
+      case "UNICAST_RETRANSMIT":
         state = 6;
         break;
       case "CLEANUP":
@@ -105,6 +107,9 @@ class FUOTADeploymentDetails extends Component {
 
   render() {
     let multicastTimeout = 0;
+    if (this.props.fuotaDeployment.fuotaDeployment.groupType === "CLASS_B") {
+      multicastTimeout = 128 * (1 << this.props.fuotaDeployment.fuotaDeployment.multicastTimeout);
+    }
     if (this.props.fuotaDeployment.fuotaDeployment.groupType === "CLASS_C") {
       multicastTimeout = (1 << this.props.fuotaDeployment.fuotaDeployment.multicastTimeout);
     }
@@ -25,24 +25,48 @@ class FUOTADeploymentForm extends FormComponent {
     this.state.file = null;
 
     this.onFileChange = this.onFileChange.bind(this);
+    this.getMulticastTimeoutOptions = this.getMulticastTimeoutOptions.bind(this);
   }
 
   getGroupTypeOptions(search, callbackFunc) {
     const options = [
+      {value: "CLASS_B", label: "Class-B"},
       {value: "CLASS_C", label: "Class-C"},
     ];
 
     callbackFunc(options);
   }
 
+  getPingSlotPeriodOptions(search, callbackFunc) {
+    const pingSlotPeriodOptions = [
+      {value: 32 * 1, label: "every second"},
+      {value: 32 * 2, label: "every 2 seconds"},
+      {value: 32 * 4, label: "every 4 seconds"},
+      {value: 32 * 8, label: "every 8 seconds"},
+      {value: 32 * 16, label: "every 16 seconds"},
+      {value: 32 * 32, label: "every 32 seconds"},
+      {value: 32 * 64, label: "every 64 seconds"},
+      {value: 32 * 128, label: "every 128 seconds"},
+    ];
+
+    callbackFunc(pingSlotPeriodOptions);
+  }
+
   getMulticastTimeoutOptions(search, callbackFunc) {
     let options = [];
 
     for (let i = 0; i < (1 << 4); i++) {
-      options.push({
-        label: `${1 << i} seconds`,
-        value: i,
-      });
+      if (this.state.object.groupType === "CLASS_B") {
+        options.push({
+          label: `${1 << i} beacon periods (${128 * (1 << i)} seconds)`,
+          value: i,
+        });
+      } else {
+        options.push({
+          label: `${1 << i} seconds`,
+          value: i,
+        });
+      }
     }
 
     callbackFunc(options);
@@ -173,6 +197,20 @@ class FUOTADeploymentForm extends FormComponent {
           </FormHelperText>
         </FormControl>
 
+        {this.state.object.groupType === "CLASS_B" && <FormControl fullWidth margin="normal">
+          <FormLabel className={this.props.classes.formLabel} required>Class-B ping-slot periodicity</FormLabel>
+          <AutocompleteSelect
+            id="pingSlotPeriod"
+            label="Select Class-B ping-slot periodicity"
+            value={this.state.object.pingSlotPeriod || ""}
+            onChange={this.onChange}
+            getOptions={this.getPingSlotPeriodOptions}
+          />
+          <FormHelperText>
+            The ping-slot periodicity used by the device(s) to receive the multicast frames.
+          </FormHelperText>
+        </FormControl>}
+
         <FormControl fullWidth margin="normal">
           <FormLabel className={this.props.classes.formLabel} required>Multicast timeout</FormLabel>
           <AutocompleteSelect
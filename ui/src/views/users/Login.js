@@ -67,6 +67,92 @@ class LoginForm extends FormComponent {
   }
 }
 
+class MFALoginForm extends FormComponent {
+  render() {
+    if (this.state.object === undefined) {
+      return null;
+    }
+
+    return(
+      <Form
+        submitLabel={this.props.submitLabel}
+        onSubmit={this.onSubmit}
+      >
+        <TextField
+          id="code"
+          label="Authentication code"
+          helperText="The code generated by your authenticator app."
+          margin="normal"
+          value={this.state.object.code || ""}
+          onChange={this.onChange}
+          autoComplete="one-time-code"
+          fullWidth
+        />
+        <TextField
+          id="recoveryCode"
+          label="Recovery code"
+          helperText="Use one of your recovery codes when you don't have access to your authenticator app."
+          margin="normal"
+          value={this.state.object.recoveryCode || ""}
+          onChange={this.onChange}
+          fullWidth
+        />
+      </Form>
+    );
+  }
+}
+
+class MFAEnrollForm extends FormComponent {
+  render() {
+    if (this.state.object === undefined) {
+      return null;
+    }
+
+    return(
+      <Form
+        submitLabel={this.props.submitLabel}
+        onSubmit={this.onSubmit}
+      >
+        <Typography variant="body1" paragraph>
+          Two-factor authentication is required for your account. Add the following secret to your authenticator app and enter the generated code to confirm.
+        </Typography>
+        <Typography variant="body1" paragraph>
+          Secret: <code>{this.props.enrollment.secret}</code>
+        </Typography>
+        <Typography variant="body1" paragraph className={this.props.classes.link}>
+          <a href={this.props.enrollment.url}>Open in authenticator app</a>
+        </Typography>
+        <TextField
+          id="code"
+          label="Authentication code"
+          margin="normal"
+          value={this.state.object.code || ""}
+          onChange={this.onChange}
+          autoComplete="one-time-code"
+          fullWidth
+          required
+        />
+      </Form>
+    );
+  }
+}
+
+class RecoveryCodes extends Component {
+  render() {
+    return(
+      <div>
+        <Typography variant="body1" paragraph>
+          Store the following recovery codes in a safe place. Each code can be used once to login when you don't have access to your authenticator app. These codes are shown only once.
+        </Typography>
+        {this.props.recoveryCodes.map(code => <Typography key={code} variant="body1"><code>{code}</code></Typography>)}
+        <Grid container justify="flex-end">
+          <Button color="primary" onClick={this.props.onContinue}>Continue</Button>
+        </Grid>
+      </div>
+    );
+  }
+}
+
 class OpenIDConnectLogin extends Component {
   render() {
     return(
@@ -88,9 +174,16 @@ class Login extends Component {
       oidcEnabled: false,
       oidcLoginlabel: "",
       oidcLoginUrl: "",
+      mfaChallengeToken: "",
+      mfaEnrollmentRequired: false,
+      mfaEnrollment: null,
+      recoveryCodes: null,
     };
 
     this.onSubmit = this.onSubmit.bind(this);
+    this.onMFASubmit = this.onMFASubmit.bind(this);
+    this.onEnrollSubmit = this.onEnrollSubmit.bind(this);
+    this.onContinue = this.onContinue.bind(this);
   }
 
   componentDidMount() {
@@ -119,9 +212,73 @@ class Login extends Component {
   onSubmit(login) {
     SessionStore.login(login, () => {
       this.props.history.push("/");
+    }, resp => {
+      this.setState({
+        mfaChallengeToken: resp.mfaChallengeToken,
+        mfaEnrollmentRequired: resp.mfaEnrollmentRequired === true,
+      });
+
+      if (resp.mfaEnrollmentRequired) {
+        SessionStore.enrollTOTP(resp.mfaChallengeToken, enrollment => {
+          this.setState({
+            mfaEnrollment: enrollment,
+          });
+        });
+      }
     });
   }
 
+  onMFASubmit(mfa) {
+    SessionStore.loginMFA({
+      mfaChallengeToken: this.state.mfaChallengeToken,
+      code: mfa.code,
+      recoveryCode: mfa.recoveryCode,
+    }, () => {
+      this.props.history.push("/");
+    });
+  }
+
+  onEnrollSubmit(enroll) {
+    SessionStore.confirmTOTP(this.state.mfaChallengeToken, enroll.code, resp => {
+      this.setState({
+        recoveryCodes: resp.recoveryCodes,
+      });
+    });
+  }
+
+  onContinue() {
+    SessionStore.fetchProfile(() => {
+      this.props.history.push("/");
+    });
+  }
+
+  renderMFA() {
+    if (this.state.recoveryCodes !== null) {
+      return <RecoveryCodes
+        recoveryCodes={this.state.recoveryCodes}
+        onContinue={this.onContinue}
+      />;
+    }
+
+    if (this.state.mfaEnrollmentRequired) {
+      if (this.state.mfaEnrollment === null) {
+        return null;
+      }
+
+      return <MFAEnrollForm
+        submitLabel="Confirm"
+        classes={this.props.classes}
+        enrollment={this.state.mfaEnrollment}
+        onSubmit={this.onEnrollSubmit}
+      />;
+    }
+
+    return <MFALoginForm
+      submitLabel="Verify"
+      onSubmit={this.onMFASubmit}
+    />;
+  }
+
   render() {
     if (!this.state.loaded) {
       return null;
@@ -132,9 +289,12 @@ class Login extends Component {
         <Grid item xs={6} lg={4}>
           <Card>
             <CardHeader
-              title="ChirpStack Login"
+              title={this.state.mfaChallengeToken === "" ? "ChirpStack Login" : "Two-factor authentication"}
             />
-            <CardContent>
+            {this.state.mfaChallengeToken !== "" && <CardContent>
+              {this.renderMFA()}
+            </CardContent>}
+            {this.state.mfaChallengeToken === "" && <CardContent>
               {!this.state.oidcEnabled && <LoginForm
                 submitLabel="Login"
                 onSubmit={this.onSubmit}
@@ -144,7 +304,7 @@ class Login extends Component {
                 loginUrl={this.state.oidcLoginUrl}
                 loginLabel={this.state.oidcLoginLabel}
               />}
-            </CardContent>
+            </CardContent>}
             {this.state.registration !== "" && <CardContent>
               <Typography className={this.props.classes.link} dangerouslySetInnerHTML={{__html: this.state.registration}}></Typography>
              </CardContent>}